@@ -11,6 +11,7 @@ replace github.com/refaktor/ryegen => ../ryegen
 require (
 	gioui.org v0.7.1
 	github.com/go-text/typesetting v0.1.1
+	github.com/iancoleman/strcase v0.3.0
 	github.com/refaktor/rye v0.0.25-0.20241008135859-3e401118b002
 	github.com/refaktor/ryegen v0.1.1-0.20241009014844-8c047bebf475
 	golang.org/x/image v0.18.0
@@ -73,7 +74,6 @@ require (
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/gorilla/sessions v1.4.0 // indirect
-	github.com/iancoleman/strcase v0.3.0 // indirect
 	github.com/itchyny/gojq v0.12.16 // indirect
 	github.com/itchyny/timefmt-go v0.1.6 // indirect
 	github.com/jinzhu/copier v0.4.0 // indirect
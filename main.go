@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	/*RYEGEN: BEGIN IMPORTS*/
 	"rye-gio/ryegen_bindings/gioui_org"
 	/*RYEGEN: END IMPORTS*/
@@ -15,5 +17,12 @@ func main() {
 		/*RYEGEN: BEGIN BUILTINS*/
 		evaldo.RegisterBuiltinsInContext(gioui_org.Builtins, ps, "gio")
 		/*RYEGEN: END BUILTINS*/
+
+		// Group the generated builtins by Gio package (gio/layout/flex),
+		// unless RYE_GIO_FLAT asks for the single flat context of earlier
+		// versions (do\par gio { layout-flex ... }).
+		if os.Getenv("RYE_GIO_FLAT") == "" {
+			gioui_org.RegisterContexts(ps, "gio")
+		}
 	})
 }
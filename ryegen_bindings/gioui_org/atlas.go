@@ -0,0 +1,221 @@
+// Sprite sheets and texture atlases.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Atlas is one image holding named sprites. All sprites share the image
+// op; drawing clips to the sprite's rectangle.
+type Atlas struct {
+	img    paint.ImageOp
+	frames map[string]image.Rectangle
+}
+
+type atlasRect struct {
+	X, Y, W, H int
+}
+
+type atlasFrame struct {
+	Filename string    `json:"filename"`
+	Frame    atlasRect `json:"frame"`
+}
+
+// loadAtlas reads a TexturePacker style JSON file, in either its hash or
+// array form. The image is taken from meta.image, relative to the JSON file,
+// or else the file with the same name and a .png extension.
+func loadAtlas(path string) (*Atlas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Frames json.RawMessage `json:"frames"`
+		Meta   struct {
+			Image string `json:"image"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	frames := map[string]image.Rectangle{}
+	var list []atlasFrame
+	var hash map[string]atlasFrame
+	switch {
+	case json.Unmarshal(doc.Frames, &list) == nil:
+	case json.Unmarshal(doc.Frames, &hash) == nil:
+		for name, f := range hash {
+			f.Filename = name
+			list = append(list, f)
+		}
+	default:
+		return nil, errors.New(path + ": frames must be an object or an array")
+	}
+	for _, f := range list {
+		r := f.Frame
+		frames[f.Filename] = image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H)
+	}
+	imgPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".png"
+	if doc.Meta.Image != "" {
+		imgPath = filepath.Join(filepath.Dir(path), doc.Meta.Image)
+	}
+	img, err := cachedImage(imgPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Atlas{img: img, frames: frames}, nil
+}
+
+// gridAtlas cuts an image into cells of w×h named by their index, row by
+// row.
+func gridAtlas(img paint.ImageOp, w, h int) *Atlas {
+	a := &Atlas{img: img, frames: map[string]image.Rectangle{}}
+	size := img.Size()
+	i := 0
+	for y := 0; y+h <= size.Y; y += h {
+		for x := 0; x+w <= size.X; x += w {
+			a.frames[strconv.Itoa(i)] = image.Rect(x, y, x+w, y+h)
+			i++
+		}
+	}
+	return a
+}
+
+// spriteArg accepts a sprite name as a word, string or index.
+func spriteArg(ps *env.ProgramState, name string, n int, a *Atlas, arg env.Object) (image.Rectangle, *env.Error) {
+	var s string
+	if i, ok := arg.(env.Integer); ok {
+		s = strconv.FormatInt(i.Value, 10)
+	} else {
+		var err *env.Error
+		if s, err = nameArg(ps, name, n, arg); err != nil {
+			return image.Rectangle{}, err
+		}
+	}
+	r, ok := a.frames[s]
+	if !ok {
+		return image.Rectangle{}, failure(ps, name, "no sprite named "+s)
+	}
+	return r, nil
+}
+
+var builtinsAtlas = map[string]*env.Builtin{
+	"load-atlas": {
+		Doc:   "Load a texture atlas from a TexturePacker JSON file and its image",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "load-atlas", 1, arg0)
+			if err != nil {
+				return err
+			}
+			a, aerr := loadAtlas(path)
+			if aerr != nil {
+				return failure(ps, "load-atlas", aerr.Error())
+			}
+			return *env.NewNative(ps.Idx, a, "Go(*gioui_org.Atlas)")
+		},
+	},
+	"sprite-sheet": {
+		Doc:   "Cut an image into a grid of w h sized sprites named by their index",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := imageArg(ps, "sprite-sheet", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := integerArg(ps, "sprite-sheet", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h, err := integerArg(ps, "sprite-sheet", 3, arg2)
+			if err != nil {
+				return err
+			}
+			if w <= 0 || h <= 0 {
+				return failure(ps, "sprite-sheet", "expected a positive cell size")
+			}
+			return *env.NewNative(ps.Idx, gridAtlas(img, int(w), int(h)), "Go(*gioui_org.Atlas)")
+		},
+	},
+	"Go(*gioui_org.Atlas)//sprites?": {
+		Doc:   "Get the number of sprites",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			a, err := nativeArg[*Atlas](ps, "Go(*gioui_org.Atlas)//sprites?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(int64(len(a.frames)))
+		},
+	},
+	"draw-sprite": {
+		Doc:   "Queue the named sprite of an atlas into a sprite batch at x y",
+		Argsn: 5,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*SpriteBatch](ps, "draw-sprite", 1, arg0)
+			if err != nil {
+				return err
+			}
+			a, err := nativeArg[*Atlas](ps, "draw-sprite", 2, arg1)
+			if err != nil {
+				return err
+			}
+			src, err := spriteArg(ps, "draw-sprite", 3, a, arg2)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "draw-sprite", 4, arg3, arg4)
+			if err != nil {
+				return err
+			}
+			b.Add(a.img, src, f32.Pt(x, y), 1, 0)
+			return arg0
+		},
+	},
+	"draw-sprite\\ex": {
+		Doc:   "Queue the named sprite of an atlas into a sprite batch with a block of x y scale rotation (in radians)",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*SpriteBatch](ps, "draw-sprite\\ex", 1, arg0)
+			if err != nil {
+				return err
+			}
+			a, err := nativeArg[*Atlas](ps, "draw-sprite\\ex", 2, arg1)
+			if err != nil {
+				return err
+			}
+			src, err := spriteArg(ps, "draw-sprite\\ex", 3, a, arg2)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg3.(env.Block)
+			if !ok || len(blk.Series.S) != 4 {
+				return argError(ps, "draw-sprite\\ex", 4, "block of x y scale rotation", arg3)
+			}
+			var v [4]float32
+			for i, o := range blk.Series.S {
+				d, err := decimalArg(ps, "draw-sprite\\ex", 4, o)
+				if err != nil {
+					return err
+				}
+				v[i] = float32(d)
+			}
+			b.Add(a.img, src, f32.Pt(v[0], v[1]), v[2], v[3])
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,555 @@
+// Waveforms and spectrograms of audio samples.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// spectrogramFloor is the level, in decibels, drawn darkest.
+const spectrogramFloor = -90
+
+// readWAV reads the samples of a PCM WAV file of 8, 16, 24 or 32 bit
+// integers or 32 bit floats, mixing its channels, and its sample rate.
+func readWAV(path string) ([]float32, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, errors.New(path + ": not a WAV file")
+	}
+	var format, channels, bits uint16
+	var rate uint32
+	for at := 12; at+8 <= len(data); {
+		id, size := string(data[at:at+4]), int(binary.LittleEndian.Uint32(data[at+4:]))
+		body := data[at+8 : min(at+8+size, len(data))]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, 0, io.ErrUnexpectedEOF
+			}
+			format = binary.LittleEndian.Uint16(body)
+			channels = binary.LittleEndian.Uint16(body[2:])
+			rate = binary.LittleEndian.Uint32(body[4:])
+			bits = binary.LittleEndian.Uint16(body[14:])
+			// The extensible format gives the real one in its subformat.
+			if format == 0xfffe && len(body) >= 26 {
+				format = binary.LittleEndian.Uint16(body[24:])
+			}
+		case "data":
+			if channels == 0 {
+				return nil, 0, errors.New(path + ": no format before the samples")
+			}
+			width := int(bits) / 8
+			float := format == 3 && bits == 32
+			if !float && (format != 1 || width < 1 || width > 4) {
+				return nil, 0, errors.New(path + ": not PCM samples")
+			}
+			frame := width * int(channels)
+			samples := make([]float32, len(body)/frame)
+			for i := range samples {
+				var sum float32
+				for c := range int(channels) {
+					b := body[i*frame+c*width:]
+					switch {
+					case float:
+						sum += math.Float32frombits(binary.LittleEndian.Uint32(b))
+					case width == 1:
+						sum += float32(int(b[0])-128) / 128
+					default:
+						// Sign-extend from the top byte.
+						v := int32(int8(b[width-1]))
+						for k := width - 2; k >= 0; k-- {
+							v = v<<8 | int32(b[k])
+						}
+						sum += float32(v) / float32(int64(1)<<(8*width-1))
+					}
+				}
+				samples[i] = sum / float32(channels)
+			}
+			return samples, int(rate), nil
+		}
+		at += 8 + size + size&1
+	}
+	return nil, 0, errors.New(path + ": no samples")
+}
+
+// audioTrack is what waveforms and spectrograms share: the samples, the
+// playhead and the selection made by clicking and dragging across them.
+type audioTrack struct {
+	ps       *env.ProgramState
+	Theme    *material.Theme
+	samples  []float32 // mono, from -1 to 1
+	rate     int
+	playhead float64 // seconds, or -1 for none
+	sel      [2]float64
+	onSeek   *env.Function
+	onSelect *env.Function
+	pressed  bool
+	dragging bool
+	pressX   float32
+}
+
+func (t *audioTrack) track() *audioTrack { return t }
+
+func (t *audioTrack) Duration() float64 {
+	if t.rate <= 0 {
+		return 0
+	}
+	return float64(len(t.samples)) / float64(t.rate)
+}
+
+// Selection returns the start and end of the selection in seconds, equal
+// when there is none.
+func (t *audioTrack) Selection() (float64, float64) { return t.sel[0], t.sel[1] }
+
+func (t *audioTrack) SetSelection(start, end float64) {
+	d := t.Duration()
+	start, end = max(0, min(start, d)), max(0, min(end, d))
+	t.sel = [2]float64{min(start, end), max(start, end)}
+}
+
+func (t *audioTrack) timeAt(x float32, width int) float64 {
+	if width <= 0 {
+		return 0
+	}
+	return max(0, min(float64(x)/float64(width), 1)) * t.Duration()
+}
+
+// update seeks where the track is clicked and selects where it is dragged
+// across.
+func (t *audioTrack) update(gtx layout.Context, tag event.Tag, width int) {
+	for {
+		ev, ok := gtx.Event(pointer.Filter{Target: tag, Kinds: pointer.Press | pointer.Drag | pointer.Release | pointer.Cancel})
+		if !ok {
+			break
+		}
+		e, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		x := e.Position.X
+		switch e.Kind {
+		case pointer.Press:
+			t.pressed, t.dragging, t.pressX = true, false, x
+		case pointer.Drag:
+			if !t.pressed {
+				break
+			}
+			if !t.dragging && math.Abs(float64(x-t.pressX)) < float64(gtx.Dp(4)) {
+				break
+			}
+			t.dragging = true
+			gtx.Execute(pointer.GrabCmd{Tag: tag, ID: e.PointerID})
+			t.SetSelection(t.timeAt(t.pressX, width), t.timeAt(x, width))
+		case pointer.Release:
+			if !t.pressed {
+				break
+			}
+			t.pressed = false
+			if t.dragging {
+				if t.onSelect != nil {
+					callFunction(t.ps, "audio on-select", *t.onSelect, *env.NewDecimal(t.sel[0]), *env.NewDecimal(t.sel[1]))
+				}
+				break
+			}
+			t.playhead = t.timeAt(x, width)
+			t.sel = [2]float64{}
+			if t.onSeek != nil {
+				callFunction(t.ps, "audio on-seek", *t.onSeek, *env.NewDecimal(t.playhead))
+			}
+		case pointer.Cancel:
+			t.pressed, t.dragging = false, false
+		}
+	}
+}
+
+// layoutMarks draws the selection and the playhead over the track.
+func (t *audioTrack) layoutMarks(gtx layout.Context, size image.Point) {
+	d := t.Duration()
+	if d <= 0 {
+		return
+	}
+	x := func(s float64) int { return int(s / d * float64(size.X)) }
+	if t.sel[1] > t.sel[0] {
+		r := image.Rect(x(t.sel[0]), 0, max(x(t.sel[1]), x(t.sel[0])+1), size.Y)
+		paint.FillShape(gtx.Ops, mulAlpha(t.Theme.ContrastBg, 0x40), clip.Rect(r).Op())
+	}
+	if t.playhead >= 0 {
+		px := min(x(t.playhead), size.X-gtx.Dp(2))
+		paint.FillShape(gtx.Ops, t.Theme.ContrastBg, clip.Rect{Min: image.Pt(px, 0), Max: image.Pt(px+gtx.Dp(2), size.Y)}.Op())
+	}
+}
+
+// audioView is a widget showing an audio track.
+type audioView interface {
+	Layout(gtx layout.Context) layout.Dimensions
+	track() *audioTrack
+	SetSamples(samples []float32, rate int)
+}
+
+// Waveform shows the samples of a track as the range of the samples each
+// column covers, with the playhead and the selection over them.
+type Waveform struct {
+	audioTrack
+	Color color.NRGBA // of the samples, the theme's foreground if unset
+	peaks [][2]float32
+}
+
+func (w *Waveform) SetSamples(samples []float32, rate int) {
+	w.samples, w.rate, w.peaks = samples, rate, nil
+	w.playhead = min(w.playhead, w.Duration())
+	w.SetSelection(w.sel[0], w.sel[1])
+}
+
+// columnPeaks returns the lowest and highest sample of each of width
+// columns.
+func (w *Waveform) columnPeaks(width int) [][2]float32 {
+	if len(w.peaks) == width {
+		return w.peaks
+	}
+	w.peaks = make([][2]float32, width)
+	n := len(w.samples)
+	parallel(width, func(lo, hi int) {
+		for c := lo; c < hi; c++ {
+			a, b := c*n/width, max((c+1)*n/width, c*n/width+1)
+			p := [2]float32{1, -1}
+			for _, s := range w.samples[min(a, n):min(b, n)] {
+				p[0], p[1] = min(p[0], s), max(p[1], s)
+			}
+			if p[0] > p[1] {
+				p = [2]float32{}
+			}
+			w.peaks[c] = p
+		}
+	})
+	return w.peaks
+}
+
+func (w *Waveform) Layout(gtx layout.Context) layout.Dimensions {
+	size := gtx.Constraints.Max
+	w.update(gtx, w, size.X)
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, w)
+	pointer.CursorText.Add(gtx.Ops)
+
+	mid := float32(size.Y) / 2
+	paint.FillShape(gtx.Ops, mulAlpha(w.Theme.Fg, 0x30), clip.Rect{Min: image.Pt(0, int(mid)), Max: image.Pt(size.X, int(mid)+1)}.Op())
+	if len(w.samples) > 0 && size.X > 0 {
+		// The top of the peaks left to right, then their bottom back.
+		peaks := w.columnPeaks(size.X)
+		var p clip.Path
+		p.Begin(gtx.Ops)
+		for c, pk := range peaks {
+			pt := f32.Pt(float32(c), mid-pk[1]*mid)
+			if c == 0 {
+				p.MoveTo(pt)
+			} else {
+				p.LineTo(pt)
+			}
+			p.LineTo(f32.Pt(float32(c+1), pt.Y))
+		}
+		for c := len(peaks) - 1; c >= 0; c-- {
+			// At least a pixel high, for silence.
+			y := max(mid-peaks[c][0]*mid, mid-peaks[c][1]*mid+1)
+			p.LineTo(f32.Pt(float32(c+1), y))
+			p.LineTo(f32.Pt(float32(c), y))
+		}
+		p.Close()
+		col := w.Color
+		if col == (color.NRGBA{}) {
+			col = w.Theme.Fg
+		}
+		paint.FillShape(gtx.Ops, col, clip.Outline{Path: p.End()}.Op())
+	}
+	w.layoutMarks(gtx, size)
+	return layout.Dimensions{Size: size}
+}
+
+// Spectrogram shows the frequencies of a track over time, computed by the
+// FFT kernel of gio/compute, low frequencies at the bottom and louder ones
+// brighter, with the playhead and the selection over them.
+type Spectrogram struct {
+	audioTrack
+	Size  int // samples a frame, a power of two
+	frame int // samples between frames
+	img   paint.ImageOp
+	ready bool
+}
+
+func (s *Spectrogram) SetSamples(samples []float32, rate int) {
+	s.samples, s.rate = samples, rate
+	s.playhead = min(s.playhead, s.Duration())
+	s.SetSelection(s.sel[0], s.sel[1])
+	s.ready = false
+}
+
+// spectrogramColor maps a level from 0 to 1 to black through purple and
+// orange to light yellow.
+func spectrogramColor(v float32) color.NRGBA {
+	stops := [...]color.NRGBA{
+		{R: 0x00, G: 0x00, B: 0x04, A: 0xff},
+		{R: 0x51, G: 0x12, B: 0x7c, A: 0xff},
+		{R: 0xb7, G: 0x37, B: 0x79, A: 0xff},
+		{R: 0xfc, G: 0x89, B: 0x61, A: 0xff},
+		{R: 0xfc, G: 0xfd, B: 0xbf, A: 0xff},
+	}
+	v = max(0, min(v, 1)) * float32(len(stops)-1)
+	i := min(int(v), len(stops)-2)
+	f := v - float32(i)
+	a, b := stops[i], stops[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float32(x) + (float32(y)-float32(x))*f) }
+	return color.NRGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 0xff}
+}
+
+// render computes the spectra of a frame a column of width and draws them
+// into an image.
+func (s *Spectrogram) render(width int) {
+	s.frame = max(len(s.samples)/max(width, 1), 1)
+	frames := spectrogram(s.samples, s.Size, s.frame)
+	bins := s.Size / 2
+	img := image.NewNRGBA(image.Rect(0, 0, len(frames), bins))
+	parallel(len(frames), func(lo, hi int) {
+		for x := lo; x < hi; x++ {
+			for y, db := range frames[x] {
+				c := spectrogramColor(1 - db/spectrogramFloor)
+				o := img.PixOffset(x, bins-1-y)
+				img.Pix[o], img.Pix[o+1], img.Pix[o+2], img.Pix[o+3] = c.R, c.G, c.B, c.A
+			}
+		}
+	})
+	s.img, s.ready = paint.NewImageOp(img), true
+}
+
+func (s *Spectrogram) Layout(gtx layout.Context) layout.Dimensions {
+	size := gtx.Constraints.Max
+	s.update(gtx, s, size.X)
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, s)
+	pointer.CursorText.Add(gtx.Ops)
+
+	paint.Fill(gtx.Ops, spectrogramColor(0))
+	if len(s.samples) > 0 && size.X > 0 {
+		// Frames more than a column apart, or the hop past the frames, are
+		// recomputed for the new width.
+		want := max(len(s.samples)/size.X, 1)
+		if !s.ready || want < s.frame/2 || want > s.frame*2 {
+			s.render(size.X)
+		}
+		igtx := gtx
+		igtx.Constraints = layout.Exact(size)
+		widget.Image{Src: s.img, Fit: widget.Fill}.Layout(igtx)
+	}
+	s.layoutMarks(gtx, size)
+	return layout.Dimensions{Size: size}
+}
+
+// samplesArg accepts a block of samples, decimals from -1 to 1 or 16 bit
+// integers.
+func samplesArg(ps *env.ProgramState, name string, n int, arg env.Object) ([]float32, *env.Error) {
+	s, integers, err := numbersArg(ps, name, n, arg)
+	if err != nil {
+		return nil, err
+	}
+	scale := 1.0
+	if integers {
+		scale = 1.0 / 32768
+	}
+	res := make([]float32, len(s))
+	for i, v := range s {
+		res[i] = float32(v * scale)
+	}
+	return res, nil
+}
+
+// audioBuiltins returns the builtins every audio view of kind has.
+func audioBuiltins[T audioView](kind string) map[string]*env.Builtin {
+	method := func(name, doc string, argsn int, fn func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, arg2 env.Object) env.Object) *env.Builtin {
+		name = kind + "//" + name
+		return &env.Builtin{
+			Doc:   doc,
+			Argsn: argsn,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				v, err := nativeArg[T](ps, name, 1, arg0)
+				if err != nil {
+					return err
+				}
+				if res := fn(ps, name, v, v.track(), arg1, arg2); res != nil {
+					return res
+				}
+				return arg0
+			},
+		}
+	}
+	seconds := func(ps *env.ProgramState, name string, n int, arg env.Object) (float64, *env.Error) {
+		return decimalArg(ps, name, n, arg)
+	}
+	return map[string]*env.Builtin{
+		kind + "//layout": layoutBuiltin[T](kind + "//layout"),
+		kind + "//samples!": method("samples!", "Show a block of samples, decimals from -1 to 1 or 16 bit integers, at a sample rate", 3, func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, arg2 env.Object) env.Object {
+			s, err := samplesArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			rate, err := integerArg(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			if rate <= 0 {
+				return failure(ps, name, "sample rate must be positive")
+			}
+			v.SetSamples(s, int(rate))
+			return nil
+		}),
+		kind + "//load-wav": method("load-wav", "Show the samples of a WAV file, its channels mixed", 2, func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, _ env.Object) env.Object {
+			path, err := stringArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			s, rate, rerr := readWAV(path)
+			if rerr != nil {
+				return failure(ps, name, rerr.Error())
+			}
+			v.SetSamples(s, rate)
+			return nil
+		}),
+		kind + "//duration?": method("duration?", "Get the length of the samples in seconds", 1, func(ps *env.ProgramState, name string, v T, t *audioTrack, _, _ env.Object) env.Object {
+			return *env.NewDecimal(t.Duration())
+		}),
+		kind + "//playhead!": method("playhead!", "Set the time of the playhead in seconds, or -1 to hide it", 2, func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, _ env.Object) env.Object {
+			s, err := seconds(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			t.playhead = -1
+			if s >= 0 {
+				t.playhead = min(s, t.Duration())
+			}
+			return nil
+		}),
+		kind + "//playhead?": method("playhead?", "Get the time of the playhead in seconds, or -1", 1, func(ps *env.ProgramState, name string, v T, t *audioTrack, _, _ env.Object) env.Object {
+			return *env.NewDecimal(t.playhead)
+		}),
+		kind + "//selection!": method("selection!", "Select from a start to an end time in seconds; equal times clear the selection", 3, func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, arg2 env.Object) env.Object {
+			start, err := seconds(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			end, err := seconds(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			t.SetSelection(start, end)
+			return nil
+		}),
+		kind + "//selection?": method("selection?", "Get a block of the start and end of the selection in seconds, empty if there is none", 1, func(ps *env.ProgramState, name string, v T, t *audioTrack, _, _ env.Object) env.Object {
+			start, end := t.Selection()
+			if end <= start {
+				return *env.NewBlock(*env.NewTSeries(nil))
+			}
+			return numbersObj([]float64{start, end}, false)
+		}),
+		kind + "//on-seek!": method("on-seek!", "Set function called with the time in seconds clicked, where the playhead moves", 2, func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, _ env.Object) env.Object {
+			fn, err := functionArg(ps, name, 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			t.onSeek = &fn
+			return nil
+		}),
+		kind + "//on-select!": method("on-select!", "Set function called with the start and end in seconds of each selection dragged", 2, func(ps *env.ProgramState, name string, v T, t *audioTrack, arg1, _ env.Object) env.Object {
+			fn, err := functionArg(ps, name, 2, 2, arg1)
+			if err != nil {
+				return err
+			}
+			t.onSelect = &fn
+			return nil
+		}),
+	}
+}
+
+var builtinsAudio = mergeBuiltins(
+	audioBuiltins[*Waveform]("Go(*gioui_org.Waveform)"),
+	audioBuiltins[*Spectrogram]("Go(*gioui_org.Spectrogram)"),
+	map[string]*env.Builtin{
+		"waveform": {
+			Doc:   "Create a waveform of audio samples, given with samples! or load-wav; click to move the playhead and drag to select",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				th, err := nativeArg[*material.Theme](ps, "waveform", 1, arg0)
+				if err != nil {
+					return err
+				}
+				w := &Waveform{audioTrack: audioTrack{ps: ps, Theme: th, playhead: -1}}
+				return *env.NewNative(ps.Idx, w, "Go(*gioui_org.Waveform)")
+			},
+		},
+		"Go(*gioui_org.Waveform)//color!": {
+			Doc:   "Set the color of the samples",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				w, err := nativeArg[*Waveform](ps, "Go(*gioui_org.Waveform)//color!", 1, arg0)
+				if err != nil {
+					return err
+				}
+				c, err := colorArg(ps, "Go(*gioui_org.Waveform)//color!", 2, arg1)
+				if err != nil {
+					return err
+				}
+				w.Color = c
+				return arg0
+			},
+		},
+		"spectrogram": {
+			Doc:   "Create a spectrogram of audio samples, given with samples! or load-wav, by FFTs of 1024 samples; click to move the playhead and drag to select",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				th, err := nativeArg[*material.Theme](ps, "spectrogram", 1, arg0)
+				if err != nil {
+					return err
+				}
+				s := &Spectrogram{audioTrack: audioTrack{ps: ps, Theme: th, playhead: -1}, Size: 1024}
+				return *env.NewNative(ps.Idx, s, "Go(*gioui_org.Spectrogram)")
+			},
+		},
+		"Go(*gioui_org.Spectrogram)//fft-size!": {
+			Doc:   "Set the samples of each FFT, a power of two from 64 to 16384; more resolve frequencies finer and times coarser",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				s, err := nativeArg[*Spectrogram](ps, "Go(*gioui_org.Spectrogram)//fft-size!", 1, arg0)
+				if err != nil {
+					return err
+				}
+				n, err := integerArg(ps, "Go(*gioui_org.Spectrogram)//fft-size!", 2, arg1)
+				if err != nil {
+					return err
+				}
+				if n < 64 || n > 16384 || n&(n-1) != 0 {
+					return failure(ps, "Go(*gioui_org.Spectrogram)//fft-size!", "size must be a power of two from 64 to 16384")
+				}
+				s.Size, s.ready = int(n), false
+				return arg0
+			},
+		},
+	},
+)
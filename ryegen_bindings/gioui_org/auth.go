@@ -0,0 +1,483 @@
+// OAuth 2 sign-in through the system browser.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// authTimeout is how long a sign-in waits for the browser to come back.
+const authTimeout = 10 * time.Minute
+
+// AuthLogin signs in with OAuth 2's authorization code flow and PKCE, as
+// native apps should: it opens the provider's page in the system browser
+// and takes the code the browser is redirected with on a loopback port,
+// then trades it for tokens. Like the Updater, the flow runs in the
+// background; the script follows it with state? and a window set with
+// wake! is invalidated as it advances.
+type AuthLogin struct {
+	AuthURL      string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	Port         int // 0 picks a free one
+
+	mu      sync.Mutex
+	state   string // idle, waiting, exchanging, signed-in, failed or cancelled
+	err     error
+	tokens  map[string]any
+	pageURL string
+	srv     *http.Server
+	timer   *time.Timer // ends waiting for the browser after authTimeout
+	win     *app.Window
+}
+
+// authClient talks to the token endpoint.
+var authClient = &http.Client{Timeout: 30 * time.Second}
+
+// set changes the state and wakes up the window.
+func (a *AuthLogin) set(f func()) {
+	a.mu.Lock()
+	f()
+	win := a.win
+	a.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+func (a *AuthLogin) busy() bool {
+	return a.state == "waiting" || a.state == "exchanging"
+}
+
+// stopTimer stops the timeout of the sign-in. Call with a.mu held.
+func (a *AuthLogin) stopTimer() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+}
+
+// finish ends a sign-in from state, if it is still in it.
+func (a *AuthLogin) finish(from string, tokens map[string]any, err error) {
+	a.set(func() {
+		if a.state != from {
+			return
+		}
+		a.stopTimer()
+		if err != nil {
+			a.state, a.err = "failed", err
+			return
+		}
+		a.state, a.tokens = "signed-in", tokens
+	})
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Start listens for the redirect and opens the sign-in page.
+func (a *AuthLogin) Start() error {
+	// Claim the sign-in before setting it up, so two calls can't both start.
+	var busy bool
+	a.set(func() {
+		if busy = a.busy(); !busy {
+			a.state, a.err, a.tokens, a.srv = "waiting", nil, nil, nil
+		}
+	})
+	if busy {
+		return nil
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", a.Port))
+	if err != nil {
+		a.finish("waiting", nil, err)
+		return err
+	}
+	verifier := randomString(32)
+	challenge := sha256.Sum256([]byte(verifier))
+	state := randomString(16)
+	redirect := fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
+	page, err := url.Parse(a.AuthURL)
+	if err != nil {
+		ln.Close()
+		a.finish("waiting", nil, err)
+		return err
+	}
+	q := page.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", a.ClientID)
+	q.Set("redirect_uri", redirect)
+	if a.Scope != "" {
+		q.Set("scope", a.Scope)
+	}
+	q.Set("state", state)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	page.RawQuery = q.Encode()
+
+	var once sync.Once
+	mux := http.NewServeMux()
+	srv := &http.Server{Handler: mux}
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "unexpected sign-in response", http.StatusBadRequest)
+			return
+		}
+		once.Do(func() {
+			var tokens map[string]any
+			err := authError(q)
+			if err == nil {
+				a.set(func() {
+					if a.state == "waiting" {
+						a.state = "exchanging"
+						a.stopTimer()
+					}
+				})
+				tokens, err = a.exchange(url.Values{
+					"grant_type":    {"authorization_code"},
+					"code":          {q.Get("code")},
+					"redirect_uri":  {redirect},
+					"code_verifier": {verifier},
+				})
+				a.finish("exchanging", tokens, err)
+			} else {
+				a.finish("waiting", nil, err)
+			}
+			msg := "Signed in. You can close this tab and return to the app."
+			if err != nil {
+				msg = "Sign-in failed: " + err.Error()
+			}
+			fmt.Fprintf(w, "<!doctype html><title>Sign-in</title><p>%s</p>", html.EscapeString(msg))
+			go srv.Close()
+		})
+	})
+	var cancelled bool
+	a.set(func() {
+		// Cancel may have been called while setting up.
+		if a.state != "waiting" {
+			cancelled = true
+			return
+		}
+		a.pageURL = page.String()
+		a.srv = srv
+		a.timer = time.AfterFunc(authTimeout, func() {
+			srv.Close()
+			a.set(func() {
+				if a.srv == srv && a.state == "waiting" {
+					a.timer = nil
+					a.state, a.err = "failed", errors.New("timed out waiting for the browser")
+				}
+			})
+		})
+	})
+	if cancelled {
+		ln.Close()
+		return nil
+	}
+	go srv.Serve(ln)
+	// Without a browser the listener keeps waiting for the page to be
+	// opened by hand.
+	return openURL(page.String())
+}
+
+// authError returns the error a provider redirected with, if any.
+func authError(q url.Values) error {
+	if e := q.Get("error"); e != "" {
+		if d := q.Get("error_description"); d != "" {
+			return errors.New(e + ": " + d)
+		}
+		return errors.New(e)
+	}
+	if q.Get("code") == "" {
+		return errors.New("no authorization code")
+	}
+	return nil
+}
+
+// exchange posts a grant to the token endpoint and returns the tokens.
+func (a *AuthLogin) exchange(form url.Values) (map[string]any, error) {
+	form.Set("client_id", a.ClientID)
+	if a.ClientSecret != "" {
+		form.Set("client_secret", a.ClientSecret)
+	}
+	req, err := http.NewRequest("POST", a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := authClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var tokens map[string]any
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if e, ok := tokens["error"].(string); ok {
+		if d, ok := tokens["error_description"].(string); ok {
+			return nil, errors.New(e + ": " + d)
+		}
+		return nil, errors.New(e)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if _, ok := tokens["access_token"].(string); !ok {
+		return nil, errors.New("token endpoint: no access_token")
+	}
+	return tokens, nil
+}
+
+// Refresh trades the refresh token for new tokens in the background,
+// keeping the refresh token if the provider doesn't send a new one.
+func (a *AuthLogin) Refresh() error {
+	a.mu.Lock()
+	refresh, _ := a.tokens["refresh_token"].(string)
+	if a.busy() || refresh == "" {
+		a.mu.Unlock()
+		return errors.New("no refresh token")
+	}
+	a.state, a.err = "exchanging", nil
+	a.mu.Unlock()
+	go func() {
+		tokens, err := a.exchange(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refresh},
+		})
+		if err == nil {
+			if _, ok := tokens["refresh_token"]; !ok {
+				tokens["refresh_token"] = refresh
+			}
+		}
+		a.finish("exchanging", tokens, err)
+	}()
+	return nil
+}
+
+// Cancel stops waiting for the browser.
+func (a *AuthLogin) Cancel() {
+	a.set(func() {
+		if a.busy() {
+			a.state = "cancelled"
+			a.stopTimer()
+			if a.srv != nil {
+				a.srv.Close()
+			}
+		}
+	})
+}
+
+// AuthStatus shows how a sign-in is going, with a spinner while it runs.
+type AuthStatus struct {
+	Login *AuthLogin
+	Theme *material.Theme
+}
+
+var authMessages = map[string]string{
+	"idle":       "Not signed in",
+	"waiting":    "Continue in your browser…",
+	"exchanging": "Signing in…",
+	"signed-in":  "Signed in",
+	"cancelled":  "Sign-in cancelled",
+}
+
+func (s *AuthStatus) Layout(gtx layout.Context) layout.Dimensions {
+	s.Login.mu.Lock()
+	busy := s.Login.busy()
+	msg := authMessages[s.Login.state]
+	if s.Login.err != nil {
+		msg = "Sign-in failed: " + s.Login.err.Error()
+	}
+	s.Login.mu.Unlock()
+	label := material.Body1(s.Theme, msg)
+	if !busy {
+		return label.Layout(gtx)
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			size := gtx.Dp(unit.Dp(18))
+			gtx.Constraints.Min.X, gtx.Constraints.Max.X = size, size
+			gtx.Constraints.Min.Y, gtx.Constraints.Max.Y = size, size
+			return material.Loader(s.Theme).Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: 8}.Layout),
+		layout.Rigid(label.Layout),
+	)
+}
+
+func authStringOption(f func(a *AuthLogin, s string)) optionSpec[func(*AuthLogin)] {
+	return optionSpec[func(*AuthLogin)]{1, func(ps *env.ProgramState, name string, args []env.Object) (func(*AuthLogin), *env.Error) {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(a *AuthLogin) { f(a, s) }, nil
+	}}
+}
+
+// authOptions are the specs of the settings of a sign-in.
+var authOptions = map[string]optionSpec[func(*AuthLogin)]{
+	"auth-url":      authStringOption(func(a *AuthLogin, s string) { a.AuthURL = s }),
+	"token-url":     authStringOption(func(a *AuthLogin, s string) { a.TokenURL = s }),
+	"client-id":     authStringOption(func(a *AuthLogin, s string) { a.ClientID = s }),
+	"client-secret": authStringOption(func(a *AuthLogin, s string) { a.ClientSecret = s }),
+	"scope":         authStringOption(func(a *AuthLogin, s string) { a.Scope = s }),
+	"port": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*AuthLogin), *env.Error) {
+		p, err := integerArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if p < 0 || p > 65535 {
+			return nil, failure(ps, name, "port must be from 0 to 65535")
+		}
+		return func(a *AuthLogin) { a.Port = int(p) }, nil
+	}},
+}
+
+// authBuiltin returns a "//method" builtin of sign-ins; fn returning nil
+// returns the sign-in.
+func authBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, a *AuthLogin, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.AuthLogin)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			a, err := nativeArg[*AuthLogin](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, a, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsAuth = map[string]*env.Builtin{
+	"auth-login": {
+		Doc:   "Create an OAuth 2 sign-in from a block of settings: auth-url, token-url and client-id, and optionally scope, client-secret and the loopback port (any free one by default)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			opts, err := optionsArg(ps, "auth-login", 1, arg0, authOptions)
+			if err != nil {
+				return err
+			}
+			a := &AuthLogin{state: "idle"}
+			for _, o := range opts {
+				o(a)
+			}
+			if a.AuthURL == "" || a.TokenURL == "" || a.ClientID == "" {
+				return failure(ps, "auth-login", "auth-url, token-url and client-id are required")
+			}
+			return *env.NewNative(ps.Idx, a, "Go(*gioui_org.AuthLogin)")
+		},
+	},
+	"Go(*gioui_org.AuthLogin)//start": authBuiltin("start", "Open the sign-in page in the browser and wait for it to redirect back; state? becomes signed-in. Fails if the browser couldn't be opened, still waiting for the page at url?", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		if err := a.Start(); err != nil {
+			return failure(ps, name, err.Error())
+		}
+		return nil
+	}),
+	"Go(*gioui_org.AuthLogin)//refresh": authBuiltin("refresh", "Get new tokens with the refresh token in the background", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		if err := a.Refresh(); err != nil {
+			return failure(ps, name, err.Error())
+		}
+		return nil
+	}),
+	"Go(*gioui_org.AuthLogin)//cancel": authBuiltin("cancel", "Stop waiting for the browser", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		a.Cancel()
+		return nil
+	}),
+	"Go(*gioui_org.AuthLogin)//wake!": authBuiltin("wake!", "Invalidate a window as the sign-in advances, so its loop shows it", 2, func(ps *env.ProgramState, name string, a *AuthLogin, arg1 env.Object) env.Object {
+		win, err := nativeArg[*app.Window](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.win = win
+		a.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.AuthLogin)//state?": authBuiltin("state?", "Get the state: idle, waiting, exchanging, signed-in, failed or cancelled", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return *env.NewString(a.state)
+	}),
+	"Go(*gioui_org.AuthLogin)//error?": authBuiltin("error?", "Get why the sign-in failed, or an empty string", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(a.err.Error())
+	}),
+	"Go(*gioui_org.AuthLogin)//tokens?": authBuiltin("tokens?", "Get a dict of what the token endpoint returned (access_token, refresh_token, expires_in, id_token ...) once signed in", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		d := map[string]any{}
+		for k, v := range a.tokens {
+			// expires_in and the like are whole seconds.
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				v = int64(f)
+			}
+			d[k] = env.ToRyeValue(v)
+		}
+		return *env.NewDict(d)
+	}),
+	"Go(*gioui_org.AuthLogin)//url?": authBuiltin("url?", "Get the address of the sign-in page, to show if the browser didn't open", 1, func(ps *env.ProgramState, name string, a *AuthLogin, _ env.Object) env.Object {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return *env.NewString(a.pageURL)
+	}),
+	"auth-status": {
+		Doc:   "Create a widget showing how a sign-in is going, with a spinner while it runs",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "auth-status", 1, arg0)
+			if err != nil {
+				return err
+			}
+			a, err := nativeArg[*AuthLogin](ps, "auth-status", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &AuthStatus{Login: a, Theme: th}, "Go(*gioui_org.AuthStatus)")
+		},
+	},
+	"Go(*gioui_org.AuthStatus)//layout": layoutBuiltin[*AuthStatus]("Go(*gioui_org.AuthStatus)//layout"),
+}
@@ -0,0 +1,487 @@
+// Badge, chip and avatar widgets.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Badge decorates a child widget with a small count or dot at one of its
+// corners.
+type Badge struct {
+	Theme   *material.Theme
+	Child   layout.Widget
+	Content string // empty for a dot
+	Corner  layout.Direction
+	Color   color.NRGBA
+	Visible bool
+}
+
+func (b *Badge) Layout(gtx layout.Context) layout.Dimensions {
+	macro := op.Record(gtx.Ops)
+	dims := b.Child(gtx)
+	child := macro.Stop()
+	child.Add(gtx.Ops)
+	if !b.Visible {
+		return dims
+	}
+
+	macro = op.Record(gtx.Ops)
+	bgtx := gtx
+	bgtx.Constraints.Min = image.Point{}
+	bdims := b.layoutBadge(bgtx)
+	badge := macro.Stop()
+
+	// Center the badge on the corner of the child.
+	var pos image.Point
+	switch b.Corner {
+	case layout.NE, layout.E, layout.SE:
+		pos.X = dims.Size.X
+	case layout.N, layout.Center, layout.S:
+		pos.X = dims.Size.X / 2
+	}
+	switch b.Corner {
+	case layout.SW, layout.S, layout.SE:
+		pos.Y = dims.Size.Y
+	case layout.W, layout.Center, layout.E:
+		pos.Y = dims.Size.Y / 2
+	}
+	pos = pos.Sub(bdims.Size.Div(2))
+	defer op.Offset(pos).Push(gtx.Ops).Pop()
+	badge.Add(gtx.Ops)
+	return dims
+}
+
+func (b *Badge) layoutBadge(gtx layout.Context) layout.Dimensions {
+	if b.Content == "" {
+		d := gtx.Dp(10)
+		paint.FillShape(gtx.Ops, b.Color, clip.Ellipse{Max: image.Pt(d, d)}.Op(gtx.Ops))
+		return layout.Dimensions{Size: image.Pt(d, d)}
+	}
+	macro := op.Record(gtx.Ops)
+	dims := layout.Inset{Left: 5, Right: 5, Top: 1, Bottom: 1}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		lbl := material.Label(b.Theme, b.Theme.TextSize*0.7, b.Content)
+		lbl.Color = b.Theme.Palette.ContrastFg
+		return lbl.Layout(gtx)
+	})
+	content := macro.Stop()
+	off := 0
+	if dims.Size.X < dims.Size.Y {
+		// Keep single digits round.
+		off = (dims.Size.Y - dims.Size.X) / 2
+		dims.Size.X = dims.Size.Y
+	}
+	r := dims.Size.Y / 2
+	paint.FillShape(gtx.Ops, b.Color, clip.UniformRRect(image.Rectangle{Max: dims.Size}, r).Op(gtx.Ops))
+	defer op.Offset(image.Pt(off, 0)).Push(gtx.Ops).Pop()
+	content.Add(gtx.Ops)
+	return dims
+}
+
+// Chip is a compact pill with a label that can be clicked, selected and,
+// optionally, dismissed.
+type Chip struct {
+	ps          *env.ProgramState
+	Theme       *material.Theme
+	Label       string
+	Selected    bool
+	Dismissible bool
+	Dismissed   bool
+	OnDismiss   *env.Function
+	click       widget.Clickable
+	dismiss     widget.Clickable
+}
+
+func (c *Chip) Layout(gtx layout.Context) layout.Dimensions {
+	if c.Dismissed {
+		return layout.Dimensions{}
+	}
+	for c.dismiss.Clicked(gtx) {
+		c.Dismissed = true
+		if c.OnDismiss != nil {
+			callFunction(c.ps, "chip on-dismiss", *c.OnDismiss)
+		}
+	}
+	th := c.Theme
+	fg := th.Palette.Fg
+	if c.Selected {
+		fg = th.Palette.ContrastFg
+	}
+	macro := op.Record(gtx.Ops)
+	dims := c.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Left: 12, Right: 12, Top: 4, Bottom: 4}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					lbl := material.Body2(th, c.Label)
+					lbl.Color = fg
+					return lbl.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if !c.Dismissible {
+						return layout.Dimensions{}
+					}
+					return layout.Inset{Left: 6}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						return c.dismiss.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							lbl := material.Body2(th, "×")
+							lbl.Color = fg
+							return lbl.Layout(gtx)
+						})
+					})
+				}),
+			)
+		})
+	})
+	content := macro.Stop()
+	rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, dims.Size.Y/2)
+	if c.Selected {
+		paint.FillShape(gtx.Ops, th.Palette.ContrastBg, rr.Op(gtx.Ops))
+	} else {
+		if c.click.Hovered() {
+			paint.FillShape(gtx.Ops, mulAlpha(fg, 0x18), rr.Op(gtx.Ops))
+		}
+		paint.FillShape(gtx.Ops, mulAlpha(fg, 0x60), clip.Stroke{Path: rr.Path(gtx.Ops), Width: float32(gtx.Dp(1))}.Op())
+	}
+	content.Add(gtx.Ops)
+	return dims
+}
+
+// Avatar is a circle showing an image, or initials when there is none.
+type Avatar struct {
+	Theme    *material.Theme
+	Initials string
+	Image    *paint.ImageOp
+	Size     unit.Dp
+	Color    color.NRGBA
+}
+
+func (a *Avatar) Layout(gtx layout.Context) layout.Dimensions {
+	d := gtx.Dp(a.Size)
+	size := image.Pt(d, d)
+	defer clip.Ellipse{Max: size}.Push(gtx.Ops).Pop()
+	if a.Image != nil {
+		gtx.Constraints = layout.Exact(size)
+		return widget.Image{Src: *a.Image, Fit: widget.Cover}.Layout(gtx)
+	}
+	paint.ColorOp{Color: a.Color}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	gtx.Constraints = layout.Exact(size)
+	return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		lbl := material.Label(a.Theme, unit.Sp(float32(a.Size)*0.4), a.Initials)
+		lbl.Color = a.Theme.Palette.ContrastFg
+		return lbl.Layout(gtx)
+	})
+}
+
+// initials returns the upper-cased first letters of the first two words of
+// name.
+func initials(name string) string {
+	var res []rune
+	for _, w := range strings.Fields(name) {
+		r := []rune(w)
+		res = append(res, unicode.ToUpper(r[0]))
+		if len(res) == 2 {
+			break
+		}
+	}
+	return string(res)
+}
+
+var cornerNames = map[string]layout.Direction{
+	"top-left":     layout.NW,
+	"top":          layout.N,
+	"top-right":    layout.NE,
+	"right":        layout.E,
+	"bottom-right": layout.SE,
+	"bottom":       layout.S,
+	"bottom-left":  layout.SW,
+	"left":         layout.W,
+	"center":       layout.Center,
+}
+
+var builtinsBadge = map[string]*env.Builtin{
+	"badge": {
+		Doc:   "Decorate a widget with a badge; content is a string or integer, empty string shows a dot",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "badge", 1, arg0)
+			if err != nil {
+				return err
+			}
+			var content string
+			switch v := arg1.(type) {
+			case env.String:
+				content = v.Value
+			case env.Integer:
+				content = v.Print(*ps.Idx)
+			default:
+				return argError(ps, "badge", 2, "string or integer", arg1)
+			}
+			child, err := widgetArg(ps, "badge", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &Badge{
+				Theme:   th,
+				Child:   child,
+				Content: content,
+				Corner:  layout.NE,
+				Color:   color.NRGBA{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff},
+				Visible: true,
+			}, "Go(*gioui_org.Badge)")
+		},
+	},
+	"Go(*gioui_org.Badge)//layout": layoutBuiltin[*Badge]("Go(*gioui_org.Badge)//layout"),
+	"Go(*gioui_org.Badge)//content!": {
+		Doc:   "Set badge content (string or integer, empty string shows a dot)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*Badge](ps, "Go(*gioui_org.Badge)//content!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			switch v := arg1.(type) {
+			case env.String:
+				b.Content = v.Value
+			case env.Integer:
+				b.Content = v.Print(*ps.Idx)
+			default:
+				return argError(ps, "Go(*gioui_org.Badge)//content!", 2, "string or integer", arg1)
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Badge)//corner!": {
+		Doc:   "Set badge corner ('top-right 'top-left 'bottom-right 'bottom-left ...)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*Badge](ps, "Go(*gioui_org.Badge)//corner!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := nameArg(ps, "Go(*gioui_org.Badge)//corner!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			dir, ok := cornerNames[s]
+			if !ok {
+				return failure(ps, "Go(*gioui_org.Badge)//corner!", "arg 2: unknown corner "+s)
+			}
+			b.Corner = dir
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Badge)//color!": {
+		Doc:   "Set badge color",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*Badge](ps, "Go(*gioui_org.Badge)//color!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.Badge)//color!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			b.Color = c
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Badge)//visible!": {
+		Doc:   "Show or hide the badge",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*Badge](ps, "Go(*gioui_org.Badge)//visible!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.Badge)//visible!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			b.Visible = v != 0
+			return arg0
+		},
+	},
+	"chip": {
+		Doc:   "Create a chip with a label",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "chip", 1, arg0)
+			if err != nil {
+				return err
+			}
+			label, err := stringArg(ps, "chip", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &Chip{ps: ps, Theme: th, Label: label}, "Go(*gioui_org.Chip)")
+		},
+	},
+	"Go(*gioui_org.Chip)//layout": layoutBuiltin[*Chip]("Go(*gioui_org.Chip)//layout"),
+	"Go(*gioui_org.Chip)//clicked": {
+		Doc:   "Check whether the chip was clicked",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*Chip](ps, "Go(*gioui_org.Chip)//clicked", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.Chip)//clicked", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(c.click.Clicked(gtx)))
+		},
+	},
+	"Go(*gioui_org.Chip)//selected!": {
+		Doc:   "Set chip selected state",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*Chip](ps, "Go(*gioui_org.Chip)//selected!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.Chip)//selected!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			c.Selected = v != 0
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Chip)//selected?": {
+		Doc:   "Get chip selected state",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*Chip](ps, "Go(*gioui_org.Chip)//selected?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(c.Selected))
+		},
+	},
+	"Go(*gioui_org.Chip)//on-dismiss!": {
+		Doc:   "Make the chip dismissible and set the function called when it's dismissed",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*Chip](ps, "Go(*gioui_org.Chip)//on-dismiss!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Chip)//on-dismiss!", 2, 0, arg1)
+			if err != nil {
+				return err
+			}
+			c.Dismissible = true
+			c.OnDismiss = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Chip)//dismissible!": {
+		Doc:   "Show or hide the dismiss button",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*Chip](ps, "Go(*gioui_org.Chip)//dismissible!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.Chip)//dismissible!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			c.Dismissible = v != 0
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Chip)//dismissed?": {
+		Doc:   "Check whether the chip was dismissed",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*Chip](ps, "Go(*gioui_org.Chip)//dismissed?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(c.Dismissed))
+		},
+	},
+	"avatar": {
+		Doc:   "Create an avatar circle of the given size in dp showing the initials of a name",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "avatar", 1, arg0)
+			if err != nil {
+				return err
+			}
+			name, err := stringArg(ps, "avatar", 2, arg1)
+			if err != nil {
+				return err
+			}
+			size, err := decimalArg(ps, "avatar", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &Avatar{
+				Theme:    th,
+				Initials: initials(name),
+				Size:     unit.Dp(size),
+				Color:    th.Palette.ContrastBg,
+			}, "Go(*gioui_org.Avatar)")
+		},
+	},
+	"avatar-image": {
+		Doc:   "Create an avatar circle of the given size in dp from an image or image file path",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "avatar-image", 1, arg0)
+			if err != nil {
+				return err
+			}
+			img, err := imageArg(ps, "avatar-image", 2, arg1)
+			if err != nil {
+				return err
+			}
+			size, err := decimalArg(ps, "avatar-image", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &Avatar{
+				Theme: th,
+				Image: &img,
+				Size:  unit.Dp(size),
+				Color: th.Palette.ContrastBg,
+			}, "Go(*gioui_org.Avatar)")
+		},
+	},
+	"Go(*gioui_org.Avatar)//layout": layoutBuiltin[*Avatar]("Go(*gioui_org.Avatar)//layout"),
+	"Go(*gioui_org.Avatar)//color!": {
+		Doc:   "Set avatar background color",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			a, err := nativeArg[*Avatar](ps, "Go(*gioui_org.Avatar)//color!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.Avatar)//color!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			a.Color = c
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,148 @@
+// Baseline alignment of flex children.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"sync"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// flexProbe collects the dimensions of the children of a flex as they are
+// laid out. layout.FlexChild hides its widget, so rigid and flexed wrap it
+// to report here.
+type flexProbe struct {
+	dims []layout.Dimensions
+}
+
+// flexProbes are the flexes being laid out, innermost last, by the ops of
+// their frame.
+var (
+	flexProbesMu sync.Mutex
+	flexProbes   = map[*op.Ops][]*flexProbe{}
+)
+
+// probed wraps w to report its dimensions to the innermost flex being laid
+// out.
+func probed(w layout.Widget) layout.Widget {
+	return func(gtx layout.Context) layout.Dimensions {
+		dims := w(gtx)
+		flexProbesMu.Lock()
+		if s := flexProbes[gtx.Ops]; len(s) > 0 {
+			p := s[len(s)-1]
+			p.dims = append(p.dims, dims)
+		}
+		flexProbesMu.Unlock()
+		return dims
+	}
+}
+
+// flexLayout lays out children like f. For baseline alignment of a
+// horizontal flex it also grows the flex to fit the children shifted down to
+// the shared baseline, which layout.Flex leaves out of its height, so text
+// of different sizes and inputs line up without being clipped.
+func flexLayout(gtx layout.Context, f layout.Flex, children []layout.FlexChild) layout.Dimensions {
+	p := &flexProbe{}
+	flexProbesMu.Lock()
+	flexProbes[gtx.Ops] = append(flexProbes[gtx.Ops], p)
+	flexProbesMu.Unlock()
+	defer func() {
+		flexProbesMu.Lock()
+		s := flexProbes[gtx.Ops]
+		if s = s[:len(s)-1]; len(s) == 0 {
+			delete(flexProbes, gtx.Ops)
+		} else {
+			flexProbes[gtx.Ops] = s
+		}
+		flexProbesMu.Unlock()
+	}()
+	if f.Axis != layout.Horizontal || f.Alignment != layout.Baseline {
+		return f.Layout(gtx, children...)
+	}
+	dims := f.Layout(gtx, children...)
+	// Children are placed with their baselines ascent from the top.
+	ascent, descent := dims.Size.Y-dims.Baseline, 0
+	for _, d := range p.dims {
+		descent = max(descent, d.Baseline)
+	}
+	if h := ascent + descent; h > dims.Size.Y {
+		dims.Size = gtx.Constraints.Constrain(image.Pt(dims.Size.X, h))
+		dims.Baseline = dims.Size.Y - ascent
+	}
+	return dims
+}
+
+// flexChildBuiltin overrides a generated flex child constructor to probe the
+// child's widget; the widget is argument n.
+func flexChildBuiltin(name string, n int) *env.Builtin {
+	gen := builtinsGenerated[name]
+	return &env.Builtin{
+		Doc:   gen.Doc,
+		Argsn: gen.Argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			arg := []*env.Object{&arg0, &arg1}[n-1]
+			// Anything else, like nil, is left to the generated builtin.
+			switch (*arg).(type) {
+			case env.Function, env.Native:
+				w, err := widgetArg(ps, name, n, *arg)
+				if err != nil {
+					return err
+				}
+				*arg = *env.NewNative(ps.Idx, probed(w), "Go(layout.Widget)")
+			}
+			return gen.Fn(ps, arg0, arg1, arg2, arg3, arg4)
+		},
+	}
+}
+
+var builtinsBaseline = map[string]*env.Builtin{
+	"Go(*layout.Flex)//layout": {
+		Doc:   "layout.Flex.Layout; with baseline alignment a horizontal flex grows to fit its children shifted to the shared baseline",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			f, err := nativeArg[*layout.Flex](ps, "Go(*layout.Flex)//layout", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*layout.Flex)//layout", 2, arg1)
+			if err != nil {
+				return err
+			}
+			children, err := sliceArg[layout.FlexChild](ps, "Go(*layout.Flex)//layout", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return dimensionsObj(ps, flexLayout(gtx, *f, children))
+		},
+	},
+	"layout-rigid":  flexChildBuiltin("layout-rigid", 1),
+	"layout-flexed": flexChildBuiltin("layout-flexed", 2),
+	"with-baseline": {
+		Doc:   "Lay out a widget with its baseline a number of dp above its bottom, for widgets without text (icons, images) to line up in a flex aligned to 'baseline",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := decimalArg(ps, "with-baseline", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "with-baseline", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "with-baseline", 3, arg2)
+			if err != nil {
+				return err
+			}
+			dims := w(gtx)
+			dims.Baseline = gtx.Dp(unit.Dp(b))
+			return dimensionsObj(ps, dims)
+		},
+	},
+}
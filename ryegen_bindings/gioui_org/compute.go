@@ -0,0 +1,587 @@
+// Image kernels run across the CPU cores. They stand in for precompiled GPU
+// compute kernels: Gio has no API to dispatch compute shaders of the app's
+// own, so they are plain Go, parallelized by rows.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/refaktor/rye/env"
+)
+
+// parallel runs f over [0, n) split into a band per core.
+func parallel(n int, f func(lo, hi int)) {
+	k := min(runtime.GOMAXPROCS(0), n)
+	if k <= 1 {
+		f(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < k; i++ {
+		lo, hi := n*i/k, n*(i+1)/k
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(lo, hi)
+		}()
+	}
+	wg.Wait()
+}
+
+// toRGBA returns img as an RGBA image with its origin at 0, 0, copying it
+// if needed. Kernels only read it.
+func toRGBA(img image.Image) *image.RGBA {
+	if m, ok := img.(*image.RGBA); ok && m.Rect.Min == (image.Point{}) {
+		return m
+	}
+	b := img.Bounds()
+	m := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(m, m.Rect, img, b.Min, draw.Src)
+	return m
+}
+
+// rgbaArg accepts an image native or the path of an image file.
+func rgbaArg(ps *env.ProgramState, name string, n int, arg env.Object) (*image.RGBA, *env.Error) {
+	switch v := arg.(type) {
+	case env.Native:
+		if img, ok := v.Value.(image.Image); ok {
+			return toRGBA(img), nil
+		}
+	case env.String:
+		img, err := loadImage(v.Value)
+		if err != nil {
+			return nil, failure(ps, name, fmt.Sprintf("arg %d: %v", n, err))
+		}
+		return toRGBA(img), nil
+	}
+	return nil, argError(ps, name, n, "image native or file path", arg)
+}
+
+// buffers hands out the images kernels write to, reusing the ones given
+// back. A nil *buffers allocates every time.
+type buffers struct {
+	free []*image.RGBA
+}
+
+func (b *buffers) get(r image.Rectangle) *image.RGBA {
+	if b != nil {
+		for i, m := range b.free {
+			if m.Rect == r {
+				b.free = append(b.free[:i], b.free[i+1:]...)
+				return m
+			}
+		}
+	}
+	return image.NewRGBA(r)
+}
+
+func (b *buffers) put(m *image.RGBA) {
+	if b != nil {
+		b.free = append(b.free, m)
+	}
+}
+
+func clampByte(v float32) uint8 {
+	return uint8(max(min(v+0.5, 255), 0))
+}
+
+// convolve writes to dst a 1D kernel of odd length applied along the rows
+// or columns of src, repeating the edge pixels. Pixels stay premultiplied,
+// so transparent ones don't bleed their color.
+func convolve(dst, src *image.RGBA, w []float32, horizontal bool) {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	r := len(w) / 2
+	parallel(height, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			for x := 0; x < width; x++ {
+				var acc [4]float32
+				for i, wt := range w {
+					sx, sy := x, y
+					if horizontal {
+						sx = max(min(x+i-r, width-1), 0)
+					} else {
+						sy = max(min(y+i-r, height-1), 0)
+					}
+					o := sy*src.Stride + sx*4
+					for c := range acc {
+						acc[c] += wt * float32(src.Pix[o+c])
+					}
+				}
+				o := y*dst.Stride + x*4
+				for c, v := range acc {
+					dst.Pix[o+c] = clampByte(v)
+				}
+			}
+		}
+	})
+}
+
+func separable(bufs *buffers, src *image.RGBA, w []float32) *image.RGBA {
+	if len(w) <= 1 {
+		return src
+	}
+	tmp, dst := bufs.get(src.Rect), bufs.get(src.Rect)
+	convolve(tmp, src, w, true)
+	convolve(dst, tmp, w, false)
+	bufs.put(tmp)
+	return dst
+}
+
+// maxBlurRadius caps the radius of blurs of src. A wider kernel takes
+// longer without blurring more, as everything is averaged already.
+func maxBlurRadius(src *image.RGBA) int {
+	return max(src.Rect.Dx(), src.Rect.Dy())
+}
+
+func boxBlur(bufs *buffers, src *image.RGBA, radius int) *image.RGBA {
+	radius = min(radius, maxBlurRadius(src))
+	w := make([]float32, 2*radius+1)
+	for i := range w {
+		w[i] = 1 / float32(len(w))
+	}
+	return separable(bufs, src, w)
+}
+
+// gaussianBlur blurs with a gaussian of standard deviation sigma pixels,
+// cut off at three sigmas, which are capped like the radius of box blurs.
+func gaussianBlur(bufs *buffers, src *image.RGBA, sigma float64) *image.RGBA {
+	if !(sigma > 0) {
+		return src
+	}
+	sigma = min(sigma, float64(maxBlurRadius(src))/3)
+	r := int(math.Ceil(3 * sigma))
+	w := make([]float32, 2*r+1)
+	var sum float32
+	for i := range w {
+		d := float64(i - r)
+		w[i] = float32(math.Exp(-d * d / (2 * sigma * sigma)))
+		sum += w[i]
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+	return separable(bufs, src, w)
+}
+
+// colorMatrix maps the unpremultiplied red, green, blue and alpha of each
+// pixel by a 4x5 row-major matrix, the fifth column adding an offset in
+// 0-255, like Android's ColorMatrix.
+func colorMatrix(bufs *buffers, src *image.RGBA, m [20]float32) *image.RGBA {
+	dst := bufs.get(src.Rect)
+	width := src.Rect.Dx()
+	parallel(src.Rect.Dy(), func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			for x := 0; x < width; x++ {
+				o := y*src.Stride + x*4
+				var in [4]float32
+				if a := src.Pix[o+3]; a != 0 {
+					for c := 0; c < 3; c++ {
+						in[c] = float32(src.Pix[o+c]) * 255 / float32(a)
+					}
+					in[3] = float32(a)
+				}
+				var out [4]float32
+				for r := range out {
+					row := m[r*5 : r*5+5]
+					out[r] = row[0]*in[0] + row[1]*in[1] + row[2]*in[2] + row[3]*in[3] + row[4]
+				}
+				a := max(min(out[3], 255), 0)
+				o = y*dst.Stride + x*4
+				for c := 0; c < 3; c++ {
+					dst.Pix[o+c] = clampByte(max(min(out[c], 255), 0) * a / 255)
+				}
+				dst.Pix[o+3] = clampByte(a)
+			}
+		}
+	})
+	return dst
+}
+
+func brightness(bufs *buffers, src *image.RGBA, k float32) *image.RGBA {
+	return colorMatrix(bufs, src, [20]float32{
+		k, 0, 0, 0, 0,
+		0, k, 0, 0, 0,
+		0, 0, k, 0, 0,
+		0, 0, 0, 1, 0,
+	})
+}
+
+// resize scales src to width by height pixels, interpolating bilinearly.
+func resize(bufs *buffers, src *image.RGBA, width, height int) *image.RGBA {
+	dst := bufs.get(image.Rect(0, 0, width, height))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == 0 || sh == 0 {
+		clear(dst.Pix)
+		return dst
+	}
+	sx, sy := float32(sw)/float32(width), float32(sh)/float32(height)
+	parallel(height, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			fy := max((float32(y)+0.5)*sy-0.5, 0)
+			y0 := min(int(fy), sh-1)
+			y1, ty := min(y0+1, sh-1), fy-float32(y0)
+			for x := 0; x < width; x++ {
+				fx := max((float32(x)+0.5)*sx-0.5, 0)
+				x0 := min(int(fx), sw-1)
+				x1, tx := min(x0+1, sw-1), fx-float32(x0)
+				o00, o01 := y0*src.Stride+x0*4, y0*src.Stride+x1*4
+				o10, o11 := y1*src.Stride+x0*4, y1*src.Stride+x1*4
+				o := y*dst.Stride + x*4
+				for c := 0; c < 4; c++ {
+					top := float32(src.Pix[o00+c])*(1-tx) + float32(src.Pix[o01+c])*tx
+					bottom := float32(src.Pix[o10+c])*(1-tx) + float32(src.Pix[o11+c])*tx
+					dst.Pix[o+c] = clampByte(top*(1-ty) + bottom*ty)
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// histogram counts the unpremultiplied values of each channel.
+func histogram(src *image.RGBA) [4][256]int64 {
+	var mu sync.Mutex
+	var res [4][256]int64
+	width := src.Rect.Dx()
+	parallel(src.Rect.Dy(), func(lo, hi int) {
+		var h [4][256]int64
+		for y := lo; y < hi; y++ {
+			for x := 0; x < width; x++ {
+				o := y*src.Stride + x*4
+				a := src.Pix[o+3]
+				for c := 0; c < 3; c++ {
+					var v uint8
+					if a != 0 {
+						v = uint8(min((int(src.Pix[o+c])*255+int(a)/2)/int(a), 255))
+					}
+					h[c][v]++
+				}
+				h[3][a]++
+			}
+		}
+		mu.Lock()
+		for c := range res {
+			for v := range res[c] {
+				res[c][v] += h[c][v]
+			}
+		}
+		mu.Unlock()
+	})
+	return res
+}
+
+// prefixSum returns the running totals of s, summing a band per core and
+// then offsetting each band by the totals of the ones before.
+func prefixSum(s []float64) []float64 {
+	res := make([]float64, len(s))
+	k := min(runtime.GOMAXPROCS(0), len(s))
+	totals := make([]float64, k)
+	band := func(i int) (int, int) { return len(s) * i / k, len(s) * (i + 1) / k }
+	parallel(k, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			var sum float64
+			a, b := band(i)
+			for j := a; j < b; j++ {
+				sum += s[j]
+				res[j] = sum
+			}
+			totals[i] = sum
+		}
+	})
+	for i := 1; i < k; i++ {
+		totals[i] += totals[i-1]
+	}
+	parallel(k, func(lo, hi int) {
+		for i := max(lo, 1); i < hi; i++ {
+			a, b := band(i)
+			for j := a; j < b; j++ {
+				res[j] += totals[i-1]
+			}
+		}
+	})
+	return res
+}
+
+// fft transforms re and im, of a power of two length, in place by the
+// iterative radix-2 Cooley-Tukey algorithm; tw holds the twiddles
+// e^(-2πik/n) for k below n/2.
+func fft(re, im []float64, tw []complex128) {
+	n := len(re)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half, stride := size/2, n/size
+		for start := 0; start < n; start += size {
+			for k := range half {
+				w := tw[k*stride]
+				a, b := start+k, start+k+half
+				tr := re[b]*real(w) - im[b]*imag(w)
+				ti := re[b]*imag(w) + im[b]*real(w)
+				re[b], im[b] = re[a]-tr, im[a]-ti
+				re[a], im[a] = re[a]+tr, im[a]+ti
+			}
+		}
+	}
+}
+
+func twiddles(n int) []complex128 {
+	tw := make([]complex128, n/2)
+	for k := range tw {
+		a := -2 * math.Pi * float64(k) / float64(n)
+		tw[k] = complex(math.Cos(a), math.Sin(a))
+	}
+	return tw
+}
+
+// nextPow2 returns the least power of two not below n.
+func nextPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// spectrum returns the magnitudes of the frequencies 0 to half the sample
+// rate in s, zero-padded to a power of two.
+func spectrum(s []float64) []float64 {
+	n := nextPow2(max(len(s), 2))
+	re, im := make([]float64, n), make([]float64, n)
+	copy(re, s)
+	fft(re, im, twiddles(n))
+	res := make([]float64, n/2+1)
+	for i := range res {
+		res[i] = math.Hypot(re[i], im[i])
+	}
+	return res
+}
+
+// spectrogram returns the spectra, in decibels below a full scale sine, of
+// a frame of size samples (a power of two) for every hop samples, centered
+// on them and windowed by a Hann window, a band of frames per core.
+func spectrogram(samples []float32, size, hop int) [][]float32 {
+	frames := max((len(samples)+hop-1)/hop, 1)
+	res := make([][]float32, frames)
+	tw := twiddles(size)
+	window := make([]float64, size)
+	var gain float64
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+		gain += window[i]
+	}
+	parallel(frames, func(lo, hi int) {
+		re, im := make([]float64, size), make([]float64, size)
+		for f := lo; f < hi; f++ {
+			clear(im)
+			for i := range re {
+				re[i] = 0
+				if j := f*hop + hop/2 - size/2 + i; j >= 0 && j < len(samples) {
+					re[i] = float64(samples[j]) * window[i]
+				}
+			}
+			fft(re, im, tw)
+			db := make([]float32, size/2)
+			for i := range db {
+				db[i] = float32(20 * math.Log10(max(math.Hypot(re[i], im[i])*2/gain, 1e-9)))
+			}
+			res[f] = db
+		}
+	})
+	return res
+}
+
+func rgbaObj(ps *env.ProgramState, img *image.RGBA) env.Object {
+	return *env.NewNative(ps.Idx, img, "Go(*image.RGBA)")
+}
+
+func numbersObj(s []float64, integers bool) env.Object {
+	objs := make([]env.Object, len(s))
+	for i, v := range s {
+		if integers {
+			objs[i] = *env.NewInteger(int64(v))
+		} else {
+			objs[i] = *env.NewDecimal(v)
+		}
+	}
+	return *env.NewBlock(*env.NewTSeries(objs))
+}
+
+// numbersArg accepts a block of numbers; integers is whether all of them
+// are integers.
+func numbersArg(ps *env.ProgramState, name string, n int, arg env.Object) (s []float64, integers bool, err *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, false, argError(ps, name, n, "block of numbers", arg)
+	}
+	integers = true
+	for _, it := range blk.Series.S {
+		switch v := it.(type) {
+		case env.Integer:
+			s = append(s, float64(v.Value))
+		case env.Decimal:
+			s = append(s, v.Value)
+			integers = false
+		default:
+			return nil, false, argError(ps, name, n, "block of numbers", arg)
+		}
+	}
+	return s, integers, nil
+}
+
+var builtinsCompute = map[string]*env.Builtin{
+	"compute-gaussian-blur": {
+		Doc:   "Blur an image (native or file path) with a gaussian of a standard deviation in pixels, across the CPU cores",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := rgbaArg(ps, "compute-gaussian-blur", 1, arg0)
+			if err != nil {
+				return err
+			}
+			sigma, err := decimalArg(ps, "compute-gaussian-blur", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if sigma < 0 {
+				return failure(ps, "compute-gaussian-blur", "sigma must not be negative")
+			}
+			return rgbaObj(ps, gaussianBlur(nil, img, sigma))
+		},
+	},
+	"compute-box-blur": {
+		Doc:   "Blur an image (native or file path) by averaging each pixel with its neighbors up to a radius in pixels, across the CPU cores",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := rgbaArg(ps, "compute-box-blur", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r, err := integerArg(ps, "compute-box-blur", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if r < 0 {
+				return failure(ps, "compute-box-blur", "radius must not be negative")
+			}
+			return rgbaObj(ps, boxBlur(nil, img, int(r)))
+		},
+	},
+	"compute-color-matrix": {
+		Doc:   "Map the red, green, blue and alpha of an image by a block of 20 numbers, a 4x5 matrix by rows whose last column adds an offset in 0-255",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := rgbaArg(ps, "compute-color-matrix", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, _, err := numbersArg(ps, "compute-color-matrix", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if len(s) != 20 {
+				return failure(ps, "compute-color-matrix", fmt.Sprintf("matrix has %d numbers, not 20", len(s)))
+			}
+			var m [20]float32
+			for i, v := range s {
+				m[i] = float32(v)
+			}
+			return rgbaObj(ps, colorMatrix(nil, img, m))
+		},
+	},
+	"compute-brightness": {
+		Doc:   "Scale the colors of an image by a factor (1.2 is 20% brighter)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := rgbaArg(ps, "compute-brightness", 1, arg0)
+			if err != nil {
+				return err
+			}
+			k, err := decimalArg(ps, "compute-brightness", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return rgbaObj(ps, brightness(nil, img, float32(k)))
+		},
+	},
+	"compute-resize": {
+		Doc:   "Scale an image to a width and height in pixels, interpolating bilinearly",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := rgbaArg(ps, "compute-resize", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := integerArg(ps, "compute-resize", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h, err := integerArg(ps, "compute-resize", 3, arg2)
+			if err != nil {
+				return err
+			}
+			if w <= 0 || h <= 0 {
+				return failure(ps, "compute-resize", "size must be positive")
+			}
+			return rgbaObj(ps, resize(nil, img, int(w), int(h)))
+		},
+	},
+	"compute-histogram": {
+		Doc:   "Count the values of each channel of an image: a dict of blocks of 256 counts for red, green, blue and alpha",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := rgbaArg(ps, "compute-histogram", 1, arg0)
+			if err != nil {
+				return err
+			}
+			h := histogram(img)
+			res := map[string]any{}
+			for c, n := range strings.Fields("red green blue alpha") {
+				s := make([]float64, 256)
+				for v, count := range h[c] {
+					s[v] = float64(count)
+				}
+				res[n] = numbersObj(s, true)
+			}
+			return *env.NewDict(res)
+		},
+	},
+	"compute-spectrum": {
+		Doc:   "Get the magnitudes of the frequencies in a block of samples, from 0 to half the sample rate, by a fast Fourier transform of the samples zero-padded to a power of two",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, _, err := numbersArg(ps, "compute-spectrum", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return numbersObj(spectrum(s), false)
+		},
+	},
+	"compute-prefix-sum": {
+		Doc:   "Get the running totals of a block of numbers",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, integers, err := numbersArg(ps, "compute-prefix-sum", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return numbersObj(prefixSum(s), integers)
+		},
+	},
+}
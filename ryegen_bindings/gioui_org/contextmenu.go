@@ -0,0 +1,414 @@
+// Right-click context menus.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// menuItem is an entry of a menu: an action, a submenu or a separator
+// (label "-").
+type menuItem struct {
+	Label   string
+	Action  *env.Function
+	Sub     *menuList
+	click   widget.Clickable
+	hovered bool
+}
+
+func (it *menuItem) separator() bool { return it.Label == "-" }
+
+type menuList struct {
+	items []*menuItem
+	sel   int // highlighted item, -1 for none
+	open  int // item whose submenu is shown, -1 for none
+}
+
+func (l *menuList) reset() {
+	l.sel, l.open = -1, -1
+	for _, it := range l.items {
+		if it.Sub != nil {
+			it.Sub.reset()
+		}
+	}
+}
+
+// move highlights the item delta steps away, skipping separators.
+func (l *menuList) move(delta int) {
+	n := len(l.items)
+	start := l.sel
+	if start < 0 && delta < 0 {
+		start = n
+	}
+	for i := 1; i <= n; i++ {
+		j := ((start+delta*i)%n + n) % n
+		if !l.items[j].separator() {
+			l.sel = j
+			return
+		}
+	}
+}
+
+// parseMenu builds a menu from a block of labels each followed by a function
+// or a block for a submenu; "-" is a separator.
+func parseMenu(ps *env.ProgramState, name string, n int, blk env.Block) (*menuList, *env.Error) {
+	l := &menuList{sel: -1, open: -1}
+	s := blk.Series.S
+	for i := 0; i < len(s); i++ {
+		lbl, ok := s[i].(env.String)
+		if !ok {
+			return nil, argError(ps, name, n, "menu item label", s[i])
+		}
+		it := &menuItem{Label: lbl.Value}
+		if !it.separator() {
+			i++
+			if i == len(s) {
+				return nil, failure(ps, name, "missing function or block for menu item "+lbl.Value)
+			}
+			switch v := s[i].(type) {
+			case env.Block:
+				sub, err := parseMenu(ps, name, n, v)
+				if err != nil {
+					return nil, err
+				}
+				it.Sub = sub
+			default:
+				fn, err := functionArg(ps, name, n, 0, v)
+				if err != nil {
+					return nil, err
+				}
+				it.Action = &fn
+			}
+		}
+		l.items = append(l.items, it)
+	}
+	return l, nil
+}
+
+// ContextMenu wraps a widget and shows a popup menu where it is
+// right-clicked.
+type ContextMenu struct {
+	ps      *env.ProgramState
+	Theme   *material.Theme
+	Widget  layout.Widget
+	menu    *menuList
+	visible bool
+	pos     image.Point
+	overlay int // tag of the area dismissing the menu
+}
+
+func (m *ContextMenu) open(gtx layout.Context, pos image.Point) {
+	m.visible = true
+	m.pos = pos
+	m.menu.reset()
+	gtx.Execute(key.FocusCmd{Tag: m})
+}
+
+func (m *ContextMenu) close() {
+	m.visible = false
+	m.menu.reset()
+}
+
+// activate runs the action of an item or opens its submenu.
+func (m *ContextMenu) activate(l *menuList, i int) {
+	it := l.items[i]
+	if it.Sub != nil {
+		l.sel, l.open = i, i
+		it.Sub.reset()
+		it.Sub.move(1)
+		return
+	}
+	m.close()
+	if it.Action != nil {
+		callFunction(m.ps, "on-context-menu", *it.Action)
+	}
+}
+
+// key handles keyboard navigation in the innermost open menu.
+func (m *ContextMenu) key(name key.Name) {
+	lists := []*menuList{m.menu}
+	for l := m.menu; l.open >= 0; {
+		l = l.items[l.open].Sub
+		lists = append(lists, l)
+	}
+	l := lists[len(lists)-1]
+	switch name {
+	case key.NameUpArrow:
+		l.move(-1)
+	case key.NameDownArrow:
+		l.move(1)
+	case key.NameRightArrow:
+		if l.sel >= 0 && l.items[l.sel].Sub != nil {
+			m.activate(l, l.sel)
+		}
+	case key.NameLeftArrow:
+		if len(lists) > 1 {
+			lists[len(lists)-2].open = -1
+		}
+	case key.NameReturn, key.NameEnter:
+		if l.sel >= 0 {
+			m.activate(l, l.sel)
+		}
+	case key.NameEscape:
+		m.close()
+	}
+}
+
+func (m *ContextMenu) update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(
+			pointer.Filter{Target: m, Kinds: pointer.Press},
+			key.Filter{Focus: m, Name: key.NameUpArrow},
+			key.Filter{Focus: m, Name: key.NameDownArrow},
+			key.Filter{Focus: m, Name: key.NameLeftArrow},
+			key.Filter{Focus: m, Name: key.NameRightArrow},
+			key.Filter{Focus: m, Name: key.NameReturn},
+			key.Filter{Focus: m, Name: key.NameEnter},
+			key.Filter{Focus: m, Name: key.NameEscape},
+		)
+		if !ok {
+			break
+		}
+		switch e := e.(type) {
+		case pointer.Event:
+			if e.Buttons.Contain(pointer.ButtonSecondary) {
+				m.open(gtx, e.Position.Round())
+			}
+		case key.Event:
+			if m.visible && e.State == key.Press {
+				m.key(e.Name)
+			}
+		}
+	}
+	for {
+		_, ok := gtx.Event(pointer.Filter{Target: &m.overlay, Kinds: pointer.Press})
+		if !ok {
+			break
+		}
+		m.close()
+	}
+	if m.visible {
+		m.updateList(gtx, m.menu)
+	}
+}
+
+func (m *ContextMenu) updateList(gtx layout.Context, l *menuList) {
+	// Presses on the menu background must not reach the overlay.
+	for {
+		if _, ok := gtx.Event(pointer.Filter{Target: l, Kinds: pointer.Press}); !ok {
+			break
+		}
+	}
+	for i, it := range l.items {
+		if it.separator() {
+			continue
+		}
+		for it.click.Clicked(gtx) {
+			m.activate(l, i)
+			if !m.visible {
+				return
+			}
+		}
+		if h := it.click.Hovered(); h != it.hovered {
+			it.hovered = h
+			if h {
+				l.sel, l.open = i, -1
+				if it.Sub != nil {
+					l.open = i
+					it.Sub.reset()
+				}
+			}
+		}
+		if it.Sub != nil {
+			m.updateList(gtx, it.Sub)
+		}
+	}
+}
+
+func (m *ContextMenu) Layout(gtx layout.Context) layout.Dimensions {
+	m.update(gtx)
+	avail := gtx.Constraints.Max
+	macro := op.Record(gtx.Ops)
+	dims := m.Widget(gtx)
+	call := macro.Stop()
+	// The widget's own handlers are nested inside the menu's area so both
+	// get their events.
+	area := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+	event.Op(gtx.Ops, m)
+	call.Add(gtx.Ops)
+	area.Pop()
+	if m.visible {
+		macro := op.Record(gtx.Ops)
+		m.layoutPopup(gtx, avail)
+		deferLayer(gtx.Ops, layerOverlay, macro.Stop())
+	}
+	return dims
+}
+
+// layoutPopup places the menu below and right of where it was opened, or
+// on the other side where there is no room in the space avail given to the
+// widget.
+func (m *ContextMenu) layoutPopup(gtx layout.Context, avail image.Point) {
+	// Pressing anywhere outside the menu dismisses it.
+	const far = 1 << 20
+	st := clip.Rect(image.Rect(-far, -far, far, far)).Push(gtx.Ops)
+	event.Op(gtx.Ops, &m.overlay)
+	st.Pop()
+	gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Dp(320), gtx.Dp(2000))}
+	macro := op.Record(gtx.Ops)
+	dims := m.layoutList(gtx, m.menu)
+	menu := macro.Stop()
+	at := placePopup(image.Rectangle{Min: m.pos, Max: m.pos}, dims.Size, avail, placement{side: "bottom", align: -1}, 0, true)
+	defer op.Offset(at).Push(gtx.Ops).Pop()
+	menu.Add(gtx.Ops)
+}
+
+func (m *ContextMenu) layoutList(gtx layout.Context, l *menuList) layout.Dimensions {
+	th := m.Theme
+	pad := gtx.Dp(4)
+	// Measure first so all rows get the width of the widest one.
+	width := 0
+	for i := range l.items {
+		macro := op.Record(gtx.Ops)
+		d := m.layoutRow(gtx, l, i)
+		macro.Stop()
+		width = max(width, d.Size.X)
+	}
+	gtx.Constraints = layout.Exact(image.Pt(width, 0))
+	gtx.Constraints.Max.Y = 1 << 20
+	macro := op.Record(gtx.Ops)
+	tops := make([]int, len(l.items))
+	y := pad
+	for i := range l.items {
+		tops[i] = y
+		st := op.Offset(image.Pt(0, y)).Push(gtx.Ops)
+		y += m.layoutRow(gtx, l, i).Size.Y
+		st.Pop()
+	}
+	rows := macro.Stop()
+	size := image.Pt(width, y+pad)
+
+	rr := clip.UniformRRect(image.Rectangle{Max: size}, gtx.Dp(4))
+	paint.FillShape(gtx.Ops, th.Palette.Bg, rr.Op(gtx.Ops))
+	paint.FillShape(gtx.Ops, mulAlpha(th.Palette.Fg, 0x40), clip.Stroke{Path: rr.Path(gtx.Ops), Width: float32(gtx.Dp(1))}.Op())
+	st := clip.Rect{Max: size}.Push(gtx.Ops)
+	event.Op(gtx.Ops, l)
+	st.Pop()
+	rows.Add(gtx.Ops)
+
+	if l.open >= 0 {
+		st := op.Offset(image.Pt(size.X-gtx.Dp(2), tops[l.open]-pad)).Push(gtx.Ops)
+		gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Dp(320), gtx.Dp(2000))}
+		m.layoutList(gtx, l.items[l.open].Sub)
+		st.Pop()
+	}
+	return layout.Dimensions{Size: size}
+}
+
+func (m *ContextMenu) layoutRow(gtx layout.Context, l *menuList, i int) layout.Dimensions {
+	th := m.Theme
+	it := l.items[i]
+	if it.separator() {
+		w, h := gtx.Constraints.Min.X, gtx.Dp(9)
+		line := image.Rect(gtx.Dp(8), h/2, w-gtx.Dp(8), h/2+gtx.Dp(1))
+		paint.FillShape(gtx.Ops, mulAlpha(th.Palette.Fg, 0x30), clip.Rect(line).Op())
+		return layout.Dimensions{Size: image.Pt(w, h)}
+	}
+	fg := th.Palette.Fg
+	if l.sel == i {
+		fg = th.Palette.ContrastFg
+	}
+	return it.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		macro := op.Record(gtx.Ops)
+		dims := layout.Inset{Left: 12, Right: 12, Top: 6, Bottom: 6}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Alignment: layout.Middle, Spacing: layout.SpaceBetween}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					lbl := material.Body2(th, it.Label)
+					lbl.Color = fg
+					return lbl.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if it.Sub == nil {
+						return layout.Dimensions{}
+					}
+					return layout.Inset{Left: 16}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						lbl := material.Body2(th, "▸")
+						lbl.Color = fg
+						return lbl.Layout(gtx)
+					})
+				}),
+			)
+		})
+		content := macro.Stop()
+		if l.sel == i {
+			paint.FillShape(gtx.Ops, th.Palette.ContrastBg, clip.Rect{Max: dims.Size}.Op())
+		}
+		content.Add(gtx.Ops)
+		return dims
+	})
+}
+
+var builtinsContextMenu = map[string]*env.Builtin{
+	"on-context-menu": {
+		Doc:   "Wrap a widget so right-clicking it shows a menu; items are labels followed by a function or a block for a submenu, \"-\" is a separator",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "on-context-menu", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "on-context-menu", 2, arg1)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg2.(env.Block)
+			if !ok {
+				return argError(ps, "on-context-menu", 3, "block", arg2)
+			}
+			menu, err := parseMenu(ps, "on-context-menu", 3, blk)
+			if err != nil {
+				return err
+			}
+			m := &ContextMenu{ps: ps, Theme: th, Widget: w, menu: menu}
+			return *env.NewNative(ps.Idx, m, "Go(*gioui_org.ContextMenu)")
+		},
+	},
+	"Go(*gioui_org.ContextMenu)//layout": layoutBuiltin[*ContextMenu]("Go(*gioui_org.ContextMenu)//layout"),
+	"Go(*gioui_org.ContextMenu)//close": {
+		Doc:   "Hide the menu",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*ContextMenu](ps, "Go(*gioui_org.ContextMenu)//close", 1, arg0)
+			if err != nil {
+				return err
+			}
+			m.close()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ContextMenu)//visible?": {
+		Doc:   "Check whether the menu is shown",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*ContextMenu](ps, "Go(*gioui_org.ContextMenu)//visible?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(m.visible))
+		},
+	},
+}
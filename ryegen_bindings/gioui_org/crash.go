@@ -0,0 +1,162 @@
+// Crash reports.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/refaktor/rye/env"
+)
+
+// crashReporter writes a report when a Rye callback run by the bindings
+// panics, then lets the panic continue. Target is a file path, or an
+// http(s) URL the report is POSTed to. For a file, panics anywhere else in
+// the program, including other goroutines, are appended to it by the Go
+// runtime as well.
+type crashReporter struct {
+	Target string
+	mu     sync.Mutex
+	stacks map[uint64][]string // Rye callbacks being run per goroutine, innermost last
+	done   bool                // a panic was reported and is unwinding
+}
+
+// crash is the reporter set by crash-reporter, read by callbacks on any
+// goroutine.
+var crash atomic.Pointer[crashReporter]
+
+// crashClient POSTs reports. The process is going down, so it doesn't wait
+// long for the server.
+var crashClient = &http.Client{Timeout: 5 * time.Second}
+
+// push notes a callback run on goroutine g, which callbacks on other
+// goroutines don't interleave with.
+func (c *crashReporter) push(g uint64, ps *env.ProgramState, name string, fn env.Function) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stacks == nil {
+		c.stacks = make(map[uint64][]string)
+	}
+	c.stacks[g] = append(c.stacks[g], fmt.Sprintf("%s: fn { %s } { %s }", name,
+		fn.Spec.Series.PositionAndSurroundingElements(*ps.Idx),
+		fn.Body.Series.PositionAndSurroundingElements(*ps.Idx)))
+}
+
+func (c *crashReporter) pop(g uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st := c.stacks[g][:len(c.stacks[g])-1]; len(st) > 0 {
+		c.stacks[g] = st
+	} else {
+		delete(c.stacks, g)
+	}
+}
+
+// report writes a report of a panic on goroutine g.
+func (c *crashReporter) report(g uint64, v any, goStack []byte) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "rye-gio crash report\n\ntime: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "module: %s %s\n", bi.Main.Path, bi.Main.Version)
+	}
+	fmt.Fprintf(&b, "args: %q\n\npanic: %v\n\nrye callbacks (innermost last):\n", os.Args, v)
+	c.mu.Lock()
+	for _, s := range c.stacks[g] {
+		fmt.Fprintf(&b, "  %s\n", s)
+	}
+	c.mu.Unlock()
+	fmt.Fprintf(&b, "\ngo stack:\n%s\n", goStack)
+
+	if strings.HasPrefix(c.Target, "http://") || strings.HasPrefix(c.Target, "https://") {
+		resp, err := crashClient.Post(c.Target, "text/plain; charset=utf-8", &b)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s: %s", c.Target, resp.Status)
+		}
+		return nil
+	}
+	f, err := os.OpenFile(c.Target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recoverCrash is deferred around callbacks on goroutine g while crash
+// reporting is on.
+func recoverCrash(c *crashReporter, g uint64) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	// Report once, from the innermost callback, while the panic passes
+	// through the outer ones.
+	c.mu.Lock()
+	done := c.done
+	c.done = true
+	c.mu.Unlock()
+	if !done {
+		if err := c.report(g, v, debug.Stack()); err != nil {
+			fmt.Printf("\033[31mError: \033[1mcrash-reporter: %v\033[m\n", err)
+		}
+	}
+	panic(v)
+}
+
+// guardCallback runs call, reporting a panic in it if crash reporting is on.
+func guardCallback(ps *env.ProgramState, name string, fn env.Function, call func()) {
+	c := crash.Load()
+	if c == nil {
+		call()
+		return
+	}
+	g := goroutineID()
+	c.push(g, ps, name, fn)
+	defer c.pop(g)
+	defer recoverCrash(c, g)
+	call()
+}
+
+var builtinsCrash = map[string]*env.Builtin{
+	"crash-reporter": {
+		Doc:   "Write a report with the Rye callbacks and Go stack when the program panics, to a file or POSTed to an http(s) URL",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			target, err := stringArg(ps, "crash-reporter", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+				f, ferr := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+				if ferr != nil {
+					return failure(ps, "crash-reporter", ferr.Error())
+				}
+				serr := debug.SetCrashOutput(f, debug.CrashOptions{})
+				f.Close()
+				if serr != nil {
+					return failure(ps, "crash-reporter", serr.Error())
+				}
+			}
+			crash.Store(&crashReporter{Target: target})
+			return arg0
+		},
+	},
+}
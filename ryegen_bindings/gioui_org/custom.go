@@ -1,5 +1,7 @@
 // Add your custom builtins to this file.
 
+//go:build !b_no_gioui
+
 package gioui_org
 
 import (
@@ -8,7 +10,91 @@ import (
 	"github.com/refaktor/rye/env"
 )
 
-var builtinsCustom = map[string]*env.Builtin{
+// builtinsCustom joins the builtins below with the ones defined in the other
+// hand-written files of this package.
+var builtinsCustom = mergeBuiltins(
+	builtinsBase,
+	builtinsProgress,
+	builtinsWizard,
+	builtinsBadge,
+	builtinsRating,
+	builtinsNumber,
+	builtinsMasked,
+	builtinsPassword,
+	builtinsSearch,
+	builtinsFocus,
+	builtinsHotkey,
+	builtinsContextMenu,
+	builtinsTooltip,
+	builtinsUndo,
+	builtinsScene,
+	builtinsViewport,
+	builtinsGame,
+	builtinsAtlas,
+	builtinsParticles,
+	builtinsMeasure,
+	builtinsSelectable,
+	builtinsLink,
+	builtinsElided,
+	builtinsFonts,
+	builtinsScreenshot,
+	builtinsRecorder,
+	builtinsPreview,
+	builtinsTestDriver,
+	builtinsReplay,
+	builtinsCrash,
+	builtinsPerf,
+	builtinsRegistry,
+	builtinsNames,
+	builtinsStructs,
+	builtinsOptions,
+	builtinsSlices,
+	builtinsStreams,
+	builtinsEnums,
+	builtinsEvents,
+	builtinsResources,
+	builtinsOpBuilder,
+	builtinsRetained,
+	builtinsPacing,
+	builtinsImageCache,
+	builtinsImageURL,
+	builtinsIconFont,
+	builtinsTheme,
+	builtinsStyle,
+	builtinsShorthand,
+	builtinsGrid,
+	builtinsBaseline,
+	builtinsPopup,
+	builtinsLayers,
+	builtinsSafeArea,
+	builtinsLifecycle,
+	builtinsSingleInstance,
+	builtinsDeepLink,
+	builtinsUpdater,
+	builtinsCompute,
+	builtinsPipeline,
+	builtinsRender,
+	builtinsShader,
+	builtinsSpeech,
+	builtinsSecret,
+	builtinsAuth,
+	builtinsData,
+	builtinsDataSQL,
+	builtinsDataGrid,
+	builtinsTable,
+	builtinsKanban,
+	builtinsNodeEditor,
+	builtinsLogView,
+	builtinsDiffView,
+	builtinsPDFView,
+	builtinsAudio,
+	builtinsDashboard,
+	builtinsHeatmap,
+	builtinsTreemap,
+	builtinsTour,
+)
+
+var builtinsBase = map[string]*env.Builtin{
 	"nil": {
 		Doc: "nil value for go types",
 		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
@@ -16,7 +102,8 @@ var builtinsCustom = map[string]*env.Builtin{
 		},
 	},
 	"kind": {
-		Doc: "underlying kind of a go native",
+		Doc:   "underlying kind of a go native",
+		Argsn: 1,
 		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
 			nat, ok := arg0.(env.Native)
 			if !ok {
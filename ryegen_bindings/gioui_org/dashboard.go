@@ -0,0 +1,613 @@
+// Gauges, meters and sparklines for dashboards.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+const (
+	// gaugeSweep is the angle the arc of gauges spans, open at the bottom.
+	gaugeSweep = 1.5 * math.Pi
+	// dialEase is how long, in seconds, dials take to catch up with most
+	// of a change of value.
+	dialEase = 0.12
+)
+
+// threshold colors values from At up, until the next threshold.
+type threshold struct {
+	At    float64
+	Color color.NRGBA
+}
+
+// dial is what gauges, meters and sparklines share: a value, set or read
+// from a watched word every frame, colored by thresholds, on a range.
+type dial struct {
+	Theme      *material.Theme
+	Min, Max   float64
+	Label      string
+	Unit       string
+	Decimals   int
+	thresholds []threshold
+	value      float64
+	bind       *binding
+	last       env.Object // of the watched word
+	shown      float64    // the value as animated
+	shownAt    time.Time  // when shown was last moved, zero before
+}
+
+func (d *dial) state() *dial { return d }
+
+func (d *dial) SetValue(v float64) { d.value = v }
+
+// Value returns the value, the watched word's if it holds a number.
+func (d *dial) Value() float64 {
+	if v, ok := d.bind.get(); ok {
+		switch v := v.(type) {
+		case env.Integer:
+			d.value = float64(v.Value)
+		case env.Decimal:
+			d.value = v.Value
+		}
+	}
+	return d.value
+}
+
+// color returns the color of the threshold v is in, or the theme's.
+func (d *dial) color(v float64) color.NRGBA {
+	c := d.Theme.ContrastBg
+	for _, t := range d.thresholds {
+		if v >= t.At {
+			c = t.Color
+		}
+	}
+	return c
+}
+
+// fraction returns where v is on the range, from 0 to 1.
+func (d *dial) fraction(v float64) float32 {
+	if d.Max <= d.Min {
+		return 0
+	}
+	return float32(max(0, min((v-d.Min)/(d.Max-d.Min), 1)))
+}
+
+// animate moves the shown value towards v, easing out.
+func (d *dial) animate(gtx layout.Context, v float64) float64 {
+	dt := gtx.Now.Sub(d.shownAt).Seconds()
+	d.shownAt = gtx.Now
+	if dt > 1 || math.Abs(v-d.shown) <= math.Abs(d.Max-d.Min)/1000 {
+		d.shown = v
+		return v
+	}
+	d.shown += (v - d.shown) * (1 - math.Exp(-dt/dialEase))
+	animateFrame(gtx)
+	return d.shown
+}
+
+func (d *dial) format(v float64) string {
+	return strconv.FormatFloat(v, 'f', d.Decimals, 64) + d.Unit
+}
+
+// zones calls fn with the part of the range each threshold colors.
+func (d *dial) zones(fn func(from, to float32, c color.NRGBA)) {
+	for i, t := range d.thresholds {
+		end := d.Max
+		if i+1 < len(d.thresholds) {
+			end = d.thresholds[i+1].At
+		}
+		if end > t.At {
+			fn(d.fraction(t.At), d.fraction(end), t.Color)
+		}
+	}
+}
+
+// strokeArc strokes the arc of a circle from angle a0 by sweep radians,
+// clockwise on screen, as short segments.
+func strokeArc(gtx layout.Context, c f32.Point, r, a0, sweep, width float32, col color.NRGBA) {
+	if sweep <= 0 {
+		return
+	}
+	n := max(int(sweep/(math.Pi/90)), 1)
+	var p clip.Path
+	p.Begin(gtx.Ops)
+	for i := 0; i <= n; i++ {
+		a := float64(a0 + sweep*float32(i)/float32(n))
+		pt := c.Add(f32.Pt(float32(math.Cos(a)), float32(math.Sin(a))).Mul(r))
+		if i == 0 {
+			p.MoveTo(pt)
+		} else {
+			p.LineTo(pt)
+		}
+	}
+	paint.FillShape(gtx.Ops, col, clip.Stroke{Path: p.End(), Width: width}.Op())
+}
+
+// Gauge shows a value as an arc filled from the start of its range, with
+// the value and a label in the middle.
+type Gauge struct {
+	dial
+	Thickness unit.Dp
+}
+
+func (g *Gauge) Layout(gtx layout.Context) layout.Dimensions {
+	th := g.Theme
+	side := min(gtx.Constraints.Max.X, gtx.Constraints.Max.Y)
+	v := g.Value()
+	shown := g.animate(gtx, v)
+
+	width := float32(gtx.Dp(g.Thickness))
+	c := f32.Pt(float32(side)/2, float32(side)/2)
+	r := float32(side)/2 - width/2 - 1
+	start := float32(math.Pi/2 + (2*math.Pi-gaugeSweep)/2)
+	strokeArc(gtx, c, r, start, gaugeSweep, width, mulAlpha(th.Fg, 0x20))
+	g.zones(func(from, to float32, col color.NRGBA) {
+		strokeArc(gtx, c, r+width/2-width/6, start+gaugeSweep*from, gaugeSweep*(to-from), width/3, mulAlpha(col, 0x60))
+	})
+	strokeArc(gtx, c, r, start, gaugeSweep*g.fraction(shown), width, g.color(v))
+
+	// The value in the middle, the label under it.
+	lgtx := gtx
+	lgtx.Constraints = layout.Constraints{Max: image.Pt(side-2*int(width), side)}
+	val := material.Label(th, unit.Sp(float32(side)/gtx.Metric.PxPerSp/5), g.format(v))
+	val.Font.Weight = font.Bold
+	val.Alignment = text.Middle
+	val.MaxLines = 1
+	m := op.Record(gtx.Ops)
+	vd := val.Layout(lgtx)
+	valCall := m.Stop()
+	off := op.Offset(image.Pt((side-vd.Size.X)/2, (side-vd.Size.Y)/2)).Push(gtx.Ops)
+	valCall.Add(gtx.Ops)
+	off.Pop()
+	if g.Label != "" {
+		lbl := material.Caption(th, g.Label)
+		lbl.Color = mulAlpha(th.Fg, 0xb0)
+		lbl.MaxLines = 1
+		m := op.Record(gtx.Ops)
+		ld := lbl.Layout(lgtx)
+		call := m.Stop()
+		off := op.Offset(image.Pt((side-ld.Size.X)/2, (side+vd.Size.Y)/2)).Push(gtx.Ops)
+		call.Add(gtx.Ops)
+		off.Pop()
+	}
+	return layout.Dimensions{Size: image.Pt(side, side)}
+}
+
+// Meter shows a value as a bar filled from the start of its range, with a
+// label and the value above it.
+type Meter struct {
+	dial
+	Thickness unit.Dp
+}
+
+func (m *Meter) Layout(gtx layout.Context) layout.Dimensions {
+	th := m.Theme
+	width := gtx.Constraints.Max.X
+	v := m.Value()
+	shown := m.animate(gtx, v)
+
+	lgtx := gtx
+	lgtx.Constraints.Min = image.Point{}
+	lbl := material.Caption(th, m.Label)
+	lbl.Color = mulAlpha(th.Fg, 0xb0)
+	lbl.MaxLines = 1
+	ld := lbl.Layout(lgtx)
+	val := material.Caption(th, m.format(v))
+	val.Font.Weight = font.Bold
+	val.MaxLines = 1
+	rec := op.Record(gtx.Ops)
+	vd := val.Layout(lgtx)
+	call := rec.Stop()
+	off := op.Offset(image.Pt(width-vd.Size.X, 0)).Push(gtx.Ops)
+	call.Add(gtx.Ops)
+	off.Pop()
+	y := max(ld.Size.Y, vd.Size.Y) + gtx.Dp(2)
+
+	h := gtx.Dp(m.Thickness)
+	bar := image.Rect(0, y, width, y+h)
+	rr := h / 2
+	paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x20), clip.UniformRRect(bar, rr).Op(gtx.Ops))
+	m.zones(func(from, to float32, col color.NRGBA) {
+		z := image.Rect(int(from*float32(width)), y+h-max(h/3, 1), int(to*float32(width)), y+h)
+		paint.FillShape(gtx.Ops, mulAlpha(col, 0x60), clip.Rect(z).Op())
+	})
+	if f := m.fraction(shown); f > 0 {
+		fill := bar
+		fill.Max.X = max(int(f*float32(width)), h)
+		paint.FillShape(gtx.Ops, m.color(v), clip.UniformRRect(fill, rr).Op(gtx.Ops))
+	}
+	return layout.Dimensions{Size: image.Pt(width, y+h)}
+}
+
+// Sparkline shows the latest values of a series as a small line, scaled to
+// their range unless one is set, the last value dotted in the color of its
+// threshold. Values are pushed, set as a block, or taken from a watched word
+// holding a block or, each time it changes, a number.
+type Sparkline struct {
+	dial
+	Capacity int
+	Fill     bool
+	values   []float64
+}
+
+func (s *Sparkline) Push(v float64) {
+	s.values = append(s.values, v)
+	if over := len(s.values) - s.Capacity; over > 0 {
+		s.values = slices.Delete(s.values, 0, over)
+	}
+}
+
+func (s *Sparkline) SetValues(vs []float64) {
+	s.values = slices.Clone(vs[max(len(vs)-s.Capacity, 0):])
+}
+
+// update reads the watched word, if it changed.
+func (s *Sparkline) update() {
+	v, ok := s.bind.get()
+	if !ok || s.last != nil && v.Equal(s.last) {
+		return
+	}
+	s.last = v
+	switch v := v.(type) {
+	case env.Integer:
+		s.Push(float64(v.Value))
+	case env.Decimal:
+		s.Push(v.Value)
+	case env.Block:
+		var vs []float64
+		for _, it := range v.Series.S {
+			switch it := it.(type) {
+			case env.Integer:
+				vs = append(vs, float64(it.Value))
+			case env.Decimal:
+				vs = append(vs, it.Value)
+			}
+		}
+		s.SetValues(vs)
+	}
+}
+
+func (s *Sparkline) Layout(gtx layout.Context) layout.Dimensions {
+	s.update()
+	size := gtx.Constraints.Constrain(image.Pt(gtx.Constraints.Max.X, gtx.Dp(24)))
+	if len(s.values) == 0 || size.X <= 0 {
+		return layout.Dimensions{Size: size}
+	}
+	lo, hi := s.Min, s.Max
+	if hi <= lo {
+		lo, hi = slices.Min(s.values), slices.Max(s.values)
+	}
+	if hi <= lo {
+		lo, hi = lo-1, hi+1
+	}
+	dot := float32(gtx.Dp(2))
+	pad := dot + 1
+	at := func(i int, v float64) f32.Point {
+		x := float32(size.X) - pad
+		if n := s.Capacity; n > 1 {
+			x = pad + (float32(size.X)-2*pad)*float32(i+n-len(s.values))/float32(n-1)
+		}
+		f := float32(max(0, min((v-lo)/(hi-lo), 1)))
+		return f32.Pt(x, pad+(float32(size.Y)-2*pad)*(1-f))
+	}
+	last := s.values[len(s.values)-1]
+	col := s.color(last)
+	if len(s.values) > 1 {
+		var line, area clip.Path
+		line.Begin(gtx.Ops)
+		for i, v := range s.values {
+			if i == 0 {
+				line.MoveTo(at(i, v))
+			} else {
+				line.LineTo(at(i, v))
+			}
+		}
+		if s.Fill {
+			area.Begin(gtx.Ops)
+			bottom := float32(size.Y)
+			area.MoveTo(f32.Pt(at(0, s.values[0]).X, bottom))
+			for i, v := range s.values {
+				area.LineTo(at(i, v))
+			}
+			area.LineTo(f32.Pt(at(len(s.values)-1, last).X, bottom))
+			area.Close()
+			paint.FillShape(gtx.Ops, mulAlpha(col, 0x30), clip.Outline{Path: area.End()}.Op())
+		}
+		paint.FillShape(gtx.Ops, mulAlpha(col, 0xc0), clip.Stroke{Path: line.End(), Width: float32(gtx.Dp(1.5))}.Op())
+	}
+	p := at(len(s.values)-1, last)
+	r := image.Rectangle{Min: p.Sub(f32.Pt(dot, dot)).Round(), Max: p.Add(f32.Pt(dot, dot)).Round()}
+	paint.FillShape(gtx.Ops, col, clip.Ellipse(r).Op(gtx.Ops))
+	return layout.Dimensions{Size: size}
+}
+
+// dialWidget is a widget showing a dial.
+type dialWidget interface {
+	Layout(gtx layout.Context) layout.Dimensions
+	state() *dial
+}
+
+// thresholdsArg accepts a block of values and the colors from them up.
+func thresholdsArg(ps *env.ProgramState, name string, n int, arg env.Object) ([]threshold, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok || len(blk.Series.S)%2 != 0 {
+		return nil, argError(ps, name, n, "block of values and colors", arg)
+	}
+	var ts []threshold
+	for i := 0; i < len(blk.Series.S); i += 2 {
+		at, err := decimalArg(ps, name, n, blk.Series.S[i])
+		if err != nil {
+			return nil, err
+		}
+		c, err := colorArg(ps, name, n, blk.Series.S[i+1])
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, threshold{At: at, Color: c})
+	}
+	slices.SortStableFunc(ts, func(a, b threshold) int {
+		switch {
+		case a.At < b.At:
+			return -1
+		case a.At > b.At:
+			return 1
+		}
+		return 0
+	})
+	return ts, nil
+}
+
+// dialBuiltins returns the builtins every dial widget of kind has.
+func dialBuiltins[T dialWidget](kind string) map[string]*env.Builtin {
+	method := func(name, doc string, argsn int, fn func(ps *env.ProgramState, name string, d *dial, arg1, arg2 env.Object) env.Object) *env.Builtin {
+		name = kind + "//" + name
+		return &env.Builtin{
+			Doc:   doc,
+			Argsn: argsn,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				w, err := nativeArg[T](ps, name, 1, arg0)
+				if err != nil {
+					return err
+				}
+				if res := fn(ps, name, w.state(), arg1, arg2); res != nil {
+					return res
+				}
+				return arg0
+			},
+		}
+	}
+	return map[string]*env.Builtin{
+		kind + "//layout": layoutBuiltin[T](kind + "//layout"),
+		kind + "//watch!": method("watch!", "Show the value of a word, read every frame; sparklines add each number it changes to, or show a block of them", 2, func(ps *env.ProgramState, name string, d *dial, arg1, _ env.Object) env.Object {
+			b, err := bindingArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			d.bind, d.last = b, nil
+			return nil
+		}),
+		kind + "//thresholds!": method("thresholds!", "Set the colors of values from thresholds up, as a block of thresholds and colors, like { 70 \"#f9a825\" 90 \"#d32f2f\" }", 2, func(ps *env.ProgramState, name string, d *dial, arg1, _ env.Object) env.Object {
+			ts, err := thresholdsArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			d.thresholds = ts
+			return nil
+		}),
+		kind + "//range!": method("range!", "Set the values at the start and the end of the scale", 3, func(ps *env.ProgramState, name string, d *dial, arg1, arg2 env.Object) env.Object {
+			lo, err := decimalArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			hi, err := decimalArg(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			d.Min, d.Max = lo, hi
+			return nil
+		}),
+		kind + "//label!": method("label!", "Set the label shown with the value", 2, func(ps *env.ProgramState, name string, d *dial, arg1, _ env.Object) env.Object {
+			s, err := stringArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			d.Label = s
+			return nil
+		}),
+		kind + "//format!": method("format!", "Set the decimals the value is shown with and the unit after it", 3, func(ps *env.ProgramState, name string, d *dial, arg1, arg2 env.Object) env.Object {
+			n, err := integerArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			u, err := stringArg(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			d.Decimals, d.Unit = int(max(n, 0)), u
+			return nil
+		}),
+	}
+}
+
+// newDialBuiltin returns a builtin creating a gauge or meter with a range.
+func newDialBuiltin(name, doc, kind string, create func(d dial) any) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			lo, err := decimalArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			hi, err := decimalArg(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, create(dial{Theme: th, Min: lo, Max: hi, value: lo}), kind)
+		},
+	}
+}
+
+// valueBuiltins returns the builtins setting and getting the value of a
+// gauge or meter.
+func valueBuiltins[T dialWidget](kind string) map[string]*env.Builtin {
+	return map[string]*env.Builtin{
+		kind + "//value!": {
+			Doc:   "Set the value shown, unless bound to a word",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				w, err := nativeArg[T](ps, kind+"//value!", 1, arg0)
+				if err != nil {
+					return err
+				}
+				v, err := decimalArg(ps, kind+"//value!", 2, arg1)
+				if err != nil {
+					return err
+				}
+				w.state().SetValue(v)
+				return arg0
+			},
+		},
+		kind + "//value?": {
+			Doc:   "Get the value shown",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				w, err := nativeArg[T](ps, kind+"//value?", 1, arg0)
+				if err != nil {
+					return err
+				}
+				return *env.NewDecimal(w.state().Value())
+			},
+		},
+	}
+}
+
+var builtinsDashboard = mergeBuiltins(
+	dialBuiltins[*Gauge]("Go(*gioui_org.Gauge)"),
+	dialBuiltins[*Meter]("Go(*gioui_org.Meter)"),
+	dialBuiltins[*Sparkline]("Go(*gioui_org.Sparkline)"),
+	valueBuiltins[*Gauge]("Go(*gioui_org.Gauge)"),
+	valueBuiltins[*Meter]("Go(*gioui_org.Meter)"),
+	map[string]*env.Builtin{
+		"gauge": newDialBuiltin("gauge", "Create a radial gauge of a value from a minimum to a maximum; set the value with value! or watch! a word holding it", "Go(*gioui_org.Gauge)", func(d dial) any {
+			return &Gauge{dial: d, Thickness: 10}
+		}),
+		"meter": newDialBuiltin("meter", "Create a linear meter of a value from a minimum to a maximum; set the value with value! or watch! a word holding it", "Go(*gioui_org.Meter)", func(d dial) any {
+			return &Meter{dial: d, Thickness: 8}
+		}),
+		"sparkline": {
+			Doc:   "Create a sparkline of the last values of a series, 60 by default; push them, set them as a block with values! or watch! a word holding them",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				th, err := nativeArg[*material.Theme](ps, "sparkline", 1, arg0)
+				if err != nil {
+					return err
+				}
+				return *env.NewNative(ps.Idx, &Sparkline{dial: dial{Theme: th}, Capacity: 60}, "Go(*gioui_org.Sparkline)")
+			},
+		},
+		"Go(*gioui_org.Sparkline)//push": {
+			Doc:   "Add a value, dropping the oldest past the capacity",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				s, err := nativeArg[*Sparkline](ps, "Go(*gioui_org.Sparkline)//push", 1, arg0)
+				if err != nil {
+					return err
+				}
+				v, err := decimalArg(ps, "Go(*gioui_org.Sparkline)//push", 2, arg1)
+				if err != nil {
+					return err
+				}
+				s.Push(v)
+				return arg0
+			},
+		},
+		"Go(*gioui_org.Sparkline)//values!": {
+			Doc:   "Replace the values with a block of numbers",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				s, err := nativeArg[*Sparkline](ps, "Go(*gioui_org.Sparkline)//values!", 1, arg0)
+				if err != nil {
+					return err
+				}
+				vs, _, err := numbersArg(ps, "Go(*gioui_org.Sparkline)//values!", 2, arg1)
+				if err != nil {
+					return err
+				}
+				s.SetValues(vs)
+				return arg0
+			},
+		},
+		"Go(*gioui_org.Sparkline)//values?": {
+			Doc:   "Get a block of the values shown",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				s, err := nativeArg[*Sparkline](ps, "Go(*gioui_org.Sparkline)//values?", 1, arg0)
+				if err != nil {
+					return err
+				}
+				s.update()
+				return numbersObj(s.values, false)
+			},
+		},
+		"Go(*gioui_org.Sparkline)//capacity!": {
+			Doc:   "Set how many of the last values are shown",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				s, err := nativeArg[*Sparkline](ps, "Go(*gioui_org.Sparkline)//capacity!", 1, arg0)
+				if err != nil {
+					return err
+				}
+				n, err := integerArg(ps, "Go(*gioui_org.Sparkline)//capacity!", 2, arg1)
+				if err != nil {
+					return err
+				}
+				if n < 1 {
+					return failure(ps, "Go(*gioui_org.Sparkline)//capacity!", "capacity must be positive")
+				}
+				s.Capacity = int(n)
+				s.SetValues(s.values)
+				return arg0
+			},
+		},
+		"Go(*gioui_org.Sparkline)//fill!": {
+			Doc:   "Set whether the area under the line is filled",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				s, err := nativeArg[*Sparkline](ps, "Go(*gioui_org.Sparkline)//fill!", 1, arg0)
+				if err != nil {
+					return err
+				}
+				b, err := integerArg(ps, "Go(*gioui_org.Sparkline)//fill!", 2, arg1)
+				if err != nil {
+					return err
+				}
+				s.Fill = b != 0
+				return arg0
+			},
+		},
+	},
+)
@@ -0,0 +1,456 @@
+// Row models and the list and table widgets showing them.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// TableModel is rows of values under named columns, as data-list and
+// data-table show them. Widgets ask for the rows they show as they lay
+// out, so a model can fetch them lazily and hold more than fits in
+// memory.
+type TableModel interface {
+	Columns() []string
+	Len() int
+	// Row returns the values of row i, from 0, or nil if it can't be
+	// read (yet: a model may read it in the background and invalidate the
+	// window).
+	Row(i int) []any
+}
+
+// EditableModel is a model whose cells can be changed.
+type EditableModel interface {
+	TableModel
+	Set(row, col int, v any) error
+}
+
+// RowsModel is a data model of rows held in memory.
+type RowsModel struct {
+	mu   sync.Mutex
+	cols []string
+	rows [][]any
+}
+
+func (m *RowsModel) Columns() []string {
+	return m.cols
+}
+
+func (m *RowsModel) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.rows)
+}
+
+func (m *RowsModel) Row(i int) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i < 0 || i >= len(m.rows) {
+		return nil
+	}
+	return m.rows[i]
+}
+
+func (m *RowsModel) Set(row, col int, v any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if row < 0 || row >= len(m.rows) || col < 0 || col >= len(m.cols) {
+		return fmt.Errorf("no cell %d %d", row, col)
+	}
+	m.rows[row][col] = v
+	return nil
+}
+
+// cellObj converts a value of a model to Rye.
+func cellObj(v any) env.Object {
+	switch v := v.(type) {
+	case nil:
+		return env.Void{}
+	case []byte:
+		return *env.NewString(string(v))
+	case bool:
+		return *env.NewInteger(boolToInt64(v))
+	case int:
+		return *env.NewInteger(int64(v))
+	case int32:
+		return *env.NewInteger(int64(v))
+	case float32:
+		return *env.NewDecimal(float64(v))
+	}
+	return env.ToRyeValue(v)
+}
+
+// cellValue converts a Rye value to one a model stores.
+func cellValue(ps *env.ProgramState, name string, n int, arg env.Object) (any, *env.Error) {
+	switch v := arg.(type) {
+	case env.Void:
+		return nil, nil
+	case env.Integer:
+		return v.Value, nil
+	case env.Decimal:
+		return v.Value, nil
+	case env.String:
+		return v.Value, nil
+	}
+	return nil, argError(ps, name, n, "integer, decimal, string or void", arg)
+}
+
+// cellText formats a value of a model for display.
+func cellText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.DateTime)
+	}
+	return fmt.Sprint(v)
+}
+
+// rowObj returns a dict of a row by column name.
+func rowObj(m TableModel, i int) env.Object {
+	vals := m.Row(i)
+	d := map[string]any{}
+	for c, name := range m.Columns() {
+		if c < len(vals) {
+			d[name] = cellObj(vals[c])
+		}
+	}
+	return *env.NewDict(d)
+}
+
+// DataList lays out the rows of a model with a Rye function of the layout
+// context, the row as a dict and its index.
+type DataList struct {
+	ps    *env.ProgramState
+	Model TableModel
+	fn    env.Function
+	list  layout.List
+}
+
+func (l *DataList) Layout(gtx layout.Context) layout.Dimensions {
+	l.list.Axis = layout.Vertical
+	return l.list.Layout(gtx, l.Model.Len(), func(gtx layout.Context, i int) layout.Dimensions {
+		res := callFunction(l.ps, "data-list", l.fn, *env.NewNative(l.ps.Idx, &gtx, "Go(*layout.Context)"), rowObj(l.Model, i), *env.NewInteger(int64(i)))
+		if v, ok := res.(env.Native); ok {
+			if dims, ok := v.Value.(*layout.Dimensions); ok {
+				return *dims
+			}
+		}
+		return layout.Dimensions{}
+	})
+}
+
+// DataTable shows the rows of a model under a header of its columns, one
+// line of text per cell, scrolling the rows.
+type DataTable struct {
+	Model  TableModel
+	Theme  *material.Theme
+	Widths []unit.Dp // of the columns; the ones not given share the space left
+	list   widget.List
+}
+
+// columnWidths returns the widths in pixels of n columns across width, the
+// first ones fixed and the others sharing the space left.
+func columnWidths(gtx layout.Context, fixed []unit.Dp, n, width int) []int {
+	ws := make([]int, n)
+	left, flexible := width, 0
+	for i := range ws {
+		if i < len(fixed) {
+			ws[i] = gtx.Dp(fixed[i])
+			left -= ws[i]
+		} else {
+			flexible++
+		}
+	}
+	for i := len(fixed); i < n; i++ {
+		ws[i] = max(left/flexible, gtx.Dp(40))
+	}
+	return ws
+}
+
+// cellPadding is the space around the text of a cell.
+const cellPadding = unit.Dp(6)
+
+// rowHeight is the height of a line of cells.
+func rowHeight(gtx layout.Context, th *material.Theme) int {
+	return gtx.Sp(th.TextSize)*14/10 + 2*gtx.Dp(cellPadding)
+}
+
+// layoutCellText lays out a line of text in the cell at x of width w.
+func layoutCellText(gtx layout.Context, th *material.Theme, s string, x, w, h int, weight font.Weight) {
+	pad := gtx.Dp(cellPadding)
+	cell := clip.Rect{Min: image.Pt(x, 0), Max: image.Pt(x+w, h)}.Push(gtx.Ops)
+	off := op.Offset(image.Pt(x+pad, pad)).Push(gtx.Ops)
+	gtx.Constraints = layout.Constraints{Max: image.Pt(max(w-2*pad, 0), h-2*pad)}
+	l := material.Body2(th, s)
+	l.MaxLines = 1
+	l.Font.Weight = weight
+	l.Layout(gtx)
+	off.Pop()
+	cell.Pop()
+}
+
+// row lays out a line of cells in columns of widths.
+func (t *DataTable) row(gtx layout.Context, cells []string, widths []int, weight font.Weight, bg color.NRGBA) layout.Dimensions {
+	size := image.Pt(gtx.Constraints.Max.X, rowHeight(gtx, t.Theme))
+	if bg.A > 0 {
+		paint.FillShape(gtx.Ops, bg, clip.Rect{Max: size}.Op())
+	}
+	x := 0
+	for i, s := range cells {
+		layoutCellText(gtx, t.Theme, s, x, widths[i], size.Y, weight)
+		x += widths[i]
+	}
+	return layout.Dimensions{Size: size}
+}
+
+func (t *DataTable) Layout(gtx layout.Context) layout.Dimensions {
+	cols := t.Model.Columns()
+	widths := columnWidths(gtx, t.Widths, len(cols), gtx.Constraints.Max.X)
+	header := mulAlpha(t.Theme.Fg, 0x18)
+	stripe := mulAlpha(t.Theme.Fg, 0x0a)
+	t.list.Axis = layout.Vertical
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return t.row(gtx, cols, widths, font.Bold, header)
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return material.List(t.Theme, &t.list).Layout(gtx, t.Model.Len(), func(gtx layout.Context, i int) layout.Dimensions {
+				vals := t.Model.Row(i)
+				cells := make([]string, len(cols))
+				for c := range cells {
+					if c < len(vals) {
+						cells[c] = cellText(vals[c])
+					}
+				}
+				var bg color.NRGBA
+				if i%2 == 1 {
+					bg = stripe
+				}
+				return t.row(gtx, cells, widths, font.Normal, bg)
+			})
+		}),
+	)
+}
+
+// modelArg accepts a native of any model.
+func modelArg(ps *env.ProgramState, name string, n int, arg env.Object) (TableModel, *env.Error) {
+	if nat, ok := arg.(env.Native); ok {
+		if m, ok := nat.Value.(TableModel); ok {
+			return m, nil
+		}
+	}
+	return nil, argError(ps, name, n, "data model", arg)
+}
+
+// columnArg accepts the name of a column of m and returns its index.
+func columnArg(ps *env.ProgramState, name string, n int, m TableModel, arg env.Object) (int, *env.Error) {
+	col, err := nameArg(ps, name, n, arg)
+	if err != nil {
+		return 0, err
+	}
+	for i, c := range m.Columns() {
+		if c == col {
+			return i, nil
+		}
+	}
+	return 0, failure(ps, name, fmt.Sprintf("no column %q (%s)", col, strings.Join(m.Columns(), " ")))
+}
+
+// rowArg accepts the index of a row of m.
+func rowArg(ps *env.ProgramState, name string, n int, m TableModel, arg env.Object) (int, *env.Error) {
+	i, err := integerArg(ps, name, n, arg)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || int(i) >= m.Len() {
+		return 0, failure(ps, name, fmt.Sprintf("row %d out of range (%d rows)", i, m.Len()))
+	}
+	return int(i), nil
+}
+
+// modelBuiltins returns the builtins every model of kind has; set is
+// there for editable models.
+func modelBuiltins[T TableModel](kind string) map[string]*env.Builtin {
+	bs := map[string]*env.Builtin{
+		kind + "//count?": {
+			Doc:   "Get the number of rows",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				m, err := nativeArg[T](ps, kind+"//count?", 1, arg0)
+				if err != nil {
+					return err
+				}
+				return *env.NewInteger(int64(m.Len()))
+			},
+		},
+		kind + "//column-names?": {
+			Doc:   "Get a block of the names of the columns",
+			Argsn: 1,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				m, err := nativeArg[T](ps, kind+"//column-names?", 1, arg0)
+				if err != nil {
+					return err
+				}
+				return argsObj(ps, m.Columns())
+			},
+		},
+		kind + "//row": {
+			Doc:   "Get a dict of a row (from 0) by column",
+			Argsn: 2,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				m, err := nativeArg[T](ps, kind+"//row", 1, arg0)
+				if err != nil {
+					return err
+				}
+				i, err := rowArg(ps, kind+"//row", 2, m, arg1)
+				if err != nil {
+					return err
+				}
+				return rowObj(m, i)
+			},
+		},
+	}
+	var m T
+	if _, ok := any(m).(EditableModel); ok {
+		bs[kind+"//set"] = &env.Builtin{
+			Doc:   "Change the value of a column of a row (from 0)",
+			Argsn: 4,
+			Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				name := kind + "//set"
+				m, err := nativeArg[T](ps, name, 1, arg0)
+				if err != nil {
+					return err
+				}
+				i, err := rowArg(ps, name, 2, m, arg1)
+				if err != nil {
+					return err
+				}
+				c, err := columnArg(ps, name, 3, m, arg2)
+				if err != nil {
+					return err
+				}
+				v, err := cellValue(ps, name, 4, arg3)
+				if err != nil {
+					return err
+				}
+				if serr := any(m).(EditableModel).Set(i, c, v); serr != nil {
+					return failure(ps, name, serr.Error())
+				}
+				return arg0
+			},
+		}
+	}
+	return bs
+}
+
+var builtinsData = mergeBuiltins(modelBuiltins[*RowsModel]("Go(*gioui_org.RowsModel)"), map[string]*env.Builtin{
+	"data-rows": {
+		Doc:   "Create an editable data model from a block of column names and a block of rows, each a block of values",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			cols, err := sliceArg[string](ps, "data-rows", 1, arg0)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg1.(env.Block)
+			if !ok {
+				return argError(ps, "data-rows", 2, "block of rows", arg1)
+			}
+			m := &RowsModel{cols: cols}
+			for i, it := range blk.Series.S {
+				r, ok := it.(env.Block)
+				if !ok || len(r.Series.S) > len(cols) {
+					return failure(ps, "data-rows", fmt.Sprintf("row %d: expected a block of at most %d values", i+1, len(cols)))
+				}
+				row := make([]any, len(cols))
+				for c, v := range r.Series.S {
+					if row[c], err = cellValue(ps, "data-rows", 2, v); err != nil {
+						return err
+					}
+				}
+				m.rows = append(m.rows, row)
+			}
+			return *env.NewNative(ps.Idx, m, "Go(*gioui_org.RowsModel)")
+		},
+	},
+	"data-list": {
+		Doc:   "Create a scrolling list of the rows of a data model, each laid out by a function of the layout context, the row as a dict and its index (from 0)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := modelArg(ps, "data-list", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "data-list", 2, 3, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &DataList{ps: ps, Model: m, fn: fn}, "Go(*gioui_org.DataList)")
+		},
+	},
+	"Go(*gioui_org.DataList)//layout": layoutBuiltin[*DataList]("Go(*gioui_org.DataList)//layout"),
+	"data-table": {
+		Doc:   "Create a table of the rows of a data model under a header of its columns",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "data-table", 1, arg0)
+			if err != nil {
+				return err
+			}
+			m, err := modelArg(ps, "data-table", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &DataTable{Model: m, Theme: th}, "Go(*gioui_org.DataTable)")
+		},
+	},
+	"Go(*gioui_org.DataTable)//layout": layoutBuiltin[*DataTable]("Go(*gioui_org.DataTable)//layout"),
+	"Go(*gioui_org.DataTable)//widths!": {
+		Doc:   "Set the widths in dp of the first columns; the others share the space left",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*DataTable](ps, "Go(*gioui_org.DataTable)//widths!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			ws, err := sliceArg[unit.Dp](ps, "Go(*gioui_org.DataTable)//widths!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			t.Widths = ws
+			return arg0
+		},
+	},
+})
@@ -0,0 +1,590 @@
+// Spreadsheet-like grids editing the cells of data models.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gioui.org/font"
+	"gioui.org/io/clipboard"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/io/transfer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// doubleClick is the longest time between the presses of a double click.
+const doubleClick = 400 * time.Millisecond
+
+// DataGrid shows the cells of a data model like a spreadsheet. The arrow
+// keys, tab and enter move the current cell, with shift extending the
+// selection, which the mouse drags too. Typing, F2 or a double click edits
+// the cell; enter or tab keeps the edit and escape drops it. Ctrl-C and
+// ctrl-V copy and paste the selection as tab-separated lines, like
+// spreadsheets do, and delete clears it. Edits are written to editable
+// models and passed to the change function.
+type DataGrid struct {
+	ps       *env.ProgramState
+	Model    TableModel
+	Theme    *material.Theme
+	Widths   []unit.Dp
+	onChange *env.Function
+
+	// cursor is the column and row of the current cell, anchor the other
+	// corner of the selection.
+	cursor, anchor image.Point
+	editing        bool
+	editor         widget.Editor
+	list           widget.List
+	focused        bool
+	dragging       bool
+	lastPress      time.Duration
+	widths         []int
+	rowHeight      int
+	visibleRows    int
+	err            error
+}
+
+func (g *DataGrid) FocusTag() event.Tag { return g }
+
+// selection returns the selected cells.
+func (g *DataGrid) selection() image.Rectangle {
+	r := image.Rectangle{Min: g.cursor, Max: g.anchor}.Canon()
+	r.Max = r.Max.Add(image.Pt(1, 1))
+	return r
+}
+
+// clamp keeps p in the model's cells.
+func (g *DataGrid) clamp(p image.Point) image.Point {
+	return image.Pt(
+		max(0, min(p.X, len(g.Model.Columns())-1)),
+		max(0, min(p.Y, g.Model.Len()-1)),
+	)
+}
+
+// moveTo makes p the current cell, extending the selection to it or
+// starting a new one, and scrolls to it.
+func (g *DataGrid) moveTo(p image.Point, extend bool) {
+	g.cursor = g.clamp(p)
+	if !extend {
+		g.anchor = g.cursor
+	}
+	pos := &g.list.Position
+	switch {
+	case g.cursor.Y < pos.First || g.cursor.Y == pos.First && pos.Offset > 0:
+		pos.First, pos.Offset = g.cursor.Y, 0
+	case g.visibleRows > 0 && g.cursor.Y >= pos.First+g.visibleRows:
+		pos.First, pos.Offset = g.cursor.Y-g.visibleRows+1, 0
+	}
+}
+
+// cellAt returns the column and row at a position, row -1 in the header.
+func (g *DataGrid) cellAt(pos image.Point) image.Point {
+	col, x := 0, 0
+	for col < len(g.widths)-1 && pos.X >= x+g.widths[col] {
+		x += g.widths[col]
+		col++
+	}
+	y := pos.Y - g.rowHeight
+	if y < 0 || g.rowHeight == 0 {
+		return image.Pt(col, -1)
+	}
+	return image.Pt(col, g.list.Position.First+(y+g.list.Position.Offset)/g.rowHeight)
+}
+
+func (g *DataGrid) cellValue(p image.Point) any {
+	row := g.Model.Row(p.Y)
+	if p.X < len(row) {
+		return row[p.X]
+	}
+	return nil
+}
+
+// parseCell reads text typed into a cell, keeping the type of the value it
+// replaces where it fits.
+func parseCell(s string, old any) any {
+	if s == "" {
+		return nil
+	}
+	switch old.(type) {
+	case string, []byte:
+		return s
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// set changes a cell, in the model if it is editable, and passes the
+// change on.
+func (g *DataGrid) set(p image.Point, v any) {
+	if m, ok := g.Model.(EditableModel); ok {
+		if err := m.Set(p.Y, p.X, v); err != nil {
+			g.err = err
+			return
+		}
+	}
+	g.err = nil
+	if g.onChange != nil {
+		callFunction(g.ps, "data-grid on-change", *g.onChange, *env.NewInteger(int64(p.Y)), *env.NewString(g.Model.Columns()[p.X]), cellObj(v))
+	}
+}
+
+func (g *DataGrid) startEdit(gtx layout.Context, text string) {
+	if g.Model.Len() == 0 {
+		return
+	}
+	g.editing = true
+	g.anchor = g.cursor
+	g.editor.SetText(text)
+	n := utf8.RuneCountInString(text)
+	g.editor.SetCaret(n, n)
+	gtx.Execute(key.FocusCmd{Tag: &g.editor})
+}
+
+// endEdit leaves editing, keeping the edit if commit is set.
+func (g *DataGrid) endEdit(gtx layout.Context, commit bool) {
+	if !g.editing {
+		return
+	}
+	g.editing = false
+	if commit {
+		old := g.cellValue(g.cursor)
+		if v := parseCell(g.editor.Text(), old); v != old {
+			g.set(g.cursor, v)
+		}
+	}
+	gtx.Execute(key.FocusCmd{Tag: g})
+}
+
+// copyText returns the selected cells as tab-separated lines.
+func (g *DataGrid) copyText() string {
+	sel := g.selection()
+	var b strings.Builder
+	for y := sel.Min.Y; y < sel.Max.Y; y++ {
+		row := g.Model.Row(y)
+		for x := sel.Min.X; x < sel.Max.X; x++ {
+			if x > sel.Min.X {
+				b.WriteByte('\t')
+			}
+			if x < len(row) {
+				b.WriteString(cellText(row[x]))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// paste sets the cells from the top left of the selection to tab-separated
+// lines, selecting the ones set.
+func (g *DataGrid) paste(text string) {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" || g.Model.Len() == 0 {
+		return
+	}
+	at := g.selection().Min
+	end := at
+	for dy, line := range strings.Split(text, "\n") {
+		for dx, s := range strings.Split(line, "\t") {
+			p := at.Add(image.Pt(dx, dy))
+			if p != g.clamp(p) {
+				continue
+			}
+			end = image.Pt(max(end.X, p.X), max(end.Y, p.Y))
+			if old := g.cellValue(p); parseCell(s, old) != old {
+				g.set(p, parseCell(s, old))
+			}
+		}
+	}
+	g.anchor, g.cursor = at, end
+}
+
+// clear empties the selected cells.
+func (g *DataGrid) clear() {
+	sel := g.selection()
+	for y := sel.Min.Y; y < sel.Max.Y; y++ {
+		for x := sel.Min.X; x < sel.Max.X; x++ {
+			if p := image.Pt(x, y); g.cellValue(p) != nil {
+				g.set(p, nil)
+			}
+		}
+	}
+}
+
+func (g *DataGrid) key(gtx layout.Context, e key.Event) {
+	extend := e.Modifiers.Contain(key.ModShift)
+	jump := e.Modifiers.Contain(key.ModShortcut)
+	last := image.Pt(len(g.Model.Columns())-1, g.Model.Len()-1)
+	switch e.Name {
+	case key.NameUpArrow:
+		if jump {
+			g.moveTo(image.Pt(g.cursor.X, 0), extend)
+		} else {
+			g.moveTo(g.cursor.Add(image.Pt(0, -1)), extend)
+		}
+	case key.NameDownArrow:
+		if jump {
+			g.moveTo(image.Pt(g.cursor.X, last.Y), extend)
+		} else {
+			g.moveTo(g.cursor.Add(image.Pt(0, 1)), extend)
+		}
+	case key.NameLeftArrow:
+		if jump {
+			g.moveTo(image.Pt(0, g.cursor.Y), extend)
+		} else {
+			g.moveTo(g.cursor.Add(image.Pt(-1, 0)), extend)
+		}
+	case key.NameRightArrow:
+		if jump {
+			g.moveTo(image.Pt(last.X, g.cursor.Y), extend)
+		} else {
+			g.moveTo(g.cursor.Add(image.Pt(1, 0)), extend)
+		}
+	case key.NamePageUp:
+		g.moveTo(g.cursor.Add(image.Pt(0, -max(g.visibleRows-1, 1))), extend)
+	case key.NamePageDown:
+		g.moveTo(g.cursor.Add(image.Pt(0, max(g.visibleRows-1, 1))), extend)
+	case key.NameHome:
+		if jump {
+			g.moveTo(image.Point{}, extend)
+		} else {
+			g.moveTo(image.Pt(0, g.cursor.Y), extend)
+		}
+	case key.NameEnd:
+		if jump {
+			g.moveTo(last, extend)
+		} else {
+			g.moveTo(image.Pt(last.X, g.cursor.Y), extend)
+		}
+	case key.NameTab:
+		g.tab(extend)
+	case key.NameReturn, key.NameEnter:
+		if extend {
+			g.moveTo(g.cursor.Add(image.Pt(0, -1)), false)
+		} else {
+			g.moveTo(g.cursor.Add(image.Pt(0, 1)), false)
+		}
+	case key.NameF2:
+		g.startEdit(gtx, cellText(g.cellValue(g.cursor)))
+	case key.NameDeleteBackward, key.NameDeleteForward:
+		g.clear()
+	case "A":
+		g.anchor, g.cursor = image.Point{}, last
+	case "C", "X":
+		gtx.Execute(clipboard.WriteCmd{Type: "application/text", Data: io.NopCloser(strings.NewReader(g.copyText()))})
+		if e.Name == "X" {
+			g.clear()
+		}
+	case "V":
+		gtx.Execute(clipboard.ReadCmd{Tag: g})
+	}
+}
+
+// tab moves to the next cell of the row, or the previous one backwards,
+// wrapping around to the next or previous row.
+func (g *DataGrid) tab(backwards bool) {
+	n := len(g.Model.Columns())
+	p := g.cursor
+	if backwards {
+		if p.X--; p.X < 0 && p.Y > 0 {
+			p = image.Pt(n-1, p.Y-1)
+		}
+	} else {
+		if p.X++; p.X >= n && p.Y < g.Model.Len()-1 {
+			p = image.Pt(0, p.Y+1)
+		}
+	}
+	g.moveTo(p, false)
+}
+
+func (g *DataGrid) pointer(gtx layout.Context, e pointer.Event) {
+	switch e.Kind {
+	case pointer.Press:
+		if !e.Buttons.Contain(pointer.ButtonPrimary) {
+			return
+		}
+		g.endEdit(gtx, true)
+		gtx.Execute(key.FocusCmd{Tag: g})
+		if g.Model.Len() == 0 {
+			return
+		}
+		cell := g.cellAt(e.Position.Round())
+		if cell.Y < 0 {
+			// The header selects the column.
+			g.anchor = image.Pt(cell.X, 0)
+			g.cursor = image.Pt(cell.X, g.Model.Len()-1)
+			return
+		}
+		cell = g.clamp(cell)
+		double := cell == g.cursor && e.Time-g.lastPress < doubleClick
+		g.lastPress = e.Time
+		g.moveTo(cell, e.Modifiers.Contain(key.ModShift))
+		g.dragging = true
+		if double {
+			g.startEdit(gtx, cellText(g.cellValue(g.cursor)))
+		}
+	case pointer.Drag:
+		if g.dragging {
+			cell := g.cellAt(e.Position.Round())
+			cell.Y = max(cell.Y, 0)
+			g.moveTo(cell, true)
+		}
+	case pointer.Release, pointer.Cancel:
+		g.dragging = false
+	}
+}
+
+func (g *DataGrid) update(gtx layout.Context) {
+	if g.editing {
+		for {
+			e, ok := gtx.Event(
+				key.Filter{Focus: &g.editor, Name: key.NameTab, Optional: key.ModShift},
+				key.Filter{Focus: &g.editor, Name: key.NameEscape},
+			)
+			if !ok {
+				break
+			}
+			if e, ok := e.(key.Event); ok && e.State == key.Press {
+				g.endEdit(gtx, e.Name == key.NameTab)
+				if e.Name == key.NameTab {
+					g.tab(e.Modifiers.Contain(key.ModShift))
+				}
+			}
+		}
+		for {
+			e, ok := g.editor.Update(gtx)
+			if !ok {
+				break
+			}
+			if _, ok := e.(widget.SubmitEvent); ok {
+				g.endEdit(gtx, true)
+				g.moveTo(g.cursor.Add(image.Pt(0, 1)), false)
+			}
+		}
+	}
+	nav := key.ModShift | key.ModShortcut
+	for {
+		e, ok := gtx.Event(
+			key.FocusFilter{Target: g},
+			pointer.Filter{Target: g, Kinds: pointer.Press | pointer.Drag | pointer.Release | pointer.Cancel},
+			transfer.TargetFilter{Target: g, Type: "application/text"},
+			key.Filter{Focus: g, Name: key.NameUpArrow, Optional: nav},
+			key.Filter{Focus: g, Name: key.NameDownArrow, Optional: nav},
+			key.Filter{Focus: g, Name: key.NameLeftArrow, Optional: nav},
+			key.Filter{Focus: g, Name: key.NameRightArrow, Optional: nav},
+			key.Filter{Focus: g, Name: key.NamePageUp, Optional: key.ModShift},
+			key.Filter{Focus: g, Name: key.NamePageDown, Optional: key.ModShift},
+			key.Filter{Focus: g, Name: key.NameHome, Optional: nav},
+			key.Filter{Focus: g, Name: key.NameEnd, Optional: nav},
+			key.Filter{Focus: g, Name: key.NameTab, Optional: key.ModShift},
+			key.Filter{Focus: g, Name: key.NameReturn, Optional: key.ModShift},
+			key.Filter{Focus: g, Name: key.NameEnter, Optional: key.ModShift},
+			key.Filter{Focus: g, Name: key.NameF2},
+			key.Filter{Focus: g, Name: key.NameDeleteBackward},
+			key.Filter{Focus: g, Name: key.NameDeleteForward},
+			key.Filter{Focus: g, Name: "A", Required: key.ModShortcut},
+			key.Filter{Focus: g, Name: "C", Required: key.ModShortcut},
+			key.Filter{Focus: g, Name: "X", Required: key.ModShortcut},
+			key.Filter{Focus: g, Name: "V", Required: key.ModShortcut},
+		)
+		if !ok {
+			break
+		}
+		switch e := e.(type) {
+		case key.FocusEvent:
+			g.focused = e.Focus
+		case key.EditEvent:
+			// Typing into the current cell replaces it.
+			if !g.editing {
+				g.startEdit(gtx, e.Text)
+			}
+		case key.Event:
+			if e.State == key.Press && g.Model.Len() > 0 {
+				g.key(gtx, e)
+			}
+		case pointer.Event:
+			g.pointer(gtx, e)
+		case transfer.DataEvent:
+			r := e.Open()
+			b, _ := io.ReadAll(r)
+			r.Close()
+			g.paste(string(b))
+		}
+	}
+}
+
+func (g *DataGrid) Layout(gtx layout.Context) layout.Dimensions {
+	g.update(gtx)
+	th := g.Theme
+	cols := g.Model.Columns()
+	if n := g.Model.Len(); n > 0 {
+		g.cursor, g.anchor = g.clamp(g.cursor), g.clamp(g.anchor)
+	} else {
+		g.editing = false
+	}
+	size := gtx.Constraints.Max
+	g.widths = columnWidths(gtx, g.Widths, len(cols), size.X)
+	g.rowHeight = rowHeight(gtx, th)
+	g.visibleRows = max((size.Y-g.rowHeight)/g.rowHeight, 1)
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, g)
+
+	line := mulAlpha(th.Fg, 0x20)
+	paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x18), clip.Rect{Max: image.Pt(size.X, g.rowHeight)}.Op())
+	x := 0
+	for i, c := range cols {
+		layoutCellText(gtx, th, c, x, g.widths[i], g.rowHeight, font.Bold)
+		x += g.widths[i]
+	}
+	off := op.Offset(image.Pt(0, g.rowHeight)).Push(gtx.Ops)
+	lgtx := gtx
+	lgtx.Constraints = layout.Exact(image.Pt(size.X, max(size.Y-g.rowHeight, 0)))
+	g.list.Axis = layout.Vertical
+	material.List(th, &g.list).Layout(lgtx, g.Model.Len(), g.layoutRow)
+	off.Pop()
+
+	// Column lines.
+	x = 0
+	for _, w := range g.widths[:max(len(g.widths)-1, 0)] {
+		x += w
+		paint.FillShape(gtx.Ops, line, clip.Rect{Min: image.Pt(x, 0), Max: image.Pt(x+1, size.Y)}.Op())
+	}
+	return layout.Dimensions{Size: size}
+}
+
+func (g *DataGrid) layoutRow(gtx layout.Context, i int) layout.Dimensions {
+	th := g.Theme
+	h := g.rowHeight
+	size := image.Pt(gtx.Constraints.Max.X, h)
+	vals := g.Model.Row(i)
+	sel := g.selection()
+	active := g.focused || g.editing
+	x := 0
+	for c, w := range g.widths {
+		p := image.Pt(c, i)
+		r := image.Rect(x, 0, x+w, h)
+		if p.In(sel) && sel.Size() != image.Pt(1, 1) {
+			paint.FillShape(gtx.Ops, mulAlpha(th.ContrastBg, 0x30), clip.Rect(r).Op())
+		}
+		if p == g.cursor && g.editing {
+			paint.FillShape(gtx.Ops, th.Bg, clip.Rect(r).Op())
+			pad := gtx.Dp(cellPadding)
+			off := op.Offset(image.Pt(x+pad, pad)).Push(gtx.Ops)
+			egtx := gtx
+			egtx.Constraints = layout.Exact(image.Pt(max(w-2*pad, 0), h-2*pad))
+			ed := material.Editor(th, &g.editor, "")
+			ed.TextSize = th.TextSize * 14 / 16
+			ed.Layout(egtx)
+			off.Pop()
+		} else if c < len(vals) {
+			layoutCellText(gtx, th, cellText(vals[c]), x, w, h, font.Normal)
+		}
+		if p == g.cursor {
+			c := mulAlpha(th.ContrastBg, 0x80)
+			if active {
+				c = th.ContrastBg
+			}
+			b := gtx.Dp(2)
+			paint.FillShape(gtx.Ops, c, clip.Stroke{Path: clip.Rect(r.Inset(b / 2)).Path(), Width: float32(b)}.Op())
+		}
+		x += w
+	}
+	paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x20), clip.Rect{Min: image.Pt(0, h-1), Max: size}.Op())
+	return layout.Dimensions{Size: size}
+}
+
+// dataGridBuiltin returns a "//method" builtin of grids; fn returning nil
+// returns the grid.
+func dataGridBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, g *DataGrid, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.DataGrid)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*DataGrid](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, g, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsDataGrid = map[string]*env.Builtin{
+	"data-grid": {
+		Doc:   "Create a spreadsheet-like grid editing the cells of a data model: arrows, tab and enter move, shift or dragging selects, typing, F2 or a double click edits and ctrl-C / ctrl-V copy and paste tab-separated cells",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "data-grid", 1, arg0)
+			if err != nil {
+				return err
+			}
+			m, err := modelArg(ps, "data-grid", 2, arg1)
+			if err != nil {
+				return err
+			}
+			g := &DataGrid{ps: ps, Model: m, Theme: th}
+			g.editor.SingleLine = true
+			g.editor.Submit = true
+			return *env.NewNative(ps.Idx, g, "Go(*gioui_org.DataGrid)")
+		},
+	},
+	"Go(*gioui_org.DataGrid)//layout": layoutBuiltin[*DataGrid]("Go(*gioui_org.DataGrid)//layout"),
+	"Go(*gioui_org.DataGrid)//widths!": dataGridBuiltin("widths!", "Set the widths in dp of the first columns; the others share the space left", 2, func(ps *env.ProgramState, name string, g *DataGrid, arg1 env.Object) env.Object {
+		ws, err := sliceArg[unit.Dp](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		g.Widths = ws
+		return nil
+	}),
+	"Go(*gioui_org.DataGrid)//on-change!": dataGridBuiltin("on-change!", "Set function called with the row (from 0), column name and new value of each cell edited, pasted or cleared, after editable models are changed", 2, func(ps *env.ProgramState, name string, g *DataGrid, arg1 env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 3, arg1)
+		if err != nil {
+			return err
+		}
+		g.onChange = &fn
+		return nil
+	}),
+	"Go(*gioui_org.DataGrid)//selection?": dataGridBuiltin("selection?", "Get a dict of the current cell's row and column and the selected rows and columns from top and left to bottom and right (from 0)", 1, func(ps *env.ProgramState, name string, g *DataGrid, _ env.Object) env.Object {
+		sel := g.selection()
+		return *env.NewDict(map[string]any{
+			"row":    *env.NewInteger(int64(g.cursor.Y)),
+			"column": *env.NewInteger(int64(g.cursor.X)),
+			"top":    *env.NewInteger(int64(sel.Min.Y)),
+			"left":   *env.NewInteger(int64(sel.Min.X)),
+			"bottom": *env.NewInteger(int64(sel.Max.Y - 1)),
+			"right":  *env.NewInteger(int64(sel.Max.X - 1)),
+		})
+	}),
+	"Go(*gioui_org.DataGrid)//error?": dataGridBuiltin("error?", "Get why writing the last edit to the model failed, or an empty string", 1, func(ps *env.ProgramState, name string, g *DataGrid, _ env.Object) env.Object {
+		if g.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(g.err.Error())
+	}),
+}
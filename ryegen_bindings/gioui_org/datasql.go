@@ -0,0 +1,438 @@
+// Data models over SQLite queries.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gioui.org/app"
+
+	"github.com/refaktor/rye/env"
+)
+
+// sqlState is what an SQLModel shares with the goroutine watching the
+// database, which mustn't keep the model itself from being collected.
+type sqlState struct {
+	db    *sql.DB
+	owned bool // opened by the model, closed with it
+	query string
+	table string
+	key   string
+	page  int
+
+	mu       sync.Mutex
+	cols     []string
+	gen      int // counts requeries; what was read before one is stale
+	count    int
+	countGen int // gen count is of, -1 before the first count
+	counting bool
+	pages    map[int]*sqlPage
+	err      error
+	win      *app.Window
+	stop     chan struct{}
+}
+
+// sqlPage is a page of rows read for a generation of the query.
+type sqlPage struct {
+	rows    [][]any
+	gen     int
+	loading bool
+}
+
+// SQLModel is the rows of an SQLite query, read a page at a time as widgets
+// show them. Pages and the row count are read in the background, and the
+// window woken when they arrive; until then layout gets what was read
+// before, or empty rows. It re-runs the query when the database changes,
+// from this or another connection or process, and with a table and key
+// column set it writes edits back to the table.
+type SQLModel struct {
+	*sqlState
+}
+
+// sqlMaxPages is how many pages of rows a model keeps.
+const sqlMaxPages = 8
+
+func newSQLModel(db *sql.DB, owned bool, query, table, key string, page int, watch time.Duration) (*SQLModel, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	rows, err := db.Query("SELECT * FROM (" + query + ") LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if (table == "") != (key == "") {
+		return nil, errors.New("edits need both table and key")
+	}
+	if key != "" && !slices.Contains(cols, key) {
+		return nil, fmt.Errorf("key %q isn't a column of the query", key)
+	}
+	s := &sqlState{db: db, owned: owned, query: query, table: table, key: key, page: page, cols: cols, countGen: -1, pages: map[int]*sqlPage{}, stop: make(chan struct{})}
+	if watch > 0 {
+		go s.watch(watch)
+	}
+	m := &SQLModel{s}
+	trackResource(m, (*SQLModel).close)
+	return m, nil
+}
+
+// quoteIdent quotes an SQL identifier.
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// watch re-runs the query when SQLite's data version, which changes as
+// other connections commit, does.
+func (s *sqlState) watch(every time.Duration) {
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	version := int64(-1)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		var v int64
+		if err := conn.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&v); err != nil {
+			return
+		}
+		if version >= 0 && v != version {
+			s.Requery()
+		}
+		version = v
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *sqlState) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	close(s.stop)
+	if s.owned {
+		s.db.Close()
+	}
+}
+
+// Requery makes the rows read so far stale and wakes the window to show
+// the query's rows again. Stale rows are shown until they are read again.
+func (s *sqlState) Requery() {
+	s.mu.Lock()
+	s.gen++
+	s.mu.Unlock()
+	s.wake()
+}
+
+func (s *sqlState) wake() {
+	s.mu.Lock()
+	win := s.win
+	s.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+func (s *sqlState) Columns() []string {
+	return s.cols
+}
+
+// Len returns the last count of rows, counting them again in the
+// background if the query was run again since.
+func (s *sqlState) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.countGen != s.gen && !s.counting {
+		s.counting = true
+		go s.countRows(s.gen)
+	}
+	return s.count
+}
+
+func (s *sqlState) countRows(gen int) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM (" + s.query + ")").Scan(&n)
+	s.mu.Lock()
+	s.counting = false
+	if err != nil {
+		s.err = err
+	} else {
+		s.count = n
+	}
+	// Given up on failure, until the next requery.
+	s.countGen = gen
+	s.mu.Unlock()
+	s.wake()
+}
+
+// Row returns row i if its page was read, reading it in the background if
+// it wasn't or is stale. Past the middle of a page, the next one is read
+// ahead.
+func (s *sqlState) Row(i int) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := i / s.page
+	p := s.want(n)
+	if i -= n * s.page; i >= s.page/2 && (n+1)*s.page < s.count {
+		s.want(n + 1)
+	}
+	if i < len(p.rows) {
+		return p.rows[i]
+	}
+	return nil
+}
+
+// want returns page n, starting to read it if it is missing or stale.
+// Call with s.mu held.
+func (s *sqlState) want(n int) *sqlPage {
+	p := s.pages[n]
+	if p == nil {
+		if len(s.pages) >= sqlMaxPages {
+			s.evictPage(n)
+		}
+		p = &sqlPage{gen: -1}
+		s.pages[n] = p
+	}
+	if p.gen != s.gen && !p.loading {
+		p.loading = true
+		go s.loadPage(n, p, s.gen)
+	}
+	return p
+}
+
+// evictPage drops the cached page farthest from page n that isn't being
+// read. Call with s.mu held.
+func (s *sqlState) evictPage(n int) {
+	dist := func(k int) int { return max(k-n, n-k) }
+	far := -1
+	for k, p := range s.pages {
+		if !p.loading && (far < 0 || dist(k) > dist(far)) {
+			far = k
+		}
+	}
+	if far >= 0 {
+		delete(s.pages, far)
+	}
+}
+
+func (s *sqlState) loadPage(n int, p *sqlPage, gen int) {
+	rows, err := s.fetch(n)
+	s.mu.Lock()
+	p.loading = false
+	if err != nil {
+		s.err = err
+	} else {
+		p.rows = rows
+	}
+	// Given up on failure, until the next requery.
+	p.gen = gen
+	s.mu.Unlock()
+	s.wake()
+}
+
+// fetch reads page n of the rows.
+func (s *sqlState) fetch(n int) ([][]any, error) {
+	rows, err := s.db.Query("SELECT * FROM ("+s.query+") LIMIT ? OFFSET ?", s.page, n*s.page)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res [][]any
+	for rows.Next() {
+		vals := make([]any, len(s.cols))
+		ptrs := make([]any, len(vals))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		res = append(res, vals)
+	}
+	return res, rows.Err()
+}
+
+// Set updates a cell in the table, in the row with the key of row i.
+func (s *sqlState) Set(row, col int, v any) error {
+	if s.table == "" {
+		return errors.New("no table and key to write edits to")
+	}
+	vals := s.Row(row)
+	if vals == nil {
+		// Not read yet; an edited row has usually been shown.
+		rows, err := s.fetch(row / s.page)
+		if err != nil {
+			return err
+		}
+		if i := row % s.page; i < len(rows) {
+			vals = rows[i]
+		}
+	}
+	if vals == nil {
+		return fmt.Errorf("can't read row %d", row)
+	}
+	var key any
+	for i, c := range s.cols {
+		if c == s.key {
+			key = vals[i]
+		}
+	}
+	_, err := s.db.Exec("UPDATE "+quoteIdent(s.table)+" SET "+quoteIdent(s.cols[col])+" = ? WHERE "+quoteIdent(s.key)+" = ?", v, key)
+	if err != nil {
+		return err
+	}
+	s.Requery()
+	return nil
+}
+
+// sqlOptions are the settings of an SQLModel.
+type sqlOptions struct {
+	table, key string
+	page       int
+	watch      time.Duration
+}
+
+var sqlModelOptions = map[string]optionSpec[func(*sqlOptions)]{
+	"table": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*sqlOptions), *env.Error) {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(o *sqlOptions) { o.table = s }, nil
+	}},
+	"key": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*sqlOptions), *env.Error) {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(o *sqlOptions) { o.key = s }, nil
+	}},
+	"page": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*sqlOptions), *env.Error) {
+		n, err := integerArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, failure(ps, name, "page must be at least 1")
+		}
+		return func(o *sqlOptions) { o.page = int(n) }, nil
+	}},
+	"watch": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*sqlOptions), *env.Error) {
+		ms, err := integerArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(o *sqlOptions) { o.watch = time.Duration(ms) * time.Millisecond }, nil
+	}},
+}
+
+// sqlModelBuiltin returns a "//method" builtin of SQL models.
+func sqlModelBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, m *SQLModel, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.SQLModel)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*SQLModel](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, m, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsDataSQL = mergeBuiltins(modelBuiltins[*SQLModel]("Go(*gioui_org.SQLModel)"), map[string]*env.Builtin{
+	"data-sqlite": {
+		Doc:   "Create a data model of the rows of an SQLite query, on a database opened with sqlite://... open or a file path, with options: table and key (a column of the query) to write edits back, page (rows read at once, 200) and watch (ms between checks for changes, 500, 0 for none)",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			var db *sql.DB
+			owned := false
+			switch v := arg0.(type) {
+			case env.Native:
+				d, ok := v.Value.(*sql.DB)
+				if !ok {
+					return argError(ps, "data-sqlite", 1, "SQLite database or path", arg0)
+				}
+				db = d
+			case env.String:
+				d, err := sql.Open("sqlite3", v.Value)
+				if err != nil {
+					return failure(ps, "data-sqlite", err.Error())
+				}
+				db, owned = d, true
+			default:
+				return argError(ps, "data-sqlite", 1, "SQLite database or path", arg0)
+			}
+			query, err := stringArg(ps, "data-sqlite", 2, arg1)
+			if err != nil {
+				return err
+			}
+			opts, err := optionsArg(ps, "data-sqlite", 3, arg2, sqlModelOptions)
+			if err != nil {
+				return err
+			}
+			o := sqlOptions{page: 200, watch: 500 * time.Millisecond}
+			for _, f := range opts {
+				f(&o)
+			}
+			m, merr := newSQLModel(db, owned, query, o.table, o.key, o.page, o.watch)
+			if merr != nil {
+				if owned {
+					db.Close()
+				}
+				return failure(ps, "data-sqlite", merr.Error())
+			}
+			return *env.NewNative(ps.Idx, m, "Go(*gioui_org.SQLModel)")
+		},
+	},
+	"Go(*gioui_org.SQLModel)//requery": sqlModelBuiltin("requery", "Run the query again, as after changes the model can't see", 1, func(ps *env.ProgramState, name string, m *SQLModel, _ env.Object) env.Object {
+		m.Requery()
+		return nil
+	}),
+	"Go(*gioui_org.SQLModel)//wake!": sqlModelBuiltin("wake!", "Invalidate a window when the query's rows change, so it shows them", 2, func(ps *env.ProgramState, name string, m *SQLModel, arg1 env.Object) env.Object {
+		win, err := nativeArg[*app.Window](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.win = win
+		m.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.SQLModel)//error?": sqlModelBuiltin("error?", "Get why reading rows last failed, or an empty string", 1, func(ps *env.ProgramState, name string, m *SQLModel, _ env.Object) env.Object {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(m.err.Error())
+	}),
+	"Go(*gioui_org.SQLModel)//close": sqlModelBuiltin("close", "Stop watching the database, closing it if the model opened it", 1, func(ps *env.ProgramState, name string, m *SQLModel, _ env.Object) env.Object {
+		m.close()
+		return nil
+	}),
+})
@@ -0,0 +1,165 @@
+// Custom URL schemes opening the app.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gioui.org/io/event"
+
+	"github.com/refaktor/rye/env"
+)
+
+// validScheme reports whether s is a URL scheme: a letter followed by
+// letters, digits, +, - or . (RFC 3986).
+func validScheme(s string) bool {
+	for i, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case i > 0 && ('0' <= r && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// launchCommand is the command line starting this app again: the
+// executable and its arguments, like the script, with paths made absolute
+// so it runs from anywhere.
+func launchCommand() ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := []string{exe}
+	for _, a := range os.Args[1:] {
+		if _, err := os.Stat(a); err == nil {
+			if abs, err := filepath.Abs(a); err == nil {
+				a = abs
+			}
+		}
+		cmd = append(cmd, a)
+	}
+	return cmd, nil
+}
+
+// openedURLs are URLs the system hands the running app instead of putting
+// them on the command line, as macOS and Android do. The ones arriving
+// before the script asks for them, like the one the app was launched with,
+// are kept until then.
+var openedURLs struct {
+	mu        sync.Mutex
+	supported bool // set by the platforms delivering URLs
+	pending   []string
+	ch        chan string
+}
+
+// viewURLs, if set, looks for an opened URL in window events.
+var viewURLs func(e event.Event)
+
+// deliverURL passes a URL opened by the system to the script.
+func deliverURL(u string) {
+	openedURLs.mu.Lock()
+	defer openedURLs.mu.Unlock()
+	if openedURLs.ch == nil {
+		openedURLs.pending = append(openedURLs.pending, u)
+		return
+	}
+	openedURLs.ch <- u
+}
+
+// openedURLStream starts the stream of opened URLs, beginning with the
+// pending ones.
+func openedURLStream() (*EventStream, error) {
+	openedURLs.mu.Lock()
+	defer openedURLs.mu.Unlock()
+	if !openedURLs.supported {
+		return nil, errors.New("URLs arrive as command-line arguments on " + runtime.GOOS + "; see url-args")
+	}
+	if openedURLs.ch != nil {
+		return nil, errors.New("there is already a stream of opened URLs")
+	}
+	ch := make(chan string, len(openedURLs.pending))
+	for _, u := range openedURLs.pending {
+		ch <- u
+	}
+	openedURLs.pending = nil
+	openedURLs.ch = ch
+	return newEventStream(ch, func(ps *env.ProgramState, u string) env.Object { return *env.NewString(u) }, func() {
+		openedURLs.mu.Lock()
+		if openedURLs.ch == ch {
+			openedURLs.ch = nil
+			close(ch)
+		}
+		openedURLs.mu.Unlock()
+	}), nil
+}
+
+var builtinsDeepLink = map[string]*env.Builtin{
+	"register-url-scheme": {
+		Doc:   "Make links like myapp://... open this app on Linux and Windows, with the URL as its last command line argument; on macOS and phones the scheme is declared when packaging and the URLs come from opened-urls",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			scheme, err := stringArg(ps, "register-url-scheme", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if !validScheme(scheme) {
+				return failure(ps, "register-url-scheme", "invalid URL scheme "+scheme)
+			}
+			title, err := stringArg(ps, "register-url-scheme", 2, arg1)
+			if err != nil {
+				return err
+			}
+			// The title is written to a desktop entry or the registry as a line.
+			if strings.ContainsFunc(title, unicode.IsControl) {
+				return failure(ps, "register-url-scheme", "title must not contain control characters")
+			}
+			if rerr := registerScheme(strings.ToLower(scheme), title); rerr != nil {
+				return failure(ps, "register-url-scheme", rerr.Error())
+			}
+			return arg0
+		},
+	},
+	"opened-urls": {
+		Doc:   "Get a stream of the URLs macOS and Android open the app with, starting with the one it was launched with; iOS is not supported, and Linux and Windows pass them as command line arguments",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, serr := openedURLStream()
+			if serr != nil {
+				return failure(ps, "opened-urls", serr.Error())
+			}
+			return streamObj(ps, s)
+		},
+	},
+	"url-args": {
+		Doc:   "Get the strings of a block (like the command line, or a block passed by single-instance) that are URLs of a scheme",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			scheme, err := stringArg(ps, "url-args", 1, arg0)
+			if err != nil {
+				return err
+			}
+			args, err := sliceArg[string](ps, "url-args", 2, arg1)
+			if err != nil {
+				return err
+			}
+			var urls []string
+			for _, a := range args {
+				if s, _, ok := strings.Cut(a, ":"); ok && strings.EqualFold(s, scheme) {
+					urls = append(urls, a)
+				}
+			}
+			return argsObj(ps, urls)
+		},
+	},
+}
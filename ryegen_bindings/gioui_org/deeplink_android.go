@@ -0,0 +1,91 @@
+//go:build !b_no_gioui
+
+package gioui_org
+
+/*
+#include <jni.h>
+#include <stdlib.h>
+#include <string.h>
+
+// intentURL returns the data URL of the intent of the activity showing
+// view, as a malloc'ed string, and clears it so the URL isn't seen again
+// when the view is recreated. It returns NULL when there is none.
+static char *intentURL(uintptr_t vmp, uintptr_t viewp) {
+	JavaVM *vm = (JavaVM *)vmp;
+	JNIEnv *env;
+	int attached = 0;
+	if ((*vm)->GetEnv(vm, (void **)&env, JNI_VERSION_1_6) == JNI_EDETACHED) {
+		if ((*vm)->AttachCurrentThread(vm, &env, NULL) != JNI_OK) {
+			return NULL;
+		}
+		attached = 1;
+	}
+	char *res = NULL;
+	(*env)->PushLocalFrame(env, 16);
+	jobject view = (jobject)viewp;
+	jclass viewClass = (*env)->FindClass(env, "android/view/View");
+	jobject ctx = (*env)->CallObjectMethod(env, view,
+		(*env)->GetMethodID(env, viewClass, "getContext", "()Landroid/content/Context;"));
+	jclass actClass = (*env)->FindClass(env, "android/app/Activity");
+	if ((*env)->ExceptionCheck(env) || ctx == NULL || !(*env)->IsInstanceOf(env, ctx, actClass)) {
+		goto done;
+	}
+	jobject intent = (*env)->CallObjectMethod(env, ctx,
+		(*env)->GetMethodID(env, actClass, "getIntent", "()Landroid/content/Intent;"));
+	if ((*env)->ExceptionCheck(env) || intent == NULL) {
+		goto done;
+	}
+	jclass intentClass = (*env)->FindClass(env, "android/content/Intent");
+	jstring data = (*env)->CallObjectMethod(env, intent,
+		(*env)->GetMethodID(env, intentClass, "getDataString", "()Ljava/lang/String;"));
+	if ((*env)->ExceptionCheck(env) || data == NULL) {
+		goto done;
+	}
+	const char *c = (*env)->GetStringUTFChars(env, data, NULL);
+	res = strdup(c);
+	(*env)->ReleaseStringUTFChars(env, data, c);
+	(*env)->CallObjectMethod(env, intent,
+		(*env)->GetMethodID(env, intentClass, "setData", "(Landroid/net/Uri;)Landroid/content/Intent;"), NULL);
+done:
+	if ((*env)->ExceptionCheck(env)) {
+		(*env)->ExceptionClear(env);
+	}
+	(*env)->PopLocalFrame(env, NULL);
+	if (attached) {
+		(*vm)->DetachCurrentThread(vm);
+	}
+	return res;
+}
+*/
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+
+	"gioui.org/app"
+	"gioui.org/io/event"
+)
+
+// Android opens URLs of the schemes in the manifest's intent filters by
+// starting an activity with them. Gio doesn't pass on intents reaching an
+// activity that already runs, so declare the activity with the standard
+// launch mode, where each link starts one.
+
+func init() {
+	openedURLs.supported = true
+	viewURLs = func(e event.Event) {
+		ve, ok := e.(app.AndroidViewEvent)
+		if !ok || ve.View == 0 {
+			return
+		}
+		// The JNI environment belongs to the thread it was attached on.
+		runtime.LockOSThread()
+		url := C.intentURL(C.uintptr_t(app.JavaVM()), C.uintptr_t(ve.View))
+		runtime.UnlockOSThread()
+		if url != nil {
+			deliverURL(C.GoString(url))
+			C.free(unsafe.Pointer(url))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build !ios && !b_no_gioui
+
+package gioui_org
+
+/*
+#cgo CFLAGS: -fobjc-arc -x objective-c
+#cgo LDFLAGS: -framework Foundation -framework CoreServices
+
+#import <CoreServices/CoreServices.h>
+#import <Foundation/Foundation.h>
+
+extern void openedURL(char *url);
+
+@interface RyeURLHandler : NSObject
+@end
+
+@implementation RyeURLHandler
+- (void)handleURL:(NSAppleEventDescriptor *)event withReply:(NSAppleEventDescriptor *)reply {
+	NSString *url = [[event paramDescriptorForKeyword:keyDirectObject] stringValue];
+	if (url != nil) {
+		openedURL((char *)[url UTF8String]);
+	}
+}
+@end
+
+// installURLHandler asks for the Apple Events that open URLs. It runs
+// before the app finishes launching, so the URL it is launched with isn't
+// missed.
+static void installURLHandler(void) {
+	static RyeURLHandler *handler;
+	handler = [[RyeURLHandler alloc] init];
+	[[NSAppleEventManager sharedAppleEventManager] setEventHandler:handler
+		andSelector:@selector(handleURL:withReply:)
+		forEventClass:kInternetEventClass
+		andEventID:kAEGetURL];
+}
+*/
+import "C"
+
+// macOS opens URLs of the schemes in the bundle's Info.plist with a GetURL
+// Apple Event, to the running app or to the one it launches.
+
+//export openedURL
+func openedURL(url *C.char) {
+	deliverURL(C.GoString(url))
+}
+
+func init() {
+	openedURLs.supported = true
+	C.installURLHandler()
+}
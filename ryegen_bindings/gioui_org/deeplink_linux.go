@@ -0,0 +1,54 @@
+//go:build !android && !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// registerScheme installs a desktop entry handling the scheme and makes it
+// the default handler.
+func registerScheme(scheme, title string) error {
+	cmd, err := launchCommand()
+	if err != nil {
+		return err
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	dir = filepath.Join(dir, "applications")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for i, a := range cmd {
+		cmd[i] = desktopQuote(a)
+	}
+	name := "rye-" + scheme + ".desktop"
+	entry := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=%s\nExec=%s %%u\nMimeType=x-scheme-handler/%s;\nNoDisplay=true\n",
+		strings.ReplaceAll(title, `\`, `\\`), strings.Join(cmd, " "), scheme)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(entry), 0o644); err != nil {
+		return err
+	}
+	if out, err := exec.Command("xdg-mime", "default", name, "x-scheme-handler/"+scheme).CombinedOutput(); err != nil {
+		return fmt.Errorf("xdg-mime: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// desktopQuote quotes an argument of an Exec key.
+func desktopQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\n\"'\\><~|&;$*?#()`%") {
+		return s
+	}
+	r := strings.NewReplacer(`"`, `\"`, "`", "\\`", `$`, `\$`, `\`, `\\`, `%`, `%%`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,16 @@
+//go:build (!linux || android) && !windows && !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"runtime"
+)
+
+// On macOS and phones the scheme goes in the package's Info.plist or
+// manifest, and URLs are handed to the running app rather than put on its
+// command line (see opened-urls).
+
+func registerScheme(scheme, title string) error {
+	return errors.New("URL schemes are declared when packaging on " + runtime.GOOS)
+}
@@ -0,0 +1,33 @@
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// registerScheme adds the scheme to the user's classes in the registry.
+func registerScheme(scheme, title string) error {
+	cmd, err := launchCommand()
+	if err != nil {
+		return err
+	}
+	for i, a := range cmd {
+		cmd[i] = syscall.EscapeArg(a)
+	}
+	key := `HKCU\Software\Classes\` + scheme
+	for _, args := range [][]string{
+		{key, "/ve", "/d", "URL:" + title},
+		{key, "/v", "URL Protocol", "/d", ""},
+		{key + `\shell\open\command`, "/ve", "/d", strings.Join(cmd, " ") + ` "%1"`},
+	} {
+		out, err := exec.Command("reg", append([]string{"add"}, append(args, "/f")...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("reg: %v %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
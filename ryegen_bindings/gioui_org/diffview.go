@@ -0,0 +1,696 @@
+// Diff viewer of two texts, unified or side by side.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+const (
+	// diffLimit is the most edits diffs look for; texts differing more
+	// show the rest as replaced.
+	diffLimit = 2000
+	// diffWordLimit is the same for the words of changed lines.
+	diffWordLimit = 200
+)
+
+var (
+	diffRed   = color.NRGBA{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff}
+	diffGreen = color.NRGBA{R: 0x2e, G: 0x9d, B: 0x32, A: 0xff}
+)
+
+type diffKind uint8
+
+const (
+	diffSame diffKind = iota
+	diffDelete
+	diffInsert
+)
+
+// diff returns the edits turning a into b, by Myers' algorithm: diffSame
+// keeps an element of both, diffDelete drops one of a and diffInsert adds
+// one of b. Past limit edits the elements left are replaced.
+func diff[T comparable](a, b []T, limit int) []diffKind {
+	// The common start and end are kept as they are.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	res := make([]diffKind, 0, len(a)+len(b))
+	for range pre {
+		res = append(res, diffSame)
+	}
+	res = append(res, myers(a[pre:len(a)-suf], b[pre:len(b)-suf], limit)...)
+	for range suf {
+		res = append(res, diffSame)
+	}
+	return res
+}
+
+func myers[T comparable](a, b []T, limit int) []diffKind {
+	n, m := len(a), len(b)
+	// trace[d][k+d] is the furthest x reached on diagonal k with d edits.
+	var trace [][]int32
+	v := []int32{0}
+	found := false
+	for d := 0; d <= min(n+m, limit) && !found; d++ {
+		next := make([]int32, 2*d+1)
+		for k := -d; k <= d && !found; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d || k != d && v[k-1+d-1] < v[k+1+d-1]:
+				x = int(v[k+1+d-1])
+			default:
+				x = int(v[k-1+d-1]) + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			next[k+d] = int32(x)
+			found = x >= n && y >= m
+		}
+		trace = append(trace, next)
+		v = next
+	}
+	if !found {
+		res := make([]diffKind, 0, n+m)
+		for range n {
+			res = append(res, diffDelete)
+		}
+		for range m {
+			res = append(res, diffInsert)
+		}
+		return res
+	}
+
+	// Walk back from the end through the edits found.
+	var res []diffKind
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		var pk int
+		if k == -d || k != d && prev[k-1+d-1] < prev[k+1+d-1] {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := int(prev[pk+d-1])
+		py := px - pk
+		mx, my := px, py+1 // after the edit
+		if pk == k-1 {
+			mx, my = px+1, py
+		}
+		for x > mx && y > my {
+			res = append(res, diffSame)
+			x, y = x-1, y-1
+		}
+		if pk == k-1 {
+			res = append(res, diffDelete)
+		} else {
+			res = append(res, diffInsert)
+		}
+		x, y = px, py
+	}
+	for ; x > 0; x-- {
+		res = append(res, diffSame)
+	}
+	slices.Reverse(res)
+	return res
+}
+
+// diffWords splits a line into words, runs of spaces and other characters.
+func diffWords(s string) []string {
+	var words []string
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 0
+		case unicode.IsSpace(r):
+			return 1
+		}
+		return 2
+	}
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		c := class(r)
+		if c != 2 {
+			for n < len(s) {
+				r, rn := utf8.DecodeRuneInString(s[n:])
+				if class(r) != c {
+					break
+				}
+				n += rn
+			}
+		}
+		words = append(words, s[:n])
+		s = s[n:]
+	}
+	return words
+}
+
+// changedRanges returns the byte ranges of the words of old and new that
+// differ.
+func changedRanges(old, new string) (a, b [][2]int) {
+	wa, wb := diffWords(old), diffWords(new)
+	i, j, oa, ob := 0, 0, 0, 0
+	add := func(rs [][2]int, start, end int) [][2]int {
+		if n := len(rs); n > 0 && rs[n-1][1] == start {
+			rs[n-1][1] = end
+			return rs
+		}
+		return append(rs, [2]int{start, end})
+	}
+	for _, k := range diff(wa, wb, diffWordLimit) {
+		switch k {
+		case diffSame:
+			oa, ob = oa+len(wa[i]), ob+len(wb[j])
+			i, j = i+1, j+1
+		case diffDelete:
+			a = add(a, oa, oa+len(wa[i]))
+			oa += len(wa[i])
+			i++
+		case diffInsert:
+			b = add(b, ob, ob+len(wb[j]))
+			ob += len(wb[j])
+			j++
+		}
+	}
+	return a, b
+}
+
+// diffLine is a line of either text, numbered from 1 in its text.
+type diffLine struct {
+	kind    diffKind
+	old     int // 0 for inserted lines
+	new     int // 0 for deleted lines
+	text    string
+	changed [][2]int // byte ranges differing from the line it replaces
+}
+
+// diffRow is a row of the view: a line, two lines side by side (either
+// possibly missing), or a number of unchanged lines hidden.
+type diffRow struct {
+	left, right *diffLine
+	hidden      int
+	hunk        int // index of the hunk of changed rows, or -1
+}
+
+// diffLines compares the lines of two texts.
+func diffLines(old, new string) []*diffLine {
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+	a, b := split(old), split(new)
+	var lines []*diffLine
+	i, j := 0, 0
+	kinds := diff(a, b, diffLimit)
+	for s := 0; s < len(kinds); {
+		if kinds[s] == diffSame {
+			lines = append(lines, &diffLine{kind: diffSame, old: i + 1, new: j + 1, text: a[i]})
+			i, j, s = i+1, j+1, s+1
+			continue
+		}
+		// A block of changes: the deleted lines, then the inserted ones,
+		// paired in order for their changed words.
+		var dels, ins []*diffLine
+		for ; s < len(kinds) && kinds[s] != diffSame; s++ {
+			if kinds[s] == diffDelete {
+				dels = append(dels, &diffLine{kind: diffDelete, old: i + 1, text: a[i]})
+				i++
+			} else {
+				ins = append(ins, &diffLine{kind: diffInsert, new: j + 1, text: b[j]})
+				j++
+			}
+		}
+		for k := range min(len(dels), len(ins)) {
+			dels[k].changed, ins[k].changed = changedRanges(dels[k].text, ins[k].text)
+		}
+		lines = append(append(lines, dels...), ins...)
+	}
+	return lines
+}
+
+// DiffView shows the differences between two texts, unified (one column of
+// deleted, inserted and unchanged lines) or side by side, the words that
+// changed within lines highlighted. N and P, or the next-hunk and
+// previous-hunk methods, move between the hunks of changed lines.
+type DiffView struct {
+	Theme      *material.Theme
+	SideBySide bool
+	Context    int // unchanged lines shown around hunks, or -1 for all
+	lines      []*diffLine
+	rows       []diffRow
+	hunks      []int // first row of each hunk
+	hunk       int   // current hunk, or -1
+	digits     int   // of the largest line number
+	list       widget.List
+	focused    bool
+}
+
+func newDiffView(th *material.Theme, old, new string) *DiffView {
+	v := &DiffView{Theme: th, Context: -1, hunk: -1}
+	v.list.Axis = layout.Vertical
+	v.SetTexts(old, new)
+	return v
+}
+
+func (v *DiffView) SetTexts(old, new string) {
+	v.lines = diffLines(old, new)
+	last := 1
+	for _, l := range v.lines {
+		last = max(last, l.old, l.new)
+	}
+	v.digits = len(strconv.Itoa(last))
+	v.hunk = -1
+	v.list.Position = layout.Position{}
+	v.build()
+}
+
+// build lays the lines out in rows for the mode and context.
+func (v *DiffView) build() {
+	v.rows, v.hunks = v.rows[:0], v.hunks[:0]
+	// Unchanged lines further than the context from changes are hidden.
+	shown := make([]bool, len(v.lines))
+	last := -1 << 30
+	for i, l := range v.lines {
+		if l.kind != diffSame {
+			last = i
+		}
+		shown[i] = v.Context < 0 || i-last <= v.Context
+	}
+	last = 1 << 30
+	for i := len(v.lines) - 1; i >= 0; i-- {
+		if v.lines[i].kind != diffSame {
+			last = i
+		}
+		shown[i] = shown[i] || last-i <= v.Context
+	}
+	for i := 0; i < len(v.lines); {
+		l := v.lines[i]
+		switch {
+		case !shown[i]:
+			n := 0
+			for ; i < len(v.lines) && !shown[i]; i++ {
+				n++
+			}
+			v.rows = append(v.rows, diffRow{hidden: n, hunk: -1})
+		case l.kind == diffSame:
+			v.rows = append(v.rows, diffRow{left: l, right: l, hunk: -1})
+			i++
+		default:
+			h := len(v.hunks)
+			v.hunks = append(v.hunks, len(v.rows))
+			var dels, ins []*diffLine
+			for ; i < len(v.lines) && v.lines[i].kind != diffSame; i++ {
+				if v.lines[i].kind == diffDelete {
+					dels = append(dels, v.lines[i])
+				} else {
+					ins = append(ins, v.lines[i])
+				}
+			}
+			if !v.SideBySide {
+				for _, l := range append(dels, ins...) {
+					v.rows = append(v.rows, diffRow{left: l, hunk: h})
+				}
+				break
+			}
+			for k := range max(len(dels), len(ins)) {
+				r := diffRow{hunk: h}
+				if k < len(dels) {
+					r.left = dels[k]
+				}
+				if k < len(ins) {
+					r.right = ins[k]
+				}
+				v.rows = append(v.rows, r)
+			}
+		}
+	}
+	v.hunk = min(v.hunk, len(v.hunks)-1)
+}
+
+// rebuild builds the rows again, keeping the current hunk in view.
+func (v *DiffView) rebuild() {
+	v.build()
+	if v.hunk >= 0 {
+		v.GoToHunk(v.hunk)
+	}
+}
+
+// GoToHunk scrolls to a hunk, a few rows above it in view.
+func (v *DiffView) GoToHunk(h int) {
+	if len(v.hunks) == 0 {
+		return
+	}
+	v.hunk = max(0, min(h, len(v.hunks)-1))
+	v.list.Position = layout.Position{First: max(v.hunks[v.hunk]-3, 0)}
+}
+
+func (v *DiffView) NextHunk() {
+	// From the top of the view when no hunk was gone to.
+	if v.hunk < 0 {
+		for h, r := range v.hunks {
+			if r > v.list.Position.First {
+				v.GoToHunk(h)
+				return
+			}
+		}
+	}
+	v.GoToHunk(v.hunk + 1)
+}
+
+func (v *DiffView) PreviousHunk() {
+	v.GoToHunk(v.hunk - 1)
+}
+
+// Stats returns the numbers of lines deleted and inserted.
+func (v *DiffView) Stats() (deleted, inserted int) {
+	for _, l := range v.lines {
+		switch l.kind {
+		case diffDelete:
+			deleted++
+		case diffInsert:
+			inserted++
+		}
+	}
+	return
+}
+
+func (v *DiffView) FocusTag() event.Tag { return v }
+
+func (v *DiffView) update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(
+			key.FocusFilter{Target: v},
+			key.Filter{Focus: v, Name: "N"},
+			key.Filter{Focus: v, Name: "P"},
+			pointer.Filter{Target: v, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		switch e := e.(type) {
+		case key.FocusEvent:
+			v.focused = e.Focus
+		case key.Event:
+			if e.State != key.Press {
+				break
+			}
+			if e.Name == "N" {
+				v.NextHunk()
+			} else {
+				v.PreviousHunk()
+			}
+		case pointer.Event:
+			gtx.Execute(key.FocusCmd{Tag: v})
+		}
+	}
+}
+
+// lineSpans returns the spans of a line, its changed words over a stronger
+// background.
+func lineSpans(th *material.Theme, l *diffLine) []textSpan {
+	s := shownText(l.text)
+	bg := diffRed
+	if l.kind == diffInsert {
+		bg = diffGreen
+	}
+	var res []textSpan
+	at := 0
+	for _, r := range l.changed {
+		start, end := min(r[0], len(s)), min(r[1], len(s))
+		if start > at {
+			res = append(res, textSpan{text: s[at:start], color: th.Fg})
+		}
+		if end > start {
+			res = append(res, textSpan{text: s[start:end], color: th.Fg, bg: mulAlpha(bg, 0x70)})
+		}
+		at = end
+	}
+	if at < len(s) {
+		res = append(res, textSpan{text: s[at:], color: th.Fg})
+	}
+	return res
+}
+
+// layoutSide lays out a line with its number in a column of a width,
+// from x; marker is drawn between the number and the text.
+func (v *DiffView) layoutSide(gtx layout.Context, l *diffLine, x, width, gutter int, unified bool) int {
+	th := v.Theme
+	sgtx := gtx
+	sgtx.Constraints.Max.X = x + width
+	h := 0
+	number := func(n int, right int) {
+		if n == 0 {
+			return
+		}
+		lbl := material.Body2(th, strconv.Itoa(n))
+		lbl.Font = monoFont
+		lbl.Color = mulAlpha(th.Fg, 0x80)
+		m := op.Record(gtx.Ops)
+		dims := lbl.Layout(gtx)
+		call := m.Stop()
+		off := op.Offset(image.Pt(right-dims.Size.X, 0)).Push(gtx.Ops)
+		call.Add(gtx.Ops)
+		off.Pop()
+	}
+	pad := gtx.Dp(6)
+	macro := op.Record(gtx.Ops)
+	tx := x + gutter + pad
+	marker := " "
+	if l != nil {
+		if unified {
+			number(l.old, x+gutter/2-pad/2)
+			number(l.new, x+gutter)
+		} else if l.kind == diffInsert {
+			number(l.new, x+gutter)
+		} else {
+			number(l.old, x+gutter)
+		}
+		switch l.kind {
+		case diffDelete:
+			marker = "-"
+		case diffInsert:
+			marker = "+"
+		}
+		h = layoutSpans(sgtx, th, tx, append([]textSpan{{text: marker + " ", color: mulAlpha(th.Fg, 0x90)}}, lineSpans(th, l)...))
+	} else {
+		h = layoutSpans(sgtx, th, tx, nil)
+	}
+	content := macro.Stop()
+	var bg color.NRGBA
+	switch {
+	case l == nil:
+		bg = mulAlpha(th.Fg, 0x0c)
+	case l.kind == diffDelete:
+		bg = mulAlpha(diffRed, 0x28)
+	case l.kind == diffInsert:
+		bg = mulAlpha(diffGreen, 0x28)
+	}
+	if bg.A != 0 {
+		paint.FillShape(gtx.Ops, bg, clip.Rect{Min: image.Pt(x, 0), Max: image.Pt(x+width, h)}.Op())
+	}
+	content.Add(gtx.Ops)
+	return h
+}
+
+func (v *DiffView) layoutRow(gtx layout.Context, i int, gutter int) layout.Dimensions {
+	th := v.Theme
+	r := v.rows[i]
+	width := gtx.Constraints.Max.X
+	var h int
+	switch {
+	case r.hidden > 0:
+		lbl := material.Body2(th, "⋯ "+strconv.Itoa(r.hidden)+" unchanged lines")
+		lbl.Color = mulAlpha(th.Fg, 0x90)
+		macro := op.Record(gtx.Ops)
+		off := op.Offset(image.Pt(gutter+gtx.Dp(6), gtx.Dp(2))).Push(gtx.Ops)
+		h = lbl.Layout(gtx).Size.Y + gtx.Dp(4)
+		off.Pop()
+		content := macro.Stop()
+		paint.FillShape(gtx.Ops, mulAlpha(th.ContrastBg, 0x18), clip.Rect{Max: image.Pt(width, h)}.Op())
+		content.Add(gtx.Ops)
+	case v.SideBySide:
+		half := width / 2
+		h = max(v.layoutSide(gtx, r.left, 0, half, gutter, false), v.layoutSide(gtx, r.right, half, width-half, gutter, false))
+		paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x30), clip.Rect{Min: image.Pt(half, 0), Max: image.Pt(half+1, h)}.Op())
+	default:
+		h = v.layoutSide(gtx, r.left, 0, width, 2*gutter, true)
+	}
+	if r.hunk >= 0 && r.hunk == v.hunk {
+		c := mulAlpha(th.ContrastBg, 0x80)
+		if v.focused {
+			c = th.ContrastBg
+		}
+		paint.FillShape(gtx.Ops, c, clip.Rect{Max: image.Pt(gtx.Dp(3), h)}.Op())
+	}
+	return layout.Dimensions{Size: image.Pt(width, h)}
+}
+
+func (v *DiffView) Layout(gtx layout.Context) layout.Dimensions {
+	v.update(gtx)
+	size := gtx.Constraints.Max
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, v)
+
+	// The gutter fits the largest line number.
+	lbl := material.Body2(v.Theme, strings.Repeat("0", v.digits))
+	lbl.Font = monoFont
+	gutter := lbl.Layout(gtx.Disabled()).Size.X + gtx.Dp(12)
+
+	return material.List(v.Theme, &v.list).Layout(gtx, len(v.rows), func(gtx layout.Context, i int) layout.Dimensions {
+		return v.layoutRow(gtx, i, gutter)
+	})
+}
+
+// diffViewBuiltin returns a "//method" builtin of diff views; fn returning
+// nil returns the view.
+func diffViewBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, v *DiffView, arg1, arg2 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.DiffView)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*DiffView](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, v, arg1, arg2); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+// diffTexts reads two texts given as strings.
+func diffTexts(ps *env.ProgramState, name string, n int, arg0, arg1 env.Object) (string, string, *env.Error) {
+	old, err := stringArg(ps, name, n, arg0)
+	if err != nil {
+		return "", "", err
+	}
+	new, err := stringArg(ps, name, n+1, arg1)
+	if err != nil {
+		return "", "", err
+	}
+	return old, new, nil
+}
+
+var builtinsDiffView = map[string]*env.Builtin{
+	"diff-view": {
+		Doc:   "Create a view of the differences between an old and a new text, unified by default, highlighting the words changed within lines; N and P go to the next and previous hunk",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "diff-view", 1, arg0)
+			if err != nil {
+				return err
+			}
+			old, new, err := diffTexts(ps, "diff-view", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newDiffView(th, old, new), "Go(*gioui_org.DiffView)")
+		},
+	},
+	"diff-view\\files": {
+		Doc:   "Create a view of the differences between an old and a new file",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "diff-view\\files", 1, arg0)
+			if err != nil {
+				return err
+			}
+			pa, pb, err := diffTexts(ps, "diff-view\\files", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			old, rerr := os.ReadFile(pa)
+			if rerr != nil {
+				return failure(ps, "diff-view\\files", rerr.Error())
+			}
+			new, rerr := os.ReadFile(pb)
+			if rerr != nil {
+				return failure(ps, "diff-view\\files", rerr.Error())
+			}
+			return *env.NewNative(ps.Idx, newDiffView(th, string(old), string(new)), "Go(*gioui_org.DiffView)")
+		},
+	},
+	"Go(*gioui_org.DiffView)//layout": layoutBuiltin[*DiffView]("Go(*gioui_org.DiffView)//layout"),
+	"Go(*gioui_org.DiffView)//texts!": diffViewBuiltin("texts!", "Compare an old and a new text instead", 3, func(ps *env.ProgramState, name string, v *DiffView, arg1, arg2 env.Object) env.Object {
+		old, new, err := diffTexts(ps, name, 2, arg1, arg2)
+		if err != nil {
+			return err
+		}
+		v.SetTexts(old, new)
+		return nil
+	}),
+	"Go(*gioui_org.DiffView)//side-by-side!": diffViewBuiltin("side-by-side!", "Set whether the texts are shown side by side rather than unified", 2, func(ps *env.ProgramState, name string, v *DiffView, arg1, _ env.Object) env.Object {
+		b, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.SideBySide = b != 0
+		v.rebuild()
+		return nil
+	}),
+	"Go(*gioui_org.DiffView)//context!": diffViewBuiltin("context!", "Set how many unchanged lines are shown around hunks, hiding the others, or -1 to show all (the default)", 2, func(ps *env.ProgramState, name string, v *DiffView, arg1, _ env.Object) env.Object {
+		n, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.Context = int(max(n, -1))
+		v.rebuild()
+		return nil
+	}),
+	"Go(*gioui_org.DiffView)//next-hunk": diffViewBuiltin("next-hunk", "Scroll to the next hunk of changed lines", 1, func(ps *env.ProgramState, name string, v *DiffView, _, _ env.Object) env.Object {
+		v.NextHunk()
+		return nil
+	}),
+	"Go(*gioui_org.DiffView)//previous-hunk": diffViewBuiltin("previous-hunk", "Scroll to the previous hunk of changed lines", 1, func(ps *env.ProgramState, name string, v *DiffView, _, _ env.Object) env.Object {
+		v.PreviousHunk()
+		return nil
+	}),
+	"Go(*gioui_org.DiffView)//hunk?": diffViewBuiltin("hunk?", "Get the index (from 0) of the hunk gone to last, or -1", 1, func(ps *env.ProgramState, name string, v *DiffView, _, _ env.Object) env.Object {
+		return *env.NewInteger(int64(v.hunk))
+	}),
+	"Go(*gioui_org.DiffView)//stats?": diffViewBuiltin("stats?", "Get a dict of the number of hunks and of lines deleted and inserted", 1, func(ps *env.ProgramState, name string, v *DiffView, _, _ env.Object) env.Object {
+		del, ins := v.Stats()
+		return *env.NewDict(map[string]any{
+			"hunks":    *env.NewInteger(int64(len(v.hunks))),
+			"deleted":  *env.NewInteger(int64(del)),
+			"inserted": *env.NewInteger(int64(ins)),
+		})
+	}),
+}
@@ -0,0 +1,123 @@
+// Labels truncated to a number of lines.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// ElidedLabel is a label cut to MaxLines lines ending with an ellipsis. It
+// remembers whether the last layout truncated the text, so a "more…"
+// affordance can be shown.
+type ElidedLabel struct {
+	Style     material.LabelStyle
+	truncated bool
+}
+
+func (l *ElidedLabel) Layout(gtx layout.Context) layout.Dimensions {
+	s := l.Style
+	m := op.Record(gtx.Ops)
+	paint.ColorOp{Color: s.Color}.Add(gtx.Ops)
+	textColor := m.Stop()
+	wl := widget.Label{
+		Alignment:       s.Alignment,
+		MaxLines:        s.MaxLines,
+		Truncator:       s.Truncator,
+		WrapPolicy:      s.WrapPolicy,
+		LineHeight:      s.LineHeight,
+		LineHeightScale: s.LineHeightScale,
+	}
+	dims, info := wl.LayoutDetailed(gtx, s.Shaper, s.Font, s.TextSize, s.Text, textColor)
+	l.truncated = info.Truncated > 0
+	return dims
+}
+
+func elidedSetter[T any](name, doc string, arg func(ps *env.ProgramState, name string, n int, arg env.Object) (T, *env.Error), set func(l *ElidedLabel, v T)) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			l, err := nativeArg[*ElidedLabel](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := arg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			set(l, v)
+			return arg0
+		},
+	}
+}
+
+var builtinsElided = map[string]*env.Builtin{
+	"elided-label": {
+		Doc:   "Create a label of a text size showing at most a number of lines, ending with an ellipsis when cut",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "elided-label", 1, arg0)
+			if err != nil {
+				return err
+			}
+			size, err := decimalArg(ps, "elided-label", 2, arg1)
+			if err != nil {
+				return err
+			}
+			txt, err := stringArg(ps, "elided-label", 3, arg2)
+			if err != nil {
+				return err
+			}
+			lines, err := integerArg(ps, "elided-label", 4, arg3)
+			if err != nil {
+				return err
+			}
+			l := &ElidedLabel{Style: material.Label(th, unit.Sp(size), txt)}
+			l.Style.MaxLines = int(lines)
+			l.Style.Truncator = "…"
+			return *env.NewNative(ps.Idx, l, "Go(*gioui_org.ElidedLabel)")
+		},
+	},
+	"Go(*gioui_org.ElidedLabel)//layout": layoutBuiltin[*ElidedLabel]("Go(*gioui_org.ElidedLabel)//layout"),
+	"Go(*gioui_org.ElidedLabel)//text!": elidedSetter("Go(*gioui_org.ElidedLabel)//text!", "Set the label text", stringArg,
+		func(l *ElidedLabel, s string) { l.Style.Text = s }),
+	"Go(*gioui_org.ElidedLabel)//max-lines!": elidedSetter("Go(*gioui_org.ElidedLabel)//max-lines!", "Set the maximum number of lines, 0 for no limit", integerArg,
+		func(l *ElidedLabel, n int64) { l.Style.MaxLines = int(n) }),
+	"Go(*gioui_org.ElidedLabel)//truncator!": elidedSetter("Go(*gioui_org.ElidedLabel)//truncator!", "Set the text shown where the label is cut, \"…\" by default", stringArg,
+		func(l *ElidedLabel, s string) { l.Style.Truncator = s }),
+	"Go(*gioui_org.ElidedLabel)//color!": elidedSetter("Go(*gioui_org.ElidedLabel)//color!", "Set the text color", colorArg,
+		func(l *ElidedLabel, c color.NRGBA) { l.Style.Color = c }),
+	"Go(*gioui_org.ElidedLabel)//text?": {
+		Doc:   "Get the label text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			l, err := nativeArg[*ElidedLabel](ps, "Go(*gioui_org.ElidedLabel)//text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(l.Style.Text)
+		},
+	},
+	"Go(*gioui_org.ElidedLabel)//truncated?": {
+		Doc:   "Check whether the text was cut at the last layout",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			l, err := nativeArg[*ElidedLabel](ps, "Go(*gioui_org.ElidedLabel)//truncated?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(l.truncated))
+		},
+	},
+}
@@ -0,0 +1,385 @@
+// Gio enums as Rye words.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/text"
+
+	"github.com/refaktor/rye/env"
+)
+
+// enumType holds the names of the values of a Gio enum type. Values of
+// flags types are bits that combine: a block of names is their union.
+type enumType struct {
+	flags  bool
+	values map[string]int64
+}
+
+// enums are the Gio enum types by Go name. The names are the kebab-case of
+// the constants without the type's prefix (pointer.CursorGrab is grab).
+var enums = map[string]*enumType{
+	"layout.Axis": {values: map[string]int64{
+		"horizontal": int64(layout.Horizontal),
+		"vertical":   int64(layout.Vertical),
+	}},
+	"layout.Alignment": {values: map[string]int64{
+		"start":    int64(layout.Start),
+		"end":      int64(layout.End),
+		"middle":   int64(layout.Middle),
+		"baseline": int64(layout.Baseline),
+	}},
+	"layout.Direction": {values: map[string]int64{
+		"nw":     int64(layout.NW),
+		"n":      int64(layout.N),
+		"ne":     int64(layout.NE),
+		"e":      int64(layout.E),
+		"se":     int64(layout.SE),
+		"s":      int64(layout.S),
+		"sw":     int64(layout.SW),
+		"w":      int64(layout.W),
+		"center": int64(layout.Center),
+	}},
+	"layout.Spacing": {values: map[string]int64{
+		"end":     int64(layout.SpaceEnd),
+		"start":   int64(layout.SpaceStart),
+		"sides":   int64(layout.SpaceSides),
+		"around":  int64(layout.SpaceAround),
+		"between": int64(layout.SpaceBetween),
+		"evenly":  int64(layout.SpaceEvenly),
+	}},
+	"text.Alignment": {values: map[string]int64{
+		"start":  int64(text.Start),
+		"end":    int64(text.End),
+		"middle": int64(text.Middle),
+	}},
+	"text.WrapPolicy": {values: map[string]int64{
+		"heuristically": int64(text.WrapHeuristically),
+		"words":         int64(text.WrapWords),
+		"graphemes":     int64(text.WrapGraphemes),
+	}},
+	"font.Style": {values: map[string]int64{
+		"regular": int64(font.Regular),
+		"italic":  int64(font.Italic),
+	}},
+	"font.Weight": {values: map[string]int64{
+		"thin":        int64(font.Thin),
+		"extra-light": int64(font.ExtraLight),
+		"light":       int64(font.Light),
+		"normal":      int64(font.Normal),
+		"medium":      int64(font.Medium),
+		"semi-bold":   int64(font.SemiBold),
+		"bold":        int64(font.Bold),
+		"extra-bold":  int64(font.ExtraBold),
+		"black":       int64(font.Black),
+	}},
+	"pointer.Kind": {flags: true, values: map[string]int64{
+		"cancel":  int64(pointer.Cancel),
+		"press":   int64(pointer.Press),
+		"release": int64(pointer.Release),
+		"move":    int64(pointer.Move),
+		"drag":    int64(pointer.Drag),
+		"enter":   int64(pointer.Enter),
+		"leave":   int64(pointer.Leave),
+		"scroll":  int64(pointer.Scroll),
+	}},
+	"pointer.Buttons": {flags: true, values: map[string]int64{
+		"primary":   int64(pointer.ButtonPrimary),
+		"secondary": int64(pointer.ButtonSecondary),
+		"tertiary":  int64(pointer.ButtonTertiary),
+	}},
+	"pointer.Source": {values: map[string]int64{
+		"mouse": int64(pointer.Mouse),
+		"touch": int64(pointer.Touch),
+	}},
+	"pointer.Priority": {values: map[string]int64{
+		"shared":   int64(pointer.Shared),
+		"foremost": int64(pointer.Foremost),
+		"grabbed":  int64(pointer.Grabbed),
+	}},
+	"pointer.Cursor": {values: map[string]int64{
+		"default":                      int64(pointer.CursorDefault),
+		"none":                         int64(pointer.CursorNone),
+		"text":                         int64(pointer.CursorText),
+		"vertical-text":                int64(pointer.CursorVerticalText),
+		"pointer":                      int64(pointer.CursorPointer),
+		"crosshair":                    int64(pointer.CursorCrosshair),
+		"all-scroll":                   int64(pointer.CursorAllScroll),
+		"col-resize":                   int64(pointer.CursorColResize),
+		"row-resize":                   int64(pointer.CursorRowResize),
+		"grab":                         int64(pointer.CursorGrab),
+		"grabbing":                     int64(pointer.CursorGrabbing),
+		"not-allowed":                  int64(pointer.CursorNotAllowed),
+		"wait":                         int64(pointer.CursorWait),
+		"progress":                     int64(pointer.CursorProgress),
+		"north-west-resize":            int64(pointer.CursorNorthWestResize),
+		"north-east-resize":            int64(pointer.CursorNorthEastResize),
+		"south-west-resize":            int64(pointer.CursorSouthWestResize),
+		"south-east-resize":            int64(pointer.CursorSouthEastResize),
+		"north-south-resize":           int64(pointer.CursorNorthSouthResize),
+		"east-west-resize":             int64(pointer.CursorEastWestResize),
+		"west-resize":                  int64(pointer.CursorWestResize),
+		"east-resize":                  int64(pointer.CursorEastResize),
+		"north-resize":                 int64(pointer.CursorNorthResize),
+		"south-resize":                 int64(pointer.CursorSouthResize),
+		"north-east-south-west-resize": int64(pointer.CursorNorthEastSouthWestResize),
+		"north-west-south-east-resize": int64(pointer.CursorNorthWestSouthEastResize),
+	}},
+	"key.Modifiers": {flags: true, values: map[string]int64{
+		"ctrl":    int64(key.ModCtrl),
+		"command": int64(key.ModCommand),
+		"shift":   int64(key.ModShift),
+		"alt":     int64(key.ModAlt),
+		"super":   int64(key.ModSuper),
+	}},
+	"key.State": {values: map[string]int64{
+		"press":   int64(key.Press),
+		"release": int64(key.Release),
+	}},
+}
+
+func (e *enumType) names() string {
+	names := make([]string, 0, len(e.values))
+	for n := range e.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// name returns the name of v, or for flags a block of the names of its bits.
+func (e *enumType) name(v int64) (env.Object, bool) {
+	if !e.flags {
+		for n, ev := range e.values {
+			if ev == v {
+				return *env.NewString(n), true
+			}
+		}
+		return nil, false
+	}
+	var names []string
+	for n, ev := range e.values {
+		if v&ev != 0 {
+			names = append(names, n)
+			v &^= ev
+		}
+	}
+	if v != 0 {
+		return nil, false
+	}
+	sort.Strings(names)
+	objs := make([]env.Object, len(names))
+	for i, n := range names {
+		objs[i] = *env.NewString(n)
+	}
+	return *env.NewBlock(*env.NewTSeries(objs)), true
+}
+
+func (e *enumType) all() int64 {
+	var all int64
+	for _, v := range e.values {
+		all |= v
+	}
+	return all
+}
+
+func enumTypeArg(ps *env.ProgramState, name string, n int, arg env.Object) (*enumType, *env.Error) {
+	typ, err := stringArg(ps, name, n, arg)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := enums[typ]
+	if !ok {
+		return nil, failure(ps, name, fmt.Sprintf("unknown enum %s", typ))
+	}
+	return e, nil
+}
+
+// enumArg converts a name of a value of e, a block of names for flags, or
+// an integer that is a valid value.
+func enumArg(ps *env.ProgramState, name string, n int, typ string, e *enumType, arg env.Object) (int64, *env.Error) {
+	switch v := arg.(type) {
+	case env.Integer:
+		valid := v.Value&^e.all() == 0
+		if !e.flags {
+			_, valid = e.name(v.Value)
+		}
+		if !valid {
+			return 0, failure(ps, name, fmt.Sprintf("arg %d: %d is not a %s", n, v.Value, typ))
+		}
+		return v.Value, nil
+	case env.Block:
+		if !e.flags {
+			break
+		}
+		var res int64
+		for _, it := range v.Series.S {
+			b, err := enumArg(ps, name, n, typ, e, it)
+			if err != nil {
+				return 0, err
+			}
+			res |= b
+		}
+		return res, nil
+	case env.Word, env.String:
+		s, _ := nameArg(ps, name, n, arg)
+		if ev, ok := e.values[s]; ok {
+			return ev, nil
+		}
+		return 0, failure(ps, name, fmt.Sprintf("arg %d: %s is not a %s (%s)", n, s, typ, e.names()))
+	}
+	expected := "name or integer"
+	if e.flags {
+		expected = "name, block of names or integer"
+	}
+	return 0, argError(ps, name, n, expected, arg)
+}
+
+// enumSetters wraps the generated setters of enum fields ("Set *layout.Flex
+// Axis value") so they also take names, and check integers. key.Name
+// fields take the words of keyNameArg.
+func enumSetters() map[string]*env.Builtin {
+	res := map[string]*env.Builtin{}
+	idx := env.NewIdxs()
+	ps := &env.ProgramState{Idx: idx}
+	for k, b := range builtinsGenerated {
+		if !strings.Contains(k, "//") || !strings.HasSuffix(k, "!") {
+			continue
+		}
+		f := strings.Fields(b.Doc)
+		if len(f) != 4 || f[0] != "Set" || f[3] != "value" || !strings.HasPrefix(f[1], "*") {
+			continue
+		}
+		ctor, ok := structConstructor(f[1][1:])
+		if !ok {
+			continue
+		}
+		nat, ok := ctor.Fn(ps, nil, nil, nil, nil, nil).(env.Native)
+		if !ok {
+			continue
+		}
+		field, ok := reflect.TypeOf(nat.Value).Elem().FieldByName(f[2])
+		if !ok {
+			continue
+		}
+		typ := field.Type.String()
+		if field.Type == reflect.TypeOf(key.Name("")) {
+			res[k] = keyNameSetter(k, b)
+		} else if e, ok := enums[typ]; ok {
+			res[k] = enumSetter(k, b, typ, e)
+		}
+	}
+	return res
+}
+
+func enumSetter(name string, b *env.Builtin, typ string, e *enumType) *env.Builtin {
+	return &env.Builtin{
+		Doc:   b.Doc + " (a name of " + typ + " or an integer)",
+		Argsn: b.Argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			if _, ok := arg1.(env.Native); !ok {
+				v, err := enumArg(ps, name, 2, typ, e, arg1)
+				if err != nil {
+					return err
+				}
+				arg1 = *env.NewInteger(v)
+			}
+			return b.Fn(ps, arg0, arg1, arg2, arg3, arg4)
+		},
+	}
+}
+
+func keyNameSetter(name string, b *env.Builtin) *env.Builtin {
+	return &env.Builtin{
+		Doc:   b.Doc + " (a key word like enter or page-up, or a string)",
+		Argsn: b.Argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			if _, ok := arg1.(env.Native); !ok {
+				k, err := keyNameArg(ps, name, 2, arg1)
+				if err != nil {
+					return err
+				}
+				arg1 = *env.NewString(string(k))
+			}
+			return b.Fn(ps, arg0, arg1, arg2, arg3, arg4)
+		},
+	}
+}
+
+var builtinsEnums = mergeBuiltins(enumSetters(), map[string]*env.Builtin{
+	"enum": {
+		Doc:   "Get the integer of a named value of a Gio enum, like enum \"layout.Axis\" 'vertical; flags take a block of names",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := enumTypeArg(ps, "enum", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := enumArg(ps, "enum", 2, arg0.(env.String).Value, e, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(v)
+		},
+	},
+	"enum-name": {
+		Doc:   "Get the name of an integer value of a Gio enum, or a block of names for flags",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := enumTypeArg(ps, "enum-name", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "enum-name", 2, arg1)
+			if err != nil {
+				return err
+			}
+			name, ok := e.name(v)
+			if !ok {
+				return failure(ps, "enum-name", fmt.Sprintf("%d is not a %s", v, arg0.(env.String).Value))
+			}
+			return name
+		},
+	},
+	"enums?": {
+		Doc:   "Get a sorted block of the Gio enum types with named values",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			names := make([]string, 0, len(enums))
+			for n := range enums {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			objs := make([]env.Object, len(names))
+			for i, n := range names {
+				objs[i] = *env.NewString(n)
+			}
+			return *env.NewBlock(*env.NewTSeries(objs))
+		},
+	},
+	"enum-values?": {
+		Doc:   "Get a dict of the names and integers of a Gio enum",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := enumTypeArg(ps, "enum-values?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			d := map[string]any{}
+			for n, v := range e.values {
+				d[n] = *env.NewInteger(v)
+			}
+			return *env.NewDict(d)
+		},
+	},
+})
@@ -0,0 +1,162 @@
+// Events decoded into tagged dicts.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+
+	"github.com/iancoleman/strcase"
+
+	"github.com/refaktor/rye/env"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	keyNameType  = reflect.TypeOf(key.Name(""))
+)
+
+// keyNameWords maps key names to their words in keyWords.
+var keyNameWords = func() map[key.Name]string {
+	res := map[key.Name]string{}
+	for w, k := range keyWords {
+		res[k] = w
+	}
+	return res
+}()
+
+// valueObj converts a Go value to the closest Rye value: numbers, strings,
+// enum names (from enums), blocks for slices and dicts of the exported
+// fields for structs that have some. Times are Unix milliseconds and durations
+// milliseconds, errors their message and nil is 0. What has no Rye
+// equivalent (functions, pointers, opaque structs) is a native.
+func valueObj(ps *env.ProgramState, v reflect.Value) env.Object {
+	t := v.Type()
+	switch t {
+	case timeType:
+		return *env.NewInteger(v.Interface().(time.Time).UnixMilli())
+	case durationType:
+		return *env.NewInteger(v.Interface().(time.Duration).Milliseconds())
+	case keyNameType:
+		if w, ok := keyNameWords[key.Name(v.String())]; ok {
+			return *env.NewString(w)
+		}
+		return *env.NewString(v.String())
+	}
+	if e, ok := enums[t.String()]; ok {
+		var n int64
+		if v.CanInt() {
+			n = v.Int()
+		} else {
+			n = int64(v.Uint())
+		}
+		if name, ok := e.name(n); ok {
+			return name
+		}
+		return *env.NewInteger(n)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return *env.NewInteger(boolToInt64(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return *env.NewInteger(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return *env.NewInteger(int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return *env.NewDecimal(v.Float())
+	case reflect.String:
+		return *env.NewString(v.String())
+	case reflect.Slice, reflect.Array:
+		items := make([]env.Object, v.Len())
+		for i := range items {
+			items[i] = valueObj(ps, v.Index(i))
+		}
+		return *env.NewBlock(*env.NewTSeries(items))
+	case reflect.Struct:
+		d := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				d[strcase.ToKebab(f.Name)] = valueObj(ps, v.Field(i))
+			}
+		}
+		if len(d) > 0 {
+			return *env.NewDict(d)
+		}
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Func, reflect.Map, reflect.Chan:
+		if v.IsNil() {
+			return *env.NewInteger(0)
+		}
+	}
+	if t.Kind() == reflect.Interface {
+		if err, ok := v.Interface().(error); ok {
+			return *env.NewString(err.Error())
+		}
+		return valueObj(ps, v.Elem())
+	}
+	if v.CanInterface() {
+		return ifaceToNative(ps.Idx, v.Interface(), nativeKindOf(t))
+	}
+	return *env.NewInteger(0)
+}
+
+// eventKind returns the Go name of an event's type, as kind does for its
+// native (app.FrameEvent, pointer.Event).
+func eventKind(e event.Event) string {
+	return strings.TrimPrefix(reflect.TypeOf(e).String(), "*")
+}
+
+// decodeEvent returns a dict of an event's fields with its type under
+// "kind" and the event itself, as a native, under "event".
+func decodeEvent(ps *env.ProgramState, e event.Event) env.Object {
+	v := reflect.ValueOf(e)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	d := map[string]any{}
+	if v.Kind() == reflect.Struct {
+		if fields, ok := valueObj(ps, v).(env.Dict); ok {
+			d = fields.Data
+		}
+	}
+	d["kind"] = *env.NewString(eventKind(e))
+	d["event"] = ifaceToNative(ps.Idx, e, "Go(event.Event)")
+	return *env.NewDict(d)
+}
+
+var builtinsEvents = map[string]*env.Builtin{
+	"decode-event": {
+		Doc:   "Decode an event native into a dict of its fields, with its type (\"pointer.Event\") under kind and the native under event; enum fields are names",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[event.Event](ps, "decode-event", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return decodeEvent(ps, e)
+		},
+	},
+	"decode-events": {
+		Doc:   "Decode a block of event natives, like the result of .events, into dicts",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			evs, err := sliceArg[event.Event](ps, "decode-events", 1, arg0)
+			if err != nil {
+				return err
+			}
+			items := make([]env.Object, len(evs))
+			for i, e := range evs {
+				items[i] = decodeEvent(ps, e)
+			}
+			return *env.NewBlock(*env.NewTSeries(items))
+		},
+	},
+}
@@ -0,0 +1,252 @@
+// Keyboard focus management.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+
+	"github.com/refaktor/rye/env"
+)
+
+// focusTagger is implemented by composite widgets whose focusable part is
+// an inner widget (usually an editor).
+type focusTagger interface {
+	FocusTag() event.Tag
+}
+
+func (n *NumberInput) FocusTag() event.Tag   { return &n.editor }
+func (m *MaskedInput) FocusTag() event.Tag   { return &m.editor }
+func (p *PasswordInput) FocusTag() event.Tag { return &p.editor }
+func (s *SearchInput) FocusTag() event.Tag   { return &s.editor }
+
+// focusTagArg returns the tag that receives keyboard focus for a widget
+// native.
+func focusTagArg(ps *env.ProgramState, name string, n int, arg env.Object) (event.Tag, *env.Error) {
+	nat, ok := arg.(env.Native)
+	if !ok {
+		return nil, argError(ps, name, n, "native", arg)
+	}
+	if t, ok := nat.Value.(focusTagger); ok {
+		return t.FocusTag(), nil
+	}
+	return nat.Value, nil
+}
+
+// FocusOrder declares the tab order of a set of widgets and reports focus
+// changes between them.
+type FocusOrder struct {
+	ps       *env.ProgramState
+	tags     []event.Tag
+	objs     []env.Object
+	current  int
+	onChange *env.Function
+}
+
+// Focused returns the index of the focused widget, or -1.
+func (f *FocusOrder) Focused(gtx layout.Context) int {
+	for i, t := range f.tags {
+		if gtx.Focused(t) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Move focuses the widget delta steps from the focused one, wrapping
+// around.
+func (f *FocusOrder) Move(gtx layout.Context, delta int) {
+	if len(f.tags) == 0 {
+		return
+	}
+	i := f.Focused(gtx)
+	if i < 0 {
+		if delta > 0 {
+			i = -1
+		} else {
+			i = 0
+		}
+	}
+	i = ((i+delta)%len(f.tags) + len(f.tags)) % len(f.tags)
+	gtx.Execute(key.FocusCmd{Tag: f.tags[i]})
+}
+
+// Update handles Tab and Shift+Tab on the member widgets and calls the
+// change function when focus moved. It must be called every frame.
+func (f *FocusOrder) Update(gtx layout.Context) {
+	filters := make([]event.Filter, len(f.tags))
+	for i, t := range f.tags {
+		filters[i] = key.Filter{Focus: t, Name: key.NameTab, Optional: key.ModShift}
+	}
+	for {
+		e, ok := gtx.Event(filters...)
+		if !ok {
+			break
+		}
+		if e, ok := e.(key.Event); ok && e.State == key.Press {
+			if e.Modifiers.Contain(key.ModShift) {
+				f.Move(gtx, -1)
+			} else {
+				f.Move(gtx, 1)
+			}
+		}
+	}
+	if i := f.Focused(gtx); i != f.current {
+		f.current = i
+		if f.onChange != nil {
+			var w env.Object = env.Void{}
+			if i >= 0 {
+				w = f.objs[i]
+			}
+			callFunction(f.ps, "focus-order on-change", *f.onChange, *env.NewInteger(int64(i)), w)
+		}
+	}
+}
+
+var builtinsFocus = map[string]*env.Builtin{
+	"focus": {
+		Doc:   "Give keyboard focus to a widget",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "focus", 1, arg0)
+			if err != nil {
+				return err
+			}
+			tag, err := focusTagArg(ps, "focus", 2, arg1)
+			if err != nil {
+				return err
+			}
+			gtx.Execute(key.FocusCmd{Tag: tag})
+			return arg1
+		},
+	},
+	"blur": {
+		Doc:   "Remove keyboard focus from all widgets",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "blur", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx.Execute(key.FocusCmd{})
+			return arg0
+		},
+	},
+	"focused?": {
+		Doc:   "Check whether a widget has keyboard focus",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "focused?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			tag, err := focusTagArg(ps, "focused?", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(gtx.Focused(tag)))
+		},
+	},
+	"focus-order": {
+		Doc:   "Declare the tab order of a block of widgets; call .update with the layout context each frame",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			blk, ok := arg0.(env.Block)
+			if !ok {
+				return argError(ps, "focus-order", 1, "block of widgets", arg0)
+			}
+			f := &FocusOrder{ps: ps, current: -1}
+			for _, o := range blk.Series.S {
+				tag, err := focusTagArg(ps, "focus-order", 1, o)
+				if err != nil {
+					return err
+				}
+				f.tags = append(f.tags, tag)
+				f.objs = append(f.objs, o)
+			}
+			return *env.NewNative(ps.Idx, f, "Go(*gioui_org.FocusOrder)")
+		},
+	},
+	"Go(*gioui_org.FocusOrder)//update": {
+		Doc:   "Handle Tab/Shift+Tab between the widgets and report focus changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			f, err := nativeArg[*FocusOrder](ps, "Go(*gioui_org.FocusOrder)//update", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.FocusOrder)//update", 2, arg1)
+			if err != nil {
+				return err
+			}
+			f.Update(gtx)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.FocusOrder)//on-change!": {
+		Doc:   "Set function called with the index and widget that got focus (-1 and void when none)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			f, err := nativeArg[*FocusOrder](ps, "Go(*gioui_org.FocusOrder)//on-change!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.FocusOrder)//on-change!", 2, 2, arg1)
+			if err != nil {
+				return err
+			}
+			f.onChange = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.FocusOrder)//focused?": {
+		Doc:   "Get the index of the focused widget, or -1",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			f, err := nativeArg[*FocusOrder](ps, "Go(*gioui_org.FocusOrder)//focused?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.FocusOrder)//focused?", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(int64(f.Focused(gtx)))
+		},
+	},
+	"focus-next": {
+		Doc:   "Move focus to the next widget of a focus order",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			f, err := nativeArg[*FocusOrder](ps, "focus-next", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "focus-next", 2, arg1)
+			if err != nil {
+				return err
+			}
+			f.Move(gtx, 1)
+			return arg0
+		},
+	},
+	"focus-prev": {
+		Doc:   "Move focus to the previous widget of a focus order",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			f, err := nativeArg[*FocusOrder](ps, "focus-prev", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "focus-prev", 2, arg1)
+			if err != nil {
+				return err
+			}
+			f.Move(gtx, -1)
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,242 @@
+// Font loading and fallback shapers.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gioui.org/font"
+	"gioui.org/font/gofont"
+	"gioui.org/font/opentype"
+	"gioui.org/text"
+	"gioui.org/widget/material"
+	"github.com/go-text/typesetting/fontscan"
+	"github.com/go-text/typesetting/opentype/api/metadata"
+	"github.com/go-text/typesetting/opentype/loader"
+
+	"github.com/refaktor/rye/env"
+)
+
+// loadFontFile parses a .ttf, .otf or .ttc file into its faces.
+func loadFontFile(path string) ([]font.FontFace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	faces, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return faces, nil
+}
+
+// themeFonts holds the faces added to each theme on top of the Go fonts, so
+// that loading another font keeps the earlier ones.
+var (
+	themeFontsMu sync.Mutex
+	themeFonts   = map[*material.Theme][]font.FontFace{}
+)
+
+// addThemeFonts appends faces to th's collection and gives th a new shaper
+// over the Go fonts followed by all added faces. Runes missing from the
+// requested face are looked up in the others, so emoji and CJK fonts fill
+// the gaps of the Go fonts. System fonts are still consulted last.
+func addThemeFonts(th *material.Theme, faces []font.FontFace) {
+	themeFontsMu.Lock()
+	defer themeFontsMu.Unlock()
+	themeFonts[th] = append(themeFonts[th], faces...)
+	th.Shaper = text.NewShaper(text.WithCollection(append(gofont.Collection(), themeFonts[th]...)))
+}
+
+func loadFontFiles(paths []string) ([]font.FontFace, error) {
+	var faces []font.FontFace
+	for _, p := range paths {
+		ff, err := loadFontFile(p)
+		if err != nil {
+			return nil, err
+		}
+		faces = append(faces, ff...)
+	}
+	return faces, nil
+}
+
+// systemFonts maps lower-cased family names of the installed fonts to the
+// files providing them. The font directories (fontconfig's on Linux, the
+// Windows and macOS font folders otherwise) are scanned on first use.
+var (
+	systemFontsOnce sync.Once
+	systemFontNames map[string]string
+	systemFontFiles map[string][]string
+)
+
+func scanSystemFonts() {
+	systemFontNames = map[string]string{}
+	systemFontFiles = map[string][]string{}
+	dirs, err := fontscan.DefaultFontDirectories(log.New(io.Discard, "", 0))
+	if err != nil {
+		return
+	}
+	var buf []byte
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ttf", ".otf", ".ttc", ".otc":
+			default:
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return nil
+			}
+			defer f.Close()
+			lds, err := loader.NewLoaders(f)
+			if err != nil {
+				return nil
+			}
+			for _, ld := range lds {
+				var family string
+				family, _, buf = metadata.Describe(ld, buf)
+				if family == "" {
+					continue
+				}
+				k := strings.ToLower(family)
+				if _, ok := systemFontNames[k]; !ok {
+					systemFontNames[k] = family
+				}
+				if files := systemFontFiles[k]; len(files) == 0 || files[len(files)-1] != path {
+					systemFontFiles[k] = append(files, path)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// loadSystemFont returns the faces of the installed font family.
+func loadSystemFont(family string) ([]font.FontFace, error) {
+	systemFontsOnce.Do(scanSystemFonts)
+	k := strings.ToLower(family)
+	paths := systemFontFiles[k]
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("font family %q not found", family)
+	}
+	var faces []font.FontFace
+	for _, p := range paths {
+		ff, err := loadFontFile(p)
+		if err != nil {
+			return nil, err
+		}
+		// Collections may bundle other families, keep only the asked one.
+		for _, f := range ff {
+			if strings.EqualFold(string(f.Font.Typeface), systemFontNames[k]) {
+				faces = append(faces, f)
+			}
+		}
+	}
+	return faces, nil
+}
+
+func fontPathsArg(ps *env.ProgramState, name string, n int, arg env.Object) ([]string, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block of font file paths", arg)
+	}
+	paths := make([]string, len(blk.Series.S))
+	for i, o := range blk.Series.S {
+		p, err := stringArg(ps, name, n, o)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = p
+	}
+	return paths, nil
+}
+
+var builtinsFonts = map[string]*env.Builtin{
+	"text-shaper\\fallback": {
+		Doc:   "Create a shaper over the Go fonts that falls back to a block of font files (e.g. Noto Color Emoji, a CJK font) for missing glyphs",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			paths, err := fontPathsArg(ps, "text-shaper\\fallback", 1, arg0)
+			if err != nil {
+				return err
+			}
+			faces, ferr := loadFontFiles(paths)
+			if ferr != nil {
+				return failure(ps, "text-shaper\\fallback", ferr.Error())
+			}
+			sh := text.NewShaper(text.WithCollection(append(gofont.Collection(), faces...)))
+			return *env.NewNative(ps.Idx, sh, "Go(*text.Shaper)")
+		},
+	},
+	"Go(*material.Theme)//font-fallback!": {
+		Doc:   "Replace the theme's shaper with one falling back to a block of font files for glyphs the Go fonts lack",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "Go(*material.Theme)//font-fallback!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			paths, err := fontPathsArg(ps, "Go(*material.Theme)//font-fallback!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			faces, ferr := loadFontFiles(paths)
+			if ferr != nil {
+				return failure(ps, "Go(*material.Theme)//font-fallback!", ferr.Error())
+			}
+			addThemeFonts(th, faces)
+			return arg0
+		},
+	},
+	"system-fonts": {
+		Doc:   "Get a sorted block of the font families installed on the system",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			systemFontsOnce.Do(scanSystemFonts)
+			names := make([]string, 0, len(systemFontNames))
+			for _, n := range systemFontNames {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			objs := make([]env.Object, len(names))
+			for i, n := range names {
+				objs[i] = *env.NewString(n)
+			}
+			return *env.NewBlock(*env.NewTSeries(objs))
+		},
+	},
+	"Go(*material.Theme)//load-system-font!": {
+		Doc:   "Add an installed font family to the theme, to be selected by its name as a typeface",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "Go(*material.Theme)//load-system-font!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			family, err := stringArg(ps, "Go(*material.Theme)//load-system-font!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			faces, ferr := loadSystemFont(family)
+			if ferr != nil {
+				return failure(ps, "Go(*material.Theme)//load-system-font!", ferr.Error())
+			}
+			addThemeFonts(th, faces)
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,315 @@
+// Fixed timestep game loop, keyboard polling and sprite batches.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"strings"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/f32"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Game runs update at a fixed rate independent of the frame rate and draws
+// every frame with the fraction of a step elapsed since the last update, for
+// interpolation.
+type Game struct {
+	ps      *env.ProgramState
+	win     *app.Window
+	Step    time.Duration
+	update  env.Function
+	draw    env.Function
+	down    map[key.Name]bool
+	pressed map[key.Name]bool // went down since the last update
+	acc     time.Duration
+	last    time.Time
+}
+
+// currentGame is the running game that key-down? and key-pressed? poll.
+var currentGame *Game
+
+const allModifiers = key.ModCtrl | key.ModCommand | key.ModShift | key.ModAlt | key.ModSuper
+
+func (g *Game) frame(e app.FrameEvent) {
+	var ops op.Ops
+	gtx := pacedContext(&ops, e)
+	typed := false
+	for {
+		ev, ok := gtx.Event(key.Filter{Optional: allModifiers})
+		if !ok {
+			break
+		}
+		ke, ok := ev.(key.Event)
+		if !ok {
+			continue
+		}
+		typed = true
+		if ke.State == key.Press {
+			if !g.down[ke.Name] {
+				g.pressed[ke.Name] = true
+			}
+			g.down[ke.Name] = true
+		} else {
+			delete(g.down, ke.Name)
+		}
+	}
+
+	if !g.last.IsZero() {
+		// Don't try to catch up after a long stall.
+		g.acc += min(gtx.Now.Sub(g.last), 10*g.Step)
+	}
+	g.last = gtx.Now
+	dt := *env.NewDecimal(g.Step.Seconds())
+	for g.acc >= g.Step {
+		g.acc -= g.Step
+		callFunction(g.ps, "game-loop update", g.update, dt)
+		clear(g.pressed)
+	}
+	alpha := *env.NewDecimal(float64(g.acc) / float64(g.Step))
+	callFunction(g.ps, "game-loop draw", g.draw, *env.NewNative(g.ps.Idx, &gtx, "Go(*layout.Context)"), alpha)
+	// Keys keep the window out of idle mode as the pointer does.
+	if typed {
+		animateFrame(gtx)
+	} else {
+		scheduleFrame(gtx)
+	}
+	e.Frame(gtx.Ops)
+}
+
+// Run handles the window's events until it is closed.
+func (g *Game) Run() {
+	currentGame = g
+	defer func() { currentGame = nil }()
+	for {
+		switch e := nextEvent(g.win).(type) {
+		case app.DestroyEvent:
+			return
+		case app.FrameEvent:
+			g.frame(e)
+		}
+	}
+}
+
+var keyWords = map[string]key.Name{
+	"left":         key.NameLeftArrow,
+	"right":        key.NameRightArrow,
+	"up":           key.NameUpArrow,
+	"down":         key.NameDownArrow,
+	"space":        key.NameSpace,
+	"enter":        key.NameReturn,
+	"escape":       key.NameEscape,
+	"tab":          key.NameTab,
+	"backspace":    key.NameDeleteBackward,
+	"shift":        key.NameShift,
+	"ctrl":         key.NameCtrl,
+	"alt":          key.NameAlt,
+	"super":        key.NameSuper,
+	"command":      key.NameCommand,
+	"home":         key.NameHome,
+	"end":          key.NameEnd,
+	"page-up":      key.NamePageUp,
+	"page-down":    key.NamePageDown,
+	"delete":       key.NameDeleteForward,
+	"keypad-enter": key.NameEnter,
+	"back":         key.NameBack,
+	"f1":           key.NameF1,
+	"f2":           key.NameF2,
+	"f3":           key.NameF3,
+	"f4":           key.NameF4,
+	"f5":           key.NameF5,
+	"f6":           key.NameF6,
+	"f7":           key.NameF7,
+	"f8":           key.NameF8,
+	"f9":           key.NameF9,
+	"f10":          key.NameF10,
+	"f11":          key.NameF11,
+	"f12":          key.NameF12,
+}
+
+func keyNameArg(ps *env.ProgramState, name string, n int, arg env.Object) (key.Name, *env.Error) {
+	s, err := nameArg(ps, name, n, arg)
+	if err != nil {
+		return "", err
+	}
+	if k, ok := keyWords[s]; ok {
+		return k, nil
+	}
+	if len([]rune(s)) == 1 {
+		return key.Name(strings.ToUpper(s)), nil
+	}
+	return key.Name(s), nil
+}
+
+type spriteDraw struct {
+	img   paint.ImageOp
+	src   image.Rectangle
+	pos   f32.Point
+	scale float32
+	rot   float32
+}
+
+// SpriteBatch collects image draws during a frame and paints them in one
+// pass on flush.
+type SpriteBatch struct {
+	draws []spriteDraw
+}
+
+// Add queues the src part of img with its top-left corner at pos (in dp),
+// scaled and rotated (in radians) around its center.
+func (b *SpriteBatch) Add(img paint.ImageOp, src image.Rectangle, pos f32.Point, scale, rot float32) {
+	b.draws = append(b.draws, spriteDraw{img: img, src: src, pos: pos, scale: scale, rot: rot})
+}
+
+func (b *SpriteBatch) Flush(gtx layout.Context) {
+	pxPerDp := gtx.Metric.PxPerDp
+	for _, d := range b.draws {
+		size := d.src.Size()
+		half := f32.Pt(float32(size.X), float32(size.Y)).Div(2)
+		s := d.scale * pxPerDp
+		tr := f32.Affine2D{}.
+			Offset(half.Mul(-1)).
+			Scale(f32.Point{}, f32.Pt(s, s)).
+			Rotate(f32.Point{}, d.rot).
+			Offset(d.pos.Mul(pxPerDp).Add(half.Mul(s)))
+		st := op.Affine(tr).Push(gtx.Ops)
+		cl := clip.Rect{Max: size}.Push(gtx.Ops)
+		off := op.Offset(d.src.Min.Mul(-1)).Push(gtx.Ops)
+		d.img.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		off.Pop()
+		cl.Pop()
+		st.Pop()
+	}
+	b.draws = b.draws[:0]
+}
+
+var builtinsGame = map[string]*env.Builtin{
+	"game-loop": {
+		Doc:   "Run a window as a game until it's closed: update is called with dt in seconds the given number of times per second, draw each frame with the context and the fraction of a step since the last update",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "game-loop", 1, arg0)
+			if err != nil {
+				return err
+			}
+			rate, err := integerArg(ps, "game-loop", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if rate <= 0 {
+				return failure(ps, "game-loop", "arg 2: expected a positive update rate")
+			}
+			update, err := functionArg(ps, "game-loop", 3, 1, arg2)
+			if err != nil {
+				return err
+			}
+			draw, err := functionArg(ps, "game-loop", 4, 2, arg3)
+			if err != nil {
+				return err
+			}
+			if currentGame != nil {
+				return failure(ps, "game-loop", "a game is already running")
+			}
+			g := &Game{ps: ps, win: win, Step: time.Second / time.Duration(rate), update: update, draw: draw,
+				down: map[key.Name]bool{}, pressed: map[key.Name]bool{}}
+			g.Run()
+			return *env.NewInteger(0)
+		},
+	},
+	"key-down?": {
+		Doc:   "Check whether a key is held in the running game, e.g. 'left 'space 'a",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			k, err := keyNameArg(ps, "key-down?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if currentGame == nil {
+				return failure(ps, "key-down?", "no game is running")
+			}
+			return *env.NewInteger(boolToInt64(currentGame.down[k]))
+		},
+	},
+	"key-pressed?": {
+		Doc:   "Check whether a key went down since the last update of the running game",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			k, err := keyNameArg(ps, "key-pressed?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if currentGame == nil {
+				return failure(ps, "key-pressed?", "no game is running")
+			}
+			return *env.NewInteger(boolToInt64(currentGame.pressed[k]))
+		},
+	},
+	"load-image": {
+		Doc:   "Load a PNG, JPEG or GIF file as an image op, shared through the image cache",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "load-image", 1, arg0)
+			if err != nil {
+				return err
+			}
+			io, ierr := cachedImage(path)
+			if ierr != nil {
+				return failure(ps, "load-image", ierr.Error())
+			}
+			return *env.NewNative(ps.Idx, &io, "Go(*paint.ImageOp)")
+		},
+	},
+	"sprite-batch": {
+		Doc:   "Create a sprite batch that paints queued images in one pass",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			return *env.NewNative(ps.Idx, &SpriteBatch{}, "Go(*gioui_org.SpriteBatch)")
+		},
+	},
+	"Go(*gioui_org.SpriteBatch)//draw": {
+		Doc:   "Queue an image with its top-left corner at x y",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*SpriteBatch](ps, "Go(*gioui_org.SpriteBatch)//draw", 1, arg0)
+			if err != nil {
+				return err
+			}
+			img, err := imageArg(ps, "Go(*gioui_org.SpriteBatch)//draw", 2, arg1)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "Go(*gioui_org.SpriteBatch)//draw", 3, arg2, arg3)
+			if err != nil {
+				return err
+			}
+			b.Add(img, image.Rectangle{Max: img.Size()}, f32.Pt(x, y), 1, 0)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SpriteBatch)//flush": {
+		Doc:   "Paint the queued images and empty the batch",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*SpriteBatch](ps, "Go(*gioui_org.SpriteBatch)//flush", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.SpriteBatch)//flush", 2, arg1)
+			if err != nil {
+				return err
+			}
+			b.Flush(gtx)
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,373 @@
+// CSS-grid-like layout of tracks and named areas.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+type trackKind int
+
+const (
+	trackFixed trackKind = iota
+	trackFr
+	trackAuto
+)
+
+// gridTrack is the size of a row or column: fixed dp, a fraction of the
+// space left, or the size of its content.
+type gridTrack struct {
+	kind trackKind
+	size float32
+}
+
+// unboundedSize is the constraint from which a grid treats its height or
+// width as unbounded, like in a list, and sizes fr tracks as auto.
+const unboundedSize = 1e6
+
+// Grid lays out widgets in areas of a template of rows and columns.
+type Grid struct {
+	cols, rows     []gridTrack
+	colGap, rowGap unit.Dp
+	// areas are the cells an area spans, as column and row ranges.
+	areas map[string]image.Rectangle
+}
+
+// gridChild is a widget placed in an area of a grid.
+type gridChild struct {
+	area image.Rectangle
+	w    layout.Widget
+}
+
+// trackArg accepts a number of dp, a fraction like "1fr" or 'auto.
+func trackArg(ps *env.ProgramState, o env.Object) (gridTrack, bool) {
+	switch v := o.(type) {
+	case env.Integer:
+		return gridTrack{trackFixed, float32(v.Value)}, true
+	case env.Decimal:
+		return gridTrack{trackFixed, float32(v.Value)}, true
+	}
+	var s string
+	switch v := o.(type) {
+	case env.Word:
+		s = ps.Idx.GetWord(v.Index)
+	case env.Tagword:
+		s = ps.Idx.GetWord(v.Index)
+	case env.String:
+		s = v.Value
+	}
+	if s == "auto" {
+		return gridTrack{kind: trackAuto}, true
+	}
+	if f, ok := strings.CutSuffix(s, "fr"); ok {
+		if v, err := strconv.ParseFloat(f, 32); err == nil && v > 0 {
+			return gridTrack{trackFr, float32(v)}, true
+		}
+	}
+	return gridTrack{}, false
+}
+
+func tracksArg(ps *env.ProgramState, key string, o env.Object) ([]gridTrack, *env.Error) {
+	blk, ok := o.(env.Block)
+	if !ok {
+		return nil, failure(ps, "grid", key+": expected block of tracks, but got "+objectDebugString(ps.Idx, o))
+	}
+	res := make([]gridTrack, len(blk.Series.S))
+	for i, it := range blk.Series.S {
+		t, ok := trackArg(ps, it)
+		if !ok {
+			return nil, failure(ps, "grid", fmt.Sprintf("%s: track %d: expected dp, \"1fr\" or 'auto, but got %s", key, i+1, objectDebugString(ps.Idx, it)))
+		}
+		res[i] = t
+	}
+	return res, nil
+}
+
+// parseAreas reads the rows of a template of area names; each name must
+// cover a rectangle of cells, and "." is an empty cell.
+func parseAreas(rows []string, ncols int) (map[string]image.Rectangle, error) {
+	areas := map[string]image.Rectangle{}
+	cells := map[string]int{}
+	for y, row := range rows {
+		names := strings.Fields(row)
+		if len(names) != ncols {
+			return nil, fmt.Errorf("areas: row %d has %d cells, but there are %d columns", y+1, len(names), ncols)
+		}
+		for x, n := range names {
+			if n == "." {
+				continue
+			}
+			cell := image.Rect(x, y, x+1, y+1)
+			if r, ok := areas[n]; ok {
+				cell = r.Union(cell)
+			}
+			areas[n] = cell
+			cells[n]++
+		}
+	}
+	for n, r := range areas {
+		if r.Dx()*r.Dy() != cells[n] {
+			return nil, fmt.Errorf("areas: %s is not a rectangle", n)
+		}
+	}
+	return areas, nil
+}
+
+// gridOf makes a grid from a spec of columns, rows, areas and gaps.
+func gridOf(ps *env.ProgramState, spec map[string]env.Object) (*Grid, *env.Error) {
+	g := &Grid{}
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var areas []string
+	for _, k := range keys {
+		o := spec[k]
+		var err *env.Error
+		switch k {
+		case "columns":
+			g.cols, err = tracksArg(ps, k, o)
+		case "rows":
+			g.rows, err = tracksArg(ps, k, o)
+		case "areas":
+			blk, ok := o.(env.Block)
+			if !ok {
+				return nil, failure(ps, "grid", "areas: expected block of strings, but got "+objectDebugString(ps.Idx, o))
+			}
+			for _, it := range blk.Series.S {
+				s, ok := it.(env.String)
+				if !ok {
+					return nil, failure(ps, "grid", "areas: expected block of strings, but got "+objectDebugString(ps.Idx, it))
+				}
+				areas = append(areas, s.Value)
+			}
+		case "gap", "row-gap", "column-gap":
+			var d float64
+			if d, err = decimalArg(ps, "grid", 1, o); err == nil {
+				if k != "column-gap" {
+					g.rowGap = unit.Dp(d)
+				}
+				if k != "row-gap" {
+					g.colGap = unit.Dp(d)
+				}
+			}
+		default:
+			return nil, failure(ps, "grid", "no key "+k+" (keys: areas column-gap columns gap row-gap rows)")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if areas != nil {
+		if g.cols == nil {
+			g.cols = make([]gridTrack, len(strings.Fields(areas[0])))
+			for i := range g.cols {
+				g.cols[i] = gridTrack{trackFr, 1}
+			}
+		}
+		for len(g.rows) < len(areas) {
+			g.rows = append(g.rows, gridTrack{kind: trackAuto})
+		}
+		if len(g.rows) > len(areas) {
+			return nil, failure(ps, "grid", fmt.Sprintf("areas: %d rows of areas for %d rows", len(areas), len(g.rows)))
+		}
+		a, aerr := parseAreas(areas, len(g.cols))
+		if aerr != nil {
+			return nil, failure(ps, "grid", aerr.Error())
+		}
+		g.areas = a
+	}
+	if len(g.cols) == 0 || len(g.rows) == 0 {
+		return nil, failure(ps, "grid", "expected columns and rows, or areas")
+	}
+	return g, nil
+}
+
+// areaArg accepts an area name, or a block of column and row (1-based) and
+// optionally the columns and rows spanned.
+func (g *Grid) areaArg(ps *env.ProgramState, name string, n int, arg env.Object) (image.Rectangle, *env.Error) {
+	if blk, ok := arg.(env.Block); ok {
+		var v [4]int
+		s := blk.Series.S
+		if len(s) != 2 && len(s) != 4 {
+			return image.Rectangle{}, argError(ps, name, n, "block of column and row, and spans", arg)
+		}
+		v[2], v[3] = 1, 1
+		for i, o := range s {
+			x, err := integerArg(ps, name, n, o)
+			if err != nil {
+				return image.Rectangle{}, err
+			}
+			v[i] = int(x)
+		}
+		r := image.Rect(v[0]-1, v[1]-1, v[0]-1+v[2], v[1]-1+v[3])
+		if v[2] < 1 || v[3] < 1 || !r.In(image.Rect(0, 0, len(g.cols), len(g.rows))) {
+			return image.Rectangle{}, failure(ps, name, fmt.Sprintf("cell %v is outside the grid of %d columns and %d rows", s, len(g.cols), len(g.rows)))
+		}
+		return r, nil
+	}
+	a, err := nameArg(ps, name, n, arg)
+	if err != nil {
+		return image.Rectangle{}, argError(ps, name, n, "area name or block of column and row", arg)
+	}
+	r, ok := g.areas[a]
+	if !ok {
+		names := make([]string, 0, len(g.areas))
+		for n := range g.areas {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return image.Rectangle{}, failure(ps, name, "no area "+a+" (areas: "+strings.Join(names, " ")+")")
+	}
+	return r, nil
+}
+
+// trackSizes sizes tracks in pixels: fixed ones first, auto ones to the
+// largest content spanning only them, and fr ones share what is left of
+// avail. When avail is unbounded fr tracks are sized as auto.
+func trackSizes(gtx layout.Context, tracks []gridTrack, gap, avail int, content func(i int) int) []int {
+	sizes := make([]int, len(tracks))
+	used := gap * (len(tracks) - 1)
+	var fr float32
+	for i, t := range tracks {
+		switch {
+		case t.kind == trackFixed:
+			sizes[i] = gtx.Dp(unit.Dp(t.size))
+		case t.kind == trackAuto, avail >= unboundedSize:
+			sizes[i] = content(i)
+		default:
+			fr += t.size
+			continue
+		}
+		used += sizes[i]
+	}
+	if fr > 0 {
+		left := max(avail-used, 0)
+		for i, t := range tracks {
+			if t.kind == trackFr {
+				sizes[i] = int(float32(left) * t.size / fr)
+			}
+		}
+	}
+	return sizes
+}
+
+// span returns the size of tracks from to to and the gaps between them.
+func span(sizes []int, gap, from, to int) int {
+	s := gap * (to - from - 1)
+	for _, v := range sizes[from:to] {
+		s += v
+	}
+	return s
+}
+
+// trackOffset returns where track i starts.
+func trackOffset(sizes []int, gap, i int) int {
+	if i == 0 {
+		return 0
+	}
+	return span(sizes, gap, 0, i) + gap
+}
+
+func (g *Grid) Layout(gtx layout.Context, children []gridChild) layout.Dimensions {
+	cgap, rgap := gtx.Dp(g.colGap), gtx.Dp(g.rowGap)
+	cols := trackSizes(gtx, g.cols, cgap, gtx.Constraints.Max.X, func(i int) int {
+		w := 0
+		for _, c := range children {
+			if c.area.Min.X == i && c.area.Dx() == 1 {
+				cgtx := gtx
+				cgtx.Constraints = layout.Constraints{Max: gtx.Constraints.Max}
+				w = max(w, dryLayout(cgtx, c.w).Size.X)
+			}
+		}
+		return w
+	})
+	rows := trackSizes(gtx, g.rows, rgap, gtx.Constraints.Max.Y, func(i int) int {
+		h := 0
+		for _, c := range children {
+			if c.area.Min.Y == i && c.area.Dy() == 1 {
+				cgtx := gtx
+				cgtx.Constraints = layout.Exact(image.Pt(span(cols, cgap, c.area.Min.X, c.area.Max.X), gtx.Constraints.Max.Y))
+				cgtx.Constraints.Min.Y = 0
+				h = max(h, dryLayout(cgtx, c.w).Size.Y)
+			}
+		}
+		return h
+	})
+	for _, c := range children {
+		at := image.Pt(trackOffset(cols, cgap, c.area.Min.X), trackOffset(rows, rgap, c.area.Min.Y))
+		cgtx := gtx
+		cgtx.Constraints = layout.Exact(image.Pt(span(cols, cgap, c.area.Min.X, c.area.Max.X), span(rows, rgap, c.area.Min.Y, c.area.Max.Y)))
+		t := op.Offset(at).Push(gtx.Ops)
+		c.w(cgtx)
+		t.Pop()
+	}
+	size := image.Pt(span(cols, cgap, 0, len(cols)), span(rows, rgap, 0, len(rows)))
+	return layout.Dimensions{Size: gtx.Constraints.Constrain(size)}
+}
+
+var builtinsGrid = map[string]*env.Builtin{
+	"grid": {
+		Doc:   "Create a grid from a dict or context of columns and rows (blocks of dp, \"1fr\" or 'auto), areas (a block of strings of area names per row, \".\" for none) and gap, row-gap or column-gap in dp",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			spec, ok := objectEntries(ps, arg0)
+			if !ok {
+				return argError(ps, "grid", 1, "dict or context", arg0)
+			}
+			g, err := gridOf(ps, spec)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, g, "Go(*gioui_org.Grid)")
+		},
+	},
+	"Go(*gioui_org.Grid)//layout": {
+		Doc:   "Lay out a block of pairs of area and widget; an area is a name of the grid's areas or a block of column and row (1-based), optionally followed by the columns and rows spanned",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*Grid](ps, "Go(*gioui_org.Grid)//layout", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.Grid)//layout", 2, arg1)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg2.(env.Block)
+			if !ok {
+				return argError(ps, "Go(*gioui_org.Grid)//layout", 3, "block", arg2)
+			}
+			items := blk.Series.S
+			if len(items)%2 != 0 {
+				return failure(ps, "Go(*gioui_org.Grid)//layout", "arg 3: expected pairs of area and widget")
+			}
+			children := make([]gridChild, 0, len(items)/2)
+			for i := 0; i < len(items); i += 2 {
+				a, err := g.areaArg(ps, "Go(*gioui_org.Grid)//layout", 3, items[i])
+				if err != nil {
+					return err
+				}
+				w, err := widgetArg(ps, "Go(*gioui_org.Grid)//layout", 3, items[i+1])
+				if err != nil {
+					return err
+				}
+				children = append(children, gridChild{a, w})
+			}
+			return dimensionsObj(ps, g.Layout(gtx, children))
+		},
+	},
+}
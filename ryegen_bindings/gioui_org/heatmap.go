@@ -0,0 +1,429 @@
+// Heatmaps of matrices of values.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// legendSteps is how many bands the color scale of the legend is drawn as.
+const legendSteps = 64
+
+// Heatmap shows a matrix of values as a grid of cells colored from the low
+// to the high end of a range, with the labels of rows and columns, a legend
+// of the colors under it and the value of the cell hovered in a tip.
+type Heatmap struct {
+	ps           *env.ProgramState
+	Theme        *material.Theme
+	Values       [][]float64 // rows of values, the longest giving the columns
+	RowLabels    []string
+	ColumnLabels []string
+	Min, Max     float64     // the range of the colors, the values' if Max <= Min
+	Low, High    color.NRGBA // colors of the ends, the spectrogram's if both unset
+	Decimals     int         // of values shown, -1 for as few as needed
+	ShowValues   bool        // in the cells big enough for them
+	Legend       bool
+	OnClick      *env.Function
+	hovered      image.Point // column and row, X -1 for none
+	grid         image.Rectangle
+}
+
+func (h *Heatmap) columns() int {
+	n := 0
+	for _, r := range h.Values {
+		n = max(n, len(r))
+	}
+	return n
+}
+
+// valueRange returns the range colored, the values' unless one is set.
+func (h *Heatmap) valueRange() (float64, float64) {
+	if h.Max > h.Min {
+		return h.Min, h.Max
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, r := range h.Values {
+		for _, v := range r {
+			if !math.IsNaN(v) {
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+	}
+	if lo > hi {
+		return 0, 1
+	}
+	if lo == hi {
+		return lo - 1, hi + 1
+	}
+	return lo, hi
+}
+
+// color returns the color of a fraction of the range, from 0 to 1.
+func (h *Heatmap) color(f float32) color.NRGBA {
+	f = max(0, min(f, 1))
+	if h.Low == (color.NRGBA{}) && h.High == (color.NRGBA{}) {
+		return spectrogramColor(f)
+	}
+	mix := func(x, y uint8) uint8 { return uint8(float32(x) + (float32(y)-float32(x))*f) }
+	return color.NRGBA{R: mix(h.Low.R, h.High.R), G: mix(h.Low.G, h.High.G), B: mix(h.Low.B, h.High.B), A: mix(h.Low.A, h.High.A)}
+}
+
+func (h *Heatmap) format(v float64) string {
+	return strconv.FormatFloat(v, 'f', h.Decimals, 64)
+}
+
+// cellAt returns the column and row of the cell at p, X -1 for none.
+func (h *Heatmap) cellAt(p image.Point) image.Point {
+	cols, rows := h.columns(), len(h.Values)
+	if !p.In(h.grid) || cols == 0 || rows == 0 {
+		return image.Pt(-1, -1)
+	}
+	c := (p.X - h.grid.Min.X) * cols / h.grid.Dx()
+	r := (p.Y - h.grid.Min.Y) * rows / h.grid.Dy()
+	if c >= len(h.Values[r]) {
+		return image.Pt(-1, -1)
+	}
+	return image.Pt(c, r)
+}
+
+// cellRect returns the bounds of the cell in column c and row r.
+func (h *Heatmap) cellRect(c, r int) image.Rectangle {
+	cols, rows := h.columns(), len(h.Values)
+	g := h.grid
+	return image.Rect(g.Min.X+c*g.Dx()/cols, g.Min.Y+r*g.Dy()/rows, g.Min.X+(c+1)*g.Dx()/cols, g.Min.Y+(r+1)*g.Dy()/rows)
+}
+
+func (h *Heatmap) update(gtx layout.Context) {
+	for {
+		ev, ok := gtx.Event(pointer.Filter{Target: h, Kinds: pointer.Enter | pointer.Move | pointer.Leave | pointer.Press | pointer.Cancel})
+		if !ok {
+			break
+		}
+		e, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch e.Kind {
+		case pointer.Enter, pointer.Move:
+			h.hovered = h.cellAt(e.Position.Round())
+		case pointer.Leave, pointer.Cancel:
+			h.hovered = image.Pt(-1, -1)
+		case pointer.Press:
+			c := h.cellAt(e.Position.Round())
+			if c.X >= 0 && h.OnClick != nil {
+				callFunction(h.ps, "heatmap on-click", *h.OnClick, *env.NewInteger(int64(c.Y)), *env.NewInteger(int64(c.X)), *env.NewDecimal(h.Values[c.Y][c.X]))
+			}
+		}
+	}
+}
+
+// label lays out a caption, returning its call and size.
+func (h *Heatmap) label(gtx layout.Context, s string, align text.Alignment) (op.CallOp, image.Point) {
+	gtx.Constraints.Min = image.Point{}
+	lbl := material.Caption(h.Theme, s)
+	lbl.Color = mulAlpha(h.Theme.Fg, 0xb0)
+	lbl.Alignment = align
+	lbl.MaxLines = 1
+	m := op.Record(gtx.Ops)
+	d := lbl.Layout(gtx)
+	return m.Stop(), d.Size
+}
+
+func (h *Heatmap) Layout(gtx layout.Context) layout.Dimensions {
+	h.update(gtx)
+	th := h.Theme
+	size := gtx.Constraints.Max
+	cols, rows := h.columns(), len(h.Values)
+	lo, hi := h.valueRange()
+	gap := gtx.Dp(4)
+
+	// Room for the row labels on the left, the column labels on top and
+	// the legend under the cells.
+	var left, top, bottom int
+	lgtx := gtx
+	lgtx.Constraints.Max = image.Pt(size.X/3, size.Y)
+	rowLabels := make([]op.CallOp, len(h.RowLabels))
+	rowSizes := make([]image.Point, len(h.RowLabels))
+	for i, s := range h.RowLabels {
+		rowLabels[i], rowSizes[i] = h.label(lgtx, s, text.End)
+		left = max(left, rowSizes[i].X+gap)
+	}
+	colLabels := make([]op.CallOp, len(h.ColumnLabels))
+	colSizes := make([]image.Point, len(h.ColumnLabels))
+	if cols > 0 {
+		lgtx.Constraints.Max = image.Pt(max((size.X-left)/cols, 1), size.Y)
+	}
+	for i, s := range h.ColumnLabels {
+		colLabels[i], colSizes[i] = h.label(lgtx, s, text.Middle)
+		top = max(top, colSizes[i].Y+gap)
+	}
+	var loLabel, hiLabel op.CallOp
+	var loSize, hiSize image.Point
+	if h.Legend {
+		lgtx.Constraints.Max = size
+		loLabel, loSize = h.label(lgtx, h.format(lo), text.Start)
+		hiLabel, hiSize = h.label(lgtx, h.format(hi), text.End)
+		bottom = gap*2 + gtx.Dp(10) + max(loSize.Y, hiSize.Y)
+	}
+	h.grid = image.Rect(left, top, size.X, max(size.Y-bottom, top))
+	if cols == 0 || rows == 0 || h.grid.Empty() {
+		return layout.Dimensions{Size: size}
+	}
+
+	for r, row := range h.Values {
+		for c, v := range row {
+			cell := h.cellRect(c, r)
+			col := mulAlpha(th.Fg, 0x10)
+			if !math.IsNaN(v) {
+				col = h.color(float32((v - lo) / (hi - lo)))
+			}
+			paint.FillShape(gtx.Ops, col, clip.Rect(cell).Op())
+			if !h.ShowValues || math.IsNaN(v) {
+				continue
+			}
+			vgtx := gtx
+			vgtx.Constraints = layout.Constraints{Max: cell.Size()}
+			lbl := material.Caption(th, h.format(v))
+			lbl.MaxLines = 1
+			lbl.Alignment = text.Middle
+			// Dark text on light cells, light on dark ones.
+			if luminance(col) > 0.5 {
+				lbl.Color = color.NRGBA{A: 0xff}
+			} else {
+				lbl.Color = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+			}
+			m := op.Record(gtx.Ops)
+			d := lbl.Layout(vgtx)
+			call := m.Stop()
+			if d.Size.X > cell.Dx() || d.Size.Y > cell.Dy() {
+				continue
+			}
+			off := op.Offset(cell.Min.Add(cell.Size().Sub(d.Size).Div(2))).Push(gtx.Ops)
+			call.Add(gtx.Ops)
+			off.Pop()
+		}
+	}
+	for r := range min(rows, len(rowLabels)) {
+		cell := h.cellRect(0, r)
+		at := image.Pt(left-gap-rowSizes[r].X, cell.Min.Y+(cell.Dy()-rowSizes[r].Y)/2)
+		off := op.Offset(at).Push(gtx.Ops)
+		rowLabels[r].Add(gtx.Ops)
+		off.Pop()
+	}
+	for c := range min(cols, len(colLabels)) {
+		cell := h.cellRect(c, 0)
+		at := image.Pt(cell.Min.X+(cell.Dx()-colSizes[c].X)/2, top-gap-colSizes[c].Y)
+		off := op.Offset(at).Push(gtx.Ops)
+		colLabels[c].Add(gtx.Ops)
+		off.Pop()
+	}
+	if h.Legend {
+		y := h.grid.Max.Y + gap
+		bar := image.Rect(h.grid.Min.X, y, h.grid.Max.X, y+gtx.Dp(10))
+		for i := range legendSteps {
+			band := image.Rect(bar.Min.X+i*bar.Dx()/legendSteps, bar.Min.Y, bar.Min.X+(i+1)*bar.Dx()/legendSteps, bar.Max.Y)
+			paint.FillShape(gtx.Ops, h.color((float32(i)+0.5)/legendSteps), clip.Rect(band).Op())
+		}
+		off := op.Offset(image.Pt(bar.Min.X, bar.Max.Y+gap)).Push(gtx.Ops)
+		loLabel.Add(gtx.Ops)
+		off.Pop()
+		off = op.Offset(image.Pt(bar.Max.X-hiSize.X, bar.Max.Y+gap)).Push(gtx.Ops)
+		hiLabel.Add(gtx.Ops)
+		off.Pop()
+	}
+
+	area := clip.Rect(h.grid).Push(gtx.Ops)
+	event.Op(gtx.Ops, h)
+	area.Pop()
+	if c := h.hovered; c.X >= 0 && c.Y < rows && c.X < len(h.Values[c.Y]) {
+		cell := h.cellRect(c.X, c.Y)
+		paint.FillShape(gtx.Ops, th.Fg, clip.Stroke{Path: clip.Rect(cell).Path(), Width: float32(gtx.Dp(1.5))}.Op())
+		tip := h.format(h.Values[c.Y][c.X])
+		if c.X < len(h.ColumnLabels) {
+			tip = h.ColumnLabels[c.X] + ": " + tip
+		}
+		if c.Y < len(h.RowLabels) {
+			tip = h.RowLabels[c.Y] + ", " + tip
+		}
+		m := op.Record(gtx.Ops)
+		layoutTipAt(gtx, th, cell, size, tipText(th, tip))
+		deferLayer(gtx.Ops, layerOverlay, m.Stop())
+	}
+	return layout.Dimensions{Size: size}
+}
+
+// luminance returns the perceived brightness of c, from 0 to 1.
+func luminance(c color.NRGBA) float32 {
+	return (0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)) / 255
+}
+
+// matrixArg accepts a block of rows, each a block of numbers.
+func matrixArg(ps *env.ProgramState, name string, n int, arg env.Object) ([][]float64, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block of rows", arg)
+	}
+	rows := make([][]float64, len(blk.Series.S))
+	for i, r := range blk.Series.S {
+		vs, _, err := numbersArg(ps, name, n, r)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = vs
+	}
+	return rows, nil
+}
+
+// stringsArg accepts a block of strings.
+func stringsArg(ps *env.ProgramState, name string, n int, arg env.Object) ([]string, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block of strings", arg)
+	}
+	res := make([]string, len(blk.Series.S))
+	for i, o := range blk.Series.S {
+		s, ok := o.(env.String)
+		if !ok {
+			return nil, argError(ps, name, n, "block of strings", arg)
+		}
+		res[i] = s.Value
+	}
+	return res, nil
+}
+
+func heatmapBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, h *Heatmap, arg1, arg2 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.Heatmap)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*Heatmap](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, h, arg1, arg2); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsHeatmap = map[string]*env.Builtin{
+	"heatmap": {
+		Doc:   "Create a heatmap of a block of rows, each a block of numbers, with a legend; hover a cell to see its value",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "heatmap", 1, arg0)
+			if err != nil {
+				return err
+			}
+			vs, err := matrixArg(ps, "heatmap", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h := &Heatmap{ps: ps, Theme: th, Values: vs, Decimals: -1, Legend: true, hovered: image.Pt(-1, -1)}
+			return *env.NewNative(ps.Idx, h, "Go(*gioui_org.Heatmap)")
+		},
+	},
+	"Go(*gioui_org.Heatmap)//layout": layoutBuiltin[*Heatmap]("Go(*gioui_org.Heatmap)//layout"),
+	"Go(*gioui_org.Heatmap)//values!": heatmapBuiltin("values!", "Replace the values with a block of rows, each a block of numbers", 2, func(ps *env.ProgramState, name string, h *Heatmap, arg1, _ env.Object) env.Object {
+		vs, err := matrixArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		h.Values, h.hovered = vs, image.Pt(-1, -1)
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//values?": heatmapBuiltin("values?", "Get the values as a block of rows, each a block of numbers", 1, func(ps *env.ProgramState, name string, h *Heatmap, _, _ env.Object) env.Object {
+		rows := make([]env.Object, len(h.Values))
+		for i, r := range h.Values {
+			rows[i] = numbersObj(r, false)
+		}
+		return *env.NewBlock(*env.NewTSeries(rows))
+	}),
+	"Go(*gioui_org.Heatmap)//labels!": heatmapBuiltin("labels!", "Set the labels of the rows and of the columns, as blocks of strings", 3, func(ps *env.ProgramState, name string, h *Heatmap, arg1, arg2 env.Object) env.Object {
+		rows, err := stringsArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		cols, err := stringsArg(ps, name, 3, arg2)
+		if err != nil {
+			return err
+		}
+		h.RowLabels, h.ColumnLabels = rows, cols
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//range!": heatmapBuiltin("range!", "Set the values colored as the low and high ends; an empty range goes back to the values' own", 3, func(ps *env.ProgramState, name string, h *Heatmap, arg1, arg2 env.Object) env.Object {
+		lo, err := decimalArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		hi, err := decimalArg(ps, name, 3, arg2)
+		if err != nil {
+			return err
+		}
+		h.Min, h.Max = lo, hi
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//colors!": heatmapBuiltin("colors!", "Set the colors of the low and high ends of the range, blended between", 3, func(ps *env.ProgramState, name string, h *Heatmap, arg1, arg2 env.Object) env.Object {
+		lo, err := colorArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		hi, err := colorArg(ps, name, 3, arg2)
+		if err != nil {
+			return err
+		}
+		h.Low, h.High = lo, hi
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//decimals!": heatmapBuiltin("decimals!", "Set the decimals values are shown with, -1 for as few as needed", 2, func(ps *env.ProgramState, name string, h *Heatmap, arg1, _ env.Object) env.Object {
+		n, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		h.Decimals = int(max(n, -1))
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//show-values!": heatmapBuiltin("show-values!", "Set whether the values are shown in the cells big enough for them", 2, func(ps *env.ProgramState, name string, h *Heatmap, arg1, _ env.Object) env.Object {
+		b, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		h.ShowValues = b != 0
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//legend!": heatmapBuiltin("legend!", "Set whether the legend of colors is shown under the cells", 2, func(ps *env.ProgramState, name string, h *Heatmap, arg1, _ env.Object) env.Object {
+		b, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		h.Legend = b != 0
+		return nil
+	}),
+	"Go(*gioui_org.Heatmap)//on-click!": heatmapBuiltin("on-click!", "Set function called with the row, the column and the value of each cell clicked", 2, func(ps *env.ProgramState, name string, h *Heatmap, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 3, arg1)
+		if err != nil {
+			return err
+		}
+		h.OnClick = &fn
+		return nil
+	}),
+}
@@ -0,0 +1,329 @@
+// Helpers shared by the hand-written builtins. They mirror the argument
+// conversion and error conventions of the generated bindings.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+
+	"gioui.org/layout"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+	"github.com/refaktor/rye/evaldo"
+)
+
+// argError sets the failure flag and returns an error in the format used by
+// the generated builtins ("name: arg N: expected ..., but got ...").
+func argError(ps *env.ProgramState, name string, n int, expected string, arg env.Object) *env.Error {
+	ps.FailureFlag = true
+	return env.NewError(name + ": arg " + strconv.Itoa(n) + ": " + "expected " + expected + ", but got " + objectDebugString(ps.Idx, arg))
+}
+
+// failure sets the failure flag and returns an error prefixed with name.
+func failure(ps *env.ProgramState, name string, msg string) *env.Error {
+	ps.FailureFlag = true
+	return env.NewError(name + ": " + msg)
+}
+
+// nativeArg extracts a native of Go type T from arg.
+func nativeArg[T any](ps *env.ProgramState, name string, n int, arg env.Object) (T, *env.Error) {
+	var zero T
+	nat, ok := arg.(env.Native)
+	if !ok {
+		return zero, argError(ps, name, n, "native", arg)
+	}
+	v, ok := nat.Value.(T)
+	if !ok {
+		return zero, argError(ps, name, n, "native of type "+fmt.Sprintf("%T", zero), arg)
+	}
+	return v, nil
+}
+
+// contextArg extracts a layout context (Go(*layout.Context)) from arg.
+func contextArg(ps *env.ProgramState, name string, n int, arg env.Object) (layout.Context, *env.Error) {
+	gtx, err := nativeArg[*layout.Context](ps, name, n, arg)
+	if err != nil {
+		return layout.Context{}, err
+	}
+	return *gtx, nil
+}
+
+// decimalArg accepts a decimal or an integer.
+func decimalArg(ps *env.ProgramState, name string, n int, arg env.Object) (float64, *env.Error) {
+	switch v := arg.(type) {
+	case env.Decimal:
+		return v.Value, nil
+	case env.Integer:
+		return float64(v.Value), nil
+	}
+	return 0, argError(ps, name, n, "decimal or integer", arg)
+}
+
+// integerArg accepts an integer.
+func integerArg(ps *env.ProgramState, name string, n int, arg env.Object) (int64, *env.Error) {
+	if v, ok := arg.(env.Integer); ok {
+		return v.Value, nil
+	}
+	return 0, argError(ps, name, n, "integer", arg)
+}
+
+// stringArg accepts a string.
+func stringArg(ps *env.ProgramState, name string, n int, arg env.Object) (string, *env.Error) {
+	if v, ok := arg.(env.String); ok {
+		return v.Value, nil
+	}
+	return "", argError(ps, name, n, "string", arg)
+}
+
+// nameArg accepts a word (e.g. 'top-left) or a string and returns its name.
+func nameArg(ps *env.ProgramState, name string, n int, arg env.Object) (string, *env.Error) {
+	switch v := arg.(type) {
+	case env.Word:
+		return ps.Idx.GetWord(v.Index), nil
+	case env.String:
+		return v.Value, nil
+	}
+	return "", argError(ps, name, n, "word or string", arg)
+}
+
+// imageArg accepts a paint.ImageOp native or a path of an image file,
+// decoded through the image cache.
+func imageArg(ps *env.ProgramState, name string, n int, arg env.Object) (paint.ImageOp, *env.Error) {
+	switch v := arg.(type) {
+	case env.Native:
+		switch img := v.Value.(type) {
+		case paint.ImageOp:
+			return img, nil
+		case *paint.ImageOp:
+			return *img, nil
+		case image.Image:
+			return cachedImageOp(img), nil
+		}
+	case env.String:
+		img, err := cachedImage(v.Value)
+		if err != nil {
+			return paint.ImageOp{}, failure(ps, name, "arg "+strconv.Itoa(n)+": "+err.Error())
+		}
+		return img, nil
+	}
+	return paint.ImageOp{}, argError(ps, name, n, "image native or file path", arg)
+}
+
+// loadImage decodes a PNG, JPEG or GIF file.
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// colorArg accepts a Go(color.NRGBA) native, a "#rrggbb" / "#rrggbbaa"
+// string or a block of 3 or 4 integers.
+func colorArg(ps *env.ProgramState, name string, n int, arg env.Object) (color.NRGBA, *env.Error) {
+	switch v := arg.(type) {
+	case env.Native:
+		switch c := v.Value.(type) {
+		case color.NRGBA:
+			return c, nil
+		case *color.NRGBA:
+			return *c, nil
+		}
+	case env.String:
+		if c, ok := parseHexColor(v.Value); ok {
+			return c, nil
+		}
+	case env.Block:
+		if c, ok := blockToColor(v); ok {
+			return c, nil
+		}
+	}
+	return color.NRGBA{}, argError(ps, name, n, "color native, hex string or block of integers", arg)
+}
+
+func parseHexColor(s string) (color.NRGBA, bool) {
+	if len(s) > 0 && s[0] == '#' {
+		s = s[1:]
+	}
+	if len(s) != 6 && len(s) != 8 {
+		return color.NRGBA{}, false
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	u, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{R: uint8(u >> 24), G: uint8(u >> 16), B: uint8(u >> 8), A: uint8(u)}, true
+}
+
+func blockToColor(b env.Block) (color.NRGBA, bool) {
+	s := b.Series.S
+	if len(s) != 3 && len(s) != 4 {
+		return color.NRGBA{}, false
+	}
+	c := [4]uint8{0, 0, 0, 255}
+	for i, o := range s {
+		v, ok := o.(env.Integer)
+		if !ok || v.Value < 0 || v.Value > 255 {
+			return color.NRGBA{}, false
+		}
+		c[i] = uint8(v.Value)
+	}
+	return color.NRGBA{R: c[0], G: c[1], B: c[2], A: c[3]}, true
+}
+
+// widgetArg accepts a layout.Widget native or a Rye function of one
+// argument (the layout context) returning dimensions.
+func widgetArg(ps *env.ProgramState, name string, n int, arg env.Object) (layout.Widget, *env.Error) {
+	switch v := arg.(type) {
+	case env.Native:
+		if w, ok := v.Value.(layout.Widget); ok {
+			return w, nil
+		}
+	case env.Function:
+		if v.Argsn != 1 {
+			ps.FailureFlag = true
+			return nil, env.NewError(name + ": arg " + strconv.Itoa(n) + ": " + "expected 1 function arguments, but got " + strconv.Itoa(v.Argsn))
+		}
+		return functionWidget(ps, name, n, v), nil
+	}
+	return nil, argError(ps, name, n, "function or native of type layout.Widget", arg)
+}
+
+// functionWidget wraps a Rye function as a layout.Widget.
+func functionWidget(ps *env.ProgramState, name string, n int, fn env.Function) layout.Widget {
+	return func(gtx layout.Context) layout.Dimensions {
+		guardCallback(ps, name, fn, func() {
+			evaldo.CallFunctionArgsN(fn, ps, ps.Ctx, *env.NewNative(ps.Idx, &gtx, "Go(*layout.Context)"))
+		})
+		if v, ok := ps.Res.(env.Native); ok {
+			if dims, ok := v.Value.(*layout.Dimensions); ok {
+				return *dims
+			}
+		}
+		ps.FailureFlag = true
+		printCallbackError(ps, fn, name+": arg "+strconv.Itoa(n)+": callback result: "+"expected native of type *layout.Dimensions, but got "+objectDebugString(ps.Idx, ps.Res))
+		return layout.Dimensions{}
+	}
+}
+
+// functionArg accepts a Rye function taking argsn arguments.
+func functionArg(ps *env.ProgramState, name string, n int, argsn int, arg env.Object) (env.Function, *env.Error) {
+	fn, ok := arg.(env.Function)
+	if !ok {
+		return env.Function{}, argError(ps, name, n, "function", arg)
+	}
+	if fn.Argsn != argsn {
+		ps.FailureFlag = true
+		return env.Function{}, env.NewError(name + ": arg " + strconv.Itoa(n) + ": " + "expected " + strconv.Itoa(argsn) + " function arguments, but got " + strconv.Itoa(fn.Argsn))
+	}
+	return fn, nil
+}
+
+// callFunction calls a Rye callback and reports (but doesn't propagate)
+// errors, the same way generated callbacks do.
+func callFunction(ps *env.ProgramState, name string, fn env.Function, args ...env.Object) env.Object {
+	guardCallback(ps, name, fn, func() {
+		evaldo.CallFunctionArgsN(fn, ps, ps.Ctx, args...)
+	})
+	if ps.ErrorFlag || ps.FailureFlag {
+		printCallbackError(ps, fn, name+": callback failed: "+objectDebugString(ps.Idx, ps.Res))
+	}
+	return ps.Res
+}
+
+func printCallbackError(ps *env.ProgramState, fn env.Function, msg string) {
+	fmt.Printf("\033[31mError: \033[1m%v\033[m\n\033[31mFrom function \033[1m%v { %v }\033[m\n",
+		msg,
+		fn.Spec.Series.PositionAndSurroundingElements(*ps.Idx),
+		fn.Body.Series.PositionAndSurroundingElements(*ps.Idx),
+	)
+}
+
+// binding writes widget values back to a Rye word. The word is modified in
+// the context where it is defined or, if undefined, in the context where the
+// binding was created.
+type binding struct {
+	ctx  *env.RyeCtx
+	word int
+}
+
+// bindingArg accepts a word (e.g. 'rating) to bind to.
+func bindingArg(ps *env.ProgramState, name string, n int, arg env.Object) (*binding, *env.Error) {
+	w, ok := arg.(env.Word)
+	if !ok {
+		return nil, argError(ps, name, n, "word", arg)
+	}
+	return &binding{ctx: ps.Ctx, word: w.Index}, nil
+}
+
+func (b *binding) set(v env.Object) {
+	if b == nil {
+		return
+	}
+	ctx := b.ctx
+	if _, ok, c := ctx.Get2(b.word); ok {
+		ctx = c
+	}
+	ctx.Mod(b.word, v)
+}
+
+// get returns the value of the bound word, if it is defined.
+func (b *binding) get() (env.Object, bool) {
+	if b == nil {
+		return nil, false
+	}
+	return b.ctx.Get(b.word)
+}
+
+// dimensionsObj wraps layout dimensions like the generated Layout methods do.
+func dimensionsObj(ps *env.ProgramState, dims layout.Dimensions) env.Object {
+	return *env.NewNative(ps.Idx, &dims, "Go(*layout.Dimensions)")
+}
+
+// layoutBuiltin returns the "Kind//layout" builtin for a hand-written widget
+// of type T.
+func layoutBuiltin[T interface {
+	Layout(layout.Context) layout.Dimensions
+}](name string) *env.Builtin {
+	return &env.Builtin{
+		Doc:   "Lay out the widget",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := nativeArg[T](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			return dimensionsObj(ps, w.Layout(gtx))
+		},
+	}
+}
+
+// mergeBuiltins joins builtin maps into one.
+func mergeBuiltins(maps ...map[string]*env.Builtin) map[string]*env.Builtin {
+	res := make(map[string]*env.Builtin)
+	for _, m := range maps {
+		for k, v := range m {
+			res[k] = v
+		}
+	}
+	return res
+}
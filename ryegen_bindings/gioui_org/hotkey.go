@@ -0,0 +1,136 @@
+// System-wide hotkeys.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gioui.org/app"
+
+	"github.com/refaktor/rye/env"
+)
+
+type hotkeyMods uint8
+
+const (
+	hotkeyCtrl hotkeyMods = 1 << iota
+	hotkeyAlt
+	hotkeyShift
+	hotkeySuper
+)
+
+// GlobalHotkey is a key combination registered with the OS. Presses are
+// counted even while the window is unfocused and wake up the window, where
+// the script picks them up with pressed?.
+type GlobalHotkey struct {
+	Spec    string
+	mods    hotkeyMods
+	key     string // upper case letter or digit, or a name like "F5" or "Space"
+	presses atomic.Int64
+	id      int
+
+	mu  sync.Mutex
+	win *app.Window
+}
+
+// parseHotkey parses combinations like "Ctrl+Alt+K" or "Super+Shift+F5".
+func parseHotkey(spec string) (*GlobalHotkey, error) {
+	h := &GlobalHotkey{Spec: spec}
+	parts := strings.Split(spec, "+")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if i == len(parts)-1 {
+			if p == "" {
+				return nil, errors.New("missing key in hotkey " + spec)
+			}
+			if len(p) == 1 {
+				p = strings.ToUpper(p)
+			}
+			h.key = p
+			break
+		}
+		switch strings.ToLower(p) {
+		case "ctrl", "control":
+			h.mods |= hotkeyCtrl
+		case "alt", "option":
+			h.mods |= hotkeyAlt
+		case "shift":
+			h.mods |= hotkeyShift
+		case "super", "win", "cmd", "meta":
+			h.mods |= hotkeySuper
+		default:
+			return nil, errors.New("unknown modifier " + p + " in hotkey " + spec)
+		}
+	}
+	return h, nil
+}
+
+// fire is called by the platform backend on a press.
+func (h *GlobalHotkey) fire() {
+	h.presses.Add(1)
+	h.mu.Lock()
+	win := h.win
+	h.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+var builtinsHotkey = map[string]*env.Builtin{
+	"global-hotkey": {
+		Doc:   "Register a system-wide hotkey like \"Ctrl+Alt+K\" that wakes up the window when pressed, even while unfocused",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "global-hotkey", 1, arg0)
+			if err != nil {
+				return err
+			}
+			spec, err := stringArg(ps, "global-hotkey", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h, herr := parseHotkey(spec)
+			if herr != nil {
+				return failure(ps, "global-hotkey", herr.Error())
+			}
+			h.win = win
+			if herr := registerHotkey(h); herr != nil {
+				return failure(ps, "global-hotkey", herr.Error())
+			}
+			// The backend holds registered hotkeys, so they are released by
+			// free or with-resources rather than collected.
+			trackResource(h, func(h *GlobalHotkey) { unregisterHotkey(h) })
+			return *env.NewNative(ps.Idx, h, "Go(*gioui_org.GlobalHotkey)")
+		},
+	},
+	"Go(*gioui_org.GlobalHotkey)//pressed?": {
+		Doc:   "Check whether the hotkey was pressed since the last check",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*GlobalHotkey](ps, "Go(*gioui_org.GlobalHotkey)//pressed?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(h.presses.Swap(0) > 0))
+		},
+	},
+	"Go(*gioui_org.GlobalHotkey)//unregister": {
+		Doc:   "Release the hotkey",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*GlobalHotkey](ps, "Go(*gioui_org.GlobalHotkey)//unregister", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if herr := unregisterHotkey(h); herr != nil {
+				return failure(ps, "Go(*gioui_org.GlobalHotkey)//unregister", herr.Error())
+			}
+			return arg0
+		},
+	},
+}
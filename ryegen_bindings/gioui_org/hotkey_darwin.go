@@ -0,0 +1,165 @@
+//go:build !ios && !b_no_gioui
+
+package gioui_org
+
+/*
+#cgo LDFLAGS: -framework Carbon
+
+#include <Carbon/Carbon.h>
+#include <dispatch/dispatch.h>
+#include <pthread.h>
+
+extern void hotkeyPressed(UInt32 id);
+
+static OSStatus hotkeyHandler(EventHandlerCallRef next, EventRef event, void *data) {
+	EventHotKeyID hid;
+	if (GetEventParameter(event, kEventParamDirectObject, typeEventHotKeyID, NULL, sizeof(hid), NULL, &hid) == noErr) {
+		hotkeyPressed(hid.id);
+	}
+	return noErr;
+}
+
+// hotkeyRegister registers a hotkey with the application event target,
+// installing the handler the first time. Carbon events are dispatched on the
+// main thread, so that's where this runs.
+static OSStatus hotkeyRegister(UInt32 code, UInt32 mods, UInt32 id, EventHotKeyRef *ref) {
+	__block OSStatus err = noErr;
+	void (^reg)(void) = ^{
+		static int installed;
+		if (!installed) {
+			EventTypeSpec spec = {kEventClassKeyboard, kEventHotKeyPressed};
+			err = InstallApplicationEventHandler(NewEventHandlerUPP(hotkeyHandler), 1, &spec, NULL, NULL);
+			if (err != noErr) {
+				return;
+			}
+			installed = 1;
+		}
+		EventHotKeyID hid = {'RyeG', id};
+		err = RegisterEventHotKey(code, mods, hid, GetApplicationEventTarget(), 0, ref);
+	};
+	if (pthread_main_np()) {
+		reg();
+	} else {
+		dispatch_sync(dispatch_get_main_queue(), reg);
+	}
+	return err;
+}
+
+static OSStatus hotkeyUnregister(EventHotKeyRef ref) {
+	__block OSStatus err;
+	void (^unreg)(void) = ^{
+		err = UnregisterEventHotKey(ref);
+	};
+	if (pthread_main_np()) {
+		unreg();
+	} else {
+		dispatch_sync(dispatch_get_main_queue(), unreg);
+	}
+	return err;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Hotkeys are registered with Carbon's RegisterEventHotKey, which unlike a
+// global event monitor needs no accessibility permission.
+
+var hotkeys struct {
+	mu     sync.Mutex
+	keys   map[C.UInt32]*GlobalHotkey
+	refs   map[*GlobalHotkey]C.EventHotKeyRef
+	nextID C.UInt32
+}
+
+//export hotkeyPressed
+func hotkeyPressed(id C.UInt32) {
+	hotkeys.mu.Lock()
+	h := hotkeys.keys[id]
+	hotkeys.mu.Unlock()
+	if h != nil {
+		h.fire()
+	}
+}
+
+func registerHotkey(h *GlobalHotkey) error {
+	code, ok := macKeyCodes[strings.ToLower(h.key)]
+	if !ok {
+		return errors.New("unknown key " + h.key)
+	}
+	var mods C.UInt32
+	if h.mods&hotkeyCtrl != 0 {
+		mods |= C.controlKey
+	}
+	if h.mods&hotkeyAlt != 0 {
+		mods |= C.optionKey
+	}
+	if h.mods&hotkeyShift != 0 {
+		mods |= C.shiftKey
+	}
+	if h.mods&hotkeySuper != 0 {
+		mods |= C.cmdKey
+	}
+	hotkeys.mu.Lock()
+	if hotkeys.keys == nil {
+		hotkeys.keys = make(map[C.UInt32]*GlobalHotkey)
+		hotkeys.refs = make(map[*GlobalHotkey]C.EventHotKeyRef)
+	}
+	hotkeys.nextID++
+	id := hotkeys.nextID
+	hotkeys.keys[id] = h
+	hotkeys.mu.Unlock()
+	var ref C.EventHotKeyRef
+	if st := C.hotkeyRegister(C.UInt32(code), mods, id, &ref); st != C.noErr {
+		hotkeys.mu.Lock()
+		delete(hotkeys.keys, id)
+		hotkeys.mu.Unlock()
+		if st == C.eventHotKeyExistsErr {
+			return errors.New("can't register hotkey " + h.Spec + ": another application has it")
+		}
+		return errors.New("can't register hotkey " + h.Spec + ": error " + strconv.Itoa(int(st)))
+	}
+	hotkeys.mu.Lock()
+	h.id = int(id)
+	hotkeys.refs[h] = ref
+	hotkeys.mu.Unlock()
+	return nil
+}
+
+func unregisterHotkey(h *GlobalHotkey) error {
+	hotkeys.mu.Lock()
+	ref, ok := hotkeys.refs[h]
+	if ok {
+		delete(hotkeys.refs, h)
+		delete(hotkeys.keys, C.UInt32(h.id))
+	}
+	hotkeys.mu.Unlock()
+	if !ok {
+		return errors.New("hotkey " + h.Spec + " is not registered")
+	}
+	if st := C.hotkeyUnregister(ref); st != C.noErr {
+		return errors.New("can't unregister hotkey " + h.Spec + ": error " + strconv.Itoa(int(st)))
+	}
+	return nil
+}
+
+// macKeyCodes maps hotkey key names to virtual key codes of the ANSI
+// layout, which Carbon hotkeys are defined by.
+var macKeyCodes = map[string]uint32{
+	"a": 0x00, "s": 0x01, "d": 0x02, "f": 0x03, "h": 0x04, "g": 0x05, "z": 0x06, "x": 0x07,
+	"c": 0x08, "v": 0x09, "b": 0x0b, "q": 0x0c, "w": 0x0d, "e": 0x0e, "r": 0x0f, "y": 0x10,
+	"t": 0x11, "1": 0x12, "2": 0x13, "3": 0x14, "4": 0x15, "6": 0x16, "5": 0x17, "9": 0x19,
+	"7": 0x1a, "8": 0x1c, "0": 0x1d, "o": 0x1f, "u": 0x20, "i": 0x22, "p": 0x23, "l": 0x25,
+	"j": 0x26, "k": 0x28, "n": 0x2d, "m": 0x2e,
+	"enter": 0x24, "return": 0x24, "tab": 0x30, "space": 0x31, "backspace": 0x33,
+	"escape": 0x35, "esc": 0x35, "insert": 0x72, "help": 0x72, "home": 0x73, "pageup": 0x74,
+	"delete": 0x75, "end": 0x77, "pagedown": 0x79,
+	"left": 0x7b, "right": 0x7c, "down": 0x7d, "up": 0x7e,
+	"f1": 0x7a, "f2": 0x78, "f3": 0x63, "f4": 0x76, "f5": 0x60, "f6": 0x61, "f7": 0x62,
+	"f8": 0x64, "f9": 0x65, "f10": 0x6d, "f11": 0x67, "f12": 0x6f,
+}
@@ -0,0 +1,270 @@
+//go:build !android && !nox11 && !b_no_gioui
+
+package gioui_org
+
+/*
+#cgo linux pkg-config: x11
+
+#include <X11/Xlib.h>
+#include <poll.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+static int hotkeyError;
+
+static int hotkeyOnError(Display *d, XErrorEvent *e) {
+	hotkeyError = e->error_code;
+	return 0;
+}
+
+// hotkeyGrab grabs or releases a key with modifiers on the root window,
+// also with Caps Lock and Num Lock on, which X counts as modifiers too. It
+// returns the X error, BadAccess when another client has the key.
+static int hotkeyGrab(Display *d, int keycode, unsigned int mods, int grab) {
+	unsigned int locks[] = {0, LockMask, Mod2Mask, LockMask | Mod2Mask};
+	Window root = DefaultRootWindow(d);
+	XSync(d, False);
+	hotkeyError = 0;
+	XErrorHandler old = XSetErrorHandler(hotkeyOnError);
+	for (int i = 0; i < 4; i++) {
+		if (grab) {
+			XGrabKey(d, keycode, mods | locks[i], root, True, GrabModeAsync, GrabModeAsync);
+		} else {
+			XUngrabKey(d, keycode, mods | locks[i], root);
+		}
+	}
+	XSync(d, False);
+	XSetErrorHandler(old);
+	return hotkeyError;
+}
+
+// hotkeyNext waits for the next key press, returning its keycode and
+// state, 0 when a byte arrives on wake, or -1 when the display is gone.
+static int hotkeyNext(Display *d, int wake, unsigned int *state) {
+	for (;;) {
+		while (XPending(d)) {
+			XEvent e;
+			XNextEvent(d, &e);
+			if (e.type == KeyPress) {
+				*state = e.xkey.state;
+				return e.xkey.keycode;
+			}
+		}
+		struct pollfd fds[2] = {{ConnectionNumber(d), POLLIN, 0}, {wake, POLLIN, 0}};
+		if (poll(fds, 2, -1) < 0) {
+			continue;
+		}
+		if (fds[1].revents & POLLIN) {
+			char b;
+			read(wake, &b, 1);
+			return 0;
+		}
+		if (fds[0].revents & (POLLERR | POLLHUP)) {
+			return -1;
+		}
+	}
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Hotkeys are grabbed on the root window through a display connection of
+// their own, served by a thread waiting on it. Wayland has no global
+// hotkeys; there they work for X11 apps only, under XWayland.
+
+// x11Hotkey is a grabbed keycode and modifier mask.
+type x11Hotkey struct {
+	code C.int
+	mods C.uint
+}
+
+// hotkeyRequest asks the hotkey thread to (un)register a hotkey, as the
+// display connection is only used there.
+type hotkeyRequest struct {
+	h        *GlobalHotkey
+	register bool
+	done     chan error
+}
+
+var hotkeyThread struct {
+	once     sync.Once
+	err      error         // why the thread isn't running, once done is closed
+	done     chan struct{} // closed when the thread can't serve requests
+	dpy      *C.Display
+	wake     *os.File // written to after sending a request
+	requests chan hotkeyRequest
+	keys     map[x11Hotkey]*GlobalHotkey
+	grabbed  map[*GlobalHotkey]x11Hotkey
+}
+
+func startHotkeyThread() {
+	t := &hotkeyThread
+	t.done = make(chan struct{})
+	t.dpy = C.XOpenDisplay(nil)
+	if t.dpy == nil {
+		t.err = errors.New("global hotkeys need an X11 display")
+		close(t.done)
+		return
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		C.XCloseDisplay(t.dpy)
+		t.err = err
+		close(t.done)
+		return
+	}
+	t.wake = w
+	t.requests = make(chan hotkeyRequest)
+	t.keys = make(map[x11Hotkey]*GlobalHotkey)
+	t.grabbed = make(map[*GlobalHotkey]x11Hotkey)
+	go func() {
+		runtime.LockOSThread()
+		const ignored = C.LockMask | C.Mod2Mask
+		const used = C.ShiftMask | C.ControlMask | C.Mod1Mask | C.Mod4Mask
+		for {
+			var state C.uint
+			code := C.hotkeyNext(t.dpy, C.int(r.Fd()), &state)
+			switch {
+			case code < 0:
+				// Registered hotkeys went with the connection.
+				C.XCloseDisplay(t.dpy)
+				r.Close()
+				t.err = errors.New("global hotkeys lost their X11 display")
+				close(t.done)
+				return
+			case code == 0:
+				req := <-t.requests
+				if req.register {
+					req.done <- registerOnThread(req.h)
+				} else {
+					req.done <- unregisterOnThread(req.h)
+				}
+			default:
+				if h := t.keys[x11Hotkey{code, state &^ ignored & used}]; h != nil {
+					h.fire()
+				}
+			}
+		}
+	}()
+}
+
+func registerOnThread(h *GlobalHotkey) error {
+	t := &hotkeyThread
+	sym, err := x11Keysym(h.key)
+	if err != nil {
+		return err
+	}
+	code := C.int(C.XKeysymToKeycode(t.dpy, sym))
+	if code == 0 {
+		return errors.New("no key for " + h.key + " on this keyboard")
+	}
+	var mods C.uint
+	if h.mods&hotkeyCtrl != 0 {
+		mods |= C.ControlMask
+	}
+	if h.mods&hotkeyAlt != 0 {
+		mods |= C.Mod1Mask
+	}
+	if h.mods&hotkeyShift != 0 {
+		mods |= C.ShiftMask
+	}
+	if h.mods&hotkeySuper != 0 {
+		mods |= C.Mod4Mask
+	}
+	k := x11Hotkey{code, mods}
+	if t.keys[k] != nil {
+		return errors.New("hotkey " + h.Spec + " is already registered")
+	}
+	if e := C.hotkeyGrab(t.dpy, code, mods, 1); e != 0 {
+		C.hotkeyGrab(t.dpy, code, mods, 0)
+		if e == C.BadAccess {
+			return errors.New("can't register hotkey " + h.Spec + ": another application has it")
+		}
+		return errors.New("can't register hotkey " + h.Spec + ": X error " + strconv.Itoa(int(e)))
+	}
+	t.keys[k] = h
+	t.grabbed[h] = k
+	return nil
+}
+
+func unregisterOnThread(h *GlobalHotkey) error {
+	t := &hotkeyThread
+	k, ok := t.grabbed[h]
+	if !ok {
+		return errors.New("hotkey " + h.Spec + " is not registered")
+	}
+	delete(t.grabbed, h)
+	delete(t.keys, k)
+	if e := C.hotkeyGrab(t.dpy, k.code, k.mods, 0); e != 0 {
+		return errors.New("can't unregister hotkey " + h.Spec + ": X error " + strconv.Itoa(int(e)))
+	}
+	return nil
+}
+
+// hotkeyCall runs a request on the hotkey thread, failing rather than
+// waiting when the thread has stopped.
+func hotkeyCall(h *GlobalHotkey, register bool) error {
+	t := &hotkeyThread
+	t.once.Do(startHotkeyThread)
+	select {
+	case <-t.done:
+		return t.err
+	default:
+	}
+	req := hotkeyRequest{h: h, register: register, done: make(chan error)}
+	if _, err := t.wake.Write([]byte{0}); err != nil {
+		return err
+	}
+	select {
+	case t.requests <- req:
+	case <-t.done:
+		return t.err
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-t.done:
+		return t.err
+	}
+}
+
+func registerHotkey(h *GlobalHotkey) error   { return hotkeyCall(h, true) }
+func unregisterHotkey(h *GlobalHotkey) error { return hotkeyCall(h, false) }
+
+// namedKeysyms maps hotkey key names to X keysym names where they differ.
+var namedKeysyms = map[string]string{
+	"space": "space", "enter": "Return", "return": "Return", "tab": "Tab", "escape": "Escape", "esc": "Escape",
+	"backspace": "BackSpace", "delete": "Delete", "insert": "Insert", "home": "Home", "end": "End",
+	"pageup": "Prior", "pagedown": "Next", "left": "Left", "up": "Up", "right": "Right", "down": "Down",
+	"printscreen": "Print", "pause": "Pause",
+}
+
+// x11Keysym maps a hotkey key name to an X keysym.
+func x11Keysym(k string) (C.KeySym, error) {
+	name := k
+	switch lk := strings.ToLower(k); {
+	case len(k) == 1:
+		// Keysyms of letters are lower case; shift is a modifier.
+		name = lk
+	case namedKeysyms[lk] != "":
+		name = namedKeysyms[lk]
+	case strings.HasPrefix(lk, "f"):
+		name = "F" + lk[1:]
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	sym := C.XStringToKeysym(cname)
+	if sym == C.NoSymbol {
+		return 0, errors.New("unknown key " + k)
+	}
+	return sym, nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows && (!linux || android || nox11) && (!darwin || ios) && !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"runtime"
+)
+
+// Global hotkeys have backends for Windows, X11 and macOS; mobile platforms
+// have no system-wide hotkeys.
+
+func registerHotkey(h *GlobalHotkey) error {
+	return errors.New("global hotkeys are not supported on " + runtime.GOOS)
+}
+
+func unregisterHotkey(h *GlobalHotkey) error {
+	return errors.New("global hotkeys are not supported on " + runtime.GOOS)
+}
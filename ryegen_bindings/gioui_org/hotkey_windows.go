@@ -0,0 +1,170 @@
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32                 = syscall.NewLazyDLL("user32.dll")
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
+	procGetMessageW        = user32.NewProc("GetMessageW")
+	procPeekMessageW       = user32.NewProc("PeekMessageW")
+	procPostThreadMessageW = user32.NewProc("PostThreadMessageW")
+	procGetCurrentThreadId = kernel32.NewProc("GetCurrentThreadId")
+)
+
+const (
+	_WM_HOTKEY      = 0x0312
+	_WM_APP         = 0x8000
+	_MOD_ALT        = 0x0001
+	_MOD_CONTROL    = 0x0002
+	_MOD_SHIFT      = 0x0004
+	_MOD_WIN        = 0x0008
+	_MOD_NOREPEAT   = 0x4000
+	_PM_NOREMOVE    = 0x0000
+	_HOTKEY_ID_BASE = 0x1000
+)
+
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// hotkeyRequest asks the hotkey thread to (un)register a hotkey. Hotkeys
+// belong to the thread that registered them, so all calls happen there.
+type hotkeyRequest struct {
+	h        *GlobalHotkey
+	register bool
+	done     chan error
+}
+
+var hotkeyThread struct {
+	once     sync.Once
+	tid      uintptr
+	requests chan hotkeyRequest
+	keys     map[int]*GlobalHotkey
+	nextID   int
+}
+
+func startHotkeyThread() {
+	hotkeyThread.requests = make(chan hotkeyRequest)
+	hotkeyThread.keys = make(map[int]*GlobalHotkey)
+	hotkeyThread.nextID = _HOTKEY_ID_BASE
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		var msg winMsg
+		// Make sure the thread has a message queue before anyone posts to it.
+		procPeekMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0, _PM_NOREMOVE)
+		hotkeyThread.tid, _, _ = procGetCurrentThreadId.Call()
+		close(ready)
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			switch msg.message {
+			case _WM_HOTKEY:
+				if h := hotkeyThread.keys[int(msg.wParam)]; h != nil {
+					h.fire()
+				}
+			case _WM_APP:
+				req := <-hotkeyThread.requests
+				if req.register {
+					req.done <- registerOnThread(req.h)
+				} else {
+					req.done <- unregisterOnThread(req.h)
+				}
+			}
+		}
+	}()
+	<-ready
+}
+
+func registerOnThread(h *GlobalHotkey) error {
+	vk, err := virtualKey(h.key)
+	if err != nil {
+		return err
+	}
+	mods := uintptr(_MOD_NOREPEAT)
+	if h.mods&hotkeyCtrl != 0 {
+		mods |= _MOD_CONTROL
+	}
+	if h.mods&hotkeyAlt != 0 {
+		mods |= _MOD_ALT
+	}
+	if h.mods&hotkeyShift != 0 {
+		mods |= _MOD_SHIFT
+	}
+	if h.mods&hotkeySuper != 0 {
+		mods |= _MOD_WIN
+	}
+	id := hotkeyThread.nextID
+	if r, _, e := procRegisterHotKey.Call(0, uintptr(id), mods, vk); r == 0 {
+		return errors.New("can't register hotkey " + h.Spec + ": " + e.Error())
+	}
+	hotkeyThread.nextID++
+	h.id = id
+	hotkeyThread.keys[id] = h
+	return nil
+}
+
+func unregisterOnThread(h *GlobalHotkey) error {
+	if hotkeyThread.keys[h.id] != h {
+		return errors.New("hotkey " + h.Spec + " is not registered")
+	}
+	delete(hotkeyThread.keys, h.id)
+	if r, _, e := procUnregisterHotKey.Call(0, uintptr(h.id)); r == 0 {
+		return errors.New("can't unregister hotkey " + h.Spec + ": " + e.Error())
+	}
+	return nil
+}
+
+func hotkeyCall(h *GlobalHotkey, register bool) error {
+	hotkeyThread.once.Do(startHotkeyThread)
+	done := make(chan error)
+	procPostThreadMessageW.Call(hotkeyThread.tid, _WM_APP, 0, 0)
+	hotkeyThread.requests <- hotkeyRequest{h: h, register: register, done: done}
+	return <-done
+}
+
+func registerHotkey(h *GlobalHotkey) error   { return hotkeyCall(h, true) }
+func unregisterHotkey(h *GlobalHotkey) error { return hotkeyCall(h, false) }
+
+var namedVirtualKeys = map[string]uintptr{
+	"space": 0x20, "enter": 0x0D, "return": 0x0D, "tab": 0x09, "escape": 0x1B, "esc": 0x1B,
+	"backspace": 0x08, "delete": 0x2E, "insert": 0x2D, "home": 0x24, "end": 0x23,
+	"pageup": 0x21, "pagedown": 0x22, "left": 0x25, "up": 0x26, "right": 0x27, "down": 0x28,
+	"printscreen": 0x2C, "pause": 0x13,
+}
+
+// virtualKey maps a hotkey key name to a Windows virtual-key code.
+func virtualKey(k string) (uintptr, error) {
+	if len(k) == 1 && (k[0] >= 'A' && k[0] <= 'Z' || k[0] >= '0' && k[0] <= '9') {
+		return uintptr(k[0]), nil
+	}
+	lk := strings.ToLower(k)
+	if vk, ok := namedVirtualKeys[lk]; ok {
+		return vk, nil
+	}
+	if strings.HasPrefix(lk, "f") {
+		if n, err := strconv.Atoi(lk[1:]); err == nil && n >= 1 && n <= 24 {
+			return uintptr(0x70 + n - 1), nil
+		}
+	}
+	return 0, errors.New("unknown key " + k)
+}
@@ -0,0 +1,236 @@
+// Icons drawn from icon fonts.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"embed"
+	"image/color"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+//go:embed icons_*.txt
+var iconSetFiles embed.FS
+
+// iconSets are the bundled name to codepoint mappings of icon fonts, by the
+// name they are loaded as (icons_material.txt is material).
+var iconSets = func() map[string]map[string]rune {
+	res := map[string]map[string]rune{}
+	files, _ := iconSetFiles.ReadDir(".")
+	for _, f := range files {
+		data, _ := iconSetFiles.ReadFile(f.Name())
+		set := strings.TrimSuffix(strings.TrimPrefix(f.Name(), "icons_"), path.Ext(f.Name()))
+		res[set] = map[string]rune{}
+		for _, line := range strings.Split(string(data), "\n") {
+			fs := strings.Fields(line)
+			if len(fs) == 0 || strings.HasPrefix(fs[0], "#") {
+				continue
+			}
+			cp, err := strconv.ParseUint(fs[len(fs)-1], 16, 32)
+			if len(fs) != 2 || err != nil {
+				panic(f.Name() + ": expected a name and a hex codepoint: " + line)
+			}
+			res[set][fs[0]] = rune(cp)
+		}
+	}
+	return res
+}()
+
+// iconFont is an icon font added to a theme.
+type iconFont struct {
+	set        string
+	typeface   font.Typeface
+	codepoints map[string]rune
+}
+
+// themeIconFonts are the icon fonts of each theme, in the order loaded.
+var themeIconFonts = map[*material.Theme][]iconFont{}
+
+// findIcon looks name up in the icon fonts of th, the last loaded first. A
+// name of the form "set:icon" only looks in the fonts loaded as set.
+func findIcon(th *material.Theme, name string) (iconFont, rune, bool) {
+	set, icon, ok := strings.Cut(name, ":")
+	if !ok {
+		set, icon = "", name
+	}
+	themeFontsMu.Lock()
+	defer themeFontsMu.Unlock()
+	fonts := themeIconFonts[th]
+	for i := len(fonts) - 1; i >= 0; i-- {
+		if set != "" && fonts[i].set != set {
+			continue
+		}
+		if r, ok := fonts[i].codepoints[icon]; ok {
+			return fonts[i], r, true
+		}
+	}
+	return iconFont{}, 0, false
+}
+
+// codepointsArg accepts the name of a bundled icon set or a dict of icon
+// names to codepoints, as integers or hex strings.
+func codepointsArg(ps *env.ProgramState, name string, n int, arg env.Object) (string, map[string]rune, *env.Error) {
+	if entries, ok := objectEntries(ps, arg); ok {
+		res := map[string]rune{}
+		for k, v := range entries {
+			switch v := v.(type) {
+			case env.Integer:
+				res[k] = rune(v.Value)
+				continue
+			case env.String:
+				if cp, err := strconv.ParseUint(strings.TrimPrefix(v.Value, "U+"), 16, 32); err == nil {
+					res[k] = rune(cp)
+					continue
+				}
+			}
+			return "", nil, failure(ps, name, "arg "+strconv.Itoa(n)+": codepoint of "+k+" is not an integer or hex string")
+		}
+		return "custom", res, nil
+	}
+	set, err := nameArg(ps, name, n, arg)
+	if err != nil {
+		return "", nil, argError(ps, name, n, "icon set name or dict of codepoints", arg)
+	}
+	cps, ok := iconSets[set]
+	if !ok {
+		return "", nil, failure(ps, name, "unknown icon set "+set+" (material or fontawesome)")
+	}
+	return set, cps, nil
+}
+
+// GlyphIcon is an icon drawn as a glyph of an icon font.
+type GlyphIcon struct {
+	th       *material.Theme
+	typeface font.Typeface
+	glyph    rune
+	Size     unit.Sp
+	Color    color.NRGBA
+}
+
+func (g *GlyphIcon) Layout(gtx layout.Context) layout.Dimensions {
+	l := material.Label(g.th, g.Size, string(g.glyph))
+	l.Font.Typeface = g.typeface
+	l.Color = g.Color
+	return l.Layout(gtx)
+}
+
+var builtinsIconFont = map[string]*env.Builtin{
+	"Go(*material.Theme)//load-icon-font!": {
+		Doc:   "Add an icon font file to the theme with its icon names, either a bundled set ('material or 'fontawesome) or a dict of names to codepoints",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "Go(*material.Theme)//load-icon-font!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			p, err := stringArg(ps, "Go(*material.Theme)//load-icon-font!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			set, cps, err := codepointsArg(ps, "Go(*material.Theme)//load-icon-font!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			faces, ferr := loadFontFile(p)
+			if ferr != nil {
+				return failure(ps, "Go(*material.Theme)//load-icon-font!", ferr.Error())
+			}
+			if len(faces) == 0 {
+				return failure(ps, "Go(*material.Theme)//load-icon-font!", p+": no fonts in file")
+			}
+			addThemeFonts(th, faces)
+			themeFontsMu.Lock()
+			themeIconFonts[th] = append(themeIconFonts[th], iconFont{set: set, typeface: faces[0].Font.Typeface, codepoints: cps})
+			themeFontsMu.Unlock()
+			return arg0
+		},
+	},
+	"glyph-icon": {
+		Doc:   "Icon widget of a glyph of the theme's icon fonts, by name ('home) or set and name (\"fontawesome:house\")",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "glyph-icon", 1, arg0)
+			if err != nil {
+				return err
+			}
+			name, err := nameArg(ps, "glyph-icon", 2, arg1)
+			if err != nil {
+				return err
+			}
+			f, r, ok := findIcon(th, name)
+			if !ok {
+				return failure(ps, "glyph-icon", "no icon font of the theme has "+name+" (load one with load-icon-font!)")
+			}
+			g := &GlyphIcon{th: th, typeface: f.typeface, glyph: r, Size: 24, Color: th.Fg}
+			return *env.NewNative(ps.Idx, g, "Go(*gioui_org.GlyphIcon)")
+		},
+	},
+	"Go(*gioui_org.GlyphIcon)//layout": layoutBuiltin[*GlyphIcon]("Go(*gioui_org.GlyphIcon)//layout"),
+	"Go(*gioui_org.GlyphIcon)//size!": {
+		Doc:   "Set the icon size in sp (24 by default)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*GlyphIcon](ps, "Go(*gioui_org.GlyphIcon)//size!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := decimalArg(ps, "Go(*gioui_org.GlyphIcon)//size!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			g.Size = unit.Sp(s)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.GlyphIcon)//color!": {
+		Doc:   "Set the icon color",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*GlyphIcon](ps, "Go(*gioui_org.GlyphIcon)//color!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.GlyphIcon)//color!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			g.Color = c
+			return arg0
+		},
+	},
+	"icon-names": {
+		Doc:   "Get a sorted block of the icon names of a bundled icon set",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			set, err := nameArg(ps, "icon-names", 1, arg0)
+			if err != nil {
+				return err
+			}
+			cps, ok := iconSets[set]
+			if !ok {
+				return failure(ps, "icon-names", "unknown icon set "+set+" (material or fontawesome)")
+			}
+			names := make([]string, 0, len(cps))
+			for n := range cps {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			objs := make([]env.Object, len(names))
+			for i, n := range names {
+				objs[i] = *env.NewString(n)
+			}
+			return *env.NewBlock(*env.NewTSeries(objs))
+		},
+	},
+}
@@ -0,0 +1,170 @@
+// A process-wide cache of decoded images.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"container/list"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+// imageCache keeps the image ops of decoded files and image natives, so a
+// script that passes a path every frame, or windows showing the same
+// assets, decode and upload each image once. The least recently used are
+// evicted when the decoded size goes over the limit.
+type imageCache struct {
+	mu           sync.Mutex
+	entries      map[any]*list.Element
+	lru          list.List // of *imageEntry, most recently used first
+	size, limit  int64
+	hits, misses int64
+}
+
+type imageEntry struct {
+	key     any
+	modTime time.Time
+	op      paint.ImageOp
+	size    int64
+}
+
+var images = &imageCache{entries: map[any]*list.Element{}, limit: 256 << 20}
+
+// imageSize estimates the memory of a decoded image at 4 bytes a pixel.
+func imageSize(img image.Image) int64 {
+	b := img.Bounds()
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
+
+func (c *imageCache) get(key any, modTime time.Time) (paint.ImageOp, bool) {
+	el, ok := c.entries[key]
+	if !ok || !el.Value.(*imageEntry).modTime.Equal(modTime) {
+		c.misses++
+		return paint.ImageOp{}, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*imageEntry).op, true
+}
+
+func (c *imageCache) put(key any, modTime time.Time, img image.Image) paint.ImageOp {
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	e := &imageEntry{key: key, modTime: modTime, op: paint.NewImageOp(img), size: imageSize(img)}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += e.size
+	c.evict()
+	return e.op
+}
+
+func (c *imageCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*imageEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// evict drops the least recently used images until the cache fits its
+// limit, keeping the newest even if it alone is larger.
+func (c *imageCache) evict() {
+	for c.size > c.limit && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// cachedImage returns the image op of an image file, decoding it if it
+// isn't cached or changed since.
+func cachedImage(path string) (paint.ImageOp, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return paint.ImageOp{}, err
+	}
+	st, err := os.Stat(abs)
+	if err != nil {
+		return paint.ImageOp{}, err
+	}
+	images.mu.Lock()
+	op, ok := images.get(abs, st.ModTime())
+	images.mu.Unlock()
+	if ok {
+		return op, nil
+	}
+	img, err := loadImage(abs)
+	if err != nil {
+		return paint.ImageOp{}, err
+	}
+	images.mu.Lock()
+	defer images.mu.Unlock()
+	return images.put(abs, st.ModTime(), img), nil
+}
+
+// cachedImageOp returns the image op of a decoded image. Only images held
+// by pointer, as the image package makes them, are cached.
+func cachedImageOp(img image.Image) paint.ImageOp {
+	if reflect.TypeOf(img).Kind() != reflect.Pointer {
+		return paint.NewImageOp(img)
+	}
+	images.mu.Lock()
+	defer images.mu.Unlock()
+	if op, ok := images.get(img, time.Time{}); ok {
+		return op
+	}
+	return images.put(img, time.Time{}, img)
+}
+
+var builtinsImageCache = map[string]*env.Builtin{
+	"image-cache-limit!": {
+		Doc:   "Set the size in megabytes of decoded images kept by the image cache shared by all windows (256 by default)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			mb, err := integerArg(ps, "image-cache-limit!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if mb < 0 {
+				return failure(ps, "image-cache-limit!", "limit can't be negative")
+			}
+			images.mu.Lock()
+			images.limit = mb << 20
+			images.evict()
+			images.mu.Unlock()
+			return arg0
+		},
+	},
+	"image-cache-clear!": {
+		Doc:   "Drop all images from the image cache",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			images.mu.Lock()
+			images.entries = map[any]*list.Element{}
+			images.lru.Init()
+			images.size = 0
+			images.mu.Unlock()
+			return *env.NewInteger(1)
+		},
+	},
+	"image-cache-stats?": {
+		Doc:   "Get a dict of the images in the image cache, their size and limit in bytes, and its hits and misses",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			images.mu.Lock()
+			defer images.mu.Unlock()
+			return *env.NewDict(map[string]any{
+				"images": *env.NewInteger(int64(images.lru.Len())),
+				"bytes":  *env.NewInteger(images.size),
+				"limit":  *env.NewInteger(images.limit),
+				"hits":   *env.NewInteger(images.hits),
+				"misses": *env.NewInteger(images.misses),
+			})
+		},
+	},
+}
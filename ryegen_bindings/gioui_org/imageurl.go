@@ -0,0 +1,209 @@
+// Images downloaded in the background.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"image"
+	"net/http"
+	"sync"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// urlKey is the image cache key of a downloaded image, apart from paths.
+type urlKey string
+
+// urlFetch is the download of an image, shared by the widgets showing it.
+type urlFetch struct {
+	done chan struct{}
+	op   paint.ImageOp
+	err  error
+}
+
+var (
+	urlFetchesMu sync.Mutex
+	urlFetches   = map[string]*urlFetch{} // in progress
+	urlClient    = &http.Client{Timeout: 30 * time.Second}
+)
+
+// fetchImage returns the image at url from the image cache, or the download
+// of it, starting one if none is in progress.
+func fetchImage(url string) *urlFetch {
+	urlFetchesMu.Lock()
+	defer urlFetchesMu.Unlock()
+	if f, ok := urlFetches[url]; ok {
+		return f
+	}
+	f := &urlFetch{done: make(chan struct{})}
+	images.mu.Lock()
+	op, ok := images.get(urlKey(url), time.Time{})
+	images.mu.Unlock()
+	if ok {
+		f.op = op
+		close(f.done)
+		return f
+	}
+	urlFetches[url] = f
+	go func() {
+		img, err := downloadImage(url)
+		if err == nil {
+			images.mu.Lock()
+			f.op = images.put(urlKey(url), time.Time{}, img)
+			images.mu.Unlock()
+		}
+		f.err = err
+		urlFetchesMu.Lock()
+		delete(urlFetches, url)
+		urlFetchesMu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+func downloadImage(url string) (image.Image, error) {
+	resp, err := urlClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(url + ": " + resp.Status)
+	}
+	img, _, err := image.Decode(resp.Body)
+	return img, err
+}
+
+// imageFadeIn is how long a downloaded image takes to fade in.
+const imageFadeIn = 250 * time.Millisecond
+
+// ImageURL shows an image downloaded from a URL, with a spinner on a
+// placeholder until it is ready.
+type ImageURL struct {
+	th    *material.Theme
+	Fit   widget.Fit
+	fetch *urlFetch
+	shown time.Time // when the image was first laid out, for the fade
+}
+
+func (w *ImageURL) ready() bool {
+	select {
+	case <-w.fetch.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *ImageURL) placeholder(gtx layout.Context, content layout.Widget) layout.Dimensions {
+	size := gtx.Constraints.Constrain(image.Pt(gtx.Dp(64), gtx.Dp(64)))
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	paint.ColorOp{Color: mulAlpha(w.th.Fg, 0x18)}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	gtx.Constraints = layout.Exact(size)
+	layout.Center.Layout(gtx, content)
+	return layout.Dimensions{Size: size}
+}
+
+func (w *ImageURL) Layout(gtx layout.Context) layout.Dimensions {
+	if !w.ready() {
+		return w.placeholder(gtx, func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Max = gtx.Constraints.Constrain(image.Pt(gtx.Dp(32), gtx.Dp(32)))
+			gtx.Constraints.Min = image.Point{}
+			return material.Loader(w.th).Layout(gtx)
+		})
+	}
+	if w.fetch.err != nil {
+		return w.placeholder(gtx, material.Caption(w.th, w.fetch.err.Error()).Layout)
+	}
+	if w.shown.IsZero() {
+		w.shown = gtx.Now
+	}
+	if t := gtx.Now.Sub(w.shown); t < imageFadeIn {
+		defer paint.PushOpacity(gtx.Ops, float32(t)/float32(imageFadeIn)).Pop()
+		animateFrame(gtx)
+	}
+	return widget.Image{Src: w.fetch.op, Fit: w.Fit}.Layout(gtx)
+}
+
+var imageFits = map[string]widget.Fit{
+	"unscaled":   widget.Unscaled,
+	"contain":    widget.Contain,
+	"cover":      widget.Cover,
+	"scale-down": widget.ScaleDown,
+	"fill":       widget.Fill,
+}
+
+var builtinsImageURL = map[string]*env.Builtin{
+	"image-url": {
+		Doc:   "Image widget downloading a PNG, JPEG or GIF from a URL in the background, showing a spinner until it fades in; downloads are shared through the image cache",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "image-url", 1, arg0)
+			if err != nil {
+				return err
+			}
+			url, err := stringArg(ps, "image-url", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w := &ImageURL{th: th, Fit: widget.Contain, fetch: fetchImage(url)}
+			return *env.NewNative(ps.Idx, w, "Go(*gioui_org.ImageURL)")
+		},
+	},
+	"Go(*gioui_org.ImageURL)//layout": layoutBuiltin[*ImageURL]("Go(*gioui_org.ImageURL)//layout"),
+	"Go(*gioui_org.ImageURL)//fit!": {
+		Doc:   "Set how the image fits its constraints: contain (default), cover, fill, scale-down or unscaled",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := nativeArg[*ImageURL](ps, "Go(*gioui_org.ImageURL)//fit!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := nameArg(ps, "Go(*gioui_org.ImageURL)//fit!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			fit, ok := imageFits[n]
+			if !ok {
+				return failure(ps, "Go(*gioui_org.ImageURL)//fit!", "unknown fit "+n+" (contain, cover, fill, scale-down or unscaled)")
+			}
+			w.Fit = fit
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ImageURL)//loaded?": {
+		Doc:   "Check whether the image was downloaded",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := nativeArg[*ImageURL](ps, "Go(*gioui_org.ImageURL)//loaded?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(w.ready() && w.fetch.err == nil))
+		},
+	},
+	"Go(*gioui_org.ImageURL)//error?": {
+		Doc:   "Get why the download failed, or an empty string",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := nativeArg[*ImageURL](ps, "Go(*gioui_org.ImageURL)//error?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if w.ready() && w.fetch.err != nil {
+				return *env.NewString(w.fetch.err.Error())
+			}
+			return *env.NewString("")
+		},
+	},
+}
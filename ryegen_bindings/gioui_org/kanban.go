@@ -0,0 +1,461 @@
+// Kanban board of columns of cards moved by dragging.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"slices"
+	"strconv"
+
+	"gioui.org/font"
+	"gioui.org/gesture"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+const (
+	kanbanPad  = unit.Dp(8)  // around the cards of a column and between them
+	kanbanEdge = unit.Dp(32) // from the edges where dragging scrolls
+)
+
+// kanbanColumn is a titled column of cards scrolling on its own.
+type kanbanColumn struct {
+	Title string
+	Cards []env.Object
+	list  widget.List
+	sizes []image.Point // of the cards with their padding, as last laid out
+	x     int           // of the column in the board
+	top   int           // of the cards' list in the column
+	first int           // index of the card of rects[0]
+	rects []image.Rectangle
+}
+
+// KanbanBoard shows columns of cards side by side. Cards are dragged within
+// and across columns, and the board and its columns scroll while a card is
+// dragged near their edges.
+type KanbanBoard struct {
+	ps          *env.ProgramState
+	Theme       *material.Theme
+	Columns     []*kanbanColumn
+	ColumnWidth unit.Dp
+	card        *env.Function // lays out the content of a card; nil shows its text
+	onMove      *env.Function
+	onClick     *env.Function
+	list        widget.List
+	drag        gesture.Drag
+	visible     [2]int // the columns laid out last, from and to
+	colWidth    int
+	pressed     bool
+	dragging    bool
+	from        image.Point // column and index of the card pressed
+	target      image.Point // column and index the card would be dropped at
+	grab        image.Point // where the card was pressed, in the card
+	pos         image.Point // of the pointer
+}
+
+// cardAt returns the column and index of the card at p.
+func (b *KanbanBoard) cardAt(p image.Point) (image.Point, bool) {
+	for ci := b.visible[0]; ci < b.visible[1]; ci++ {
+		c := b.Columns[ci]
+		for k, r := range c.rects {
+			if p.In(r.Add(image.Pt(c.x, 0))) {
+				return image.Pt(ci, c.first+k), true
+			}
+		}
+	}
+	return image.Point{}, false
+}
+
+// dropAt returns where a card dropped at p goes: the column nearest p and
+// the index of the first card below it.
+func (b *KanbanBoard) dropAt(p image.Point) image.Point {
+	if b.visible[0] == b.visible[1] {
+		return b.from
+	}
+	ci, best := b.visible[0], -1
+	for i := b.visible[0]; i < b.visible[1]; i++ {
+		c := b.Columns[i]
+		d := p.X - c.x - b.colWidth/2
+		if d < 0 {
+			d = -d
+		}
+		if best < 0 || d < best {
+			ci, best = i, d
+		}
+	}
+	c := b.Columns[ci]
+	idx := c.first + len(c.rects)
+	for k, r := range c.rects {
+		if p.Y < r.Min.Y+r.Dy()/2 {
+			idx = c.first + k
+			break
+		}
+	}
+	return image.Pt(ci, idx)
+}
+
+// move moves the card at from to before the card at to and reports it.
+func (b *KanbanBoard) move(from, to image.Point) {
+	src, dst := b.Columns[from.X], b.Columns[to.X]
+	if from.Y >= len(src.Cards) {
+		return
+	}
+	if to.X == from.X && to.Y > from.Y {
+		to.Y--
+	}
+	to.Y = min(to.Y, len(dst.Cards))
+	if to == from {
+		return
+	}
+	card := src.Cards[from.Y]
+	src.Cards = slices.Delete(src.Cards, from.Y, from.Y+1)
+	dst.Cards = slices.Insert(dst.Cards, min(to.Y, len(dst.Cards)), card)
+	if b.onMove != nil {
+		callFunction(b.ps, "kanban-board on-move", *b.onMove, card,
+			*env.NewString(src.Title), *env.NewInteger(int64(from.Y)),
+			*env.NewString(dst.Title), *env.NewInteger(int64(to.Y)))
+	}
+}
+
+func (b *KanbanBoard) update(gtx layout.Context) {
+	for {
+		e, ok := b.drag.Update(gtx.Metric, gtx.Source, gesture.Both)
+		if !ok {
+			break
+		}
+		p := e.Position.Round()
+		b.pos = p
+		switch e.Kind {
+		case pointer.Press:
+			b.from, b.pressed = b.cardAt(p)
+			if b.pressed {
+				c := b.Columns[b.from.X]
+				b.grab = p.Sub(c.rects[b.from.Y-c.first].Min.Add(image.Pt(c.x, 0)))
+			}
+		case pointer.Drag:
+			// The drag gesture grabs the pointer, keeping the lists from
+			// scrolling, once it moved far enough to be a drag.
+			if b.pressed && e.Priority == pointer.Grabbed {
+				b.dragging = true
+				b.target = b.dropAt(p)
+			}
+		case pointer.Release:
+			if b.dragging {
+				b.move(b.from, b.dropAt(p))
+			} else if at, ok := b.cardAt(p); ok && b.pressed && at == b.from && b.onClick != nil {
+				c := b.Columns[at.X]
+				callFunction(b.ps, "kanban-board on-click", *b.onClick, c.Cards[at.Y], *env.NewString(c.Title), *env.NewInteger(int64(at.Y)))
+			}
+			b.pressed, b.dragging = false, false
+		case pointer.Cancel:
+			b.pressed, b.dragging = false, false
+		}
+	}
+}
+
+// autoScroll scrolls the board or the target column while a card is dragged
+// near their edges.
+func (b *KanbanBoard) autoScroll(gtx layout.Context, size image.Point) {
+	edge, step := gtx.Dp(kanbanEdge), gtx.Dp(8)
+	scrolled := false
+	switch {
+	case b.pos.X < edge && b.list.Position.First+b.list.Position.Offset > 0:
+		b.list.Position.Offset -= step
+		scrolled = true
+	case b.pos.X > size.X-edge && b.list.Position.BeforeEnd:
+		b.list.Position.Offset += step
+		scrolled = true
+	}
+	c := b.Columns[b.target.X]
+	switch {
+	case b.pos.Y < c.top+edge && c.list.Position.First+c.list.Position.Offset > 0:
+		c.list.Position.Offset -= step
+		scrolled = true
+	case b.pos.Y > size.Y-edge && c.list.Position.BeforeEnd:
+		c.list.Position.Offset += step
+		scrolled = true
+	}
+	if scrolled {
+		animateFrame(gtx)
+	}
+}
+
+// cardText is the text shown for a card without a layout function.
+func (b *KanbanBoard) cardText(card env.Object) string {
+	if s, ok := card.(env.String); ok {
+		return s.Value
+	}
+	return card.Print(*b.ps.Idx)
+}
+
+func (b *KanbanBoard) layoutCard(gtx layout.Context, card env.Object) layout.Dimensions {
+	th := b.Theme
+	gtx.Constraints.Min = image.Pt(gtx.Constraints.Max.X, 0)
+	macro := op.Record(gtx.Ops)
+	dims := layout.UniformInset(10).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		if b.card == nil {
+			return material.Body2(th, b.cardText(card)).Layout(gtx)
+		}
+		res := callFunction(b.ps, "kanban-board card", *b.card, *env.NewNative(b.ps.Idx, &gtx, "Go(*layout.Context)"), card)
+		if v, ok := res.(env.Native); ok {
+			if dims, ok := v.Value.(*layout.Dimensions); ok {
+				return *dims
+			}
+		}
+		return layout.Dimensions{}
+	})
+	content := macro.Stop()
+	dims.Size.X = max(dims.Size.X, gtx.Constraints.Min.X)
+	rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(4))
+	paint.FillShape(gtx.Ops, th.Bg, rr.Op(gtx.Ops))
+	paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x30), clip.Stroke{Path: rr.Path(gtx.Ops), Width: float32(gtx.Dp(1))}.Op())
+	content.Add(gtx.Ops)
+	return dims
+}
+
+func (b *KanbanBoard) layoutColumn(gtx layout.Context, ci int) layout.Dimensions {
+	th := b.Theme
+	c := b.Columns[ci]
+	w, h := b.colWidth, gtx.Constraints.Max.Y
+	pad := gtx.Dp(kanbanPad)
+	paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x10), clip.UniformRRect(image.Rect(0, 0, w, h), gtx.Dp(6)).Op(gtx.Ops))
+
+	// The title and the number of cards.
+	off := op.Offset(image.Pt(pad+gtx.Dp(2), pad)).Push(gtx.Ops)
+	title := material.Body1(th, c.Title)
+	title.Font.Weight = font.Bold
+	title.MaxLines = 1
+	lgtx := gtx
+	lgtx.Constraints = layout.Constraints{Max: image.Pt(w-2*pad-gtx.Dp(40), h)}
+	tdims := title.Layout(lgtx)
+	off.Pop()
+	off = op.Offset(image.Pt(2*pad+gtx.Dp(2)+tdims.Size.X, pad)).Push(gtx.Ops)
+	count := material.Body1(th, strconv.Itoa(len(c.Cards)))
+	count.Color = mulAlpha(th.Fg, 0x90)
+	count.Layout(lgtx)
+	off.Pop()
+
+	c.top = 2*pad + tdims.Size.Y
+	c.sizes = slices.Grow(c.sizes[:0], len(c.Cards))[:len(c.Cards)]
+	off = op.Offset(image.Pt(0, c.top)).Push(gtx.Ops)
+	lgtx.Constraints = layout.Exact(image.Pt(w, max(h-c.top, 0)))
+	c.list.Axis = layout.Vertical
+	material.List(th, &c.list).Layout(lgtx, len(c.Cards), func(gtx layout.Context, i int) layout.Dimensions {
+		var opacity paint.OpacityStack
+		faded := b.dragging && b.from == image.Pt(ci, i)
+		if faded {
+			opacity = paint.PushOpacity(gtx.Ops, 0.4)
+		}
+		dims := layout.Inset{Left: kanbanPad, Right: kanbanPad, Bottom: kanbanPad}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return b.layoutCard(gtx, c.Cards[i])
+		})
+		if faded {
+			opacity.Pop()
+		}
+		c.sizes[i] = dims.Size
+		return dims
+	})
+	off.Pop()
+
+	// Where the cards shown are, for hit testing and dropping.
+	pos := c.list.Position
+	c.first, c.rects = pos.First, c.rects[:0]
+	y := c.top - pos.Offset
+	for i := pos.First; i < min(pos.First+pos.Count, len(c.Cards)); i++ {
+		s := c.sizes[i]
+		c.rects = append(c.rects, image.Rect(pad, y, s.X-pad, y+s.Y-pad))
+		y += s.Y
+	}
+
+	if b.dragging && b.target.X == ci {
+		// The line where the dragged card would go.
+		y := c.top + pad/2
+		switch k := b.target.Y - c.first; {
+		case k >= 0 && k < len(c.rects):
+			y = c.rects[k].Min.Y - pad/2
+		case k > 0 && len(c.rects) > 0:
+			y = c.rects[len(c.rects)-1].Max.Y + pad/2
+		}
+		t := gtx.Dp(3)
+		paint.FillShape(gtx.Ops, th.ContrastBg, clip.UniformRRect(image.Rect(pad, y-t/2, w-pad, y-t/2+t), t/2).Op(gtx.Ops))
+	}
+	return layout.Dimensions{Size: image.Pt(w+pad, h)}
+}
+
+func (b *KanbanBoard) Layout(gtx layout.Context) layout.Dimensions {
+	b.update(gtx)
+	size := gtx.Constraints.Max
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	b.drag.Add(gtx.Ops)
+	if len(b.Columns) == 0 {
+		b.pressed, b.dragging = false, false
+		return layout.Dimensions{Size: size}
+	}
+	if b.dragging {
+		b.autoScroll(gtx, size)
+	}
+
+	b.colWidth = gtx.Dp(b.ColumnWidth)
+	lgtx := gtx
+	lgtx.Constraints = layout.Exact(size)
+	b.list.Axis = layout.Horizontal
+	material.List(b.Theme, &b.list).Layout(lgtx, len(b.Columns), b.layoutColumn)
+	pos := b.list.Position
+	b.visible = [2]int{pos.First, min(pos.First+pos.Count, len(b.Columns))}
+	x := -pos.Offset
+	for ci := b.visible[0]; ci < b.visible[1]; ci++ {
+		b.Columns[ci].x = x
+		x += b.colWidth + gtx.Dp(kanbanPad)
+	}
+
+	if b.dragging && b.from.X < len(b.Columns) && b.from.Y < len(b.Columns[b.from.X].Cards) {
+		b.target = b.dropAt(b.pos)
+		// The dragged card follows the pointer above the columns.
+		off := op.Offset(b.pos.Sub(b.grab)).Push(gtx.Ops)
+		cgtx := gtx
+		cgtx.Constraints = layout.Constraints{Max: image.Pt(b.colWidth-2*gtx.Dp(kanbanPad), size.Y)}
+		b.layoutCard(cgtx, b.Columns[b.from.X].Cards[b.from.Y])
+		off.Pop()
+	}
+	return layout.Dimensions{Size: size}
+}
+
+// kanbanColumns reads a block of column titles each followed by a block of
+// cards.
+func kanbanColumns(ps *env.ProgramState, name string, n int, arg env.Object) ([]*kanbanColumn, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block", arg)
+	}
+	s := blk.Series.S
+	var cols []*kanbanColumn
+	for i := 0; i < len(s); i += 2 {
+		title, ok := s[i].(env.String)
+		if !ok {
+			return nil, argError(ps, name, n, "column title", s[i])
+		}
+		if i+1 == len(s) {
+			return nil, failure(ps, name, "missing block of cards for column "+title.Value)
+		}
+		cards, ok := s[i+1].(env.Block)
+		if !ok {
+			return nil, argError(ps, name, n, "block of cards", s[i+1])
+		}
+		cols = append(cols, &kanbanColumn{Title: title.Value, Cards: slices.Clone(cards.Series.S)})
+	}
+	return cols, nil
+}
+
+// kanbanBuiltin returns a "//method" builtin of boards; fn returning nil
+// returns the board.
+func kanbanBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, arg2 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.KanbanBoard)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*KanbanBoard](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, b, arg1, arg2); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsKanban = map[string]*env.Builtin{
+	"kanban-board": {
+		Doc:   "Create a kanban board from a block of column titles each followed by a block of cards, like { \"To do\" { \"Write docs\" } \"Done\" { } }; cards are dragged within and across columns",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "kanban-board", 1, arg0)
+			if err != nil {
+				return err
+			}
+			cols, err := kanbanColumns(ps, "kanban-board", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &KanbanBoard{ps: ps, Theme: th, Columns: cols, ColumnWidth: 280}, "Go(*gioui_org.KanbanBoard)")
+		},
+	},
+	"Go(*gioui_org.KanbanBoard)//layout": layoutBuiltin[*KanbanBoard]("Go(*gioui_org.KanbanBoard)//layout"),
+	"Go(*gioui_org.KanbanBoard)//column-width!": kanbanBuiltin("column-width!", "Set the width of the columns in dp (280 by default)", 2, func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, _ env.Object) env.Object {
+		d, err := decimalArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return failure(ps, name, "column width must be positive")
+		}
+		b.ColumnWidth = unit.Dp(d)
+		return nil
+	}),
+	"Go(*gioui_org.KanbanBoard)//card-layout!": kanbanBuiltin("card-layout!", "Set function of the layout context and a card laying out the card's content; without, cards show their text", 2, func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 2, arg1)
+		if err != nil {
+			return err
+		}
+		b.card = &fn
+		return nil
+	}),
+	"Go(*gioui_org.KanbanBoard)//on-move!": kanbanBuiltin("on-move!", "Set function called with the card, the column it left and its index there, and the column it was dropped in and its index there (from 0) after a card is moved", 2, func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 5, arg1)
+		if err != nil {
+			return err
+		}
+		b.onMove = &fn
+		return nil
+	}),
+	"Go(*gioui_org.KanbanBoard)//on-click!": kanbanBuiltin("on-click!", "Set function called with the card, its column and its index (from 0) when a card is clicked without dragging it", 2, func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 3, arg1)
+		if err != nil {
+			return err
+		}
+		b.onClick = &fn
+		return nil
+	}),
+	"Go(*gioui_org.KanbanBoard)//cards?": kanbanBuiltin("cards?", "Get the columns as a block of titles each followed by a block of cards, as the board was created from", 1, func(ps *env.ProgramState, name string, b *KanbanBoard, _, _ env.Object) env.Object {
+		var objs []env.Object
+		for _, c := range b.Columns {
+			objs = append(objs, *env.NewString(c.Title), *env.NewBlock(*env.NewTSeries(slices.Clone(c.Cards))))
+		}
+		return *env.NewBlock(*env.NewTSeries(objs))
+	}),
+	"Go(*gioui_org.KanbanBoard)//cards!": kanbanBuiltin("cards!", "Replace the columns with a block of titles each followed by a block of cards", 2, func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, _ env.Object) env.Object {
+		cols, err := kanbanColumns(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		b.Columns = cols
+		b.visible = [2]int{}
+		b.pressed, b.dragging = false, false
+		return nil
+	}),
+	"Go(*gioui_org.KanbanBoard)//add-card!": kanbanBuiltin("add-card!", "Add a card at the end of the column with a title", 3, func(ps *env.ProgramState, name string, b *KanbanBoard, arg1, arg2 env.Object) env.Object {
+		title, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		for _, c := range b.Columns {
+			if c.Title == title {
+				c.Cards = append(c.Cards, arg2)
+				return nil
+			}
+		}
+		return failure(ps, name, "no column "+title)
+	}),
+}
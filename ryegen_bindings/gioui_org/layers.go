@@ -0,0 +1,89 @@
+// Z-ordered layers of the frame.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gioui.org/op"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Layers are drawn in order, each above the ones before. Content is drawn
+// in place; the others are deferred that many times, as Gio runs defers
+// made by deferred operations after all the earlier ones.
+const (
+	layerContent = iota
+	layerOverlay
+	layerToast
+	layerDebug
+)
+
+var layerNames = map[string]int{
+	"content": layerContent,
+	"overlay": layerOverlay,
+	"toast":   layerToast,
+	"debug":   layerDebug,
+}
+
+// deferLayer draws call on a layer, keeping the transformation it was
+// deferred with. Popups, menus and tooltips are on the overlay layer.
+func deferLayer(ops *op.Ops, layer int, call op.CallOp) {
+	if layer == layerContent {
+		call.Add(ops)
+		return
+	}
+	for i := 1; i < layer; i++ {
+		m := op.Record(ops)
+		op.Defer(ops, call)
+		call = m.Stop()
+	}
+	op.Defer(ops, call)
+}
+
+func layerArg(ps *env.ProgramState, name string, n int, arg env.Object) (int, *env.Error) {
+	s, err := nameArg(ps, name, n, arg)
+	if err != nil {
+		return 0, err
+	}
+	l, ok := layerNames[s]
+	if !ok {
+		names := make([]string, 0, len(layerNames))
+		for n := range layerNames {
+			names = append(names, n)
+		}
+		sort.Slice(names, func(i, j int) bool { return layerNames[names[i]] < layerNames[names[j]] })
+		return 0, failure(ps, name, fmt.Sprintf("arg %d: unknown layer %s (%s)", n, s, strings.Join(names, " ")))
+	}
+	return l, nil
+}
+
+var builtinsLayers = map[string]*env.Builtin{
+	"on-layer": {
+		Doc:   "Lay out a widget where it is but draw it on a layer, above everything on the layers below wherever that was laid out: 'content, 'overlay (popups and menus), 'toast or 'debug",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			l, err := layerArg(ps, "on-layer", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "on-layer", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "on-layer", 3, arg2)
+			if err != nil {
+				return err
+			}
+			m := op.Record(gtx.Ops)
+			dims := w(gtx)
+			deferLayer(gtx.Ops, l, m.Stop())
+			return dimensionsObj(ps, dims)
+		},
+	},
+}
@@ -0,0 +1,208 @@
+// App lifecycle and close handlers.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"gioui.org/app"
+	"gioui.org/io/event"
+	"gioui.org/io/system"
+
+	"github.com/refaktor/rye/env"
+	"github.com/refaktor/rye/util"
+)
+
+// lifecycleStages are the stages handlers can be registered for.
+var lifecycleStages = []string{"focused", "unfocused", "paused", "resumed", "destroy"}
+
+// lifecycle tracks the stage of a window to run the script's handlers on
+// changes. Gio reports focus and the window mode; a window is paused while
+// minimized or, on phones where apps lose focus when put away, unfocused.
+type lifecycle struct {
+	mu       sync.Mutex
+	ps       *env.ProgramState
+	focused  bool
+	paused   bool
+	handlers map[string][]env.Function
+	closers  []env.Function
+}
+
+var lifecycles sync.Map // *app.Window -> *lifecycle
+
+func lifecycleOf(win *app.Window) *lifecycle {
+	v, _ := lifecycles.LoadOrStore(win, &lifecycle{handlers: map[string][]env.Function{}})
+	return v.(*lifecycle)
+}
+
+// stages returns the stages e moves the window to.
+func (l *lifecycle) stages(e event.Event) []string {
+	var res []string
+	switch e := e.(type) {
+	case app.ConfigEvent:
+		if e.Config.Focused != l.focused {
+			l.focused = e.Config.Focused
+			if l.focused {
+				res = append(res, "focused")
+			} else {
+				res = append(res, "unfocused")
+			}
+		}
+		mobile := runtime.GOOS == "android" || runtime.GOOS == "ios"
+		paused := e.Config.Mode == app.Minimized || mobile && !e.Config.Focused
+		if paused != l.paused {
+			l.paused = paused
+			if paused {
+				res = append(res, "paused")
+			} else {
+				res = append(res, "resumed")
+			}
+		}
+	case app.DestroyEvent:
+		res = append(res, "destroy")
+	}
+	return res
+}
+
+// nextEvent waits for the next event of win, noting frames for its pacing
+// and running the lifecycle handlers of the stages it moves to. As the
+// window closes, speech and recordings stop.
+func nextEvent(win *app.Window) event.Event {
+	e := win.Event()
+	if fe, ok := e.(app.FrameEvent); ok {
+		paceFrame(win, fe)
+		noteFrame(win, fe)
+		e = fe
+	}
+	if viewURLs != nil {
+		viewURLs(e)
+	}
+	if v, ok := lifecycles.Load(win); ok {
+		l := v.(*lifecycle)
+		l.mu.Lock()
+		var calls []env.Function
+		for _, s := range l.stages(e) {
+			calls = append(calls, l.handlers[s]...)
+		}
+		ps := l.ps
+		l.mu.Unlock()
+		for _, fn := range calls {
+			callFunction(ps, "on-lifecycle!", fn)
+		}
+	}
+	if _, ok := e.(app.DestroyEvent); ok {
+		lifecycles.Delete(win)
+		forgetWindow(win)
+		stopAudio()
+	}
+	return e
+}
+
+// closeWindow asks the on-close! handlers of win, in order, whether it may
+// close and closes it if none vetoes. Gio has no way to keep a window open
+// once the system closes it, so only closes asked for by the script can be
+// vetoed.
+func closeWindow(win *app.Window) bool {
+	var closers []env.Function
+	var ps *env.ProgramState
+	if v, ok := lifecycles.Load(win); ok {
+		l := v.(*lifecycle)
+		l.mu.Lock()
+		closers, ps = l.closers, l.ps
+		l.mu.Unlock()
+	}
+	for _, fn := range closers {
+		if !util.IsTruthy(callFunction(ps, "on-close!", fn)) {
+			return false
+		}
+	}
+	win.Perform(system.ActionClose)
+	return true
+}
+
+var builtinsLifecycle = map[string]*env.Builtin{
+	"Go(*app.Window)//on-lifecycle!": {
+		Doc:   "Add a function called when the app moves to a stage: 'focused, 'unfocused, 'paused (minimized, or put away on phones), 'resumed or 'destroy; save state and stop timers when paused",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "Go(*app.Window)//on-lifecycle!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			stage, err := nameArg(ps, "Go(*app.Window)//on-lifecycle!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			known := false
+			for _, s := range lifecycleStages {
+				known = known || s == stage
+			}
+			if !known {
+				return failure(ps, "Go(*app.Window)//on-lifecycle!", fmt.Sprintf("unknown stage %s (%v)", stage, lifecycleStages))
+			}
+			fn, err := functionArg(ps, "Go(*app.Window)//on-lifecycle!", 3, 0, arg2)
+			if err != nil {
+				return err
+			}
+			l := lifecycleOf(win)
+			l.mu.Lock()
+			l.ps = ps
+			l.handlers[stage] = append(l.handlers[stage], fn)
+			l.mu.Unlock()
+			return arg0
+		},
+	},
+	"Go(*app.Window)//on-close!": {
+		Doc:   "Add a function asked before win .close closes the window; returning false keeps it open, like for unsaved changes. Put cleanup in on-lifecycle! 'destroy, which also runs when the system closes the window",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "Go(*app.Window)//on-close!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*app.Window)//on-close!", 2, 0, arg1)
+			if err != nil {
+				return err
+			}
+			l := lifecycleOf(win)
+			l.mu.Lock()
+			l.ps = ps
+			l.closers = append(l.closers, fn)
+			l.mu.Unlock()
+			return arg0
+		},
+	},
+	"Go(*app.Window)//close": {
+		Doc:   "Close the window unless an on-close! function returns false; returns whether it is closing, its on-lifecycle! 'destroy functions run as the event loop gets the destroy event",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "Go(*app.Window)//close", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(closeWindow(win)))
+		},
+	},
+	"Go(*app.Window)//paused?": {
+		Doc:   "Check whether the app is paused: minimized, or put away on phones",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "Go(*app.Window)//paused?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, ok := lifecycles.Load(win)
+			if !ok {
+				return *env.NewInteger(0)
+			}
+			l := v.(*lifecycle)
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return *env.NewInteger(boolToInt64(l.paused))
+		},
+	},
+}
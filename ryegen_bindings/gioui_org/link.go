@@ -0,0 +1,191 @@
+// Hyperlink labels.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os/exec"
+	"runtime"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// openURL opens url with the system's default handler.
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Link is a label that opens URL when clicked, or calls OnClick with the
+// URL and how it was clicked: "click", "ctrl-click" or "middle-click".
+type Link struct {
+	ps      *env.ProgramState
+	Theme   *material.Theme
+	Text    string
+	URL     string
+	Color   color.NRGBA
+	OnClick *env.Function
+	hovered bool
+	pressed pointer.Buttons
+}
+
+func (l *Link) activate(how string) {
+	if l.OnClick != nil {
+		callFunction(l.ps, "link on-click", *l.OnClick, *env.NewString(l.URL), *env.NewString(how))
+		return
+	}
+	if err := openURL(l.URL); err != nil {
+		fmt.Printf("\033[31mError: \033[1mlink: %v\033[m\n", err)
+	}
+}
+
+func (l *Link) update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(pointer.Filter{Target: l, Kinds: pointer.Enter | pointer.Leave | pointer.Press | pointer.Release | pointer.Cancel})
+		if !ok {
+			break
+		}
+		pe, ok := e.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch pe.Kind {
+		case pointer.Enter:
+			l.hovered = true
+		case pointer.Leave:
+			l.hovered = false
+		case pointer.Cancel:
+			l.hovered, l.pressed = false, 0
+		case pointer.Press:
+			l.pressed = pe.Buttons
+			if pe.Source == pointer.Touch {
+				l.pressed = pointer.ButtonPrimary
+			}
+		case pointer.Release:
+			b := l.pressed
+			l.pressed = 0
+			if !l.hovered && pe.Source == pointer.Mouse {
+				break
+			}
+			switch {
+			case b == pointer.ButtonTertiary:
+				l.activate("middle-click")
+			case b == pointer.ButtonPrimary && pe.Modifiers.Contain(key.ModShortcut):
+				l.activate("ctrl-click")
+			case b == pointer.ButtonPrimary:
+				l.activate("click")
+			}
+		}
+	}
+}
+
+func (l *Link) Layout(gtx layout.Context) layout.Dimensions {
+	l.update(gtx)
+	lbl := material.Body1(l.Theme, l.Text)
+	lbl.Color = l.Color
+	dims := lbl.Layout(gtx)
+	defer clip.Rect{Max: dims.Size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, l)
+	pointer.CursorPointer.Add(gtx.Ops)
+	if l.hovered {
+		y := dims.Size.Y - dims.Baseline + gtx.Dp(unit.Dp(1))
+		line := image.Rect(0, y, dims.Size.X, y+max(gtx.Dp(unit.Dp(1)), 1))
+		paint.FillShape(gtx.Ops, l.Color, clip.Rect(line).Op())
+	}
+	return dims
+}
+
+var builtinsLink = map[string]*env.Builtin{
+	"link": {
+		Doc:   "Create a hyperlink label that opens a URL in the default browser when clicked",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "link", 1, arg0)
+			if err != nil {
+				return err
+			}
+			txt, err := stringArg(ps, "link", 2, arg1)
+			if err != nil {
+				return err
+			}
+			url, err := stringArg(ps, "link", 3, arg2)
+			if err != nil {
+				return err
+			}
+			l := &Link{ps: ps, Theme: th, Text: txt, URL: url, Color: th.Palette.ContrastBg}
+			return *env.NewNative(ps.Idx, l, "Go(*gioui_org.Link)")
+		},
+	},
+	"Go(*gioui_org.Link)//layout": layoutBuiltin[*Link]("Go(*gioui_org.Link)//layout"),
+	"Go(*gioui_org.Link)//on-click!": {
+		Doc:   "Set function called with the URL and \"click\", \"ctrl-click\" or \"middle-click\" instead of opening the URL",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			l, err := nativeArg[*Link](ps, "Go(*gioui_org.Link)//on-click!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Link)//on-click!", 2, 2, arg1)
+			if err != nil {
+				return err
+			}
+			l.OnClick = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Link)//color!": {
+		Doc:   "Set the link color",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			l, err := nativeArg[*Link](ps, "Go(*gioui_org.Link)//color!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.Link)//color!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			l.Color = c
+			return arg0
+		},
+	},
+	"open-url": {
+		Doc:   "Open a URL with the system's default handler",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			url, err := stringArg(ps, "open-url", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if oerr := openURL(url); oerr != nil {
+				return failure(ps, "open-url", oerr.Error())
+			}
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,679 @@
+// Log viewer of many lines with filtering and tailing.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gioui.org/app"
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+const (
+	// logCapacity is how many lines a LogView keeps by default; older
+	// lines are dropped.
+	logCapacity = 1_000_000
+	// logScanBatch is how many lines a filter matches between updates.
+	logScanBatch = 1 << 14
+	// logMaxShown is how many bytes of a line are shown.
+	logMaxShown = 2000
+	// logPoll is how often a followed file is checked for more lines.
+	logPoll = 250 * time.Millisecond
+)
+
+// logRule colors the text matching a pattern.
+type logRule struct {
+	re    *regexp.Regexp
+	color color.NRGBA
+}
+
+// LogView shows lines of a log, the latest at the bottom, keeping the last
+// lines up to its capacity in a ring. Only the lines on screen are laid
+// out. A filter shows the lines matching a pattern, matched in the
+// background; rules color the text matching theirs. The view follows new
+// lines while scrolled to the end.
+type LogView struct {
+	Theme  *material.Theme
+	Follow bool
+	list   widget.List
+	rules  []logRule
+	anchor int64 // line at the top of the view when not following, or -1
+	mark   int64 // line jumped to, or -1
+	*logState
+}
+
+// logState is what a LogView shares with the goroutines following files
+// and matching filters, which mustn't keep the view itself from being
+// collected.
+type logState struct {
+	mu       sync.Mutex
+	capacity int
+	lines    []string // ring, oldest at head once full
+	head     int
+	first    int64 // number of the oldest line
+	filter   *regexp.Regexp
+	matches  []int64 // numbers of the lines matching the filter
+	scanned  int64   // lines before this one are matched
+	gen      int     // of the filter, ending stale scans
+	follower *logFollower
+	err      error
+	win      *app.Window
+}
+
+func newLogView(th *material.Theme, capacity int) *LogView {
+	v := &LogView{Theme: th, Follow: true, anchor: -1, mark: -1, logState: &logState{capacity: capacity}}
+	v.list.Axis = layout.Vertical
+	v.list.ScrollToEnd = true
+	return v
+}
+
+func (v *logState) invalidate() {
+	v.mu.Lock()
+	win := v.win
+	v.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+// line returns the line numbered seq; v.mu is held.
+func (v *logState) line(seq int64) string {
+	return v.lines[(v.head+int(seq-v.first))%len(v.lines)]
+}
+
+// push adds a line, dropping the oldest when full; v.mu is held.
+func (v *logState) push(s string) {
+	seq := v.first + int64(len(v.lines))
+	if len(v.lines) < v.capacity {
+		v.lines = append(v.lines, s)
+	} else {
+		v.lines[v.head] = s
+		v.head = (v.head + 1) % len(v.lines)
+		v.first++
+	}
+	// While a scan runs it matches the new lines itself.
+	if v.filter != nil && v.scanned == seq {
+		if v.filter.MatchString(s) {
+			v.matches = append(v.matches, seq)
+		}
+		v.scanned++
+	}
+}
+
+// Append adds the lines of text.
+func (v *LogView) Append(text string) {
+	text = strings.TrimSuffix(text, "\n")
+	v.mu.Lock()
+	for _, s := range strings.Split(text, "\n") {
+		v.push(strings.TrimSuffix(s, "\r"))
+	}
+	v.mu.Unlock()
+	v.invalidate()
+}
+
+func (v *LogView) Clear() {
+	v.mu.Lock()
+	v.first += int64(len(v.lines))
+	v.lines, v.head = nil, 0
+	v.matches, v.scanned = nil, v.first
+	v.mu.Unlock()
+	v.anchor, v.mark = -1, -1
+	v.invalidate()
+}
+
+// SetFilter shows only the lines matching re, or all for nil. Lines held
+// are matched in the background, the view growing as they are.
+func (v *LogView) SetFilter(re *regexp.Regexp) {
+	v.mu.Lock()
+	v.gen++
+	v.filter, v.matches, v.scanned = re, nil, v.first
+	gen := v.gen
+	v.mu.Unlock()
+	if re != nil {
+		go v.scan(gen, re)
+	}
+	v.invalidate()
+}
+
+func (v *logState) scan(gen int, re *regexp.Regexp) {
+	var chunk []string
+	var found []int64
+	for {
+		v.mu.Lock()
+		if v.gen != gen {
+			v.mu.Unlock()
+			return
+		}
+		start := max(v.scanned, v.first)
+		end := min(start+logScanBatch, v.first+int64(len(v.lines)))
+		if start == end {
+			v.scanned = end
+			v.mu.Unlock()
+			return
+		}
+		chunk = chunk[:0]
+		for seq := start; seq < end; seq++ {
+			chunk = append(chunk, v.line(seq))
+		}
+		v.mu.Unlock()
+
+		found = found[:0]
+		for i, s := range chunk {
+			if re.MatchString(s) {
+				found = append(found, start+int64(i))
+			}
+		}
+		v.mu.Lock()
+		if v.gen == gen {
+			v.matches = append(v.matches, found...)
+			v.scanned = end
+		}
+		v.mu.Unlock()
+		v.invalidate()
+	}
+}
+
+// Filtering reports whether the filter is still matching the lines held.
+func (v *LogView) Filtering() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.filter != nil && v.scanned < v.first+int64(len(v.lines))
+}
+
+// rows returns the number of lines shown and a function numbering them;
+// v.mu is held.
+func (v *LogView) rows() (int, func(i int) int64) {
+	if v.filter == nil {
+		return len(v.lines), func(i int) int64 { return v.first + int64(i) }
+	}
+	// Drop the matches of lines no longer held.
+	if k := sort.Search(len(v.matches), func(i int) bool { return v.matches[i] >= v.first }); k > 0 {
+		v.matches = v.matches[k:]
+	}
+	return len(v.matches), func(i int) int64 { return v.matches[i] }
+}
+
+// index returns the row showing the line numbered seq, or the row after.
+func (v *LogView) index(seq int64) int {
+	if v.filter == nil {
+		return int(max(seq-v.first, 0))
+	}
+	return sort.Search(len(v.matches), func(i int) bool { return v.matches[i] >= seq })
+}
+
+var logTimeRe = regexp.MustCompile(`(\d{4}-\d{2}-\d{2})[T ](\d{2}:\d{2}(?::\d{2})?(?:[.,]\d+)?)\s?(Z|[+-]\d{2}:?\d{2})?`)
+
+// parseLogTime reads a time like 2024-05-01 12:00:05.123+02:00 near the
+// start of s; times without a zone are local.
+func parseLogTime(s string) (time.Time, bool) {
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	m := logTimeRe.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	clock := strings.Replace(m[2], ",", ".", 1)
+	if len(clock) == 5 {
+		clock += ":00"
+	}
+	zone := m[3]
+	if len(zone) == 5 {
+		zone = zone[:3] + ":" + zone[3:]
+	}
+	layout := "2006-01-02T15:04:05"
+	if zone != "" {
+		layout += "Z07:00"
+	}
+	t, err := time.ParseInLocation(layout, m[1]+"T"+clock+zone, time.Local)
+	return t, err == nil
+}
+
+// JumpTo scrolls to the first line shown logged at or after t, going by
+// the times the lines start with, and marks it. Lines without a time take
+// the time of the next line with one.
+func (v *LogView) JumpTo(t time.Time) bool {
+	v.mu.Lock()
+	n, seq := v.rows()
+	timeAt := func(i int) (time.Time, bool) {
+		for end := min(i+1000, n); i < end; i++ {
+			if lt, ok := parseLogTime(v.line(seq(i))); ok {
+				return lt, true
+			}
+		}
+		return time.Time{}, false
+	}
+	i := sort.Search(n, func(i int) bool {
+		lt, ok := timeAt(i)
+		return !ok || !lt.Before(t)
+	})
+	if i < n {
+		v.mark = seq(i)
+	}
+	v.mu.Unlock()
+	if i == n {
+		return false
+	}
+	v.list.Position = layout.Position{First: i, BeforeEnd: true}
+	v.anchor = v.mark
+	v.invalidate()
+	return true
+}
+
+// logFollower reads the lines written to a file.
+type logFollower struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// FollowFile adds the lines of a file and the lines written to it later,
+// reopening it when it's truncated or replaced, as logs are rotated.
+func (v *LogView) FollowFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	v.Stop()
+	fl := &logFollower{stop: make(chan struct{}), done: make(chan struct{})}
+	v.mu.Lock()
+	v.follower, v.err = fl, nil
+	v.mu.Unlock()
+	go v.follow(fl, path, f)
+	return nil
+}
+
+func (v *logState) follow(fl *logFollower, path string, f *os.File) {
+	defer close(fl.done)
+	defer func() { f.Close() }()
+	buf := make([]byte, 64<<10)
+	var partial []byte
+	var off int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			off += int64(n)
+			data := append(partial, buf[:n]...)
+			last := strings.LastIndexByte(string(data), '\n')
+			if last >= 0 {
+				v.mu.Lock()
+				for _, s := range strings.Split(string(data[:last]), "\n") {
+					v.push(strings.TrimSuffix(s, "\r"))
+				}
+				v.mu.Unlock()
+				v.invalidate()
+			}
+			partial = append(partial[:0], data[last+1:]...)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			v.mu.Lock()
+			v.err = err
+			v.mu.Unlock()
+			return
+		}
+		select {
+		case <-fl.stop:
+			return
+		case <-time.After(logPoll):
+		}
+		// A file shorter than read so far was truncated, another at
+		// the path replaced it.
+		st, serr := f.Stat()
+		pst, perr := os.Stat(path)
+		if serr == nil && perr == nil && (st.Size() < off || !os.SameFile(st, pst)) {
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f, off, partial = nf, 0, partial[:0]
+		}
+	}
+}
+
+// Stop stops following a file.
+func (v *logState) Stop() {
+	v.mu.Lock()
+	fl := v.follower
+	v.follower = nil
+	v.mu.Unlock()
+	if fl != nil {
+		close(fl.stop)
+		<-fl.done
+	}
+}
+
+// textSpan is a part of a line of text drawn in a color, over a background
+// unless it's transparent.
+type textSpan struct {
+	text  string
+	color color.NRGBA
+	bg    color.NRGBA
+}
+
+// monoFont is the font of logs and code.
+var monoFont = font.Font{Typeface: "Go Mono"}
+
+// layoutSpans lays out spans of monospaced text one after the other from x,
+// clipped at the width, and returns the height of the line.
+func layoutSpans(gtx layout.Context, th *material.Theme, x int, spans []textSpan) int {
+	width := gtx.Constraints.Max.X
+	h := 0
+	for _, sp := range spans {
+		if x >= width {
+			break
+		}
+		lbl := material.Body2(th, sp.text)
+		lbl.Font = monoFont
+		lbl.Color = sp.color
+		lbl.MaxLines = 1
+		lgtx := gtx
+		lgtx.Constraints = layout.Constraints{Max: image.Pt(width-x, gtx.Constraints.Max.Y)}
+		m := op.Record(gtx.Ops)
+		dims := lbl.Layout(lgtx)
+		call := m.Stop()
+		if sp.bg.A != 0 {
+			paint.FillShape(gtx.Ops, sp.bg, clip.Rect{Min: image.Pt(x, 0), Max: image.Pt(x+dims.Size.X, dims.Size.Y)}.Op())
+		}
+		off := op.Offset(image.Pt(x, 0)).Push(gtx.Ops)
+		call.Add(gtx.Ops)
+		off.Pop()
+		x += dims.Size.X
+		h = max(h, dims.Size.Y)
+	}
+	if h == 0 {
+		lbl := material.Body2(th, " ")
+		lbl.Font = monoFont
+		h = lbl.Layout(gtx.Disabled()).Size.Y
+	}
+	return h
+}
+
+// shownText cuts s to the bytes of logMaxShown at most.
+func shownText(s string) string {
+	if len(s) <= logMaxShown {
+		return s
+	}
+	n := logMaxShown
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// spans splits a line into parts colored by the rules, the matches of the
+// filter over a background.
+func (v *LogView) spans(s string, filter *regexp.Regexp) []textSpan {
+	s = shownText(s)
+	th := v.Theme
+	if len(v.rules) == 0 && filter == nil {
+		return []textSpan{{text: s, color: th.Fg}}
+	}
+	colors := make([]color.NRGBA, len(s))
+	bgs := make([]bool, len(s))
+	for i := range colors {
+		colors[i] = th.Fg
+	}
+	for _, r := range v.rules {
+		for _, m := range r.re.FindAllStringIndex(s, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				colors[i] = r.color
+			}
+		}
+	}
+	if filter != nil {
+		for _, m := range filter.FindAllStringIndex(s, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				bgs[i] = true
+			}
+		}
+	}
+	var res []textSpan
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || colors[i] != colors[start] || bgs[i] != bgs[start] {
+			sp := textSpan{text: s[start:i], color: colors[start]}
+			if bgs[start] {
+				sp.bg = mulAlpha(th.ContrastBg, 0x50)
+			}
+			res = append(res, sp)
+			start = i
+		}
+	}
+	return res
+}
+
+func (v *LogView) layoutLine(gtx layout.Context, s string, filter *regexp.Regexp, marked bool) layout.Dimensions {
+	width := gtx.Constraints.Max.X
+	macro := op.Record(gtx.Ops)
+	h := layoutSpans(gtx, v.Theme, gtx.Dp(6), v.spans(s, filter))
+	content := macro.Stop()
+	if marked {
+		paint.FillShape(gtx.Ops, mulAlpha(v.Theme.ContrastBg, 0x30), clip.Rect{Max: image.Pt(width, h)}.Op())
+	}
+	content.Add(gtx.Ops)
+	return layout.Dimensions{Size: image.Pt(width, h)}
+}
+
+func (v *LogView) Layout(gtx layout.Context) layout.Dimensions {
+	// The lock is held while the lines on screen are laid out, a short
+	// while even for millions of lines.
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	n, seq := v.rows()
+	if v.anchor >= 0 {
+		// Keep the line at the top in place as older lines are dropped.
+		v.list.Position.First = v.index(v.anchor)
+	}
+	v.list.ScrollToEnd = v.Follow
+	dims := material.List(v.Theme, &v.list).Layout(gtx, n, func(gtx layout.Context, i int) layout.Dimensions {
+		sq := seq(i)
+		return v.layoutLine(gtx, v.line(sq), v.filter, sq == v.mark)
+	})
+	v.anchor = -1
+	if pos := v.list.Position; (pos.BeforeEnd || !v.Follow) && pos.First < n {
+		v.anchor = seq(pos.First)
+	}
+	return dims
+}
+
+// logViewBuiltin returns a "//method" builtin of log views; fn returning nil
+// returns the view.
+func logViewBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.LogView)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*LogView](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, v, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+// logViewObj returns a new log view, stopping following files as the
+// window closes.
+func logViewObj(ps *env.ProgramState, th *material.Theme, capacity int) env.Object {
+	v := newLogView(th, capacity)
+	trackResource(v, (*LogView).Stop)
+	return *env.NewNative(ps.Idx, v, "Go(*gioui_org.LogView)")
+}
+
+var builtinsLogView = map[string]*env.Builtin{
+	"log-view": {
+		Doc:   "Create a log view keeping the last million lines, following new lines while scrolled to the end",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "log-view", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return logViewObj(ps, th, logCapacity)
+		},
+	},
+	"log-view\\capacity": {
+		Doc:   "Create a log view keeping the last lines up to a number",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "log-view\\capacity", 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := integerArg(ps, "log-view\\capacity", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if n <= 0 {
+				return failure(ps, "log-view\\capacity", "capacity must be positive")
+			}
+			return logViewObj(ps, th, int(n))
+		},
+	},
+	"Go(*gioui_org.LogView)//layout": layoutBuiltin[*LogView]("Go(*gioui_org.LogView)//layout"),
+	"Go(*gioui_org.LogView)//append": logViewBuiltin("append", "Add the lines of a text, dropping the oldest lines beyond the capacity", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		s, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.Append(s)
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//clear": logViewBuiltin("clear", "Remove all lines", 1, func(ps *env.ProgramState, name string, v *LogView, _ env.Object) env.Object {
+		v.Clear()
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//follow-file": logViewBuiltin("follow-file", "Add the lines of a file and, in the background, the lines written to it later, like tail -f; the file is reopened when rotated", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		path, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if ferr := v.FollowFile(path); ferr != nil {
+			return failure(ps, name, ferr.Error())
+		}
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//stop": logViewBuiltin("stop", "Stop following a file", 1, func(ps *env.ProgramState, name string, v *LogView, _ env.Object) env.Object {
+		v.Stop()
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//filter!": logViewBuiltin("filter!", "Show only the lines matching a regular expression, highlighting the matches, or all lines for an empty string; lines are matched in the background", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		s, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			v.SetFilter(nil)
+			return nil
+		}
+		re, rerr := regexp.Compile(s)
+		if rerr != nil {
+			return failure(ps, name, rerr.Error())
+		}
+		v.SetFilter(re)
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//filtering?": logViewBuiltin("filtering?", "Check whether the filter is still matching the lines", 1, func(ps *env.ProgramState, name string, v *LogView, _ env.Object) env.Object {
+		return *env.NewInteger(boolToInt64(v.Filtering()))
+	}),
+	"Go(*gioui_org.LogView)//highlight!": logViewBuiltin("highlight!", "Color the text matching regular expressions, from a block of expressions each followed by a color, like { \"ERROR\" \"#d32f2f\" \"WARN\" \"#f57c00\" }", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		blk, ok := arg1.(env.Block)
+		if !ok || len(blk.Series.S)%2 != 0 {
+			return argError(ps, name, 2, "block of expressions and colors", arg1)
+		}
+		var rules []logRule
+		s := blk.Series.S
+		for i := 0; i < len(s); i += 2 {
+			expr, err := stringArg(ps, name, 2, s[i])
+			if err != nil {
+				return err
+			}
+			re, rerr := regexp.Compile(expr)
+			if rerr != nil {
+				return failure(ps, name, rerr.Error())
+			}
+			c, err := colorArg(ps, name, 2, s[i+1])
+			if err != nil {
+				return err
+			}
+			rules = append(rules, logRule{re: re, color: c})
+		}
+		v.rules = rules
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//follow!": logViewBuiltin("follow!", "Set whether the view follows new lines while scrolled to the end (true by default); turning it on scrolls to the end", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		b, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.Follow = b != 0
+		if v.Follow {
+			v.anchor = -1
+			v.list.Position = layout.Position{First: math.MaxInt32}
+		}
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//jump-to": logViewBuiltin("jump-to", "Scroll to and mark the first line shown logged at or after a time like \"2024-05-01 12:00\", going by the times lines start with; fails if none is that late", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		s, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		t, ok := parseLogTime(s)
+		if !ok {
+			return failure(ps, name, "expected a time like 2024-05-01 12:00:00, got "+s)
+		}
+		if !v.JumpTo(t) {
+			return failure(ps, name, "no line logged at or after "+s)
+		}
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//count?": logViewBuiltin("count?", "Get the number of lines shown, the ones matching the filter if set", 1, func(ps *env.ProgramState, name string, v *LogView, _ env.Object) env.Object {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		n, _ := v.rows()
+		return *env.NewInteger(int64(n))
+	}),
+	"Go(*gioui_org.LogView)//wake!": logViewBuiltin("wake!", "Invalidate a window as lines are added or matched in the background, so it shows them", 2, func(ps *env.ProgramState, name string, v *LogView, arg1 env.Object) env.Object {
+		win, err := nativeArg[*app.Window](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.mu.Lock()
+		v.win = win
+		v.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.LogView)//error?": logViewBuiltin("error?", "Get why following the file failed, or an empty string", 1, func(ps *env.ProgramState, name string, v *LogView, _ env.Object) env.Object {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(v.err.Error())
+	}),
+}
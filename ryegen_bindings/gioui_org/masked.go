@@ -0,0 +1,355 @@
+// Masked and validated text inputs.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image/color"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+	"github.com/refaktor/rye/util"
+)
+
+// Mask slot characters: 9 is a digit, a is a letter, * is a letter or
+// digit. Any other mask character is a literal that is inserted
+// automatically.
+var maskPresets = map[string]string{
+	"phone":       "(999) 999-9999",
+	"date":        "9999-99-99",
+	"time":        "99:99",
+	"credit-card": "9999 9999 9999 9999",
+	"zip":         "99999",
+}
+
+func maskSlot(m rune) bool {
+	return m == '9' || m == 'a' || m == '*'
+}
+
+func maskAccepts(m rune, r rune) bool {
+	switch m {
+	case '9':
+		return unicode.IsDigit(r)
+	case 'a':
+		return unicode.IsLetter(r)
+	case '*':
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	return false
+}
+
+// applyMask extracts the raw characters of s that fit the slots of mask and
+// returns them together with the formatted text. Literals of the mask met
+// where they belong are skipped, so the 1 of "+1 (999) 999-9999" in text
+// formatted earlier isn't read as a digit typed.
+func applyMask(mask, s string) (raw, formatted string) {
+	if mask == "" {
+		return s, s
+	}
+	m := []rune(mask)
+	in := []rune(s)
+	var rb, fb strings.Builder
+	i := 0
+	for mi := 0; mi < len(m) && i < len(in); mi++ {
+		if !maskSlot(m[mi]) {
+			if in[i] == m[mi] {
+				i++
+			}
+			continue
+		}
+		for i < len(in) && !maskAccepts(m[mi], in[i]) {
+			i++
+		}
+		if i == len(in) {
+			break
+		}
+		rb.WriteRune(in[i])
+		i++
+	}
+	// Write literals only up to the last filled slot, so that deleting
+	// works naturally.
+	n := utf8.RuneCountInString(rb.String())
+	rawRunes := []rune(rb.String())
+	for mi, ri := 0, 0; mi < len(m) && ri < n; mi++ {
+		if maskSlot(m[mi]) {
+			fb.WriteRune(rawRunes[ri])
+			ri++
+		} else {
+			fb.WriteRune(m[mi])
+		}
+	}
+	return rb.String(), fb.String()
+}
+
+// MaskedInput is a single line editor that formats its content according
+// to a mask and colors its border by validation state.
+type MaskedInput struct {
+	ps       *env.ProgramState
+	Theme    *material.Theme
+	Mask     string
+	Hint     string
+	Pattern  *regexp.Regexp
+	validate *env.Function
+	onChange *env.Function
+	editor   widget.Editor
+	raw      string
+	valid    bool
+}
+
+func newMaskedInput(ps *env.ProgramState, th *material.Theme, mask string) *MaskedInput {
+	m := &MaskedInput{ps: ps, Theme: th, Mask: mask, Hint: mask}
+	m.editor.SingleLine = true
+	m.editor.Submit = true
+	m.revalidate()
+	return m
+}
+
+// Complete reports whether all slots of the mask are filled.
+func (m *MaskedInput) Complete() bool {
+	if m.Mask == "" {
+		return m.raw != ""
+	}
+	slots := 0
+	for _, r := range m.Mask {
+		if maskSlot(r) {
+			slots++
+		}
+	}
+	return utf8.RuneCountInString(m.raw) == slots
+}
+
+func (m *MaskedInput) setText(s string) {
+	raw, formatted := applyMask(m.Mask, s)
+	if formatted != m.editor.Text() {
+		m.editor.SetText(formatted)
+		n := m.editor.Len()
+		m.editor.SetCaret(n, n)
+	}
+	if raw == m.raw {
+		return
+	}
+	m.raw = raw
+	m.revalidate()
+	if m.onChange != nil {
+		callFunction(m.ps, "masked-input on-change", *m.onChange, *env.NewString(raw), *env.NewString(formatted))
+	}
+}
+
+func (m *MaskedInput) revalidate() {
+	m.valid = true
+	if m.Pattern != nil {
+		m.valid = m.Pattern.MatchString(m.raw)
+	}
+	if m.valid && m.validate != nil {
+		m.valid = util.IsTruthy(callFunction(m.ps, "masked-input validate", *m.validate, *env.NewString(m.raw)))
+	}
+}
+
+func (m *MaskedInput) Layout(gtx layout.Context) layout.Dimensions {
+	for {
+		e, ok := m.editor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := e.(widget.ChangeEvent); ok {
+			m.setText(m.editor.Text())
+		}
+	}
+	th := m.Theme
+	border := mulAlpha(th.Palette.Fg, 0x60)
+	switch {
+	case m.raw == "":
+	case !m.valid:
+		border = color.NRGBA{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff}
+	case m.Complete():
+		border = color.NRGBA{R: 0x38, G: 0x8e, B: 0x3c, A: 0xff}
+	}
+	return widget.Border{Color: border, CornerRadius: 4, Width: 1}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Left: 8, Right: 8, Top: 6, Bottom: 6}.Layout(gtx, material.Editor(th, &m.editor, m.Hint).Layout)
+	})
+}
+
+// maskArg accepts a preset name ('phone 'date 'time 'credit-card 'zip) or
+// a mask string.
+func maskArg(ps *env.ProgramState, name string, n int, arg env.Object) (string, *env.Error) {
+	switch v := arg.(type) {
+	case env.Word:
+		w := ps.Idx.GetWord(v.Index)
+		mask, ok := maskPresets[w]
+		if !ok {
+			return "", failure(ps, name, "unknown mask preset "+w)
+		}
+		return mask, nil
+	case env.String:
+		return v.Value, nil
+	}
+	return "", argError(ps, name, n, "word or string", arg)
+}
+
+var builtinsMasked = map[string]*env.Builtin{
+	"masked-input": {
+		Doc:   "Create a text input formatted by a mask: a preset ('phone 'date 'time 'credit-card 'zip) or a string where 9 is a digit, a a letter and * either",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "masked-input", 1, arg0)
+			if err != nil {
+				return err
+			}
+			mask, err := maskArg(ps, "masked-input", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newMaskedInput(ps, th, mask), "Go(*gioui_org.MaskedInput)")
+		},
+	},
+	"validated-input": {
+		Doc:   "Create a text input without a mask, colored by validation state",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "validated-input", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newMaskedInput(ps, th, ""), "Go(*gioui_org.MaskedInput)")
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//layout": layoutBuiltin[*MaskedInput]("Go(*gioui_org.MaskedInput)//layout"),
+	"Go(*gioui_org.MaskedInput)//raw?": {
+		Doc:   "Get the entered characters without mask literals",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//raw?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(m.raw)
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//text?": {
+		Doc:   "Get the formatted text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(m.editor.Text())
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//text!": {
+		Doc:   "Set the text; it's reformatted by the mask",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//text!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, "Go(*gioui_org.MaskedInput)//text!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			m.setText(s)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//hint!": {
+		Doc:   "Set the hint shown when empty (defaults to the mask)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//hint!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, "Go(*gioui_org.MaskedInput)//hint!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			m.Hint = s
+			return arg0
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//pattern!": {
+		Doc:   "Set a regular expression the raw value must match to be valid",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//pattern!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, "Go(*gioui_org.MaskedInput)//pattern!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			re, rerr := regexp.Compile(s)
+			if rerr != nil {
+				return failure(ps, "Go(*gioui_org.MaskedInput)//pattern!", rerr.Error())
+			}
+			m.Pattern = re
+			m.revalidate()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//validate!": {
+		Doc:   "Set a function that gets the raw value and returns true if it's valid",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//validate!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.MaskedInput)//validate!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			m.validate = &fn
+			m.revalidate()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//on-change!": {
+		Doc:   "Set function called with the raw and formatted value whenever the input changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//on-change!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.MaskedInput)//on-change!", 2, 2, arg1)
+			if err != nil {
+				return err
+			}
+			m.onChange = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//valid?": {
+		Doc:   "Check whether the value passes validation",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//valid?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(m.valid))
+		},
+	},
+	"Go(*gioui_org.MaskedInput)//complete?": {
+		Doc:   "Check whether all mask slots are filled",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			m, err := nativeArg[*MaskedInput](ps, "Go(*gioui_org.MaskedInput)//complete?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(m.Complete()))
+		},
+	},
+}
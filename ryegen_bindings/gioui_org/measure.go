@@ -0,0 +1,216 @@
+// Text and widget measurement and absolute text placement.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/refaktor/rye/env"
+)
+
+// TextMetrics is the result of shaping a string.
+type TextMetrics struct {
+	Width, Height float32
+	Advances      []float32 // per glyph cluster
+	Breaks        []int     // rune offsets where wrapped lines start
+}
+
+// dryLayout lays out w to get its size, discarding the operations it
+// records. Input is disabled so widgets don't consume events.
+func dryLayout(gtx layout.Context, w layout.Widget) layout.Dimensions {
+	m := op.Record(gtx.Ops)
+	dims := w(gtx.Disabled())
+	m.Stop()
+	return dims
+}
+
+// measureContext is a context for measuring widgets outside a frame, with
+// 1px = 1dp = 1sp and at most max.
+func measureContext(max image.Point) layout.Context {
+	return layout.Context{
+		Ops:         new(op.Ops),
+		Metric:      unit.Metric{PxPerDp: 1, PxPerSp: 1},
+		Constraints: layout.Constraints{Max: max},
+		Now:         time.Now(),
+	}
+}
+
+// sizeObj returns a dict of the width, height and baseline of dims in dp.
+func sizeObj(m unit.Metric, dims layout.Dimensions) env.Object {
+	return *env.NewDict(map[string]any{
+		"width":    *env.NewDecimal(float64(m.PxToDp(dims.Size.X))),
+		"height":   *env.NewDecimal(float64(m.PxToDp(dims.Size.Y))),
+		"baseline": *env.NewDecimal(float64(m.PxToDp(dims.Baseline))),
+	})
+}
+
+// measureText shapes s at size and wraps it at maxWidth (0 for no
+// wrapping). Sizes are sp and results dp, taking 1sp = 1dp.
+func measureText(th *material.Theme, s string, size float32, maxWidth int) TextMetrics {
+	if maxWidth <= 0 {
+		maxWidth = math.MaxInt32 / 2
+	}
+	sh := th.Shaper
+	sh.LayoutString(text.Parameters{
+		Font:     font.Font{Typeface: th.Face},
+		PxPerEm:  fixed.Int26_6(size * 64),
+		MaxWidth: maxWidth,
+	}, s)
+	var m TextMetrics
+	var right fixed.Int26_6
+	top, bottom := int32(math.MaxInt32), int32(math.MinInt32)
+	var cluster fixed.Int26_6
+	runes := 0
+	for g, ok := sh.NextGlyph(); ok; g, ok = sh.NextGlyph() {
+		right = max(right, g.X+g.Advance)
+		top = min(top, g.Y-int32(g.Ascent.Ceil()))
+		bottom = max(bottom, g.Y+int32(g.Descent.Ceil()))
+		cluster += g.Advance
+		if g.Flags&text.FlagClusterBreak != 0 {
+			m.Advances = append(m.Advances, float32(cluster)/64)
+			cluster = 0
+			runes += int(g.Runes)
+		}
+		if g.Flags&text.FlagLineBreak != 0 && g.Flags&text.FlagParagraphBreak == 0 {
+			m.Breaks = append(m.Breaks, runes)
+		}
+	}
+	m.Width = float32(right) / 64
+	if bottom > top {
+		m.Height = float32(bottom - top)
+	}
+	return m
+}
+
+func (m TextMetrics) object() env.Object {
+	adv := make([]env.Object, len(m.Advances))
+	for i, a := range m.Advances {
+		adv[i] = *env.NewDecimal(float64(a))
+	}
+	brk := make([]env.Object, len(m.Breaks))
+	for i, b := range m.Breaks {
+		brk[i] = *env.NewInteger(int64(b))
+	}
+	return *env.NewDict(map[string]any{
+		"width":    *env.NewDecimal(float64(m.Width)),
+		"height":   *env.NewDecimal(float64(m.Height)),
+		"advances": *env.NewBlock(*env.NewTSeries(adv)),
+		"breaks":   *env.NewBlock(*env.NewTSeries(brk)),
+	})
+}
+
+func measureBuiltin(name string, wrap bool) *env.Builtin {
+	doc := "Measure a string at a text size; returns a dict of width, height, glyph cluster advances and line break rune offsets"
+	argsn := 3
+	if wrap {
+		doc = "Measure a string at a text size wrapped at a width; returns a dict of width, height, glyph cluster advances and line break rune offsets"
+		argsn = 4
+	}
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			size, err := decimalArg(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			width := 0.0
+			if wrap {
+				if width, err = decimalArg(ps, name, 4, arg3); err != nil {
+					return err
+				}
+			}
+			return measureText(th, s, float32(size), int(width)).object()
+		},
+	}
+}
+
+var builtinsMeasure = map[string]*env.Builtin{
+	"measure-text":       measureBuiltin("measure-text", false),
+	"measure-text\\wrap": measureBuiltin("measure-text\\wrap", true),
+	"measure": {
+		Doc:   "Measure the natural size of a widget by laying it out without drawing; returns a dict of width, height and baseline in dp",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := widgetArg(ps, "measure", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx := measureContext(image.Pt(unboundedSize, unboundedSize))
+			return sizeObj(gtx.Metric, dryLayout(gtx, w))
+		},
+	},
+	"measure\\max": {
+		Doc:   "Measure the natural size of a widget given at most a width and height in dp, like wrapped text; returns a dict of width, height and baseline in dp",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := widgetArg(ps, "measure\\max", 1, arg0)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "measure\\max", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			gtx := measureContext(image.Pt(int(x), int(y)))
+			return sizeObj(gtx.Metric, dryLayout(gtx, w))
+		},
+	},
+	"measure\\in": {
+		Doc:   "Measure the natural size of a widget in a frame, at most the context's maximum, without drawing; returns a dict of width, height and baseline in dp",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "measure\\in", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "measure\\in", 2, arg1)
+			if err != nil {
+				return err
+			}
+			gtx.Constraints.Min = image.Point{}
+			return sizeObj(gtx.Metric, dryLayout(gtx, w))
+		},
+	},
+	"draw-text-at": {
+		Doc:   "Draw a label with its top-left corner at x y, without wrapping",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "draw-text-at", 1, arg0)
+			if err != nil {
+				return err
+			}
+			lbl, err := nativeArg[*material.LabelStyle](ps, "draw-text-at", 2, arg1)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "draw-text-at", 3, arg2, arg3)
+			if err != nil {
+				return err
+			}
+			defer op.Offset(image.Pt(gtx.Dp(unit.Dp(x)), gtx.Dp(unit.Dp(y)))).Push(gtx.Ops).Pop()
+			gtx.Constraints = layout.Constraints{Max: image.Pt(math.MaxInt32/2, math.MaxInt32/2)}
+			return dimensionsObj(ps, lbl.Layout(gtx))
+		},
+	},
+}
@@ -0,0 +1,46 @@
+// Rye-idiomatic aliases of generated builtins.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	_ "embed"
+	"strings"
+
+	"github.com/refaktor/rye/env"
+)
+
+//go:embed names.txt
+var namesFile string
+
+// aliasBuiltins returns the builtins of names under their additional
+// names. names has a builtin key and a word per line; for a method
+// ("kind//method") the word replaces the method name. Lines starting with #
+// are comments. Names already taken are left alone.
+func aliasBuiltins(builtins map[string]*env.Builtin, names string) map[string]*env.Builtin {
+	res := map[string]*env.Builtin{}
+	for _, line := range strings.Split(names, "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		if len(f) != 2 {
+			panic("names.txt: expected a builtin and a word: " + line)
+		}
+		b, ok := builtins[f[0]]
+		if !ok {
+			panic("names.txt: no builtin " + f[0])
+		}
+		alias := f[1]
+		if kind, _, ok := strings.Cut(f[0], "//"); ok {
+			alias = kind + "//" + f[1]
+		}
+		if _, taken := builtins[alias]; !taken {
+			res[alias] = b
+		}
+	}
+	return res
+}
+
+var builtinsNames = aliasBuiltins(builtinsGenerated, namesFile)
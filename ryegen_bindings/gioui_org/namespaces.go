@@ -0,0 +1,116 @@
+// Sub-contexts per Gio package.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"strings"
+
+	"github.com/refaktor/rye/env"
+	"github.com/refaktor/rye/evaldo"
+)
+
+// packagePrefixes maps the prefixes ryegen gives the generated builtins of
+// each Gio package to the name of the package's sub-context.
+var packagePrefixes = map[string]string{
+	"app":       "app",
+	"clip":      "clip",
+	"clipboard": "clipboard",
+	"event":     "event",
+	"f-32":      "f32",
+	"font":      "font",
+	"gesture":   "gesture",
+	"gofont":    "gofont",
+	"gpu":       "gpu",
+	"headless":  "headless",
+	"input":     "input",
+	"key":       "key",
+	"layout":    "layout",
+	"material":  "material",
+	"op":        "op",
+	"opentype":  "opentype",
+	"paint":     "paint",
+	"pointer":   "pointer",
+	"semantic":  "semantic",
+	"system":    "system",
+	"text":      "text",
+	"transfer":  "transfer",
+	"unit":      "unit",
+	"widget":    "widget",
+}
+
+// handPackages maps the sub-contexts of hand-written builtins to the maps
+// holding them; a builtin named with the sub-context's prefix is moved there
+// (compute-resize becomes compute/resize, secret-get secret/get).
+var handPackages = map[string][]map[string]*env.Builtin{
+	"compute": {builtinsCompute, builtinsPipeline},
+	"secret":  {builtinsSecret},
+	"auth":    {builtinsAuth},
+	"data":    {builtinsData, builtinsDataSQL, builtinsDataGrid},
+	"table":   {builtinsTable},
+}
+
+// splitPackages sorts the builtins into the ones of each package sub-context,
+// named without their package prefix (layout-flex becomes layout/flex), and
+// the rest: methods, the hand-written builtins and unprefixed generated
+// ones. Only generated names are moved, with the hand-written builtins
+// replacing some of them (headless-window), so hand-written ones that
+// happen to share a prefix (key-down?, text-shaper\fallback) stay where
+// they are. Some hand-written groups get a sub-context of their own, listed
+// in handPackages.
+func splitPackages() (top map[string]*env.Builtin, pkgs map[string]map[string]*env.Builtin) {
+	top = map[string]*env.Builtin{}
+	pkgs = map[string]map[string]*env.Builtin{}
+	for k, b := range Builtins {
+		top[k] = b
+	}
+	for k := range builtinsGenerated {
+		if strings.Contains(k, "//") {
+			continue
+		}
+		b := Builtins[k]
+		for prefix, pkg := range packagePrefixes {
+			name, ok := strings.CutPrefix(k, prefix+"-")
+			if !ok || name == "" {
+				continue
+			}
+			if pkgs[pkg] == nil {
+				pkgs[pkg] = map[string]*env.Builtin{}
+			}
+			pkgs[pkg][name] = b
+			delete(top, k)
+			break
+		}
+	}
+	for pkg, maps := range handPackages {
+		pkgs[pkg] = map[string]*env.Builtin{}
+		for _, bs := range maps {
+			for k := range bs {
+				if name, ok := strings.CutPrefix(k, pkg+"-"); ok {
+					pkgs[pkg][name] = Builtins[k]
+					delete(top, k)
+				}
+			}
+		}
+	}
+	return top, pkgs
+}
+
+// RegisterContexts registers the builtins in a context called name, with
+// the generated ones grouped in a sub-context per Gio package, reached by
+// paths like gio/layout/flex. Methods stay generic words usable anywhere.
+// The sub-contexts are meant to be used through paths: inside the context
+// (do\par gio) their names would hide methods of the same name, like
+// .layout or .text.
+func RegisterContexts(ps *env.ProgramState, name string) *env.RyeCtx {
+	top, pkgs := splitPackages()
+	ctx := evaldo.RegisterBuiltinsInContext(top, ps, name)
+	outer := ps.Ctx
+	ps.Ctx = ctx
+	for pkg, bs := range pkgs {
+		evaldo.RegisterBuiltinsInSubContext(bs, ps, ctx, pkg)
+	}
+	ps.Ctx = outer
+	return ctx
+}
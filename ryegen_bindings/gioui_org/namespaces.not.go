@@ -0,0 +1,13 @@
+// Sub-contexts per Gio package, for builds without Gio.
+
+//go:build b_no_gioui
+
+package gioui_org
+
+import "github.com/refaktor/rye/env"
+
+// RegisterContexts does nothing without Gio; there are no builtins to
+// group.
+func RegisterContexts(ps *env.ProgramState, name string) *env.RyeCtx {
+	return nil
+}
@@ -0,0 +1,740 @@
+// Node graph editor of nodes with ports joined by links.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"gioui.org/f32"
+	"gioui.org/font"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Sizes of nodes in dp.
+const (
+	nodeWidth  = 160
+	nodeHeader = 28
+	nodeRow    = 22
+	nodePort   = 5 // radius of the ports
+)
+
+// graphNode is a node at a world position (in dp) with named input ports on
+// its left and output ports on its right.
+type graphNode struct {
+	ID      string
+	Title   string
+	Pos     f32.Point
+	Inputs  []string
+	Outputs []string
+}
+
+func (n *graphNode) bounds() bbox {
+	rows := max(len(n.Inputs), len(n.Outputs))
+	return bbox{Min: n.Pos, Max: n.Pos.Add(f32.Pt(nodeWidth, nodeHeader+float32(rows)*nodeRow+6))}
+}
+
+// port returns the world position of an input or output port.
+func (n *graphNode) port(output bool, i int) f32.Point {
+	p := n.Pos.Add(f32.Pt(0, nodeHeader+nodeRow*(float32(i)+0.5)))
+	if output {
+		p.X += nodeWidth
+	}
+	return p
+}
+
+// graphLink joins an output port of a node to an input port of another.
+type graphLink struct {
+	From, Output, To, Input string
+}
+
+// graphPort is a port of a node.
+type graphPort struct {
+	node   *graphNode
+	output bool
+	index  int
+}
+
+func (p graphPort) name() string {
+	if p.output {
+		return p.node.Outputs[p.index]
+	}
+	return p.node.Inputs[p.index]
+}
+
+func (p graphPort) pos() f32.Point { return p.node.port(p.output, p.index) }
+
+// What dragging on the editor does.
+const (
+	nodeIdle = iota
+	nodePanning
+	nodeMoving
+	nodeLinking
+	nodeSelecting
+)
+
+// NodeEditor edits a graph of nodes whose output ports are linked to the
+// input ports of others, the way visual programming and pipeline editors
+// do. Nodes are dragged to move them, links are drawn from an output to an
+// input and dragged off an input to remove them; the canvas pans by
+// dragging its background and zooms by scrolling.
+type NodeEditor struct {
+	ps           *env.ProgramState
+	Theme        *material.Theme
+	view         *Viewport // pan and zoom
+	nodes        []*graphNode
+	links        []graphLink
+	selected     map[*graphNode]bool
+	onConnect    *env.Function
+	onDisconnect *env.Function
+	onChange     *env.Function
+	focused      bool
+	mode         int
+	moved        bool
+	last         f32.Point // of the pointer in the world
+	start        f32.Point // of a band selection in the world
+	from         graphPort // of the link being drawn
+}
+
+func (e *NodeEditor) FocusTag() event.Tag { return e }
+
+func (e *NodeEditor) node(id string) *graphNode {
+	for _, n := range e.nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// linkPorts returns the ports a link joins.
+func (e *NodeEditor) linkPorts(l graphLink) (from, to graphPort, ok bool) {
+	fn, tn := e.node(l.From), e.node(l.To)
+	if fn == nil || tn == nil {
+		return
+	}
+	fi, ti := slices.Index(fn.Outputs, l.Output), slices.Index(tn.Inputs, l.Input)
+	return graphPort{fn, true, fi}, graphPort{tn, false, ti}, fi >= 0 && ti >= 0
+}
+
+// portAt returns the port within reach of the world point p.
+func (e *NodeEditor) portAt(p f32.Point) (graphPort, bool) {
+	reach := 10 / e.view.Zoom
+	for i := len(e.nodes) - 1; i >= 0; i-- {
+		n := e.nodes[i]
+		for _, output := range []bool{false, true} {
+			ports := n.Inputs
+			if output {
+				ports = n.Outputs
+			}
+			for k := range ports {
+				if dist(p, n.port(output, k)) <= max(reach, nodePort) {
+					return graphPort{n, output, k}, true
+				}
+			}
+		}
+	}
+	return graphPort{}, false
+}
+
+// nodeAt returns the topmost node at the world point p.
+func (e *NodeEditor) nodeAt(p f32.Point) *graphNode {
+	for i := len(e.nodes) - 1; i >= 0; i-- {
+		b := e.nodes[i].bounds()
+		if p.X >= b.Min.X && p.X < b.Max.X && p.Y >= b.Min.Y && p.Y < b.Max.Y {
+			return e.nodes[i]
+		}
+	}
+	return nil
+}
+
+// linkInto returns the index of the link into an input port, or -1.
+func (e *NodeEditor) linkInto(p graphPort) int {
+	return slices.IndexFunc(e.links, func(l graphLink) bool { return l.To == p.node.ID && l.Input == p.name() })
+}
+
+func (e *NodeEditor) changed() {
+	if e.onChange != nil {
+		callFunction(e.ps, "node-editor on-change", *e.onChange)
+	}
+}
+
+func (e *NodeEditor) disconnect(i int) {
+	l := e.links[i]
+	e.links = slices.Delete(e.links, i, i+1)
+	if e.onDisconnect != nil {
+		callFunction(e.ps, "node-editor on-disconnect", *e.onDisconnect,
+			*env.NewString(l.From), *env.NewString(l.Output), *env.NewString(l.To), *env.NewString(l.Input))
+	}
+}
+
+// connect links an output to an input, replacing the link into the input.
+func (e *NodeEditor) connect(from, to graphPort) {
+	if i := e.linkInto(to); i >= 0 {
+		e.disconnect(i)
+	}
+	l := graphLink{From: from.node.ID, Output: from.name(), To: to.node.ID, Input: to.name()}
+	e.links = append(e.links, l)
+	if e.onConnect != nil {
+		callFunction(e.ps, "node-editor on-connect", *e.onConnect,
+			*env.NewString(l.From), *env.NewString(l.Output), *env.NewString(l.To), *env.NewString(l.Input))
+	}
+}
+
+// removeNode removes a node and its links.
+func (e *NodeEditor) removeNode(n *graphNode) {
+	for i := len(e.links) - 1; i >= 0; i-- {
+		if l := e.links[i]; l.From == n.ID || l.To == n.ID {
+			e.disconnect(i)
+		}
+	}
+	e.nodes = slices.DeleteFunc(e.nodes, func(m *graphNode) bool { return m == n })
+	delete(e.selected, n)
+}
+
+func (e *NodeEditor) press(gtx layout.Context, p f32.Point, mods key.Modifiers) {
+	gtx.Execute(key.FocusCmd{Tag: e})
+	e.last, e.moved = p, false
+	if port, ok := e.portAt(p); ok {
+		e.mode = nodeLinking
+		e.from = port
+		if !port.output {
+			// Dragging a link off an input moves its other end.
+			i := e.linkInto(port)
+			if i < 0 {
+				e.mode = nodeIdle
+				return
+			}
+			from, _, _ := e.linkPorts(e.links[i])
+			e.disconnect(i)
+			e.from = from
+			e.changed()
+		}
+		return
+	}
+	if n := e.nodeAt(p); n != nil {
+		switch {
+		case mods.Contain(key.ModShift):
+			e.selected[n] = !e.selected[n]
+		case !e.selected[n]:
+			clear(e.selected)
+			e.selected[n] = true
+		}
+		// Raise the node above the others.
+		e.nodes = append(slices.DeleteFunc(e.nodes, func(m *graphNode) bool { return m == n }), n)
+		e.mode = nodeMoving
+		return
+	}
+	if mods.Contain(key.ModShift) {
+		e.mode = nodeSelecting
+		e.start = p
+		return
+	}
+	clear(e.selected)
+	e.mode = nodePanning
+}
+
+func (e *NodeEditor) drag(p f32.Point, screen f32.Point) {
+	switch e.mode {
+	case nodePanning:
+		e.view.Pan = e.view.Pan.Add(screen.Sub(e.view.ToScreen(e.last)))
+		return // the pointer stays at the same world point
+	case nodeMoving:
+		d := p.Sub(e.last)
+		for n, sel := range e.selected {
+			if sel {
+				n.Pos = n.Pos.Add(d)
+			}
+		}
+		e.moved = true
+	}
+	e.last = p
+}
+
+func (e *NodeEditor) release(p f32.Point) {
+	switch e.mode {
+	case nodeLinking:
+		if to, ok := e.portAt(p); ok && !to.output && to.node != e.from.node {
+			e.connect(e.from, to)
+			e.changed()
+		}
+	case nodeSelecting:
+		band := e.band(p)
+		for _, n := range e.nodes {
+			b := n.bounds()
+			if b.Max.X > band.Min.X && b.Min.X < band.Max.X && b.Max.Y > band.Min.Y && b.Min.Y < band.Max.Y {
+				e.selected[n] = true
+			}
+		}
+	case nodeMoving:
+		if e.moved {
+			e.changed()
+		}
+	}
+	e.mode = nodeIdle
+}
+
+// band returns the rectangle selected by dragging to p.
+func (e *NodeEditor) band(p f32.Point) bbox {
+	return bbox{
+		Min: f32.Pt(min(e.start.X, p.X), min(e.start.Y, p.Y)),
+		Max: f32.Pt(max(e.start.X, p.X), max(e.start.Y, p.Y)),
+	}
+}
+
+func (e *NodeEditor) update(gtx layout.Context) {
+	scale := gtx.Metric.PxPerDp
+	for {
+		ev, ok := gtx.Event(
+			key.FocusFilter{Target: e},
+			key.Filter{Focus: e, Name: key.NameDeleteBackward},
+			key.Filter{Focus: e, Name: key.NameDeleteForward},
+			key.Filter{Focus: e, Name: "A", Required: key.ModShortcut},
+			pointer.Filter{
+				Target:  e,
+				Kinds:   pointer.Press | pointer.Drag | pointer.Release | pointer.Cancel | pointer.Scroll,
+				ScrollY: pointer.ScrollRange{Min: math.MinInt32, Max: math.MaxInt32},
+			},
+		)
+		if !ok {
+			break
+		}
+		switch ev := ev.(type) {
+		case key.FocusEvent:
+			e.focused = ev.Focus
+		case key.Event:
+			if ev.State != key.Press {
+				break
+			}
+			if ev.Name == "A" {
+				for _, n := range e.nodes {
+					e.selected[n] = true
+				}
+				break
+			}
+			removed := false
+			for _, n := range slices.Clone(e.nodes) {
+				if e.selected[n] {
+					e.removeNode(n)
+					removed = true
+				}
+			}
+			if removed {
+				e.changed()
+			}
+		case pointer.Event:
+			screen := ev.Position.Div(scale)
+			p := e.view.ToWorld(screen)
+			switch ev.Kind {
+			case pointer.Scroll:
+				e.view.zoomAt(screen, e.view.Zoom*float32(math.Pow(1.002, float64(-ev.Scroll.Y))))
+			case pointer.Press:
+				e.press(gtx, p, ev.Modifiers)
+			case pointer.Drag:
+				if e.mode == nodeIdle {
+					break
+				}
+				gtx.Execute(pointer.GrabCmd{Tag: e, ID: ev.PointerID})
+				e.drag(p, screen)
+			case pointer.Release:
+				e.release(p)
+			case pointer.Cancel:
+				e.mode = nodeIdle
+			}
+		}
+	}
+}
+
+// strokeLink draws a link as a curve leaving a to the right and entering b
+// from the left, in world pixels.
+func strokeLink(gtx layout.Context, a, b f32.Point, width float32, col color.NRGBA) {
+	dx := max(float32(math.Abs(float64(b.X-a.X)))/2, float32(gtx.Dp(40)))
+	var p clip.Path
+	p.Begin(gtx.Ops)
+	p.MoveTo(a)
+	p.CubeTo(a.Add(f32.Pt(dx, 0)), b.Sub(f32.Pt(dx, 0)), b)
+	paint.FillShape(gtx.Ops, col, clip.Stroke{Path: p.End(), Width: width}.Op())
+}
+
+func (e *NodeEditor) layoutNode(gtx layout.Context, n *graphNode, linked map[graphLink]bool) {
+	th := e.Theme
+	scale := gtx.Metric.PxPerDp
+	b := n.bounds()
+	r := image.Rectangle{Min: b.Min.Mul(scale).Round(), Max: b.Max.Mul(scale).Round()}
+	rr := gtx.Dp(6)
+	paint.FillShape(gtx.Ops, th.Bg, clip.UniformRRect(r, rr).Op(gtx.Ops))
+	header := image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+gtx.Dp(nodeHeader))
+	paint.FillShape(gtx.Ops, mulAlpha(th.ContrastBg, 0x40), clip.RRect{Rect: header, NW: rr, NE: rr}.Op(gtx.Ops))
+	border, width := mulAlpha(th.Fg, 0x40), gtx.Dp(1)
+	if e.selected[n] {
+		border, width = mulAlpha(th.ContrastBg, 0x80), gtx.Dp(2)
+		if e.focused {
+			border = th.ContrastBg
+		}
+	}
+	paint.FillShape(gtx.Ops, border, clip.Stroke{Path: clip.UniformRRect(r, rr).Path(gtx.Ops), Width: float32(width)}.Op())
+
+	lgtx := gtx
+	lgtx.Constraints = layout.Constraints{Max: image.Pt(r.Dx()-gtx.Dp(16), gtx.Dp(nodeHeader))}
+	title := material.Body2(th, n.Title)
+	title.Font.Weight = font.Bold
+	title.MaxLines = 1
+	off := op.Offset(r.Min.Add(image.Pt(gtx.Dp(8), gtx.Dp(5)))).Push(gtx.Ops)
+	title.Layout(lgtx)
+	off.Pop()
+
+	lgtx.Constraints.Max.X = r.Dx()/2 - gtx.Dp(12)
+	for _, output := range []bool{false, true} {
+		ports := n.Inputs
+		if output {
+			ports = n.Outputs
+		}
+		for k, name := range ports {
+			p := n.port(output, k).Mul(scale).Round()
+			connected := false
+			for l := range linked {
+				if output && l.From == n.ID && l.Output == name || !output && l.To == n.ID && l.Input == name {
+					connected = true
+					break
+				}
+			}
+			d := gtx.Dp(nodePort)
+			dot := image.Rectangle{Min: p.Sub(image.Pt(d, d)), Max: p.Add(image.Pt(d, d))}
+			if connected {
+				paint.FillShape(gtx.Ops, th.ContrastBg, clip.Ellipse(dot).Op(gtx.Ops))
+			} else {
+				paint.FillShape(gtx.Ops, th.Bg, clip.Ellipse(dot).Op(gtx.Ops))
+				paint.FillShape(gtx.Ops, mulAlpha(th.Fg, 0x90), clip.Stroke{Path: clip.Ellipse(dot).Path(gtx.Ops), Width: float32(gtx.Dp(1.5))}.Op())
+			}
+
+			lbl := material.Caption(th, name)
+			lbl.MaxLines = 1
+			macro := op.Record(gtx.Ops)
+			dims := lbl.Layout(lgtx)
+			call := macro.Stop()
+			at := image.Pt(p.X+gtx.Dp(10), p.Y-dims.Size.Y/2)
+			if output {
+				at.X = p.X - gtx.Dp(10) - dims.Size.X
+			}
+			off := op.Offset(at).Push(gtx.Ops)
+			call.Add(gtx.Ops)
+			off.Pop()
+		}
+	}
+}
+
+func (e *NodeEditor) Layout(gtx layout.Context) layout.Dimensions {
+	e.update(gtx)
+	th := e.Theme
+	v := e.view
+	size := gtx.Constraints.Max
+	scale := gtx.Metric.PxPerDp
+	v.size = f32.Pt(float32(size.X), float32(size.Y)).Div(scale)
+
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, e)
+	tr := f32.Affine2D{}.Scale(f32.Point{}, f32.Pt(v.Zoom, v.Zoom)).Offset(v.Pan.Mul(scale))
+	defer op.Affine(tr).Push(gtx.Ops).Pop()
+
+	linked := map[graphLink]bool{}
+	for _, l := range e.links {
+		from, to, ok := e.linkPorts(l)
+		if !ok {
+			continue
+		}
+		linked[l] = true
+		col := mulAlpha(th.Fg, 0x90)
+		if e.selected[from.node] || e.selected[to.node] {
+			col = th.ContrastBg
+		}
+		strokeLink(gtx, from.pos().Mul(scale), to.pos().Mul(scale), float32(gtx.Dp(2)), col)
+	}
+	if e.mode == nodeLinking {
+		strokeLink(gtx, e.from.pos().Mul(scale), e.last.Mul(scale), float32(gtx.Dp(2)), th.ContrastBg)
+	}
+	for _, n := range e.nodes {
+		e.layoutNode(gtx, n, linked)
+	}
+	if e.mode == nodeSelecting {
+		b := e.band(e.last)
+		r := image.Rectangle{Min: b.Min.Mul(scale).Round(), Max: b.Max.Mul(scale).Round()}
+		paint.FillShape(gtx.Ops, mulAlpha(th.ContrastBg, 0x30), clip.Rect(r).Op())
+		paint.FillShape(gtx.Ops, th.ContrastBg, clip.Stroke{Path: clip.Rect(r).Path(), Width: float32(gtx.Dp(1))}.Op())
+	}
+	return layout.Dimensions{Size: size}
+}
+
+// parseGraph reads the nodes and links of a block like
+//
+//	node "blur" "Blur" 200 40 { "image" "radius" } { "image" }
+//	link "load" "image" "blur" "image"
+func parseGraph(ps *env.ProgramState, blk env.Block) ([]*graphNode, []graphLink, error) {
+	var nodes []*graphNode
+	var links []graphLink
+	ids := map[string]*graphNode{}
+	s := blk.Series.S
+	strs := func(at, n int) ([]string, bool) {
+		if at+n > len(s) {
+			return nil, false
+		}
+		var res []string
+		for _, o := range s[at : at+n] {
+			str, ok := o.(env.String)
+			if !ok {
+				return nil, false
+			}
+			res = append(res, str.Value)
+		}
+		return res, true
+	}
+	for i := 0; i < len(s); {
+		w, ok := s[i].(env.Word)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected node or link, got %s", s[i].Inspect(*ps.Idx))
+		}
+		switch ps.Idx.GetWord(w.Index) {
+		case "node":
+			names, ok := strs(i+1, 2)
+			if !ok || i+7 > len(s) {
+				return nil, nil, fmt.Errorf("node %d: expected id, title, x, y and blocks of inputs and outputs", len(nodes)+1)
+			}
+			n := &graphNode{ID: names[0], Title: names[1]}
+			for k, o := range s[i+3 : i+5] {
+				var v float64
+				switch o := o.(type) {
+				case env.Integer:
+					v = float64(o.Value)
+				case env.Decimal:
+					v = o.Value
+				default:
+					return nil, nil, fmt.Errorf("node %s: expected a number for %c, got %s", n.ID, "xy"[k], o.Inspect(*ps.Idx))
+				}
+				if k == 0 {
+					n.Pos.X = float32(v)
+				} else {
+					n.Pos.Y = float32(v)
+				}
+			}
+			for k, o := range s[i+5 : i+7] {
+				b, ok := o.(env.Block)
+				if !ok {
+					return nil, nil, fmt.Errorf("node %s: expected a block of port names, got %s", n.ID, o.Inspect(*ps.Idx))
+				}
+				for _, p := range b.Series.S {
+					str, ok := p.(env.String)
+					if !ok {
+						return nil, nil, fmt.Errorf("node %s: expected a port name, got %s", n.ID, p.Inspect(*ps.Idx))
+					}
+					if k == 0 {
+						n.Inputs = append(n.Inputs, str.Value)
+					} else {
+						n.Outputs = append(n.Outputs, str.Value)
+					}
+				}
+			}
+			if ids[n.ID] != nil {
+				return nil, nil, fmt.Errorf("node %s: the id is taken", n.ID)
+			}
+			ids[n.ID] = n
+			nodes = append(nodes, n)
+			i += 7
+		case "link":
+			v, ok := strs(i+1, 4)
+			if !ok {
+				return nil, nil, fmt.Errorf("link %d: expected from node, output, to node and input", len(links)+1)
+			}
+			l := graphLink{From: v[0], Output: v[1], To: v[2], Input: v[3]}
+			if n := ids[l.From]; n == nil || !slices.Contains(n.Outputs, l.Output) {
+				return nil, nil, fmt.Errorf("link %d: no output %s of node %s", len(links)+1, l.Output, l.From)
+			}
+			if n := ids[l.To]; n == nil || !slices.Contains(n.Inputs, l.Input) {
+				return nil, nil, fmt.Errorf("link %d: no input %s of node %s", len(links)+1, l.Input, l.To)
+			}
+			links = slices.DeleteFunc(links, func(o graphLink) bool { return o.To == l.To && o.Input == l.Input })
+			links = append(links, l)
+			i += 5
+		default:
+			return nil, nil, fmt.Errorf("expected node or link, got %s", s[i].Inspect(*ps.Idx))
+		}
+	}
+	return nodes, links, nil
+}
+
+// graphObj returns the graph as a block parseGraph reads.
+func (e *NodeEditor) graphObj(ps *env.ProgramState) env.Object {
+	strs := func(v []string) env.Object {
+		objs := make([]env.Object, len(v))
+		for i, s := range v {
+			objs[i] = *env.NewString(s)
+		}
+		return *env.NewBlock(*env.NewTSeries(objs))
+	}
+	num := func(v float32) env.Object {
+		if v == float32(math.Trunc(float64(v))) {
+			return *env.NewInteger(int64(v))
+		}
+		return *env.NewDecimal(float64(v))
+	}
+	var objs []env.Object
+	for _, n := range e.nodes {
+		objs = append(objs, *env.NewWord(ps.Idx.IndexWord("node")),
+			*env.NewString(n.ID), *env.NewString(n.Title),
+			num(n.Pos.X), num(n.Pos.Y),
+			strs(n.Inputs), strs(n.Outputs))
+	}
+	for _, l := range e.links {
+		objs = append(objs, *env.NewWord(ps.Idx.IndexWord("link")),
+			*env.NewString(l.From), *env.NewString(l.Output), *env.NewString(l.To), *env.NewString(l.Input))
+	}
+	return *env.NewBlock(*env.NewTSeries(objs))
+}
+
+// nodeEditorBuiltin returns a "//method" builtin of node editors; fn
+// returning nil returns the editor.
+func nodeEditorBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.NodeEditor)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*NodeEditor](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, e, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+// linkCallbackBuiltin sets a function called with the from node, output, to
+// node and input of links.
+func linkCallbackBuiltin(method, doc string, set func(e *NodeEditor, fn *env.Function)) *env.Builtin {
+	return nodeEditorBuiltin(method, doc, 2, func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 4, arg1)
+		if err != nil {
+			return err
+		}
+		set(e, &fn)
+		return nil
+	})
+}
+
+var builtinsNodeEditor = map[string]*env.Builtin{
+	"node-editor": {
+		Doc:   "Create a node graph editor from a block of node id title x y { inputs } { outputs } and link from-node output to-node input entries; drag nodes to move them and from an output to an input to link them, drag the background to pan, scroll to zoom, shift-drag to select and delete to remove",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "node-editor", 1, arg0)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg1.(env.Block)
+			if !ok {
+				return argError(ps, "node-editor", 2, "block", arg1)
+			}
+			nodes, links, perr := parseGraph(ps, blk)
+			if perr != nil {
+				return failure(ps, "node-editor", perr.Error())
+			}
+			e := &NodeEditor{ps: ps, Theme: th, view: newViewport(), nodes: nodes, links: links, selected: map[*graphNode]bool{}}
+			e.view.MinZoom, e.view.MaxZoom = 0.2, 4
+			return *env.NewNative(ps.Idx, e, "Go(*gioui_org.NodeEditor)")
+		},
+	},
+	"Go(*gioui_org.NodeEditor)//layout": layoutBuiltin[*NodeEditor]("Go(*gioui_org.NodeEditor)//layout"),
+	"Go(*gioui_org.NodeEditor)//graph?": nodeEditorBuiltin("graph?", "Get the graph as a block of node and link entries, as the editor is created from, to save it", 1, func(ps *env.ProgramState, name string, e *NodeEditor, _ env.Object) env.Object {
+		return e.graphObj(ps)
+	}),
+	"Go(*gioui_org.NodeEditor)//graph!": nodeEditorBuiltin("graph!", "Replace the graph with a block of node and link entries", 2, func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object {
+		blk, ok := arg1.(env.Block)
+		if !ok {
+			return argError(ps, name, 2, "block", arg1)
+		}
+		nodes, links, perr := parseGraph(ps, blk)
+		if perr != nil {
+			return failure(ps, name, perr.Error())
+		}
+		e.nodes, e.links, e.mode = nodes, links, nodeIdle
+		clear(e.selected)
+		return nil
+	}),
+	"Go(*gioui_org.NodeEditor)//add-node!": nodeEditorBuiltin("add-node!", "Add a node given as a block of id title x y { inputs } { outputs }", 2, func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object {
+		blk, ok := arg1.(env.Block)
+		if !ok {
+			return argError(ps, name, 2, "block", arg1)
+		}
+		spec := append([]env.Object{*env.NewWord(ps.Idx.IndexWord("node"))}, blk.Series.S...)
+		nodes, _, perr := parseGraph(ps, *env.NewBlock(*env.NewTSeries(spec)))
+		if perr == nil && len(nodes) != 1 {
+			perr = fmt.Errorf("expected one node")
+		}
+		if perr != nil {
+			return failure(ps, name, perr.Error())
+		}
+		if e.node(nodes[0].ID) != nil {
+			return failure(ps, name, "node "+nodes[0].ID+": the id is taken")
+		}
+		e.nodes = append(e.nodes, nodes[0])
+		return nil
+	}),
+	"Go(*gioui_org.NodeEditor)//remove-node!": nodeEditorBuiltin("remove-node!", "Remove the node with an id and its links", 2, func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object {
+		id, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		n := e.node(id)
+		if n == nil {
+			return failure(ps, name, "no node "+id)
+		}
+		e.removeNode(n)
+		return nil
+	}),
+	"Go(*gioui_org.NodeEditor)//selection?": nodeEditorBuiltin("selection?", "Get the ids of the selected nodes", 1, func(ps *env.ProgramState, name string, e *NodeEditor, _ env.Object) env.Object {
+		var ids []string
+		for _, n := range e.nodes {
+			if e.selected[n] {
+				ids = append(ids, n.ID)
+			}
+		}
+		return argsObj(ps, ids)
+	}),
+	"Go(*gioui_org.NodeEditor)//on-connect!": linkCallbackBuiltin("on-connect!", "Set function called with the from node, output, to node and input of each link drawn", func(e *NodeEditor, fn *env.Function) {
+		e.onConnect = fn
+	}),
+	"Go(*gioui_org.NodeEditor)//on-disconnect!": linkCallbackBuiltin("on-disconnect!", "Set function called with the from node, output, to node and input of each link removed, by dragging it off its input, replacing it or removing a node", func(e *NodeEditor, fn *env.Function) {
+		e.onDisconnect = fn
+	}),
+	"Go(*gioui_org.NodeEditor)//on-change!": nodeEditorBuiltin("on-change!", "Set function called after each edit of the graph by the user, to save it", 2, func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 0, arg1)
+		if err != nil {
+			return err
+		}
+		e.onChange = &fn
+		return nil
+	}),
+	"Go(*gioui_org.NodeEditor)//zoom!": nodeEditorBuiltin("zoom!", "Set the zoom factor around the center of the editor", 2, func(ps *env.ProgramState, name string, e *NodeEditor, arg1 env.Object) env.Object {
+		z, err := decimalArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		e.view.zoomAt(e.view.size.Div(2), float32(z))
+		return nil
+	}),
+}
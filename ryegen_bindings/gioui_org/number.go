@@ -0,0 +1,395 @@
+// Number input with spinner buttons and numeric formatting.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// NumberInput is a single line numeric field with up/down buttons. The
+// value is clamped to [Min, Max] and shown with the configured number of
+// decimals and separators.
+type NumberInput struct {
+	ps         *env.ProgramState
+	Theme      *material.Theme
+	Value      float64
+	Min        float64
+	Max        float64
+	Step       float64
+	Integer    bool
+	Decimals   int
+	DecimalSep string
+	GroupSep   string
+	editor     widget.Editor
+	up, down   widget.Clickable
+	focused    bool
+	bind       *binding
+	onChange   *env.Function
+}
+
+func newNumberInput(ps *env.ProgramState, th *material.Theme, integer bool) *NumberInput {
+	n := &NumberInput{
+		ps:         ps,
+		Theme:      th,
+		Min:        math.Inf(-1),
+		Max:        math.Inf(1),
+		Step:       1,
+		Integer:    integer,
+		Decimals:   2,
+		DecimalSep: ".",
+	}
+	n.editor.SingleLine = true
+	n.editor.Submit = true
+	n.editor.InputHint = key.HintNumeric
+	n.editor.Alignment = text.End
+	n.updateFilter()
+	n.editor.SetText(n.Format(n.Value))
+	return n
+}
+
+func (n *NumberInput) updateFilter() {
+	n.editor.Filter = "0123456789-" + n.GroupSep
+	if !n.Integer {
+		n.editor.Filter += n.DecimalSep
+	}
+}
+
+// Format formats v according to the input's mode and separators.
+func (n *NumberInput) Format(v float64) string {
+	decimals := n.Decimals
+	if n.Integer {
+		decimals = 0
+	}
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	neg := strings.HasPrefix(intPart, "-")
+	intPart = strings.TrimPrefix(intPart, "-")
+	if n.GroupSep != "" {
+		var b strings.Builder
+		for i, r := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteString(n.GroupSep)
+			}
+			b.WriteRune(r)
+		}
+		intPart = b.String()
+	}
+	if neg {
+		intPart = "-" + intPart
+	}
+	if frac == "" {
+		return intPart
+	}
+	return intPart + n.DecimalSep + frac
+}
+
+// Parse parses s written with the input's separators.
+func (n *NumberInput) Parse(s string) (float64, bool) {
+	if n.GroupSep != "" {
+		s = strings.ReplaceAll(s, n.GroupSep, "")
+	}
+	s = strings.ReplaceAll(s, n.DecimalSep, ".")
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+func (n *NumberInput) clamp(v float64) float64 {
+	if n.Integer {
+		v = math.Round(v)
+	}
+	return math.Max(n.Min, math.Min(n.Max, v))
+}
+
+// Set clamps v and updates the text and bound word.
+func (n *NumberInput) Set(v float64) {
+	v = n.clamp(v)
+	n.editor.SetText(n.Format(v))
+	if v == n.Value {
+		return
+	}
+	n.Value = v
+	n.bind.set(n.valueObj())
+	if n.onChange != nil {
+		callFunction(n.ps, "number-input on-change", *n.onChange, n.valueObj())
+	}
+}
+
+func (n *NumberInput) valueObj() env.Object {
+	if n.Integer {
+		return *env.NewInteger(int64(n.Value))
+	}
+	return *env.NewDecimal(n.Value)
+}
+
+// commit applies the edited text, restoring the previous value if it
+// doesn't parse.
+func (n *NumberInput) commit() {
+	if v, ok := n.Parse(n.editor.Text()); ok {
+		n.Set(v)
+	} else {
+		n.editor.SetText(n.Format(n.Value))
+	}
+}
+
+func (n *NumberInput) Layout(gtx layout.Context) layout.Dimensions {
+	// Key events go to the first filter asking for them, and the editor
+	// takes the arrows to move its caret.
+	for {
+		e, ok := gtx.Event(
+			key.Filter{Focus: &n.editor, Name: key.NameUpArrow},
+			key.Filter{Focus: &n.editor, Name: key.NameDownArrow},
+		)
+		if !ok {
+			break
+		}
+		if e, ok := e.(key.Event); ok && e.State == key.Press {
+			n.commit()
+			if e.Name == key.NameUpArrow {
+				n.Set(n.Value + n.Step)
+			} else {
+				n.Set(n.Value - n.Step)
+			}
+		}
+	}
+	for {
+		e, ok := n.editor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := e.(widget.SubmitEvent); ok {
+			n.commit()
+		}
+	}
+	for n.up.Clicked(gtx) {
+		n.commit()
+		n.Set(n.Value + n.Step)
+	}
+	for n.down.Clicked(gtx) {
+		n.commit()
+		n.Set(n.Value - n.Step)
+	}
+	focused := gtx.Focused(&n.editor)
+	if n.focused && !focused {
+		n.commit()
+	}
+	n.focused = focused
+
+	th := n.Theme
+	return widget.Border{Color: mulAlpha(th.Palette.Fg, 0x60), CornerRadius: 4, Width: 1}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: 8, Right: 8, Top: 4, Bottom: 4}.Layout(gtx, material.Editor(th, &n.editor, "").Layout)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(n.spinButton(&n.up, "▲", n.Value < n.Max)),
+					layout.Rigid(n.spinButton(&n.down, "▼", n.Value > n.Min)),
+				)
+			}),
+		)
+	})
+}
+
+func (n *NumberInput) spinButton(btn *widget.Clickable, label string, enabled bool) layout.Widget {
+	return func(gtx layout.Context) layout.Dimensions {
+		if !enabled {
+			gtx = gtx.Disabled()
+		}
+		return btn.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: 6, Right: 6}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				lbl := material.Label(n.Theme, unit.Sp(9), label)
+				if !enabled {
+					lbl.Color = mulAlpha(lbl.Color, 0x60)
+				}
+				return lbl.Layout(gtx)
+			})
+		})
+	}
+}
+
+var builtinsNumber = map[string]*env.Builtin{
+	"number-input": {
+		Doc:   "Create a numeric input for decimals",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "number-input", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newNumberInput(ps, th, false), "Go(*gioui_org.NumberInput)")
+		},
+	},
+	"integer-input": {
+		Doc:   "Create a numeric input for integers",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "integer-input", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newNumberInput(ps, th, true), "Go(*gioui_org.NumberInput)")
+		},
+	},
+	"Go(*gioui_org.NumberInput)//layout": layoutBuiltin[*NumberInput]("Go(*gioui_org.NumberInput)//layout"),
+	"Go(*gioui_org.NumberInput)//value?": {
+		Doc:   "Get value as integer or decimal, depending on the mode",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//value?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return n.valueObj()
+		},
+	},
+	"Go(*gioui_org.NumberInput)//value!": {
+		Doc:   "Set value (clamped to the range)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//value!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := decimalArg(ps, "Go(*gioui_org.NumberInput)//value!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			n.Set(v)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.NumberInput)//range!": {
+		Doc:   "Set minimum and maximum value",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//range!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			min, err := decimalArg(ps, "Go(*gioui_org.NumberInput)//range!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			max, err := decimalArg(ps, "Go(*gioui_org.NumberInput)//range!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			if min > max {
+				return failure(ps, "Go(*gioui_org.NumberInput)//range!", "minimum is larger than maximum")
+			}
+			n.Min, n.Max = min, max
+			n.Set(n.Value)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.NumberInput)//step!": {
+		Doc:   "Set the amount added or subtracted by the spinner buttons and arrow keys",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//step!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := decimalArg(ps, "Go(*gioui_org.NumberInput)//step!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			n.Step = v
+			return arg0
+		},
+	},
+	"Go(*gioui_org.NumberInput)//decimals!": {
+		Doc:   "Set the number of decimals shown for decimal inputs",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//decimals!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.NumberInput)//decimals!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if v < 0 {
+				return failure(ps, "Go(*gioui_org.NumberInput)//decimals!", "arg 2: expected non-negative integer")
+			}
+			n.Decimals = int(v)
+			n.editor.SetText(n.Format(n.Value))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.NumberInput)//separators!": {
+		Doc:   "Set decimal and digit grouping separators, e.g. \",\" \".\" for 1.234,5 (empty grouping separator disables grouping)",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//separators!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			dec, err := stringArg(ps, "Go(*gioui_org.NumberInput)//separators!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			group, err := stringArg(ps, "Go(*gioui_org.NumberInput)//separators!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			if dec == "" || dec == group {
+				return failure(ps, "Go(*gioui_org.NumberInput)//separators!", "decimal separator must be non-empty and differ from the grouping separator")
+			}
+			n.DecimalSep, n.GroupSep = dec, group
+			n.updateFilter()
+			n.editor.SetText(n.Format(n.Value))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.NumberInput)//bind!": {
+		Doc:   "Bind the value to a word that is updated whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//bind!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, err := bindingArg(ps, "Go(*gioui_org.NumberInput)//bind!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			n.bind = b
+			b.set(n.valueObj())
+			return arg0
+		},
+	},
+	"Go(*gioui_org.NumberInput)//on-change!": {
+		Doc:   "Set function called with the new value whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			n, err := nativeArg[*NumberInput](ps, "Go(*gioui_org.NumberInput)//on-change!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.NumberInput)//on-change!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			n.onChange = &fn
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,223 @@
+// An op-list builder that keeps pushes and pops balanced.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"strconv"
+	"strings"
+
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+// openOp is a clip, transform, opacity or pass-through pushed by an
+// OpBuilder, or a macro it started recording.
+type openOp struct {
+	kind  string
+	pop   func()
+	macro op.MacroOp
+}
+
+// OpBuilder adds operations to a frame's op list, tracking what was pushed
+// so pops match. A pop of the wrong kind or of nothing, which Gio reports
+// by panicking or by drawing wrongly, is a script error instead, and what a
+// widget laid out by the builder leaves open is closed when it returns.
+type OpBuilder struct {
+	gtx  layout.Context
+	open []openOp
+}
+
+func (b *OpBuilder) push(kind string, pop func()) {
+	b.open = append(b.open, openOp{kind: kind, pop: pop})
+}
+
+// openKinds lists what is open above depth, innermost last.
+func (b *OpBuilder) openKinds(depth int) string {
+	var kinds []string
+	for _, o := range b.open[depth:] {
+		kinds = append(kinds, o.kind)
+	}
+	return strings.Join(kinds, " ")
+}
+
+// closeTo pops everything above depth and stops the macros among it,
+// returning how many macros were left recording.
+func (b *OpBuilder) closeTo(depth int) (macros int) {
+	for len(b.open) > depth {
+		o := b.open[len(b.open)-1]
+		b.open = b.open[:len(b.open)-1]
+		if o.pop != nil {
+			o.pop()
+		} else {
+			o.macro.Stop()
+			macros++
+		}
+	}
+	return macros
+}
+
+func rectArgs(ps *env.ProgramState, name string, n int, x0, y0, x1, y1 env.Object) (image.Rectangle, *env.Error) {
+	var c [4]int64
+	for i, arg := range []env.Object{x0, y0, x1, y1} {
+		v, err := integerArg(ps, name, n+i, arg)
+		if err != nil {
+			return image.Rectangle{}, err
+		}
+		c[i] = v
+	}
+	return image.Rect(int(c[0]), int(c[1]), int(c[2]), int(c[3])), nil
+}
+
+// opBuilderBuiltin returns a "//method" builtin of op builders; fn
+// returning nil returns the builder.
+func opBuilderBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.OpBuilder)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*OpBuilder](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, b, arg1, arg2, arg3, arg4); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsOpBuilder = map[string]*env.Builtin{
+	"op-builder": {
+		Doc:   "Get a builder adding operations to the op list of a layout context, checking that pushes and pops are balanced",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "op-builder", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &OpBuilder{gtx: gtx}, "Go(*gioui_org.OpBuilder)")
+		},
+	},
+	"Go(*gioui_org.OpBuilder)//context": opBuilderBuiltin("context", "Get the layout context of the builder, to draw with other builtins", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		gtx := b.gtx
+		return *env.NewNative(ps.Idx, &gtx, "Go(*layout.Context)")
+	}),
+	"Go(*gioui_org.OpBuilder)//offset": opBuilderBuiltin("offset", "Push an offset of x y pixels", 3, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		x, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		y, err := integerArg(ps, name, 3, arg2)
+		if err != nil {
+			return err
+		}
+		b.push("offset", op.Offset(image.Pt(int(x), int(y))).Push(b.gtx.Ops).Pop)
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//clip-rect": opBuilderBuiltin("clip-rect", "Push a clip to the rectangle from x0 y0 to x1 y1", 5, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		r, err := rectArgs(ps, name, 2, arg1, arg2, arg3, arg4)
+		if err != nil {
+			return err
+		}
+		b.push("clip", clip.Rect(r).Push(b.gtx.Ops).Pop)
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//clip-ellipse": opBuilderBuiltin("clip-ellipse", "Push a clip to the ellipse in the rectangle from x0 y0 to x1 y1", 5, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		r, err := rectArgs(ps, name, 2, arg1, arg2, arg3, arg4)
+		if err != nil {
+			return err
+		}
+		b.push("clip", clip.Ellipse(r).Push(b.gtx.Ops).Pop)
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//opacity": opBuilderBuiltin("opacity", "Push an opacity from 0.0 to 1.0", 2, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		a, err := decimalArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		b.push("opacity", paint.PushOpacity(b.gtx.Ops, float32(a)).Pop)
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//pass": opBuilderBuiltin("pass", "Push a pass-through, letting pointer events reach the areas below", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		b.push("pass", pointer.PassOp{}.Push(b.gtx.Ops).Pop)
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//pop": opBuilderBuiltin("pop", "Pop the innermost offset, clip, opacity or pass-through; fails if nothing is pushed or a macro is recording", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		if len(b.open) == 0 {
+			return failure(ps, name, "nothing to pop")
+		}
+		o := b.open[len(b.open)-1]
+		if o.pop == nil {
+			return failure(ps, name, "a macro is recording; end it with stop first")
+		}
+		b.open = b.open[:len(b.open)-1]
+		o.pop()
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//record": opBuilderBuiltin("record", "Start recording a macro; the operations until stop are only drawn when it is called", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		b.open = append(b.open, openOp{kind: "record", macro: op.Record(b.gtx.Ops)})
+		return nil
+	}),
+	"Go(*gioui_org.OpBuilder)//stop": opBuilderBuiltin("stop", "End the macro being recorded and get its call op (Go(*op.CallOp)); fails if pushes in it are still open", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		if len(b.open) == 0 {
+			return failure(ps, name, "no macro is recording")
+		}
+		o := b.open[len(b.open)-1]
+		if o.pop != nil {
+			depth := len(b.open) - 1
+			for depth > 0 && b.open[depth].pop != nil {
+				depth--
+			}
+			if b.open[depth].pop != nil {
+				return failure(ps, name, "no macro is recording")
+			}
+			return failure(ps, name, "still open in the macro: "+b.openKinds(depth+1))
+		}
+		b.open = b.open[:len(b.open)-1]
+		call := o.macro.Stop()
+		return *env.NewNative(ps.Idx, &call, "Go(*op.CallOp)")
+	}),
+	"Go(*gioui_org.OpBuilder)//layout": opBuilderBuiltin("layout", "Lay out a widget with the builder's context; what it pushes on the builder and leaves open is popped when it returns", 2, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		w, err := widgetArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		depth := len(b.open)
+		dims := w(b.gtx)
+		if len(b.open) < depth {
+			return failure(ps, name, "the widget popped what was pushed before it")
+		}
+		if n := b.closeTo(depth); n > 0 {
+			return failure(ps, name, "the widget left "+strconv.Itoa(n)+" macro(s) recording")
+		}
+		return dimensionsObj(ps, dims)
+	}),
+	"Go(*gioui_org.OpBuilder)//depth?": opBuilderBuiltin("depth?", "Get the number of pushes and macros open", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		return *env.NewInteger(int64(len(b.open)))
+	}),
+	"Go(*gioui_org.OpBuilder)//open?": opBuilderBuiltin("open?", "Get a block of what is open (offset, clip, opacity, pass, record), innermost last", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		items := make([]env.Object, len(b.open))
+		for i, o := range b.open {
+			items[i] = *env.NewString(o.kind)
+		}
+		return *env.NewBlock(*env.NewTSeries(items))
+	}),
+	"Go(*gioui_org.OpBuilder)//done": opBuilderBuiltin("done", "Finish building; fails, after closing them, if pushes or macros are still open", 1, func(ps *env.ProgramState, name string, b *OpBuilder, arg1, arg2, arg3, arg4 env.Object) env.Object {
+		if len(b.open) == 0 {
+			return nil
+		}
+		open := b.openKinds(0)
+		b.closeTo(0)
+		return failure(ps, name, "still open: "+open)
+	}),
+}
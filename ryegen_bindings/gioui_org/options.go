@@ -0,0 +1,247 @@
+// Variadic options from blocks of option specs.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image/color"
+
+	"gioui.org/app"
+	"gioui.org/font/gofont"
+	"gioui.org/text"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// optionSpec makes an option of type T from argsn values following its
+// name in a spec block.
+type optionSpec[T any] struct {
+	argsn int
+	make  func(ps *env.ProgramState, name string, args []env.Object) (T, *env.Error)
+}
+
+// optionsArg converts a block of option specs, each a word naming the
+// option followed by its values ({ title "Hi" size 800 600 }), to the
+// slice Go expects for ...T. Natives of type T can be mixed in.
+func optionsArg[T any](ps *env.ProgramState, name string, n int, arg env.Object, specs map[string]optionSpec[T]) ([]T, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block of options", arg)
+	}
+	var opts []T
+	s := blk.Series.S
+	for i := 0; i < len(s); {
+		if nat, ok := s[i].(env.Native); ok {
+			if o, ok := nat.Value.(T); ok {
+				opts = append(opts, o)
+				i++
+				continue
+			}
+		}
+		opt, err := nameArg(ps, name, n, s[i])
+		if err != nil {
+			return nil, err
+		}
+		spec, ok := specs[opt]
+		if !ok {
+			return nil, failure(ps, name, fmt.Sprintf("unknown option %q", opt))
+		}
+		if i+1+spec.argsn > len(s) {
+			return nil, failure(ps, name, fmt.Sprintf("option %q needs %d values", opt, spec.argsn))
+		}
+		o, err := spec.make(ps, name+" "+opt, s[i+1:i+1+spec.argsn])
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, o)
+		i += 1 + spec.argsn
+	}
+	return opts, nil
+}
+
+func dpOption(f func(w, h unit.Dp) app.Option) optionSpec[app.Option] {
+	return optionSpec[app.Option]{2, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		w, err := decimalArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		h, err := decimalArg(ps, name, 2, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return f(unit.Dp(w), unit.Dp(h)), nil
+	}}
+}
+
+func boolOption(f func(bool) app.Option) optionSpec[app.Option] {
+	return optionSpec[app.Option]{1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		b, err := integerArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(b != 0), nil
+	}}
+}
+
+var windowModes = map[string]app.WindowMode{
+	"windowed":   app.Windowed,
+	"fullscreen": app.Fullscreen,
+	"minimized":  app.Minimized,
+	"maximized":  app.Maximized,
+}
+
+var orientations = map[string]app.Orientation{
+	"any":       app.AnyOrientation,
+	"landscape": app.LandscapeOrientation,
+	"portrait":  app.PortraitOrientation,
+}
+
+// windowOptions are the specs of app.Option.
+var windowOptions = map[string]optionSpec[app.Option]{
+	"title": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		t, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return app.Title(t), nil
+	}},
+	"size":            dpOption(app.Size),
+	"min-size":        dpOption(app.MinSize),
+	"max-size":        dpOption(app.MaxSize),
+	"decorated":       boolOption(app.Decorated),
+	"custom-renderer": boolOption(app.CustomRenderer),
+	"status-color": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		c, err := colorArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return app.StatusColor(c), nil
+	}},
+	"navigation-color": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		c, err := colorArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return app.NavigationColor(c), nil
+	}},
+	"bar-color": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		c, err := colorArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return barColors(c), nil
+	}},
+	"edge-to-edge": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		icons, err := nameArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		// Android picks dark icons over light bar colors, transparency
+		// aside.
+		switch icons {
+		case "dark":
+			return barColors(color.NRGBA{R: 0xff, G: 0xff, B: 0xff}), nil
+		case "light":
+			return barColors(color.NRGBA{}), nil
+		}
+		return nil, failure(ps, name, fmt.Sprintf("unknown icons %q (dark or light)", icons))
+	}},
+	"mode": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		m, err := nameArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		mode, ok := windowModes[m]
+		if !ok {
+			return nil, failure(ps, name, fmt.Sprintf("unknown mode %q (windowed, fullscreen, minimized or maximized)", m))
+		}
+		return mode.Option(), nil
+	}},
+	"orientation": {1, func(ps *env.ProgramState, name string, args []env.Object) (app.Option, *env.Error) {
+		o, err := nameArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		orientation, ok := orientations[o]
+		if !ok {
+			return nil, failure(ps, name, fmt.Sprintf("unknown orientation %q (any, landscape or portrait)", o))
+		}
+		return orientation.Option(), nil
+	}},
+}
+
+// barColors colors the status and navigation bars of Android; their icons
+// are dark over light colors and light over dark ones.
+func barColors(c color.NRGBA) app.Option {
+	return func(m unit.Metric, cnf *app.Config) {
+		app.StatusColor(c)(m, cnf)
+		app.NavigationColor(c)(m, cnf)
+	}
+}
+
+// shaperOptions are the specs of text.ShaperOption.
+var shaperOptions = map[string]optionSpec[text.ShaperOption]{
+	"no-system-fonts": {0, func(ps *env.ProgramState, name string, args []env.Object) (text.ShaperOption, *env.Error) {
+		return text.NoSystemFonts(), nil
+	}},
+	"go-fonts": {0, func(ps *env.ProgramState, name string, args []env.Object) (text.ShaperOption, *env.Error) {
+		return text.WithCollection(gofont.Collection()), nil
+	}},
+	"fonts": {1, func(ps *env.ProgramState, name string, args []env.Object) (text.ShaperOption, *env.Error) {
+		paths, err := fontPathsArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		faces, ferr := loadFontFiles(paths)
+		if ferr != nil {
+			return nil, failure(ps, name, ferr.Error())
+		}
+		return text.WithCollection(faces), nil
+	}},
+}
+
+var builtinsOptions = map[string]*env.Builtin{
+	"window\\options": {
+		Doc:   "Create a window with a block of options: title, size, min-size, max-size (in dp), decorated, custom-renderer, status-color, navigation-color, bar-color, edge-to-edge ('dark or 'light icons over transparent bars), mode and orientation, e.g. { title \"Hi\" size 800 600 }",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			opts, err := optionsArg(ps, "window\\options", 1, arg0, windowOptions)
+			if err != nil {
+				return err
+			}
+			w := &app.Window{}
+			w.Option(opts...)
+			return *env.NewNative(ps.Idx, w, "Go(*app.Window)")
+		},
+	},
+	"Go(*app.Window)//option": {
+		Doc:   "Set window options from a block like { title \"Hi\" size 800 600 mode fullscreen }",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := nativeArg[*app.Window](ps, "Go(*app.Window)//option", 1, arg0)
+			if err != nil {
+				return err
+			}
+			opts, err := optionsArg(ps, "Go(*app.Window)//option", 2, arg1, windowOptions)
+			if err != nil {
+				return err
+			}
+			w.Option(opts...)
+			return arg0
+		},
+	},
+	"text-shaper\\options": {
+		Doc:   "Create a shaper with a block of options: go-fonts, fonts [ paths ] and no-system-fonts",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			opts, err := optionsArg(ps, "text-shaper\\options", 1, arg0, shaperOptions)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, text.NewShaper(opts...), "Go(*text.Shaper)")
+		},
+	},
+}
@@ -0,0 +1,227 @@
+// Frame-rate limits and an idle mode for windows.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+
+	"github.com/refaktor/rye/env"
+)
+
+// framePacing spaces the frames of a window. Scripts that redraw every
+// frame do so as fast as the display allows; a limit keeps a dashboard from
+// using a core, and in idle mode redrawing stops until the pointer moves or
+// the script marks itself active.
+type framePacing struct {
+	mu        sync.Mutex
+	interval  time.Duration // 0 for no limit
+	idleAfter time.Duration // 0 for no idle mode
+	lastFrame time.Time
+	lastInput time.Time
+}
+
+var (
+	pacings       sync.Map // *app.Window -> *framePacing
+	sourcePacings sync.Map // input.Source -> *framePacing, of the window the frame is for
+)
+
+func pacingOf(win *app.Window) *framePacing {
+	p, _ := pacings.LoadOrStore(win, &framePacing{lastInput: time.Now()})
+	return p.(*framePacing)
+}
+
+func (p *framePacing) idle(now time.Time) bool {
+	return p.idleAfter > 0 && now.Sub(p.lastInput) >= p.idleAfter
+}
+
+func (p *framePacing) active() {
+	p.mu.Lock()
+	p.lastInput = time.Now()
+	p.mu.Unlock()
+}
+
+// paceFrame notes a frame of win, which the next scheduled one is spaced
+// from.
+func paceFrame(win *app.Window, e app.FrameEvent) {
+	v, ok := pacings.Load(win)
+	if !ok {
+		return
+	}
+	p := v.(*framePacing)
+	sourcePacings.Store(e.Source, p)
+	p.mu.Lock()
+	p.lastFrame = e.Now
+	p.mu.Unlock()
+}
+
+// scheduleFrame asks for another frame after this one, once the interval of
+// the window's pacing has passed; an idle window isn't redrawn until there
+// is input.
+func scheduleFrame(gtx layout.Context) {
+	v, ok := sourcePacings.Load(gtx.Source)
+	if !ok {
+		gtx.Execute(op.InvalidateCmd{})
+		return
+	}
+	p := v.(*framePacing)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle(gtx.Now) {
+		return
+	}
+	gtx.Execute(op.InvalidateCmd{At: p.lastFrame.Add(p.interval)})
+}
+
+// animateFrame is scheduleFrame for an animation, which keeps the window
+// out of idle mode while it runs.
+func animateFrame(gtx layout.Context) {
+	if v, ok := sourcePacings.Load(gtx.Source); ok {
+		v.(*framePacing).active()
+	}
+	scheduleFrame(gtx)
+}
+
+// pacedContext is app.NewContext that, for a window in idle mode, also
+// watches the pointer over the whole window to tell when it is in use.
+func pacedContext(ops *op.Ops, e app.FrameEvent) layout.Context {
+	// The frame is padded by its insets unless edgeContext says otherwise.
+	frameInsets.Delete(ops)
+	gtx := app.NewContext(ops, e)
+	v, ok := sourcePacings.Load(e.Source)
+	if !ok {
+		return gtx
+	}
+	p := v.(*framePacing)
+	p.mu.Lock()
+	idleMode := p.idleAfter > 0
+	p.mu.Unlock()
+	if !idleMode {
+		return gtx
+	}
+	for {
+		_, ok := gtx.Event(pointer.Filter{Target: p, Kinds: pointer.Move | pointer.Press | pointer.Release | pointer.Drag})
+		if !ok {
+			break
+		}
+		p.active()
+	}
+	pass := pointer.PassOp{}.Push(ops)
+	area := clip.Rect(image.Rectangle{Max: e.Size}).Push(ops)
+	event.Op(ops, p)
+	area.Pop()
+	pass.Pop()
+	return gtx
+}
+
+// pacingBuiltin returns a "//method" builtin of windows acting on their
+// pacing; fn returning nil returns the window.
+func pacingBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, win *app.Window, p *framePacing, arg1, arg2 env.Object) env.Object) *env.Builtin {
+	name := "Go(*app.Window)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, win, pacingOf(win), arg1, arg2); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsPacing = map[string]*env.Builtin{
+	"Go(*app.Window)//event": {
+		Doc:   "(*app.Window).Event; frames are noted for the window's max-fps! and idle! limits and on-lifecycle! handlers run",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*app.Window](ps, "Go(*app.Window)//event", 1, arg0)
+			if err != nil {
+				return err
+			}
+			e := nextEvent(win)
+			return ifaceToNative(ps.Idx, e, "Go(event.Event)")
+		},
+	},
+	"app-context": {
+		Doc:   "app.NewContext",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			ops, err := nativeArg[*op.Ops](ps, "app-context", 1, arg0)
+			if err != nil {
+				return err
+			}
+			e, err := nativeArg[*app.FrameEvent](ps, "app-context", 2, arg1)
+			if err != nil {
+				return err
+			}
+			gtx := pacedContext(ops, *e)
+			return *env.NewNative(ps.Idx, &gtx, "Go(*layout.Context)")
+		},
+	},
+	"Go(*layout.Context)//invalidate": {
+		Doc:   "Redraw the window again after this frame, within its max-fps! limit; an idle window waits for input",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := nativeArg[*layout.Context](ps, "Go(*layout.Context)//invalidate", 1, arg0)
+			if err != nil {
+				return err
+			}
+			scheduleFrame(*gtx)
+			return arg0
+		},
+	},
+	"Go(*app.Window)//max-fps!": pacingBuiltin("max-fps!", "Limit the window to a number of frames per second, 0 for no limit", 2, func(ps *env.ProgramState, name string, win *app.Window, p *framePacing, arg1, arg2 env.Object) env.Object {
+		fps, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if fps < 0 {
+			return failure(ps, name, "frames per second can't be negative")
+		}
+		p.mu.Lock()
+		p.interval = 0
+		if fps > 0 {
+			p.interval = time.Second / time.Duration(fps)
+		}
+		p.mu.Unlock()
+		return nil
+	}),
+	"Go(*app.Window)//idle!": pacingBuiltin("idle!", "After a number of milliseconds without pointer input or active!, stop redrawing the window until there is; 0 turns idle mode off", 2, func(ps *env.ProgramState, name string, win *app.Window, p *framePacing, arg1, arg2 env.Object) env.Object {
+		ms, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if ms < 0 {
+			return failure(ps, name, "milliseconds can't be negative")
+		}
+		p.mu.Lock()
+		p.idleAfter = time.Duration(ms) * time.Millisecond
+		p.mu.Unlock()
+		return nil
+	}),
+	"Go(*app.Window)//active!": pacingBuiltin("active!", "Leave idle mode, as pointer input does; call it while animating or when keys are typed", 1, func(ps *env.ProgramState, name string, win *app.Window, p *framePacing, arg1, arg2 env.Object) env.Object {
+		p.active()
+		win.Invalidate()
+		return nil
+	}),
+	"Go(*app.Window)//idle?": pacingBuiltin("idle?", "Check whether the window is in idle mode", 1, func(ps *env.ProgramState, name string, win *app.Window, p *framePacing, arg1, arg2 env.Object) env.Object {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return *env.NewInteger(boolToInt64(p.idle(time.Now())))
+	}),
+}
@@ -0,0 +1,351 @@
+// Particle emitters.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+type particle struct {
+	pos, vel  f32.Point
+	age, life float32
+}
+
+// rampBuckets is the number of color steps particles are grouped into, so
+// drawing takes one path per step instead of one per particle.
+const rampBuckets = 16
+
+// Emitter spawns particles at Pos that move with a random speed and
+// direction, fall with Gravity and fade through Colors over their lifetime.
+// Units are dp and seconds; angles are radians.
+type Emitter struct {
+	Pos       f32.Point
+	Rate      float32
+	Life      [2]float32
+	Speed     [2]float32
+	Direction float32
+	Spread    float32
+	Gravity   f32.Point
+	Size      float32
+	Colors    []color.NRGBA
+	Max       int
+	particles []particle
+	spawn     float32 // fractional particles owed
+	rng       *rand.Rand
+}
+
+func newEmitter(x, y float32) *Emitter {
+	return &Emitter{
+		Pos:    f32.Pt(x, y),
+		Rate:   50,
+		Life:   [2]float32{0.5, 1.5},
+		Speed:  [2]float32{40, 80},
+		Spread: 2 * math.Pi,
+		Size:   3,
+		Colors: []color.NRGBA{{R: 0xff, G: 0xc0, B: 0x40, A: 0xff}, {R: 0xff, G: 0x40, B: 0x20, A: 0}},
+		Max:    5000,
+		rng:    rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+func (e *Emitter) between(r [2]float32) float32 {
+	return r[0] + e.rng.Float32()*(r[1]-r[0])
+}
+
+// Burst spawns n particles at once.
+func (e *Emitter) Burst(n int) {
+	for i := 0; i < n && len(e.particles) < e.Max; i++ {
+		a := e.Direction + (e.rng.Float32()-.5)*e.Spread
+		s := e.between(e.Speed)
+		e.particles = append(e.particles, particle{
+			pos:  e.Pos,
+			vel:  f32.Pt(float32(math.Cos(float64(a)))*s, float32(math.Sin(float64(a)))*s),
+			life: e.between(e.Life),
+		})
+	}
+}
+
+// Update advances the simulation by dt seconds.
+func (e *Emitter) Update(dt float32) {
+	e.spawn += e.Rate * dt
+	if n := int(e.spawn); n > 0 {
+		e.spawn -= float32(n)
+		e.Burst(n)
+	}
+	ps := e.particles
+	for i := 0; i < len(ps); {
+		p := &ps[i]
+		p.age += dt
+		if p.age >= p.life {
+			ps[i] = ps[len(ps)-1]
+			ps = ps[:len(ps)-1]
+			continue
+		}
+		p.vel = p.vel.Add(e.Gravity.Mul(dt))
+		p.pos = p.pos.Add(p.vel.Mul(dt))
+		i++
+	}
+	e.particles = ps
+}
+
+// rampColor returns the color at t in [0, 1] along Colors.
+func (e *Emitter) rampColor(t float32) color.NRGBA {
+	cs := e.Colors
+	if len(cs) == 1 {
+		return cs[0]
+	}
+	f := t * float32(len(cs)-1)
+	i := min(int(f), len(cs)-2)
+	f -= float32(i)
+	a, b := cs[i], cs[i+1]
+	lerp := func(x, y uint8) uint8 { return uint8(float32(x) + (float32(y)-float32(x))*f + .5) }
+	return color.NRGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: lerp(a.A, b.A)}
+}
+
+func (e *Emitter) Layout(gtx layout.Context) layout.Dimensions {
+	if len(e.Colors) == 0 || len(e.particles) == 0 {
+		return layout.Dimensions{Size: gtx.Constraints.Min}
+	}
+	scale := gtx.Metric.PxPerDp
+	half := e.Size * scale / 2
+	var buckets [rampBuckets][]f32.Point
+	for _, p := range e.particles {
+		b := min(int(p.age/p.life*rampBuckets), rampBuckets-1)
+		buckets[b] = append(buckets[b], p.pos.Mul(scale))
+	}
+	for b, centers := range buckets {
+		if len(centers) == 0 {
+			continue
+		}
+		var path clip.Path
+		path.Begin(gtx.Ops)
+		for _, c := range centers {
+			path.MoveTo(f32.Pt(c.X-half, c.Y-half))
+			path.LineTo(f32.Pt(c.X+half, c.Y-half))
+			path.LineTo(f32.Pt(c.X+half, c.Y+half))
+			path.LineTo(f32.Pt(c.X-half, c.Y+half))
+			path.Close()
+		}
+		c := e.rampColor((float32(b) + .5) / rampBuckets)
+		paint.FillShape(gtx.Ops, c, clip.Outline{Path: path.End()}.Op())
+	}
+	return layout.Dimensions{Size: gtx.Constraints.Min}
+}
+
+// rangeArgs reads a min and max decimal argument.
+func rangeArgs(ps *env.ProgramState, name string, n int, a, b env.Object) ([2]float32, *env.Error) {
+	lo, hi, err := pointArgs(ps, name, n, a, b)
+	if err != nil {
+		return [2]float32{}, err
+	}
+	if hi < lo {
+		return [2]float32{}, failure(ps, name, "expected min <= max")
+	}
+	return [2]float32{lo, hi}, nil
+}
+
+func emitterSetter(name, doc string, set func(e *Emitter, a, b float32)) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			a, b, err := pointArgs(ps, name, 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			set(e, a, b)
+			return arg0
+		},
+	}
+}
+
+var builtinsParticles = map[string]*env.Builtin{
+	"particle-emitter": {
+		Doc:   "Create a particle emitter at x y; call .update with dt and .layout each frame",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			x, y, err := pointArgs(ps, "particle-emitter", 1, arg0, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newEmitter(x, y), "Go(*gioui_org.Emitter)")
+		},
+	},
+	"Go(*gioui_org.Emitter)//layout": layoutBuiltin[*Emitter]("Go(*gioui_org.Emitter)//layout"),
+	"Go(*gioui_org.Emitter)//update": {
+		Doc:   "Advance the particles by dt seconds",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//update", 1, arg0)
+			if err != nil {
+				return err
+			}
+			dt, err := decimalArg(ps, "Go(*gioui_org.Emitter)//update", 2, arg1)
+			if err != nil {
+				return err
+			}
+			e.Update(float32(dt))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//burst": {
+		Doc:   "Spawn a number of particles at once",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//burst", 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := integerArg(ps, "Go(*gioui_org.Emitter)//burst", 2, arg1)
+			if err != nil {
+				return err
+			}
+			e.Burst(int(n))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//rate!": {
+		Doc:   "Set the number of particles spawned per second",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//rate!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r, err := decimalArg(ps, "Go(*gioui_org.Emitter)//rate!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			e.Rate = float32(r)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//max!": {
+		Doc:   "Set the maximum number of live particles",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//max!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := integerArg(ps, "Go(*gioui_org.Emitter)//max!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			e.Max = int(n)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//lifetime!": {
+		Doc:   "Set the minimum and maximum particle lifetime in seconds",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//lifetime!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r, err := rangeArgs(ps, "Go(*gioui_org.Emitter)//lifetime!", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			if r[0] <= 0 {
+				return failure(ps, "Go(*gioui_org.Emitter)//lifetime!", "expected a positive lifetime")
+			}
+			e.Life = r
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//speed!": {
+		Doc:   "Set the minimum and maximum initial speed in dp per second",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//speed!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r, err := rangeArgs(ps, "Go(*gioui_org.Emitter)//speed!", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			e.Speed = r
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//direction!": emitterSetter("Go(*gioui_org.Emitter)//direction!",
+		"Set the emission direction and spread in degrees (0 is right, 90 down)",
+		func(e *Emitter, dir, spread float32) {
+			e.Direction, e.Spread = dir*math.Pi/180, spread*math.Pi/180
+		}),
+	"Go(*gioui_org.Emitter)//gravity!": emitterSetter("Go(*gioui_org.Emitter)//gravity!",
+		"Set the acceleration x y in dp per second squared",
+		func(e *Emitter, x, y float32) { e.Gravity = f32.Pt(x, y) }),
+	"Go(*gioui_org.Emitter)//position!": emitterSetter("Go(*gioui_org.Emitter)//position!",
+		"Move the emitter to x y",
+		func(e *Emitter, x, y float32) { e.Pos = f32.Pt(x, y) }),
+	"Go(*gioui_org.Emitter)//size!": {
+		Doc:   "Set the particle size in dp",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//size!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := decimalArg(ps, "Go(*gioui_org.Emitter)//size!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			e.Size = float32(s)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//colors!": {
+		Doc:   "Set the block of colors particles fade through over their lifetime",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//colors!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg1.(env.Block)
+			if !ok || len(blk.Series.S) == 0 {
+				return argError(ps, "Go(*gioui_org.Emitter)//colors!", 2, "block of colors", arg1)
+			}
+			cs := make([]color.NRGBA, len(blk.Series.S))
+			for i, o := range blk.Series.S {
+				c, err := colorArg(ps, "Go(*gioui_org.Emitter)//colors!", 2, o)
+				if err != nil {
+					return err
+				}
+				cs[i] = c
+			}
+			e.Colors = cs
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Emitter)//count?": {
+		Doc:   "Get the number of live particles",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			e, err := nativeArg[*Emitter](ps, "Go(*gioui_org.Emitter)//count?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(int64(len(e.particles)))
+		},
+	},
+}
@@ -0,0 +1,356 @@
+// Password field with reveal toggle and strength meter.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"unicode"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/transfer"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// passwordMask is the rune shown instead of each character while hidden.
+const passwordMask = '•'
+
+// PasswordInput is a masked single line editor with a reveal toggle, paste
+// control and an optional strength meter.
+type PasswordInput struct {
+	ps         *env.ProgramState
+	Theme      *material.Theme
+	Hint       string
+	AllowPaste bool
+	ShowMeter  bool
+	revealed   bool
+	editor     widget.Editor
+	reveal     widget.Clickable
+	strength   *env.Function
+	onChange   *env.Function
+	score      float64
+}
+
+func newPasswordInput(ps *env.ProgramState, th *material.Theme) *PasswordInput {
+	p := &PasswordInput{ps: ps, Theme: th, Hint: "Password", AllowPaste: true}
+	p.editor.SingleLine = true
+	p.editor.Submit = true
+	p.editor.Mask = passwordMask
+	p.editor.InputHint = key.HintPassword
+	return p
+}
+
+// passwordStrength is the default strength estimate in [0, 1], based on
+// length and the number of character classes used.
+func passwordStrength(s string) float64 {
+	var lower, upper, digit, other bool
+	n := 0
+	for _, r := range s {
+		n++
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, b := range []bool{lower, upper, digit, other} {
+		if b {
+			classes++
+		}
+	}
+	score := 0.0
+	switch {
+	case n >= 16:
+		score = 0.5
+	case n >= 12:
+		score = 0.4
+	case n >= 8:
+		score = 0.25
+	case n > 0:
+		score = 0.1
+	}
+	return min(1, score+float64(classes)*0.125)
+}
+
+func (p *PasswordInput) update() {
+	pw := p.editor.Text()
+	if p.strength != nil {
+		switch v := callFunction(p.ps, "password-input strength", *p.strength, *env.NewString(pw)).(type) {
+		case env.Decimal:
+			p.score = v.Value
+		case env.Integer:
+			// Integers are scores from 0 to 4.
+			p.score = float64(v.Value) / 4
+		}
+	} else {
+		p.score = passwordStrength(pw)
+	}
+	// A NaN from the script would index the meter's colors out of range.
+	if math.IsNaN(p.score) {
+		p.score = 0
+	}
+	p.score = max(0, min(1, p.score))
+	if p.onChange != nil {
+		callFunction(p.ps, "password-input on-change", *p.onChange, *env.NewString(pw))
+	}
+}
+
+func (p *PasswordInput) Layout(gtx layout.Context) layout.Dimensions {
+	// Swallow clipboard shortcuts before the editor sees them: copying is
+	// blocked while hidden and pasting when disabled.
+	var blocked []event.Filter
+	if !p.revealed {
+		blocked = append(blocked,
+			key.Filter{Focus: &p.editor, Name: "C", Required: key.ModShortcut},
+			key.Filter{Focus: &p.editor, Name: "X", Required: key.ModShortcut},
+		)
+	}
+	if !p.AllowPaste {
+		blocked = append(blocked,
+			key.Filter{Focus: &p.editor, Name: "V", Required: key.ModShortcut},
+			transfer.TargetFilter{Target: &p.editor, Type: "application/text"},
+		)
+	}
+	for len(blocked) > 0 {
+		if _, ok := gtx.Event(blocked...); !ok {
+			break
+		}
+	}
+	for {
+		e, ok := p.editor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := e.(widget.ChangeEvent); ok {
+			p.update()
+		}
+	}
+	for p.reveal.Clicked(gtx) {
+		p.revealed = !p.revealed
+		if p.revealed {
+			p.editor.Mask = 0
+		} else {
+			p.editor.Mask = passwordMask
+		}
+	}
+
+	th := p.Theme
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return widget.Border{Color: mulAlpha(th.Palette.Fg, 0x60), CornerRadius: 4, Width: 1}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: 8, Right: 8, Top: 6, Bottom: 6}.Layout(gtx, material.Editor(th, &p.editor, p.Hint).Layout)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						label := "Show"
+						if p.revealed {
+							label = "Hide"
+						}
+						return p.reveal.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							return layout.Inset{Left: 8, Right: 8}.Layout(gtx, material.Caption(th, label).Layout)
+						})
+					}),
+				)
+			})
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if !p.ShowMeter {
+				return layout.Dimensions{}
+			}
+			return layout.Inset{Top: 4}.Layout(gtx, p.layoutMeter)
+		}),
+	)
+}
+
+// strengthColors go from weak (red) to strong (green).
+var strengthColors = []color.NRGBA{
+	{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff},
+	{R: 0xf5, G: 0x7c, B: 0x00, A: 0xff},
+	{R: 0xfb, G: 0xc0, B: 0x2d, A: 0xff},
+	{R: 0x7c, G: 0xb3, B: 0x42, A: 0xff},
+	{R: 0x38, G: 0x8e, B: 0x3c, A: 0xff},
+}
+
+func (p *PasswordInput) layoutMeter(gtx layout.Context) layout.Dimensions {
+	size := image.Pt(gtx.Constraints.Max.X, gtx.Dp(4))
+	rr := size.Y / 2
+	paint.FillShape(gtx.Ops, mulAlpha(p.Theme.Palette.Fg, 0x20), clip.UniformRRect(image.Rectangle{Max: size}, rr).Op(gtx.Ops))
+	if p.editor.Len() > 0 {
+		c := strengthColors[int(p.score*float64(len(strengthColors)-1)+0.5)]
+		w := max(int(float64(size.X)*p.score), 2*rr)
+		paint.FillShape(gtx.Ops, c, clip.UniformRRect(image.Rect(0, 0, w, size.Y), rr).Op(gtx.Ops))
+	}
+	return layout.Dimensions{Size: size}
+}
+
+var builtinsPassword = map[string]*env.Builtin{
+	"password-input": {
+		Doc:   "Create a masked password input with a show/hide toggle",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "password-input", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newPasswordInput(ps, th), "Go(*gioui_org.PasswordInput)")
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//layout": layoutBuiltin[*PasswordInput]("Go(*gioui_org.PasswordInput)//layout"),
+	"Go(*gioui_org.PasswordInput)//text?": {
+		Doc:   "Get the password",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(p.editor.Text())
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//text!": {
+		Doc:   "Set the password",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//text!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, "Go(*gioui_org.PasswordInput)//text!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.editor.SetText(s)
+			p.update()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//hint!": {
+		Doc:   "Set the hint shown when empty",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//hint!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, "Go(*gioui_org.PasswordInput)//hint!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.Hint = s
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//revealed!": {
+		Doc:   "Show (1) or hide (0) the password",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//revealed!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.PasswordInput)//revealed!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.revealed = v != 0
+			p.editor.Mask = passwordMask
+			if p.revealed {
+				p.editor.Mask = 0
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//allow-paste!": {
+		Doc:   "Allow (1) or block (0) pasting into the field",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//allow-paste!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.PasswordInput)//allow-paste!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.AllowPaste = v != 0
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//strength-meter!": {
+		Doc:   "Show (1) or hide (0) the strength meter",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//strength-meter!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.PasswordInput)//strength-meter!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.ShowMeter = v != 0
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//strength!": {
+		Doc:   "Show the strength meter using a function that gets the password and returns a score (integer 0-4 or decimal 0.0-1.0)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//strength!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.PasswordInput)//strength!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			p.strength = &fn
+			p.ShowMeter = true
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//strength?": {
+		Doc:   "Get the current strength score (0.0 - 1.0)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//strength?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewDecimal(p.score)
+		},
+	},
+	"Go(*gioui_org.PasswordInput)//on-change!": {
+		Doc:   "Set function called with the password whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PasswordInput](ps, "Go(*gioui_org.PasswordInput)//on-change!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.PasswordInput)//on-change!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			p.onChange = &fn
+			return arg0
+		},
+	},
+}
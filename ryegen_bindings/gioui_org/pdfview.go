@@ -0,0 +1,599 @@
+// PDF documents rendered page by page by poppler's tools.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/gesture"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+const (
+	pdfMinZoom = 0.25
+	pdfMaxZoom = 6
+	// pdfMaxDPI caps the resolution pages are rendered at.
+	pdfMaxDPI = 600
+)
+
+var (
+	pdfMatch   = color.NRGBA{R: 0xff, G: 0xd6, B: 0x00, A: 0x60}
+	pdfCurrent = color.NRGBA{R: 0xff, G: 0x8f, B: 0x00, A: 0x90}
+)
+
+// pdfKey is the image cache key of a rendered page, apart from paths.
+type pdfKey struct {
+	path string
+	page int // from 1
+	dpi  int
+}
+
+// pdfRender is the rendering of a page, shared by the views showing it.
+type pdfRender struct {
+	done chan struct{}
+	op   paint.ImageOp
+	err  error
+}
+
+var (
+	pdfRendersMu sync.Mutex
+	pdfRenders   = map[pdfKey]*pdfRender{} // in progress
+	// pdfSlots limits the pages rendered at once.
+	pdfSlots = make(chan struct{}, 2)
+)
+
+// renderPage returns the page from the image cache, or the rendering of it
+// by pdftoppm, starting one if none is in progress.
+func renderPage(key pdfKey, modTime time.Time) *pdfRender {
+	pdfRendersMu.Lock()
+	defer pdfRendersMu.Unlock()
+	if r, ok := pdfRenders[key]; ok {
+		return r
+	}
+	r := &pdfRender{done: make(chan struct{})}
+	images.mu.Lock()
+	op, ok := images.get(key, modTime)
+	images.mu.Unlock()
+	if ok {
+		r.op = op
+		close(r.done)
+		return r
+	}
+	pdfRenders[key] = r
+	go func() {
+		pdfSlots <- struct{}{}
+		img, err := rasterizePage(key)
+		<-pdfSlots
+		if err == nil {
+			images.mu.Lock()
+			r.op = images.put(key, modTime, img)
+			images.mu.Unlock()
+		}
+		r.err = err
+		pdfRendersMu.Lock()
+		delete(pdfRenders, key)
+		pdfRendersMu.Unlock()
+		close(r.done)
+	}()
+	return r
+}
+
+func (r *pdfRender) ready() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// poppler runs one of poppler's tools, which must be installed, returning
+// its output.
+func poppler(tool string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, errors.New(tool + " not found: install poppler (poppler-utils) to view PDF documents")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(tool, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(tool + ": " + msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func rasterizePage(key pdfKey) (image.Image, error) {
+	n := strconv.Itoa(key.page)
+	out, err := poppler("pdftoppm", "-f", n, "-l", n, "-r", strconv.Itoa(key.dpi), "-png", key.path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(out))
+	return img, err
+}
+
+var pdfPageInfo = regexp.MustCompile(`^Page\s+(\d+)\s+(size|rot):\s+([\d.]+)(?:\s+x\s+([\d.]+))?`)
+
+// pdfPages reads the sizes of the pages of a document in points, turned as
+// the pages are rotated.
+func pdfPages(path string) ([]f32.Point, error) {
+	out, err := poppler("pdfinfo", "-f", "1", "-l", strconv.Itoa(math.MaxInt32), path)
+	if err != nil {
+		return nil, err
+	}
+	var sizes []f32.Point
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		m := pdfPageInfo.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		for len(sizes) < n {
+			sizes = append(sizes, f32.Point{})
+		}
+		p := &sizes[n-1]
+		a, _ := strconv.ParseFloat(m[3], 32)
+		if m[2] == "size" {
+			b, _ := strconv.ParseFloat(m[4], 32)
+			*p = f32.Pt(float32(a), float32(b))
+		} else if int(a)%180 == 90 {
+			*p = f32.Pt(p.Y, p.X)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New(path + ": no pages")
+	}
+	return sizes, nil
+}
+
+// pdfWord is a word of a page and its box in points.
+type pdfWord struct {
+	text string
+	box  bbox
+}
+
+var (
+	pdfPageTag = regexp.MustCompile(`^\s*<page `)
+	pdfWordTag = regexp.MustCompile(`<word xMin="([\d.]+)" yMin="([\d.]+)" xMax="([\d.]+)" yMax="([\d.]+)">(.*)</word>`)
+)
+
+// pdfWords reads the words of each page of a document with pdftotext.
+func pdfWords(path string) ([][]pdfWord, error) {
+	out, err := poppler("pdftotext", "-bbox", "-enc", "UTF-8", path, "-")
+	if err != nil {
+		return nil, err
+	}
+	var pages [][]pdfWord
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if pdfPageTag.MatchString(line) {
+			pages = append(pages, nil)
+			continue
+		}
+		m := pdfWordTag.FindStringSubmatch(line)
+		if m == nil || len(pages) == 0 {
+			continue
+		}
+		var c [4]float32
+		for i := range c {
+			f, _ := strconv.ParseFloat(m[i+1], 32)
+			c[i] = float32(f)
+		}
+		w := pdfWord{text: html.UnescapeString(m[5]), box: bbox{Min: f32.Pt(c[0], c[1]), Max: f32.Pt(c[2], c[3])}}
+		pages[len(pages)-1] = append(pages[len(pages)-1], w)
+	}
+	return pages, sc.Err()
+}
+
+// pdfHit is a match of a search, the boxes of the words it covers on a page.
+type pdfHit struct {
+	page  int // from 0
+	boxes []bbox
+}
+
+// searchWords finds the text in the words of a page, ignoring case, across
+// the spaces between words.
+func searchWords(words []pdfWord, page int, text string) []pdfHit {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	if text == "" {
+		return nil
+	}
+	var all strings.Builder
+	starts := make([]int, len(words))
+	for i, w := range words {
+		if i > 0 {
+			all.WriteByte(' ')
+		}
+		starts[i] = all.Len()
+		all.WriteString(strings.ToLower(w.text))
+	}
+	s := all.String()
+	var hits []pdfHit
+	for at := 0; ; {
+		i := strings.Index(s[at:], text)
+		if i < 0 {
+			break
+		}
+		start, end := at+i, at+i+len(text)
+		h := pdfHit{page: page}
+		for j, w := range words {
+			if starts[j] < end && starts[j]+len(strings.ToLower(w.text)) > start {
+				h.boxes = append(h.boxes, w.box)
+			}
+		}
+		hits = append(hits, h)
+		at = end
+	}
+	return hits
+}
+
+// PDFView shows the pages of a PDF document one under another, zoomed or
+// fitted to its width, rendering the pages in view in the background with
+// pdftoppm. Searches highlight their matches, found in the text pdftotext
+// extracts, and go from one to the next. Ctrl with + and - zooms, and Ctrl
+// with 0 zooms back to 1.
+type PDFView struct {
+	Theme    *material.Theme
+	Zoom     float32 // a point to a dp at 1
+	FitWidth bool
+	path     string
+	modTime  time.Time
+	pages    []f32.Point
+	words    [][]pdfWord // nil until searched
+	query    string
+	hits     []pdfHit
+	hit      int // current hit, or -1
+	list     widget.List
+	hscroll  gesture.Scroll
+	panX     int
+	scale    float32     // pixels a point at the last layout
+	size     image.Point // of the view at the last layout
+	err      error
+}
+
+func newPDFView(th *material.Theme, path string) (*PDFView, error) {
+	v := &PDFView{Theme: th, Zoom: 1, hit: -1}
+	v.list.Axis = layout.Vertical
+	return v, v.Open(path)
+}
+
+// Open shows another document.
+func (v *PDFView) Open(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(abs)
+	if err != nil {
+		return err
+	}
+	pages, err := pdfPages(abs)
+	if err != nil {
+		return err
+	}
+	v.path, v.modTime, v.pages = abs, st.ModTime(), pages
+	v.words, v.query, v.hits, v.hit, v.err = nil, "", nil, -1, nil
+	v.list.Position = layout.Position{}
+	v.panX = 0
+	return nil
+}
+
+// Search highlights the matches of text, returning how many there are;
+// an empty text clears them.
+func (v *PDFView) Search(text string) (int, error) {
+	v.query, v.hits, v.hit = text, nil, -1
+	if strings.TrimSpace(text) == "" {
+		return 0, nil
+	}
+	if v.words == nil {
+		words, err := pdfWords(v.path)
+		if err != nil {
+			return 0, err
+		}
+		v.words = words
+	}
+	for p, words := range v.words {
+		v.hits = append(v.hits, searchWords(words, p, text)...)
+	}
+	return len(v.hits), nil
+}
+
+// GoToMatch scrolls to a match of the search, wrapping around at either end.
+func (v *PDFView) GoToMatch(i int) {
+	if len(v.hits) == 0 {
+		return
+	}
+	v.hit = (i%len(v.hits) + len(v.hits)) % len(v.hits)
+	h := v.hits[v.hit]
+	// A third down the view, as far as the last layout tells.
+	box := h.boxes[0]
+	v.list.Position = layout.Position{First: h.page, Offset: int(box.Min.Y*v.scale) - v.size.Y/3}
+	if v.size.X > 0 {
+		page := int(v.pages[h.page].X * v.scale)
+		if page > v.size.X {
+			v.panX = max(0, min(int(box.Min.X*v.scale)-v.size.X/3, page-v.size.X))
+		}
+	}
+}
+
+func (v *PDFView) NextMatch()     { v.GoToMatch(v.hit + 1) }
+func (v *PDFView) PreviousMatch() { v.GoToMatch(v.hit - 1) }
+
+// GoToPage scrolls to the top of a page, numbered from 1.
+func (v *PDFView) GoToPage(n int) {
+	v.list.Position = layout.Position{First: max(0, min(n-1, len(v.pages)-1))}
+}
+
+// Page returns the number, from 1, of the page at the top of the view.
+func (v *PDFView) Page() int {
+	return v.list.Position.First + 1
+}
+
+func (v *PDFView) SetZoom(z float32) {
+	v.Zoom = max(pdfMinZoom, min(z, pdfMaxZoom))
+	v.FitWidth = false
+}
+
+func (v *PDFView) FocusTag() event.Tag { return v }
+
+func (v *PDFView) update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(
+			key.FocusFilter{Target: v},
+			key.Filter{Focus: v, Name: "+", Required: key.ModShortcut},
+			key.Filter{Focus: v, Name: "=", Required: key.ModShortcut},
+			key.Filter{Focus: v, Name: "-", Required: key.ModShortcut},
+			key.Filter{Focus: v, Name: "0", Required: key.ModShortcut},
+			pointer.Filter{Target: v, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		switch e := e.(type) {
+		case key.Event:
+			if e.State != key.Press {
+				break
+			}
+			switch e.Name {
+			case "+", "=":
+				v.SetZoom(v.Zoom * 1.25)
+			case "-":
+				v.SetZoom(v.Zoom / 1.25)
+			case "0":
+				v.SetZoom(1)
+			}
+		case pointer.Event:
+			gtx.Execute(key.FocusCmd{Tag: v})
+		}
+	}
+}
+
+// fitWidth zooms the widest page to the width of the view.
+func (v *PDFView) fitWidth(gtx layout.Context) {
+	var widest float32
+	for _, p := range v.pages {
+		widest = max(widest, p.X)
+	}
+	v.Zoom = max(pdfMinZoom, min(float32(gtx.Constraints.Max.X-2*gtx.Dp(8))/widest/gtx.Metric.PxPerDp, pdfMaxZoom))
+}
+
+func (v *PDFView) layoutPage(gtx layout.Context, i int) layout.Dimensions {
+	gap := gtx.Dp(8)
+	size := image.Pt(int(v.pages[i].X*v.scale+.5), int(v.pages[i].Y*v.scale+.5))
+	x := (v.size.X-size.X)/2 - v.panX
+	if size.X > v.size.X {
+		x = -v.panX
+	}
+	defer op.Offset(image.Pt(x, gap)).Push(gtx.Ops).Pop()
+	page := clip.Rect{Max: size}.Push(gtx.Ops)
+	paint.Fill(gtx.Ops, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+
+	dpi := min(int(72*v.scale+.5), pdfMaxDPI)
+	r := renderPage(pdfKey{path: v.path, page: i + 1, dpi: dpi}, v.modTime)
+	pgtx := gtx
+	pgtx.Constraints = layout.Exact(size)
+	switch {
+	case !r.ready():
+		s := min(gtx.Dp(32), size.X, size.Y)
+		pgtx.Constraints = layout.Exact(image.Pt(s, s))
+		off := op.Offset(image.Pt((size.X-s)/2, (size.Y-s)/2)).Push(gtx.Ops)
+		material.Loader(v.Theme).Layout(pgtx)
+		off.Pop()
+	case r.err != nil:
+		v.err = r.err
+		lbl := material.Caption(v.Theme, r.err.Error())
+		lbl.Color = color.NRGBA{A: 0xff}
+		layout.UniformInset(8).Layout(pgtx, lbl.Layout)
+	default:
+		widget.Image{Src: r.op, Fit: widget.Fill}.Layout(pgtx)
+	}
+	for n, h := range v.hits {
+		if h.page != i {
+			continue
+		}
+		c := pdfMatch
+		if n == v.hit {
+			c = pdfCurrent
+		}
+		for _, b := range h.boxes {
+			rect := image.Rect(int(b.Min.X*v.scale), int(b.Min.Y*v.scale), int(b.Max.X*v.scale+.5), int(b.Max.Y*v.scale+.5))
+			paint.FillShape(gtx.Ops, c, clip.Rect(rect).Op())
+		}
+	}
+	page.Pop()
+	return layout.Dimensions{Size: image.Pt(v.size.X, size.Y+gap)}
+}
+
+func (v *PDFView) Layout(gtx layout.Context) layout.Dimensions {
+	v.update(gtx)
+	size := gtx.Constraints.Max
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	paint.Fill(gtx.Ops, mulAlpha(v.Theme.Fg, 0x20))
+	event.Op(gtx.Ops, v)
+
+	if v.FitWidth {
+		v.fitWidth(gtx)
+	}
+	v.scale = v.Zoom * gtx.Metric.PxPerDp
+	v.size = size
+	// Pages wider than the view scroll sideways.
+	var widest int
+	for _, p := range v.pages {
+		widest = max(widest, int(p.X*v.scale+.5))
+	}
+	over := max(widest-size.X, 0)
+	v.panX += v.hscroll.Update(gtx.Metric, gtx.Source, gtx.Now, gesture.Horizontal,
+		pointer.ScrollRange{Min: -v.panX, Max: over - v.panX}, pointer.ScrollRange{})
+	v.panX = max(0, min(v.panX, over))
+	v.hscroll.Add(gtx.Ops)
+
+	return material.List(v.Theme, &v.list).Layout(gtx, len(v.pages), v.layoutPage)
+}
+
+// pdfViewBuiltin returns a "//method" builtin of PDF views; fn returning nil
+// returns the view.
+func pdfViewBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, v *PDFView, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.PDFView)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*PDFView](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, v, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsPDFView = map[string]*env.Builtin{
+	"pdf-view": {
+		Doc:   "Create a view of the pages of a PDF file, rendered with poppler's pdftoppm, which must be installed; Ctrl with + and - zooms",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "pdf-view", 1, arg0)
+			if err != nil {
+				return err
+			}
+			path, err := stringArg(ps, "pdf-view", 2, arg1)
+			if err != nil {
+				return err
+			}
+			v, oerr := newPDFView(th, path)
+			if oerr != nil {
+				return failure(ps, "pdf-view", oerr.Error())
+			}
+			return *env.NewNative(ps.Idx, v, "Go(*gioui_org.PDFView)")
+		},
+	},
+	"Go(*gioui_org.PDFView)//layout": layoutBuiltin[*PDFView]("Go(*gioui_org.PDFView)//layout"),
+	"Go(*gioui_org.PDFView)//open": pdfViewBuiltin("open", "Show another PDF file", 2, func(ps *env.ProgramState, name string, v *PDFView, arg1 env.Object) env.Object {
+		path, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if err := v.Open(path); err != nil {
+			return failure(ps, name, err.Error())
+		}
+		return nil
+	}),
+	"Go(*gioui_org.PDFView)//pages?": pdfViewBuiltin("pages?", "Get the number of pages", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		return *env.NewInteger(int64(len(v.pages)))
+	}),
+	"Go(*gioui_org.PDFView)//page?": pdfViewBuiltin("page?", "Get the number, from 1, of the page at the top of the view", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		return *env.NewInteger(int64(v.Page()))
+	}),
+	"Go(*gioui_org.PDFView)//go-to-page": pdfViewBuiltin("go-to-page", "Scroll to a page, numbered from 1", 2, func(ps *env.ProgramState, name string, v *PDFView, arg1 env.Object) env.Object {
+		n, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.GoToPage(int(n))
+		return nil
+	}),
+	"Go(*gioui_org.PDFView)//zoom!": pdfViewBuiltin("zoom!", fmt.Sprintf("Set the zoom, 1 showing a point of the pages as a dp, from %g to %g", pdfMinZoom, float64(pdfMaxZoom)), 2, func(ps *env.ProgramState, name string, v *PDFView, arg1 env.Object) env.Object {
+		z, err := decimalArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.SetZoom(float32(z))
+		return nil
+	}),
+	"Go(*gioui_org.PDFView)//zoom?": pdfViewBuiltin("zoom?", "Get the zoom, as last laid out when fitting the width", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		return *env.NewDecimal(float64(v.Zoom))
+	}),
+	"Go(*gioui_org.PDFView)//fit-width!": pdfViewBuiltin("fit-width!", "Set whether the pages are zoomed to the width of the view", 2, func(ps *env.ProgramState, name string, v *PDFView, arg1 env.Object) env.Object {
+		b, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		v.FitWidth = b != 0
+		return nil
+	}),
+	"Go(*gioui_org.PDFView)//search": pdfViewBuiltin("search", "Highlight the matches of a text, ignoring case, and get how many there are; \"\" clears them", 2, func(ps *env.ProgramState, name string, v *PDFView, arg1 env.Object) env.Object {
+		s, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		n, serr := v.Search(s)
+		if serr != nil {
+			return failure(ps, name, serr.Error())
+		}
+		return *env.NewInteger(int64(n))
+	}),
+	"Go(*gioui_org.PDFView)//next-match": pdfViewBuiltin("next-match", "Scroll to the next match of the search", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		v.NextMatch()
+		return nil
+	}),
+	"Go(*gioui_org.PDFView)//previous-match": pdfViewBuiltin("previous-match", "Scroll to the previous match of the search", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		v.PreviousMatch()
+		return nil
+	}),
+	"Go(*gioui_org.PDFView)//match?": pdfViewBuiltin("match?", "Get the index (from 0) of the match gone to last, or -1", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		return *env.NewInteger(int64(v.hit))
+	}),
+	"Go(*gioui_org.PDFView)//error?": pdfViewBuiltin("error?", "Get why rendering a page failed, or an empty string", 1, func(ps *env.ProgramState, name string, v *PDFView, _ env.Object) env.Object {
+		if v.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(v.err.Error())
+	}),
+}
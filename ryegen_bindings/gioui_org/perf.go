@@ -0,0 +1,215 @@
+// Memory and GC overlay.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"runtime/metrics"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// perfHistory is the number of frames the overlay graphs show.
+const perfHistory = 120
+
+// perfSeries is a ring of the last perfHistory samples of a quantity.
+type perfSeries struct {
+	Name   string
+	Format func(float64) string
+	Color  color.NRGBA
+	vals   [perfHistory]float64
+	n      int
+}
+
+func (s *perfSeries) add(v float64) {
+	s.vals[s.n%perfHistory] = v
+	s.n++
+}
+
+func (s *perfSeries) last() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return s.vals[(s.n-1)%perfHistory]
+}
+
+// each calls f with the samples from oldest to newest.
+func (s *perfSeries) each(f func(i int, v float64)) {
+	k := min(s.n, perfHistory)
+	for i := 0; i < k; i++ {
+		f(i, s.vals[(s.n-k+i)%perfHistory])
+	}
+}
+
+func formatBytes(v float64) string {
+	switch {
+	case v >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", v/(1<<30))
+	case v >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", v/(1<<20))
+	case v >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", v/(1<<10))
+	}
+	return fmt.Sprintf("%.0f B", v)
+}
+
+// PerfOverlay samples heap size, allocation rate, GC cycles and the size
+// of the frame's operation buffer every frame and graphs them in a corner
+// of the window.
+type PerfOverlay struct {
+	Theme   *material.Theme
+	Heap    perfSeries
+	Allocs  perfSeries // per second
+	GCs     perfSeries // per second
+	Ops     perfSeries // bytes of operations laid out this frame
+	samples []metrics.Sample
+	last    time.Time
+	allocs  uint64
+	gcs     uint64
+}
+
+func newPerfOverlay(th *material.Theme) *PerfOverlay {
+	perSec := func(f func(float64) string) func(float64) string {
+		return func(v float64) string { return f(v) + "/s" }
+	}
+	return &PerfOverlay{
+		Theme:  th,
+		Heap:   perfSeries{Name: "heap", Format: formatBytes, Color: color.NRGBA{R: 0x4c, G: 0xaf, B: 0x50, A: 0xff}},
+		Allocs: perfSeries{Name: "alloc", Format: perSec(formatBytes), Color: color.NRGBA{R: 0x21, G: 0x96, B: 0xf3, A: 0xff}},
+		GCs:    perfSeries{Name: "gc", Format: perSec(func(v float64) string { return fmt.Sprintf("%.1f", v) }), Color: color.NRGBA{R: 0xff, G: 0x98, B: 0x00, A: 0xff}},
+		Ops:    perfSeries{Name: "ops", Format: formatBytes, Color: color.NRGBA{R: 0x9c, G: 0x27, B: 0xb0, A: 0xff}},
+		samples: []metrics.Sample{
+			{Name: "/memory/classes/heap/objects:bytes"},
+			{Name: "/gc/heap/allocs:bytes"},
+			{Name: "/gc/cycles/total:gc-cycles"},
+		},
+	}
+}
+
+// opsSize returns the number of bytes of operations recorded in ops. The
+// buffer isn't exported by Gio, but its length can be read.
+func opsSize(ops *op.Ops) int {
+	return reflect.ValueOf(&ops.Internal).Elem().FieldByName("data").Len()
+}
+
+func metricUint(s metrics.Sample) uint64 {
+	if s.Value.Kind() == metrics.KindUint64 {
+		return s.Value.Uint64()
+	}
+	return 0
+}
+
+// Sample records the current values; Layout calls it.
+func (p *PerfOverlay) Sample(gtx layout.Context) {
+	metrics.Read(p.samples)
+	heap := metricUint(p.samples[0])
+	allocs := metricUint(p.samples[1])
+	gcs := metricUint(p.samples[2])
+	if !p.last.IsZero() {
+		if dt := gtx.Now.Sub(p.last).Seconds(); dt > 0 {
+			p.Heap.add(float64(heap))
+			p.Allocs.add(float64(allocs-p.allocs) / dt)
+			p.GCs.add(float64(gcs-p.gcs) / dt)
+			p.Ops.add(float64(opsSize(gtx.Ops)))
+		}
+	}
+	p.last, p.allocs, p.gcs = gtx.Now, allocs, gcs
+}
+
+// Layout samples and draws the graphs at the top right. Call it last in
+// the frame so the operation buffer size covers the whole frame.
+func (p *PerfOverlay) Layout(gtx layout.Context) layout.Dimensions {
+	p.Sample(gtx)
+	scheduleFrame(gtx)
+	w, rowH := gtx.Dp(unit.Dp(180)), gtx.Dp(unit.Dp(34))
+	series := []*perfSeries{&p.Heap, &p.Allocs, &p.GCs, &p.Ops}
+	size := image.Pt(w, rowH*len(series))
+	defer op.Offset(image.Pt(gtx.Constraints.Max.X-size.X, 0)).Push(gtx.Ops).Pop()
+	paint.FillShape(gtx.Ops, color.NRGBA{A: 0xc0}, clip.Rect{Max: size}.Op())
+	for i, s := range series {
+		row := op.Offset(image.Pt(0, i*rowH)).Push(gtx.Ops)
+		p.layoutGraph(gtx, s, image.Pt(w, rowH))
+		lgtx := gtx
+		lgtx.Constraints = layout.Constraints{Max: image.Pt(w, rowH)}
+		lbl := material.Caption(p.Theme, s.Name+" "+s.Format(s.last()))
+		lbl.Color = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+		layout.UniformInset(unit.Dp(2)).Layout(lgtx, lbl.Layout)
+		row.Pop()
+	}
+	return layout.Dimensions{}
+}
+
+// layoutGraph draws the samples of s as bars scaled to their maximum.
+func (p *PerfOverlay) layoutGraph(gtx layout.Context, s *perfSeries, size image.Point) {
+	peak := 0.0
+	s.each(func(_ int, v float64) { peak = max(peak, v) })
+	if peak == 0 {
+		return
+	}
+	bw := float32(size.X) / perfHistory
+	var path clip.Path
+	path.Begin(gtx.Ops)
+	s.each(func(i int, v float64) {
+		h := float32(v/peak) * float32(size.Y-2)
+		x := float32(i) * bw
+		path.MoveTo(f32.Pt(x, float32(size.Y)))
+		path.LineTo(f32.Pt(x+bw, float32(size.Y)))
+		path.LineTo(f32.Pt(x+bw, float32(size.Y)-h))
+		path.LineTo(f32.Pt(x, float32(size.Y)-h))
+		path.Close()
+	})
+	c := s.Color
+	c.A = 0x90
+	paint.FillShape(gtx.Ops, c, clip.Outline{Path: path.End()}.Op())
+}
+
+func (p *PerfOverlay) object() env.Object {
+	return *env.NewDict(map[string]any{
+		"heap":         *env.NewInteger(int64(p.Heap.last())),
+		"alloc-rate":   *env.NewDecimal(p.Allocs.last()),
+		"gc-rate":      *env.NewDecimal(p.GCs.last()),
+		"frame-ops":    *env.NewInteger(int64(p.Ops.last())),
+		"total-allocs": *env.NewInteger(int64(p.allocs)),
+		"gc-cycles":    *env.NewInteger(int64(p.gcs)),
+	})
+}
+
+var builtinsPerf = map[string]*env.Builtin{
+	"perf-overlay": {
+		Doc:   "Create an overlay graphing heap size, allocation rate, GC cycles and operation buffer size per frame; lay it out last in the frame",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "perf-overlay", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newPerfOverlay(th), "Go(*gioui_org.PerfOverlay)")
+		},
+	},
+	"Go(*gioui_org.PerfOverlay)//layout": layoutBuiltin[*PerfOverlay]("Go(*gioui_org.PerfOverlay)//layout"),
+	"Go(*gioui_org.PerfOverlay)//stats?": {
+		Doc:   "Get a dict of the last sampled heap, alloc-rate, gc-rate and frame-ops, and the total-allocs and gc-cycles so far",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*PerfOverlay](ps, "Go(*gioui_org.PerfOverlay)//stats?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return p.object()
+		},
+	},
+}
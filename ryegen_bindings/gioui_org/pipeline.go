@@ -0,0 +1,193 @@
+// Image pipelines chaining the compute kernels.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+
+	"github.com/refaktor/rye/env"
+)
+
+// pipelineKernel is a kernel a pipeline stage can run, with the kinds of
+// its arguments: number, radius (an integer from 0), size (an integer from
+// 1) or matrix (a block of 20 numbers).
+type pipelineKernel struct {
+	args []string
+	run  func(bufs *buffers, src *image.RGBA, args []float64) *image.RGBA
+}
+
+func gaussianStage(bufs *buffers, src *image.RGBA, a []float64) *image.RGBA {
+	return gaussianBlur(bufs, src, a[0])
+}
+
+var pipelineKernels = map[string]pipelineKernel{
+	"blur":          {[]string{"number"}, gaussianStage},
+	"gaussian-blur": {[]string{"number"}, gaussianStage},
+	"box-blur": {[]string{"radius"}, func(bufs *buffers, src *image.RGBA, a []float64) *image.RGBA {
+		return boxBlur(bufs, src, int(a[0]))
+	}},
+	"brightness": {[]string{"number"}, func(bufs *buffers, src *image.RGBA, a []float64) *image.RGBA {
+		return brightness(bufs, src, float32(a[0]))
+	}},
+	"color-matrix": {[]string{"matrix"}, func(bufs *buffers, src *image.RGBA, a []float64) *image.RGBA {
+		var m [20]float32
+		for i, v := range a {
+			m[i] = float32(v)
+		}
+		return colorMatrix(bufs, src, m)
+	}},
+	"resize": {[]string{"size", "size"}, func(bufs *buffers, src *image.RGBA, a []float64) *image.RGBA {
+		return resize(bufs, src, int(a[0]), int(a[1]))
+	}},
+}
+
+type pipelineStage struct {
+	kernel pipelineKernel
+	args   []float64
+}
+
+// Pipeline runs kernels one after the other, each on the image of the one
+// before. Images between stages are reused by the later stages of a run.
+type Pipeline struct {
+	stages []pipelineStage
+}
+
+func (p *Pipeline) Run(src *image.RGBA) *image.RGBA {
+	bufs := &buffers{}
+	img := src
+	for _, st := range p.stages {
+		out := st.kernel.run(bufs, img, st.args)
+		if out != img && img != src {
+			bufs.put(img)
+		}
+		img = out
+	}
+	return img
+}
+
+// pipelineArg reads an argument of a kind.
+func pipelineArg(kind string, arg env.Object) ([]float64, bool) {
+	var v float64
+	switch a := arg.(type) {
+	case env.Integer:
+		v = float64(a.Value)
+	case env.Decimal:
+		if kind == "radius" || kind == "size" {
+			return nil, false
+		}
+		v = a.Value
+	case env.Block:
+		if kind != "matrix" || len(a.Series.S) != 20 {
+			return nil, false
+		}
+		var m []float64
+		for _, it := range a.Series.S {
+			n, ok := pipelineArg("number", it)
+			if !ok {
+				return nil, false
+			}
+			m = append(m, n...)
+		}
+		return m, true
+	default:
+		return nil, false
+	}
+	switch kind {
+	case "matrix":
+		return nil, false
+	case "radius":
+		return []float64{v}, v >= 0
+	case "size":
+		return []float64{v}, v >= 1
+	}
+	return []float64{v}, true
+}
+
+// parsePipeline reads stages like blur 4 -> resize 512 512.
+func parsePipeline(ps *env.ProgramState, blk env.Block) (*Pipeline, error) {
+	p := &Pipeline{}
+	items := blk.Series.S
+	for i := 0; i < len(items); {
+		n := len(p.stages) + 1
+		w, ok := items[i].(env.Word)
+		if !ok {
+			return nil, fmt.Errorf("stage %d: expected a kernel, got %s", n, items[i].Inspect(*ps.Idx))
+		}
+		name := ps.Idx.GetWord(w.Index)
+		k, ok := pipelineKernels[name]
+		if !ok {
+			names := make([]string, 0, len(pipelineKernels))
+			for n := range pipelineKernels {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("stage %d: unknown kernel %s (%s)", n, name, strings.Join(names, " "))
+		}
+		i++
+		st := pipelineStage{kernel: k}
+		for _, kind := range k.args {
+			if i == len(items) {
+				return nil, fmt.Errorf("stage %d: %s needs %d arguments", n, name, len(k.args))
+			}
+			v, ok := pipelineArg(kind, items[i])
+			if !ok {
+				return nil, fmt.Errorf("stage %d: %s: expected a %s, got %s", n, name, kind, items[i].Inspect(*ps.Idx))
+			}
+			st.args = append(st.args, v...)
+			i++
+		}
+		p.stages = append(p.stages, st)
+		if i == len(items) {
+			break
+		}
+		if pw, ok := items[i].(env.Pipeword); !ok || strings.TrimPrefix(ps.Idx.GetWord(pw.Index), "_") != "->" {
+			return nil, fmt.Errorf("stage %d: expected -> after %s, got %s", n, name, items[i].Inspect(*ps.Idx))
+		}
+		if i++; i == len(items) {
+			return nil, fmt.Errorf("stage %d: missing stage after ->", n+1)
+		}
+	}
+	if len(p.stages) == 0 {
+		return nil, errors.New("no stages")
+	}
+	return p, nil
+}
+
+var builtinsPipeline = map[string]*env.Builtin{
+	"compute-pipeline": {
+		Doc:   "Create a pipeline of compute kernels from a block like { blur 4 -> brightness 1.2 -> resize 512 512 }: blur (gaussian-blur) sigma, box-blur radius, brightness k, color-matrix { 20 numbers } and resize width height",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			blk, ok := arg0.(env.Block)
+			if !ok {
+				return argError(ps, "compute-pipeline", 1, "block", arg0)
+			}
+			p, perr := parsePipeline(ps, blk)
+			if perr != nil {
+				return failure(ps, "compute-pipeline", perr.Error())
+			}
+			return *env.NewNative(ps.Idx, p, "Go(*gioui_org.Pipeline)")
+		},
+	},
+	"Go(*gioui_org.Pipeline)//run": {
+		Doc:   "Run the pipeline on an image (native or file path), reusing the images between stages",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Pipeline](ps, "Go(*gioui_org.Pipeline)//run", 1, arg0)
+			if err != nil {
+				return err
+			}
+			img, err := rgbaArg(ps, "Go(*gioui_org.Pipeline)//run", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return rgbaObj(ps, p.Run(img))
+		},
+	},
+}
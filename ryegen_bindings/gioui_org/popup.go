@@ -0,0 +1,286 @@
+// Popups anchored to a widget.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"strings"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// placement is where a popup goes next to its anchor: a side (top, bottom,
+// left or right) and an alignment along it (-1 start, 0 center, 1 end).
+type placement struct {
+	side  string
+	align int
+}
+
+// parsePlacement reads a placement like bottom-start, right or top-end.
+func parsePlacement(s string) (placement, bool) {
+	side, align, _ := strings.Cut(s, "-")
+	p := placement{side: side}
+	switch side {
+	case "top", "bottom", "left", "right":
+	default:
+		return p, false
+	}
+	switch align {
+	case "start":
+		p.align = -1
+	case "end":
+		p.align = 1
+	case "":
+	default:
+		return p, false
+	}
+	return p, true
+}
+
+func (p placement) vertical() bool { return p.side == "top" || p.side == "bottom" }
+
+// placePopup returns where a popup of size goes next to anchor, gap apart;
+// both are relative to the space avail given to the anchor. With flip a
+// popup that doesn't fit below or right of the anchor goes to the other
+// side. Along the side it is kept within avail.
+func placePopup(anchor image.Rectangle, size, avail image.Point, pl placement, gap int, flip bool) image.Point {
+	var at image.Point
+	switch pl.side {
+	case "bottom":
+		at.Y = anchor.Max.Y + gap
+		if flip && at.Y+size.Y > avail.Y {
+			at.Y = anchor.Min.Y - gap - size.Y
+		}
+	case "top":
+		at.Y = anchor.Min.Y - gap - size.Y
+	case "right":
+		at.X = anchor.Max.X + gap
+		if flip && at.X+size.X > avail.X {
+			at.X = anchor.Min.X - gap - size.X
+		}
+	case "left":
+		at.X = anchor.Min.X - gap - size.X
+	}
+	align := func(lo, hi, size, limit int) int {
+		var v int
+		switch pl.align {
+		case -1:
+			v = lo
+		case 0:
+			v = (lo+hi)/2 - size/2
+		case 1:
+			v = hi - size
+		}
+		return max(min(v, limit-size), 0)
+	}
+	if pl.vertical() {
+		at.X = align(anchor.Min.X, anchor.Max.X, size.X, avail.X)
+	} else {
+		at.Y = align(anchor.Min.Y, anchor.Max.Y, size.Y, avail.Y)
+	}
+	return at
+}
+
+// Popup shows Content next to Anchor while open, on top of everything else.
+// It follows the anchor as it scrolls, and closes on a press outside it or
+// Escape.
+type Popup struct {
+	ps        *env.ProgramState
+	Anchor    layout.Widget
+	Content   layout.Widget
+	Placement placement
+	Gap       unit.Dp
+	Flip      bool
+	open      bool
+	onDismiss *env.Function
+	overlay   int // tag of the area dismissing the popup
+}
+
+func (p *Popup) dismiss() {
+	p.open = false
+	if p.onDismiss != nil {
+		callFunction(p.ps, "on-dismiss", *p.onDismiss)
+	}
+}
+
+func (p *Popup) update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(
+			pointer.Filter{Target: &p.overlay, Kinds: pointer.Press},
+			key.Filter{Name: key.NameEscape},
+		)
+		if !ok {
+			break
+		}
+		if e, ok := e.(key.Event); ok && e.State != key.Press {
+			continue
+		}
+		if p.open {
+			p.dismiss()
+		}
+	}
+	// Presses on the popup must not reach the overlay.
+	for {
+		if _, ok := gtx.Event(pointer.Filter{Target: p, Kinds: pointer.Press}); !ok {
+			break
+		}
+	}
+}
+
+func (p *Popup) Layout(gtx layout.Context) layout.Dimensions {
+	p.update(gtx)
+	avail := gtx.Constraints.Max
+	dims := p.Anchor(gtx)
+	if p.open {
+		macro := op.Record(gtx.Ops)
+		p.layoutPopup(gtx, dims.Size, avail)
+		deferLayer(gtx.Ops, layerOverlay, macro.Stop())
+	}
+	return dims
+}
+
+func (p *Popup) layoutPopup(gtx layout.Context, size, avail image.Point) {
+	const far = 1 << 20
+	st := clip.Rect(image.Rect(-far, -far, far, far)).Push(gtx.Ops)
+	event.Op(gtx.Ops, &p.overlay)
+	st.Pop()
+	gtx.Constraints = layout.Constraints{Max: avail}
+	macro := op.Record(gtx.Ops)
+	dims := p.Content(gtx)
+	content := macro.Stop()
+	at := placePopup(image.Rectangle{Max: size}, dims.Size, avail, p.Placement, gtx.Dp(p.Gap), p.Flip)
+	defer op.Offset(at).Push(gtx.Ops).Pop()
+	area := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+	event.Op(gtx.Ops, p)
+	content.Add(gtx.Ops)
+	area.Pop()
+}
+
+// popupState returns a builtin changing whether a popup is open.
+func popupState(method, doc string, open func(p *Popup) bool) *env.Builtin {
+	name := "Go(*gioui_org.Popup)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Popup](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			p.open = open(p)
+			return arg0
+		},
+	}
+}
+
+var builtinsPopup = map[string]*env.Builtin{
+	"popup": {
+		Doc:   "Create a popup showing a content widget next to an anchor widget while open, below it and aligned to its start by default",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			anchor, err := widgetArg(ps, "popup", 1, arg0)
+			if err != nil {
+				return err
+			}
+			content, err := widgetArg(ps, "popup", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p := &Popup{ps: ps, Anchor: anchor, Content: content, Placement: placement{side: "bottom", align: -1}, Gap: 4, Flip: true}
+			return *env.NewNative(ps.Idx, p, "Go(*gioui_org.Popup)")
+		},
+	},
+	"Go(*gioui_org.Popup)//layout": layoutBuiltin[*Popup]("Go(*gioui_org.Popup)//layout"),
+	"Go(*gioui_org.Popup)//placement!": {
+		Doc:   "Set where the popup goes: 'bottom, 'top, 'left or 'right of the anchor, optionally aligned to its start or end ('bottom-start, 'right-end)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Popup](ps, "Go(*gioui_org.Popup)//placement!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := nameArg(ps, "Go(*gioui_org.Popup)//placement!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			pl, ok := parsePlacement(s)
+			if !ok {
+				return failure(ps, "Go(*gioui_org.Popup)//placement!", "unknown placement "+s+" (a side top, bottom, left or right, optionally followed by -start or -end)")
+			}
+			p.Placement = pl
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Popup)//flip!": {
+		Doc:   "Set whether a popup that doesn't fit below or right of the anchor goes to the other side (true by default)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Popup](ps, "Go(*gioui_org.Popup)//flip!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, err := integerArg(ps, "Go(*gioui_org.Popup)//flip!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.Flip = b != 0
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Popup)//gap!": {
+		Doc:   "Set the space between the anchor and the popup in dp (4 by default)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Popup](ps, "Go(*gioui_org.Popup)//gap!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			d, err := decimalArg(ps, "Go(*gioui_org.Popup)//gap!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.Gap = unit.Dp(d)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Popup)//on-dismiss!": {
+		Doc:   "Set a function called when the popup closes by a press outside it or Escape",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Popup](ps, "Go(*gioui_org.Popup)//on-dismiss!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Popup)//on-dismiss!", 2, 0, arg1)
+			if err != nil {
+				return err
+			}
+			p.onDismiss = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Popup)//open!":   popupState("open!", "Show the popup", func(p *Popup) bool { return true }),
+	"Go(*gioui_org.Popup)//close!":  popupState("close!", "Hide the popup", func(p *Popup) bool { return false }),
+	"Go(*gioui_org.Popup)//toggle!": popupState("toggle!", "Show the popup if hidden, else hide it", func(p *Popup) bool { return !p.open }),
+	"Go(*gioui_org.Popup)//open?": {
+		Doc:   "Check whether the popup is shown",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Popup](ps, "Go(*gioui_org.Popup)//open?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(p.open))
+		},
+	},
+}
@@ -0,0 +1,251 @@
+// Serving rendered frames over HTTP for remote preview.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// previewPage shows the latest frame, asking for the next one as soon as
+// the previous has arrived.
+const previewPage = `<!DOCTYPE html>
+<html><head><title>rye-gio preview</title>
+<style>body{margin:0;background:#333}img{display:block;margin:auto}</style></head>
+<body><img id="f">
+<script>
+const f = document.getElementById("f");
+(async () => {
+	let seq = 0;
+	for (;;) {
+		try {
+			const r = await fetch("frame.png?after=" + seq, {cache: "no-store"});
+			if (!r.ok) throw r.status;
+			seq = Number(r.headers.get("X-Frame"));
+			const u = URL.createObjectURL(await r.blob());
+			f.onload = () => URL.revokeObjectURL(u);
+			f.src = u;
+		} catch (e) {
+			await new Promise(ok => setTimeout(ok, 1000));
+		}
+	}
+})();
+</script></body></html>
+`
+
+// PreviewServer serves the frames published to it on an HTTP address: the
+// page at / shows them live and /frame.png is the latest one. A request for
+// frame.png?after=n waits for a frame numbered above n; the number of the
+// returned frame is in the X-Frame header.
+type PreviewServer struct {
+	Addr     string
+	Interval time.Duration
+	mu       sync.Mutex
+	cond     *sync.Cond
+	frame    []byte
+	seq      int
+	last     time.Time
+}
+
+// newPreviewServer listens on addr and serves the frames in the background.
+// An address without a host, like ":8080", listens on 127.0.0.1 only, as
+// the frames are screenshots of the app served without authentication;
+// "0.0.0.0:8080" serves them to the network.
+func newPreviewServer(addr string) (*PreviewServer, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &PreviewServer{Addr: ln.Addr().String(), Interval: 100 * time.Millisecond}
+	s.cond = sync.NewCond(&s.mu)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, previewPage)
+	})
+	mux.HandleFunc("/frame.png", s.serveFrame)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			fmt.Printf("\033[31mError: \033[1mpreview-server: %v\033[m\n", err)
+		}
+	}()
+	return s, nil
+}
+
+func (s *PreviewServer) serveFrame(w http.ResponseWriter, r *http.Request) {
+	after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+	s.mu.Lock()
+	// Wait for a newer frame, but not forever, so a stalled app still
+	// answers with the last one.
+	timeout := time.AfterFunc(5*time.Second, s.cond.Broadcast)
+	for s.frame == nil || s.seq <= after {
+		s.cond.Wait()
+		if !timeout.Stop() {
+			break
+		}
+		timeout.Reset(5 * time.Second)
+	}
+	timeout.Stop()
+	frame, seq := s.frame, s.seq
+	s.mu.Unlock()
+	if frame == nil {
+		http.Error(w, "no frame yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame", strconv.Itoa(seq))
+	w.Write(frame)
+}
+
+// Publish renders the frame laid out in gtx and makes it the latest one,
+// at most once per Interval.
+func (s *PreviewServer) Publish(gtx layout.Context) error {
+	if gtx.Now.Sub(s.last) < s.Interval {
+		return nil
+	}
+	s.last = gtx.Now
+	img, err := captureFrame(gtx)
+	if err != nil {
+		return err
+	}
+	return s.publishImage(img)
+}
+
+func (s *PreviewServer) publishImage(img image.Image) error {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&buf, img); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.frame = buf.Bytes()
+	s.seq++
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return nil
+}
+
+// Run lays out frames of size w×h with draw, without a window, and
+// publishes them. It doesn't return; it's meant for machines with no
+// display.
+func (s *PreviewServer) Run(ps *env.ProgramState, w, h int, draw env.Function) error {
+	var ops op.Ops
+	for {
+		ops.Reset()
+		gtx := layout.Context{
+			Ops:         &ops,
+			Now:         time.Now(),
+			Metric:      unit.Metric{PxPerDp: 1, PxPerSp: 1},
+			Constraints: layout.Exact(image.Pt(w, h)),
+		}
+		callFunction(ps, "preview-server run", draw, *env.NewNative(ps.Idx, &gtx, "Go(*layout.Context)"))
+		if err := s.Publish(gtx); err != nil {
+			return err
+		}
+		time.Sleep(time.Until(gtx.Now.Add(s.Interval)))
+	}
+}
+
+var builtinsPreview = map[string]*env.Builtin{
+	"preview-server": {
+		Doc:   "Start serving published frames on an HTTP address like \":8080\", viewable in a browser; without a host it listens on 127.0.0.1 only, \"0.0.0.0:8080\" serves the network without authentication",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			addr, err := stringArg(ps, "preview-server", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, serr := newPreviewServer(addr)
+			if serr != nil {
+				return failure(ps, "preview-server", serr.Error())
+			}
+			return *env.NewNative(ps.Idx, s, "Go(*gioui_org.PreviewServer)")
+		},
+	},
+	"Go(*gioui_org.PreviewServer)//publish": {
+		Doc:   "Publish the frame laid out so far, at most ten times a second; call before submitting the frame",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*PreviewServer](ps, "Go(*gioui_org.PreviewServer)//publish", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.PreviewServer)//publish", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if perr := s.Publish(gtx); perr != nil {
+				return failure(ps, "Go(*gioui_org.PreviewServer)//publish", perr.Error())
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PreviewServer)//rate!": {
+		Doc:   "Set the maximum number of frames published per second",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*PreviewServer](ps, "Go(*gioui_org.PreviewServer)//rate!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fps, err := decimalArg(ps, "Go(*gioui_org.PreviewServer)//rate!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if fps <= 0 {
+				return failure(ps, "Go(*gioui_org.PreviewServer)//rate!", "rate must be positive")
+			}
+			s.Interval = time.Duration(float64(time.Second) / fps)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.PreviewServer)//run": {
+		Doc:   "Without opening a window, lay out frames of width and height with a function of the layout context and publish them; doesn't return",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*PreviewServer](ps, "Go(*gioui_org.PreviewServer)//run", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := integerArg(ps, "Go(*gioui_org.PreviewServer)//run", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h, err := integerArg(ps, "Go(*gioui_org.PreviewServer)//run", 3, arg2)
+			if err != nil {
+				return err
+			}
+			draw, err := functionArg(ps, "Go(*gioui_org.PreviewServer)//run", 4, 1, arg3)
+			if err != nil {
+				return err
+			}
+			if rerr := s.Run(ps, int(w), int(h), draw); rerr != nil {
+				return failure(ps, "Go(*gioui_org.PreviewServer)//run", rerr.Error())
+			}
+			return arg0
+		},
+	},
+}
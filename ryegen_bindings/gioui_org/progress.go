@@ -0,0 +1,335 @@
+// Progress indicators and skeleton loaders.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Progress is a progress value shared between a background task and the
+// widgets displaying it. A negative value means indeterminate progress.
+type Progress struct {
+	mu    sync.Mutex
+	value float64
+	win   *app.Window
+}
+
+// Set updates the value and invalidates the bound window, if any.
+func (p *Progress) Set(v float64) {
+	p.mu.Lock()
+	p.value = v
+	win := p.win
+	p.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+func (p *Progress) Value() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.value
+}
+
+// Indeterminate reports whether the progress is unknown.
+func (p *Progress) Indeterminate() bool {
+	return p.Value() < 0
+}
+
+// indeterminateCycle is the duration of one indeterminate animation cycle.
+const indeterminateCycle = 1500 * time.Millisecond
+
+// animationPhase returns the position in [0, 1) of gtx.Now within a cycle of
+// length d and schedules the next frame.
+func animationPhase(gtx layout.Context, d time.Duration) float32 {
+	animateFrame(gtx)
+	return float32(gtx.Now.UnixNano()%int64(d)) / float32(d)
+}
+
+// ProgressBar is a horizontal bar that shows either the fraction of a
+// Progress or, when indeterminate, a sliding segment.
+type ProgressBar struct {
+	Progress   *Progress
+	Color      color.NRGBA
+	TrackColor color.NRGBA
+	Height     unit.Dp
+	Radius     unit.Dp
+}
+
+func (b *ProgressBar) Layout(gtx layout.Context) layout.Dimensions {
+	if !b.Progress.Indeterminate() {
+		return material.ProgressBarStyle{
+			Color:      b.Color,
+			TrackColor: b.TrackColor,
+			Height:     b.Height,
+			Radius:     b.Radius,
+			Progress:   float32(b.Progress.Value()),
+		}.Layout(gtx)
+	}
+	width := gtx.Constraints.Max.X
+	size := image.Pt(width, gtx.Dp(b.Height))
+	rr := gtx.Dp(b.Radius)
+	defer clip.UniformRRect(image.Rectangle{Max: size}, rr).Push(gtx.Ops).Pop()
+	paint.ColorOp{Color: b.TrackColor}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+
+	// The segment is 30% of the width and travels from fully hidden on
+	// the left to fully hidden on the right.
+	seg := width * 3 / 10
+	x := int(animationPhase(gtx, indeterminateCycle)*float32(width+seg)) - seg
+	fill := clip.UniformRRect(image.Rect(x, 0, x+seg, size.Y), rr).Push(gtx.Ops)
+	paint.ColorOp{Color: b.Color}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	fill.Pop()
+	return layout.Dimensions{Size: size}
+}
+
+// ProgressSpinner is a circular indicator; an arc for determinate progress
+// and a rotating loader otherwise.
+type ProgressSpinner struct {
+	Progress *Progress
+	Color    color.NRGBA
+}
+
+func (s *ProgressSpinner) Layout(gtx layout.Context) layout.Dimensions {
+	if s.Progress.Indeterminate() {
+		return material.LoaderStyle{Color: s.Color}.Layout(gtx)
+	}
+	return material.ProgressCircleStyle{Color: s.Color, Progress: float32(s.Progress.Value())}.Layout(gtx)
+}
+
+// Skeleton is a placeholder block with a shimmer, shown while content loads.
+type Skeleton struct {
+	Width     unit.Dp
+	Height    unit.Dp
+	Radius    unit.Dp
+	Color     color.NRGBA
+	Highlight color.NRGBA
+}
+
+func (s *Skeleton) Layout(gtx layout.Context) layout.Dimensions {
+	size := gtx.Constraints.Constrain(image.Pt(gtx.Dp(s.Width), gtx.Dp(s.Height)))
+	defer clip.UniformRRect(image.Rectangle{Max: size}, gtx.Dp(s.Radius)).Push(gtx.Ops).Pop()
+	paint.ColorOp{Color: s.Color}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+
+	// The shimmer is a band fading in and out of the highlight color,
+	// sweeping across the block.
+	band := float32(size.X) / 2
+	if band < 1 {
+		return layout.Dimensions{Size: size}
+	}
+	x := animationPhase(gtx, indeterminateCycle)*(float32(size.X)+band) - band
+	mid := x + band/2
+	shimmer := func(x0, x1 float32, c0, c1 color.NRGBA) {
+		area := clip.Rect(image.Rect(int(math.Floor(float64(x0))), 0, int(math.Ceil(float64(x1))), size.Y)).Push(gtx.Ops)
+		paint.LinearGradientOp{Stop1: f32.Pt(x0, 0), Stop2: f32.Pt(x1, 0), Color1: c0, Color2: c1}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		area.Pop()
+	}
+	transparent := s.Highlight
+	transparent.A = 0
+	shimmer(x, mid, transparent, s.Highlight)
+	shimmer(mid, x+band, s.Highlight, transparent)
+	return layout.Dimensions{Size: size}
+}
+
+func mulAlpha(c color.NRGBA, alpha uint8) color.NRGBA {
+	c.A = uint8(uint32(c.A) * uint32(alpha) / 0xFF)
+	return c
+}
+
+var builtinsProgress = map[string]*env.Builtin{
+	"progress": {
+		Doc:   "Create a progress value (0.0 - 1.0, negative for indeterminate) that can be updated from other goroutines",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := decimalArg(ps, "progress", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &Progress{value: v}, "Go(*gioui_org.Progress)")
+		},
+	},
+	"Go(*gioui_org.Progress)//value!": {
+		Doc:   "Set progress value (0.0 - 1.0, negative for indeterminate)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Progress](ps, "Go(*gioui_org.Progress)//value!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := decimalArg(ps, "Go(*gioui_org.Progress)//value!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.Set(v)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Progress)//value?": {
+		Doc:   "Get progress value",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Progress](ps, "Go(*gioui_org.Progress)//value?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewDecimal(p.Value())
+		},
+	},
+	"Go(*gioui_org.Progress)//indeterminate!": {
+		Doc:   "Mark progress as indeterminate",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Progress](ps, "Go(*gioui_org.Progress)//indeterminate!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			p.Set(-1)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Progress)//indeterminate?": {
+		Doc:   "Check whether progress is indeterminate",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Progress](ps, "Go(*gioui_org.Progress)//indeterminate?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(p.Indeterminate()))
+		},
+	},
+	"Go(*gioui_org.Progress)//window!": {
+		Doc:   "Bind a window that is redrawn whenever the progress value changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			p, err := nativeArg[*Progress](ps, "Go(*gioui_org.Progress)//window!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			win, err := nativeArg[*app.Window](ps, "Go(*gioui_org.Progress)//window!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			p.mu.Lock()
+			p.win = win
+			p.mu.Unlock()
+			return arg0
+		},
+	},
+	"progress-bar": {
+		Doc:   "Progress bar widget showing a progress value, animated when indeterminate",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "progress-bar", 1, arg0)
+			if err != nil {
+				return err
+			}
+			p, err := nativeArg[*Progress](ps, "progress-bar", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &ProgressBar{
+				Progress:   p,
+				Color:      th.Palette.ContrastBg,
+				TrackColor: mulAlpha(th.Palette.Fg, 0x88),
+				Height:     unit.Dp(4),
+				Radius:     unit.Dp(2),
+			}, "Go(*gioui_org.ProgressBar)")
+		},
+	},
+	"Go(*gioui_org.ProgressBar)//layout": layoutBuiltin[*ProgressBar]("Go(*gioui_org.ProgressBar)//layout"),
+	"Go(*gioui_org.ProgressBar)//color!": {
+		Doc:   "Set progress bar fill color",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*ProgressBar](ps, "Go(*gioui_org.ProgressBar)//color!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.ProgressBar)//color!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			b.Color = c
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ProgressBar)//height!": {
+		Doc:   "Set progress bar height in dp",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			b, err := nativeArg[*ProgressBar](ps, "Go(*gioui_org.ProgressBar)//height!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			h, err := decimalArg(ps, "Go(*gioui_org.ProgressBar)//height!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			b.Height = unit.Dp(h)
+			b.Radius = unit.Dp(h / 2)
+			return arg0
+		},
+	},
+	"progress-spinner": {
+		Doc:   "Circular progress widget showing a progress value, spinning when indeterminate",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "progress-spinner", 1, arg0)
+			if err != nil {
+				return err
+			}
+			p, err := nativeArg[*Progress](ps, "progress-spinner", 2, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &ProgressSpinner{Progress: p, Color: th.Palette.ContrastBg}, "Go(*gioui_org.ProgressSpinner)")
+		},
+	},
+	"Go(*gioui_org.ProgressSpinner)//layout": layoutBuiltin[*ProgressSpinner]("Go(*gioui_org.ProgressSpinner)//layout"),
+	"skeleton": {
+		Doc:   "Shimmering placeholder block of the given width and height in dp",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "skeleton", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := decimalArg(ps, "skeleton", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h, err := decimalArg(ps, "skeleton", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &Skeleton{
+				Width:     unit.Dp(w),
+				Height:    unit.Dp(h),
+				Radius:    unit.Dp(4),
+				Color:     mulAlpha(th.Palette.Fg, 0x20),
+				Highlight: mulAlpha(th.Palette.Bg, 0xa0),
+			}, "Go(*gioui_org.Skeleton)")
+		},
+	},
+	"Go(*gioui_org.Skeleton)//layout": layoutBuiltin[*Skeleton]("Go(*gioui_org.Skeleton)//layout"),
+}
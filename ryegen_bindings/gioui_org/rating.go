@@ -0,0 +1,462 @@
+// Rating and toggle-button-group widgets.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Rating is a star-rating input. Clicking the currently selected star
+// clears the rating.
+type Rating struct {
+	ps       *env.ProgramState
+	Max      int
+	Value    int
+	Size     unit.Dp
+	Color    color.NRGBA
+	Empty    color.NRGBA
+	stars    []widget.Clickable
+	bind     *binding
+	onChange *env.Function
+}
+
+func (r *Rating) set(v int) {
+	if v == r.Value {
+		return
+	}
+	r.Value = v
+	r.bind.set(*env.NewInteger(int64(v)))
+	if r.onChange != nil {
+		callFunction(r.ps, "rating on-change", *r.onChange, *env.NewInteger(int64(v)))
+	}
+}
+
+func (r *Rating) Layout(gtx layout.Context) layout.Dimensions {
+	if len(r.stars) != r.Max {
+		r.stars = make([]widget.Clickable, r.Max)
+	}
+	hovered := -1
+	for i := range r.stars {
+		for r.stars[i].Clicked(gtx) {
+			if r.Value == i+1 {
+				r.set(0)
+			} else {
+				r.set(i + 1)
+			}
+		}
+		if r.stars[i].Hovered() {
+			hovered = i
+		}
+	}
+	children := make([]layout.FlexChild, r.Max)
+	for i := range r.stars {
+		children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return r.stars[i].Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				c := r.Empty
+				switch {
+				case hovered >= 0 && i <= hovered:
+					c = mulAlpha(r.Color, 0xaa)
+				case hovered < 0 && i < r.Value:
+					c = r.Color
+				}
+				d := gtx.Dp(r.Size)
+				paint.FillShape(gtx.Ops, c, clip.Outline{Path: starPath(gtx, float32(d))}.Op())
+				return layout.Dimensions{Size: image.Pt(d, d)}
+			})
+		})
+	}
+	return layout.Flex{}.Layout(gtx, children...)
+}
+
+// starPath returns a five-pointed star inscribed in a square of size d.
+func starPath(gtx layout.Context, d float32) clip.PathSpec {
+	var p clip.Path
+	p.Begin(gtx.Ops)
+	c := d / 2
+	for i := 0; i < 10; i++ {
+		r := c
+		if i%2 == 1 {
+			r = c * 0.4
+		}
+		a := -math.Pi/2 + float64(i)*math.Pi/5
+		pt := f32.Pt(c+r*float32(math.Cos(a)), c+r*float32(math.Sin(a)))
+		if i == 0 {
+			p.MoveTo(pt)
+		} else {
+			p.LineTo(pt)
+		}
+	}
+	p.Close()
+	return p.End()
+}
+
+// ToggleGroup is a segmented row of buttons where either exactly one
+// (exclusive) or any number (multi) of them can be selected.
+type ToggleGroup struct {
+	ps       *env.ProgramState
+	Theme    *material.Theme
+	Labels   []string
+	Multi    bool
+	selected []bool
+	buttons  []widget.Clickable
+	bind     *binding
+	onChange *env.Function
+}
+
+// value returns the selected index (-1 for none) in exclusive mode, or a
+// block of selected indexes in multi mode.
+func (g *ToggleGroup) value() env.Object {
+	if !g.Multi {
+		for i, s := range g.selected {
+			if s {
+				return *env.NewInteger(int64(i))
+			}
+		}
+		return *env.NewInteger(-1)
+	}
+	var res []env.Object
+	for i, s := range g.selected {
+		if s {
+			res = append(res, *env.NewInteger(int64(i)))
+		}
+	}
+	return *env.NewBlock(*env.NewTSeries(res))
+}
+
+func (g *ToggleGroup) toggle(i int) {
+	if g.Multi {
+		g.selected[i] = !g.selected[i]
+	} else {
+		for j := range g.selected {
+			g.selected[j] = j == i
+		}
+	}
+	g.changed()
+}
+
+func (g *ToggleGroup) changed() {
+	v := g.value()
+	g.bind.set(v)
+	if g.onChange != nil {
+		callFunction(g.ps, "toggle-group on-change", *g.onChange, v)
+	}
+}
+
+func (g *ToggleGroup) Layout(gtx layout.Context) layout.Dimensions {
+	for i := range g.buttons {
+		for g.buttons[i].Clicked(gtx) {
+			g.toggle(i)
+		}
+	}
+	th := g.Theme
+	children := make([]layout.FlexChild, len(g.Labels))
+	for i := range g.Labels {
+		children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return g.buttons[i].Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return g.layoutSegment(gtx, i)
+			})
+		})
+	}
+	return widget.Border{Color: mulAlpha(th.Palette.Fg, 0x60), CornerRadius: 4, Width: 1}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{}.Layout(gtx, children...)
+	})
+}
+
+func (g *ToggleGroup) layoutSegment(gtx layout.Context, i int) layout.Dimensions {
+	th := g.Theme
+	lbl := material.Body2(th, g.Labels[i])
+	if g.selected[i] {
+		lbl.Color = th.Palette.ContrastFg
+	}
+	macro := op.Record(gtx.Ops)
+	dims := layout.Inset{Left: 12, Right: 12, Top: 6, Bottom: 6}.Layout(gtx, lbl.Layout)
+	content := macro.Stop()
+	switch {
+	case g.selected[i]:
+		paint.FillShape(gtx.Ops, th.Palette.ContrastBg, clip.Rect{Max: dims.Size}.Op())
+	case g.buttons[i].Hovered():
+		paint.FillShape(gtx.Ops, mulAlpha(th.Palette.Fg, 0x18), clip.Rect{Max: dims.Size}.Op())
+	}
+	content.Add(gtx.Ops)
+	return dims
+}
+
+var builtinsRating = map[string]*env.Builtin{
+	"rating": {
+		Doc:   "Create a star rating input with the given number of stars",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "rating", 1, arg0)
+			if err != nil {
+				return err
+			}
+			max, err := integerArg(ps, "rating", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if max < 1 {
+				return failure(ps, "rating", "arg 2: expected at least one star")
+			}
+			return *env.NewNative(ps.Idx, &Rating{
+				ps:    ps,
+				Max:   int(max),
+				Size:  unit.Dp(24),
+				Color: color.NRGBA{R: 0xff, G: 0xb3, B: 0x00, A: 0xff},
+				Empty: mulAlpha(th.Palette.Fg, 0x40),
+			}, "Go(*gioui_org.Rating)")
+		},
+	},
+	"Go(*gioui_org.Rating)//layout": layoutBuiltin[*Rating]("Go(*gioui_org.Rating)//layout"),
+	"Go(*gioui_org.Rating)//value?": {
+		Doc:   "Get the rating (0 for none)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Rating](ps, "Go(*gioui_org.Rating)//value?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(int64(r.Value))
+		},
+	},
+	"Go(*gioui_org.Rating)//value!": {
+		Doc:   "Set the rating",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Rating](ps, "Go(*gioui_org.Rating)//value!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.Rating)//value!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if v < 0 || int(v) > r.Max {
+				return failure(ps, "Go(*gioui_org.Rating)//value!", "arg 2: rating out of range")
+			}
+			r.set(int(v))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Rating)//size!": {
+		Doc:   "Set star size in dp",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Rating](ps, "Go(*gioui_org.Rating)//size!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := decimalArg(ps, "Go(*gioui_org.Rating)//size!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			r.Size = unit.Dp(v)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Rating)//color!": {
+		Doc:   "Set color of selected stars",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Rating](ps, "Go(*gioui_org.Rating)//color!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.Rating)//color!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			r.Color = c
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Rating)//bind!": {
+		Doc:   "Bind the rating to a word that is updated whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Rating](ps, "Go(*gioui_org.Rating)//bind!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, err := bindingArg(ps, "Go(*gioui_org.Rating)//bind!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			r.bind = b
+			b.set(*env.NewInteger(int64(r.Value)))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Rating)//on-change!": {
+		Doc:   "Set function called with the new rating whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Rating](ps, "Go(*gioui_org.Rating)//on-change!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Rating)//on-change!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			r.onChange = &fn
+			return arg0
+		},
+	},
+	"toggle-group": {
+		Doc:   "Create a segmented group of toggle buttons from a block of labels (exclusive by default)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "toggle-group", 1, arg0)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg1.(env.Block)
+			if !ok {
+				return argError(ps, "toggle-group", 2, "block of strings", arg1)
+			}
+			g := &ToggleGroup{ps: ps, Theme: th}
+			for _, o := range blk.Series.S {
+				s, err := stringArg(ps, "toggle-group", 2, o)
+				if err != nil {
+					return err
+				}
+				g.Labels = append(g.Labels, s)
+			}
+			g.selected = make([]bool, len(g.Labels))
+			g.buttons = make([]widget.Clickable, len(g.Labels))
+			return *env.NewNative(ps.Idx, g, "Go(*gioui_org.ToggleGroup)")
+		},
+	},
+	"Go(*gioui_org.ToggleGroup)//layout": layoutBuiltin[*ToggleGroup]("Go(*gioui_org.ToggleGroup)//layout"),
+	"Go(*gioui_org.ToggleGroup)//multi!": {
+		Doc:   "Allow selecting any number of buttons (1) or exactly one (0), which keeps only the first selected",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*ToggleGroup](ps, "Go(*gioui_org.ToggleGroup)//multi!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v, err := integerArg(ps, "Go(*gioui_org.ToggleGroup)//multi!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if g.Multi == (v != 0) {
+				return arg0
+			}
+			g.Multi = v != 0
+			if !g.Multi {
+				// Keep the first selected button only.
+				first := slices.Index(g.selected, true)
+				for i := range g.selected {
+					g.selected[i] = i == first
+				}
+			}
+			// The value changes form between an index and a block.
+			g.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ToggleGroup)//value?": {
+		Doc:   "Get the selected index (-1 for none), or a block of selected indexes in multi mode",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*ToggleGroup](ps, "Go(*gioui_org.ToggleGroup)//value?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return g.value()
+		},
+	},
+	"Go(*gioui_org.ToggleGroup)//value!": {
+		Doc:   "Set the selected index, or a block of selected indexes in multi mode",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*ToggleGroup](ps, "Go(*gioui_org.ToggleGroup)//value!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			var idxs []env.Object
+			switch v := arg1.(type) {
+			case env.Integer:
+				idxs = []env.Object{v}
+			case env.Block:
+				idxs = v.Series.S
+			default:
+				return argError(ps, "Go(*gioui_org.ToggleGroup)//value!", 2, "integer or block of integers", arg1)
+			}
+			sel := make([]bool, len(g.selected))
+			n := 0
+			for _, o := range idxs {
+				i, err := integerArg(ps, "Go(*gioui_org.ToggleGroup)//value!", 2, o)
+				if err != nil {
+					return err
+				}
+				if i == -1 {
+					continue
+				}
+				if i < 0 || int(i) >= len(sel) {
+					return failure(ps, "Go(*gioui_org.ToggleGroup)//value!", "arg 2: index out of range")
+				}
+				if !sel[i] {
+					sel[i] = true
+					n++
+				}
+			}
+			if n > 1 && !g.Multi {
+				return failure(ps, "Go(*gioui_org.ToggleGroup)//value!", "arg 2: only one index can be selected outside multi mode")
+			}
+			g.selected = sel
+			g.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ToggleGroup)//bind!": {
+		Doc:   "Bind the selection to a word that is updated whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*ToggleGroup](ps, "Go(*gioui_org.ToggleGroup)//bind!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, err := bindingArg(ps, "Go(*gioui_org.ToggleGroup)//bind!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			g.bind = b
+			b.set(g.value())
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ToggleGroup)//on-change!": {
+		Doc:   "Set function called with the new selection whenever it changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			g, err := nativeArg[*ToggleGroup](ps, "Go(*gioui_org.ToggleGroup)//on-change!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.ToggleGroup)//on-change!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			g.onChange = &fn
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,260 @@
+// Recording the window to animated GIF or WebM.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gioui.org/layout"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Recorder captures frames of a window for a duration and writes them to
+// Path, as an animated GIF or, for a .webm path, a WebM video encoded by
+// ffmpeg. Frames are handed to an encoder running in the background as
+// they are captured, rather than kept until the end.
+type Recorder struct {
+	Path     string
+	Duration time.Duration
+	Interval time.Duration
+	frames   chan recordedFrame // to the encoder, nil until the first frame
+	last     time.Time          // of the last frame captured
+	start    time.Time
+	stopped  bool
+	done     atomic.Bool
+}
+
+// recordedFrame is a captured frame and when it was laid out. The frame
+// ending a recording has no image.
+type recordedFrame struct {
+	img *image.RGBA
+	at  time.Time
+}
+
+// Capture grabs the frame laid out in gtx if a frame interval has passed,
+// and saves the recording once its duration is reached. It keeps the
+// window redrawing while recording.
+func (r *Recorder) Capture(gtx layout.Context) error {
+	if r.stopped {
+		return nil
+	}
+	if r.start.IsZero() {
+		r.start = gtx.Now
+	}
+	if gtx.Now.Sub(r.start) >= r.Duration {
+		r.Stop()
+		return nil
+	}
+	animateFrame(gtx)
+	if !r.last.IsZero() && gtx.Now.Sub(r.last) < r.Interval {
+		return nil
+	}
+	img, err := captureFrame(gtx)
+	if err != nil {
+		return err
+	}
+	if r.frames == nil {
+		r.startEncoder()
+	}
+	// Waits for the encoder when it falls behind, slowing the frames down
+	// rather than queueing them up.
+	r.frames <- recordedFrame{img, gtx.Now}
+	r.last = gtx.Now
+	return nil
+}
+
+// startEncoder starts writing the file from the frames sent to r.frames.
+func (r *Recorder) startEncoder() {
+	r.frames = make(chan recordedFrame, 4)
+	go func() {
+		defer r.done.Store(true)
+		var err error
+		if strings.EqualFold(filepath.Ext(r.Path), ".webm") {
+			err = writeWebM(r.Path, r.frames, r.Interval)
+		} else {
+			err = writeGIF(r.Path, r.frames)
+		}
+		// Let Capture and Stop go on after a failure.
+		for range r.frames {
+		}
+		if err != nil {
+			fmt.Printf("\033[31mError: \033[1mscreen-recorder: %v\033[m\n", err)
+		}
+	}()
+}
+
+// Stop ends the recording; the file is finished in the background.
+func (r *Recorder) Stop() {
+	if r.stopped {
+		return
+	}
+	r.stopped = true
+	if r.frames == nil {
+		r.done.Store(true)
+		fmt.Printf("\033[31mError: \033[1mscreen-recorder: no frames captured\033[m\n")
+		return
+	}
+	r.frames <- recordedFrame{at: time.Now()}
+	close(r.frames)
+}
+
+// writeGIF reduces each frame to a palette as it arrives, as the GIF is
+// only written once the delay of the last frame is known.
+func writeGIF(path string, frames <-chan recordedFrame) error {
+	g := &gif.GIF{}
+	var prev time.Time
+	for f := range frames {
+		if n := len(g.Image); n > 0 {
+			// Delays are in hundredths of a second.
+			g.Delay[n-1] = max(int(f.at.Sub(prev)/(10*time.Millisecond)), 2)
+		}
+		if f.img == nil {
+			break
+		}
+		p := image.NewPaletted(f.img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(p, p.Rect, f.img, image.Point{})
+		g.Image = append(g.Image, p)
+		g.Delay = append(g.Delay, 2)
+		prev = f.at
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(out, g); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeWebM pipes the frames as PNGs into ffmpeg, which must be installed.
+func writeWebM(path string, frames <-chan recordedFrame, interval time.Duration) error {
+	fps := fmt.Sprintf("%.3f", float64(time.Second)/float64(interval))
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "image2pipe", "-framerate", fps,
+		"-i", "-", "-c:v", "libvpx-vp9", "-pix_fmt", "yuv420p", path)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("WebM recording needs ffmpeg: %w", err)
+	}
+	err = encodePNGs(in, frames)
+	in.Close()
+	if werr := cmd.Wait(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+func encodePNGs(w io.Writer, frames <-chan recordedFrame) error {
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	for f := range frames {
+		if f.img == nil {
+			break
+		}
+		if err := enc.Encode(w, f.img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var builtinsRecorder = map[string]*env.Builtin{
+	"screen-recorder": {
+		Doc:   "Create a recorder saving a number of seconds of frames at a frame rate to a .gif file, or a .webm file using ffmpeg; call .capture each frame",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "screen-recorder", 1, arg0)
+			if err != nil {
+				return err
+			}
+			secs, err := decimalArg(ps, "screen-recorder", 2, arg1)
+			if err != nil {
+				return err
+			}
+			fps, err := decimalArg(ps, "screen-recorder", 3, arg2)
+			if err != nil {
+				return err
+			}
+			if secs <= 0 || fps <= 0 {
+				return failure(ps, "screen-recorder", "duration and frame rate must be positive")
+			}
+			r := &Recorder{
+				Path:     path,
+				Duration: time.Duration(secs * float64(time.Second)),
+				Interval: time.Duration(float64(time.Second) / fps),
+			}
+			return *env.NewNative(ps.Idx, r, "Go(*gioui_org.Recorder)")
+		},
+	},
+	"Go(*gioui_org.Recorder)//capture": {
+		Doc:   "Capture the frame laid out so far if due; call before submitting the frame",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Recorder](ps, "Go(*gioui_org.Recorder)//capture", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.Recorder)//capture", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if cerr := r.Capture(gtx); cerr != nil {
+				return failure(ps, "Go(*gioui_org.Recorder)//capture", cerr.Error())
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Recorder)//stop": {
+		Doc:   "End the recording early and save it",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Recorder](ps, "Go(*gioui_org.Recorder)//stop", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r.Stop()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Recorder)//recording?": {
+		Doc:   "Check whether frames are still being captured",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Recorder](ps, "Go(*gioui_org.Recorder)//recording?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(!r.stopped))
+		},
+	},
+	"Go(*gioui_org.Recorder)//saved?": {
+		Doc:   "Check whether the recording has been written to its file",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Recorder](ps, "Go(*gioui_org.Recorder)//saved?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(r.done.Load()))
+		},
+	},
+}
@@ -0,0 +1,117 @@
+// Method registry of native types.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/refaktor/rye/env"
+)
+
+// methodRegistry maps native kinds (e.g. "Go(*widget.Clickable)") to their
+// methods, the builtins registered under "kind//method". Rye already
+// dispatches `obj .method` on these; the registry lets scripts list them
+// and call one chosen at runtime.
+var (
+	methodRegistryOnce sync.Once
+	methodRegistry     map[string]map[string]*env.Builtin
+)
+
+func methodsOf(kind string) map[string]*env.Builtin {
+	methodRegistryOnce.Do(func() {
+		methodRegistry = map[string]map[string]*env.Builtin{}
+		for k, b := range Builtins {
+			kind, method, ok := strings.Cut(k, "//")
+			if !ok || kind == "" {
+				continue
+			}
+			if methodRegistry[kind] == nil {
+				methodRegistry[kind] = map[string]*env.Builtin{}
+			}
+			methodRegistry[kind][method] = b
+		}
+	})
+	return methodRegistry[kind]
+}
+
+func nativeKind(ps *env.ProgramState, name string, n int, arg env.Object) (string, *env.Error) {
+	nat, ok := arg.(env.Native)
+	if !ok {
+		return "", argError(ps, name, n, "native", arg)
+	}
+	return ps.Idx.GetWord(nat.Kind.Index), nil
+}
+
+var builtinsRegistry = map[string]*env.Builtin{
+	"methods?": {
+		Doc:   "Get a sorted block of the method names of a native",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			kind, err := nativeKind(ps, "methods?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			ms := methodsOf(kind)
+			names := make([]string, 0, len(ms))
+			for m := range ms {
+				names = append(names, m)
+			}
+			sort.Strings(names)
+			objs := make([]env.Object, len(names))
+			for i, m := range names {
+				objs[i] = *env.NewString(m)
+			}
+			return *env.NewBlock(*env.NewTSeries(objs))
+		},
+	},
+	"responds-to?": {
+		Doc:   "Check whether a native has a method",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			kind, err := nativeKind(ps, "responds-to?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			method, err := nameArg(ps, "responds-to?", 2, arg1)
+			if err != nil {
+				return err
+			}
+			_, ok := methodsOf(kind)[method]
+			return *env.NewInteger(boolToInt64(ok))
+		},
+	},
+	"send": {
+		Doc:   "Call a method of a native by name with a block of arguments, dispatching on the native's type",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			kind, err := nativeKind(ps, "send", 1, arg0)
+			if err != nil {
+				return err
+			}
+			method, err := nameArg(ps, "send", 2, arg1)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg2.(env.Block)
+			if !ok {
+				return argError(ps, "send", 3, "block of arguments", arg2)
+			}
+			b, ok := methodsOf(kind)[method]
+			if !ok {
+				return failure(ps, "send", fmt.Sprintf("%s has no method %s", kind, method))
+			}
+			args := blk.Series.S
+			if len(args)+1 != b.Argsn {
+				return failure(ps, "send", fmt.Sprintf("%s//%s takes %d arguments, but got %d", kind, method, b.Argsn-1, len(args)))
+			}
+			a := make([]env.Object, 4)
+			copy(a, args)
+			return b.Fn(ps, arg0, a[0], a[1], a[2], a[3])
+		},
+	},
+}
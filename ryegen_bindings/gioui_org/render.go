@@ -0,0 +1,113 @@
+// Graphics backends windows render with.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/refaktor/rye/env"
+)
+
+// buildTags are the tags the program was built with.
+func buildTags() map[string]bool {
+	tags := map[string]bool{}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "-tags" {
+				for _, t := range strings.Split(s.Value, ",") {
+					tags[t] = true
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// renderBackends returns the graphics APIs Gio tries for a new window, in
+// order; a window renders with the first that works. Gio picks them at
+// build time, so the ones turned off by tags (novulkan, noopengl, nometal,
+// nowayland, nox11) are left out.
+func renderBackends() []string {
+	tags := buildTags()
+	var res []string
+	add := func(api, tag string) {
+		if !tags[tag] {
+			res = append(res, api)
+		}
+	}
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		// Wayland tries OpenGL first, X11 Vulkan; OpenBSD has no Vulkan.
+		wayland := runtime.GOOS != "openbsd" && !tags["nowayland"] && os.Getenv("WAYLAND_DISPLAY") != ""
+		switch {
+		case wayland:
+			add("opengl", "noopengl")
+			add("vulkan", "novulkan")
+		case !tags["nox11"]:
+			if runtime.GOOS != "openbsd" {
+				add("vulkan", "novulkan")
+			}
+			add("opengl", "noopengl")
+		}
+	case "android":
+		add("vulkan", "novulkan")
+		add("opengl", "noopengl")
+	case "windows":
+		res = append(res, "d3d11")
+		add("opengl", "noopengl")
+	case "darwin", "ios":
+		if tags["nometal"] {
+			res = append(res, "opengl")
+		} else {
+			res = append(res, "metal")
+		}
+	case "js":
+		res = append(res, "webgl")
+	}
+	return res
+}
+
+// renderEnv returns a builtin setting or clearing environment variables
+// read as windows create their GPU context.
+func renderEnv(name, doc string, vars map[string]string) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			on, err := integerArg(ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			for k, v := range vars {
+				if on != 0 {
+					os.Setenv(k, v)
+				} else {
+					os.Unsetenv(k)
+				}
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsRender = map[string]*env.Builtin{
+	"render-backends": {
+		Doc:   "Get the graphics APIs (vulkan, opengl, d3d11, metal, webgl) windows try in order, rendering with the first that works; build with tags like novulkan to leave one out",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			return argsObj(ps, renderBackends())
+		},
+	},
+	"render-software!": renderEnv("render-software!", "Set whether OpenGL renders in software (Mesa's llvmpipe), for VMs and boxes without a working GPU; set before creating the window", map[string]string{
+		"LIBGL_ALWAYS_SOFTWARE": "1",
+		"GALLIUM_DRIVER":        "llvmpipe",
+	}),
+	"render-compute!": renderEnv("render-compute!", "Set whether windows draw with Gio's compute renderer, which runs on the CPU where the GPU lacks compute support; set before creating the window", map[string]string{
+		"GIORENDERER": "forcecompute",
+	}),
+}
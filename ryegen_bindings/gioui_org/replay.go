@@ -0,0 +1,273 @@
+// Recording input sessions and replaying them deterministically.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"os"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+
+	"github.com/refaktor/rye/env"
+)
+
+// inputRecord is a line of a session file. Frame is the number of the frame
+// the event arrived in and T its time since the first frame, in
+// milliseconds. Positions are in dp.
+type inputRecord struct {
+	Frame   int     `json:"frame"`
+	T       float64 `json:"t"`
+	Kind    string  `json:"kind"`
+	X       float32 `json:"x,omitempty"`
+	Y       float32 `json:"y,omitempty"`
+	DX      float32 `json:"dx,omitempty"`
+	DY      float32 `json:"dy,omitempty"`
+	Buttons int     `json:"buttons,omitempty"`
+	Mods    int     `json:"mods,omitempty"`
+	Key     string  `json:"key,omitempty"`
+}
+
+var pointerKindNames = map[pointer.Kind]string{
+	pointer.Move:    "move",
+	pointer.Drag:    "drag",
+	pointer.Press:   "press",
+	pointer.Release: "release",
+	pointer.Scroll:  "scroll",
+}
+
+// InputRecorder wraps a UI and appends the pointer events it receives and
+// the key presses no widget handles to a session file, one JSON object per
+// line, flushed every frame so the file survives a crash. Text typed into
+// a focused editor doesn't reach the recorder and isn't recorded.
+type InputRecorder struct {
+	f     *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	frame int
+	start time.Time
+	err   error
+}
+
+func newInputRecorder(path string) (*InputRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &InputRecorder{f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (r *InputRecorder) write(rec inputRecord) {
+	if r.err == nil {
+		r.err = r.enc.Encode(rec)
+	}
+}
+
+func (r *InputRecorder) Layout(gtx layout.Context, w layout.Widget) layout.Dimensions {
+	if r.start.IsZero() {
+		r.start = gtx.Now
+	}
+	t := float64(gtx.Now.Sub(r.start)) / float64(time.Millisecond)
+	dp := func(v float32) float32 { return v / gtx.Metric.PxPerDp }
+	for {
+		e, ok := gtx.Event(pointer.Filter{
+			Target:  r,
+			Kinds:   pointer.Move | pointer.Drag | pointer.Press | pointer.Release | pointer.Scroll,
+			ScrollX: pointer.ScrollRange{Min: math.MinInt32, Max: math.MaxInt32},
+			ScrollY: pointer.ScrollRange{Min: math.MinInt32, Max: math.MaxInt32},
+		})
+		if !ok {
+			break
+		}
+		if pe, ok := e.(pointer.Event); ok {
+			r.write(inputRecord{
+				Frame: r.frame, T: t, Kind: pointerKindNames[pe.Kind],
+				X: dp(pe.Position.X), Y: dp(pe.Position.Y), DX: dp(pe.Scroll.X), DY: dp(pe.Scroll.Y),
+				Buttons: int(pe.Buttons), Mods: int(pe.Modifiers),
+			})
+		}
+	}
+	for {
+		e, ok := gtx.Event(key.Filter{Optional: allModifiers})
+		if !ok {
+			break
+		}
+		if ke, ok := e.(key.Event); ok {
+			kind := "key-press"
+			if ke.State == key.Release {
+				kind = "key-release"
+			}
+			r.write(inputRecord{Frame: r.frame, T: t, Kind: kind, Key: string(ke.Name), Mods: int(ke.Modifiers)})
+		}
+	}
+	r.write(inputRecord{Frame: r.frame, T: t, Kind: "frame"})
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	r.frame++
+
+	m := op.Record(gtx.Ops)
+	dims := w(gtx)
+	call := m.Stop()
+	defer clip.Rect{Max: dims.Size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, r)
+	call.Add(gtx.Ops)
+	return dims
+}
+
+func (r *InputRecorder) Close() error {
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	if err := r.f.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+func loadSession(path string) ([]inputRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recs []inputRecord
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var rec inputRecord
+		if err := dec.Decode(&rec); err != nil {
+			// A session cut short by a crash ends in a partial line.
+			break
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// Replay feeds a recorded session to the driver, laying out one frame per
+// recorded frame at its recorded time, so the UI sees the same input at the
+// same frames and times as during recording.
+func (d *TestDriver) Replay(recs []inputRecord) {
+	var evs []event.Event
+	for _, rec := range recs {
+		at := d.start.Add(time.Duration(rec.T * float64(time.Millisecond)))
+		mods := key.Modifiers(rec.Mods)
+		switch rec.Kind {
+		case "frame":
+			d.router.Queue(evs...)
+			evs = evs[:0]
+			if at.After(d.now) {
+				d.now = at
+			}
+			d.Frame()
+		case "key-press", "key-release":
+			state := key.Press
+			if rec.Kind == "key-release" {
+				state = key.Release
+			}
+			evs = append(evs, key.Event{Name: key.Name(rec.Key), Modifiers: mods, State: state})
+		default:
+			for k, name := range pointerKindNames {
+				if name != rec.Kind {
+					continue
+				}
+				d.mouse = f32.Pt(rec.X, rec.Y)
+				evs = append(evs, pointer.Event{
+					Kind:      k,
+					Source:    pointer.Mouse,
+					Position:  d.mouse,
+					Scroll:    f32.Pt(rec.DX, rec.DY),
+					Buttons:   pointer.Buttons(rec.Buttons),
+					Modifiers: mods,
+					Time:      at.Sub(d.start),
+				})
+			}
+		}
+	}
+	if len(evs) > 0 {
+		d.send(evs...)
+	}
+}
+
+var builtinsReplay = map[string]*env.Builtin{
+	"input-recorder": {
+		Doc:   "Create a recorder writing the input a UI receives to a session file; lay the UI out with .layout",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "input-recorder", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r, rerr := newInputRecorder(path)
+			if rerr != nil {
+				return failure(ps, "input-recorder", rerr.Error())
+			}
+			trackResource(r, func(r *InputRecorder) { r.Close() })
+			return *env.NewNative(ps.Idx, r, "Go(*gioui_org.InputRecorder)")
+		},
+	},
+	"Go(*gioui_org.InputRecorder)//layout": {
+		Doc:   "Lay out a widget, recording the input it receives",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*InputRecorder](ps, "Go(*gioui_org.InputRecorder)//layout", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.InputRecorder)//layout", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "Go(*gioui_org.InputRecorder)//layout", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return dimensionsObj(ps, r.Layout(gtx, w))
+		},
+	},
+	"Go(*gioui_org.InputRecorder)//close": {
+		Doc:   "Finish the session file",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*InputRecorder](ps, "Go(*gioui_org.InputRecorder)//close", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if cerr := r.Close(); cerr != nil {
+				return failure(ps, "Go(*gioui_org.InputRecorder)//close", cerr.Error())
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.TestDriver)//replay": {
+		Doc:   "Replay a session file recorded with input-recorder, frame by frame",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := nativeArg[*TestDriver](ps, "Go(*gioui_org.TestDriver)//replay", 1, arg0)
+			if err != nil {
+				return err
+			}
+			path, err := stringArg(ps, "Go(*gioui_org.TestDriver)//replay", 2, arg1)
+			if err != nil {
+				return err
+			}
+			recs, lerr := loadSession(path)
+			if lerr != nil {
+				return failure(ps, "Go(*gioui_org.TestDriver)//replay", lerr.Error())
+			}
+			d.Replay(recs)
+			return arg0
+		},
+	},
+}
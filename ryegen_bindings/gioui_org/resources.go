@@ -0,0 +1,217 @@
+// Releasing the resources natives hold.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"gioui.org/gpu/headless"
+
+	"github.com/refaktor/rye/env"
+	"github.com/refaktor/rye/evaldo"
+)
+
+// resource is something a native holds beyond Go memory: a GPU context, an
+// open file, a running goroutine or an OS registration. release is given
+// the native's value, so it needn't hold on to it.
+//
+// Natives of gioui.org/cpu aren't bound, fonts are Go memory, and image
+// textures belong to the renderer, which frees them as images stop being
+// drawn, so none are tracked. A gpu.GPU must be released on the thread of
+// its graphics context, which a finalizer doesn't run on; free releases it
+// through its Release method.
+type resource struct {
+	release func(v any)
+	freed   bool
+}
+
+// resources are keyed by address rather than pointer, so the registry
+// doesn't keep them alive; an entry is removed by the finalizer.
+var (
+	resourcesMu sync.Mutex
+	resources   = map[uintptr]*resource{}
+	// resourceScopes are the resources made in each with-resources block
+	// being run, innermost last.
+	resourceScopes [][]any
+)
+
+// trackResource registers the resource ptr holds, released by release when
+// the script frees it, when the with-resources block it was made in ends,
+// or when ptr is garbage collected, whichever is first. release gets ptr
+// and mustn't refer to it otherwise, or ptr is never collected; neither
+// must goroutines the resource runs (see sqlState or streamState).
+func trackResource[T any](ptr T, release func(T)) {
+	p := reflect.ValueOf(ptr).Pointer()
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	if _, ok := resources[p]; ok {
+		return
+	}
+	resources[p] = &resource{release: func(v any) { release(v.(T)) }}
+	if n := len(resourceScopes); n > 0 {
+		resourceScopes[n-1] = append(resourceScopes[n-1], ptr)
+	}
+	runtime.SetFinalizer(ptr, func(v T) {
+		resourcesMu.Lock()
+		r := resources[p]
+		delete(resources, p)
+		resourcesMu.Unlock()
+		if r != nil && !r.freed {
+			r.release(v)
+		}
+	})
+}
+
+// releaser returns how to release the value of a native not made by a
+// tracking constructor, going by its methods.
+func releaser(v any) (func(v any), bool) {
+	switch v.(type) {
+	case interface{ Release() }:
+		return func(v any) { v.(interface{ Release() }).Release() }, true
+	case interface{ Close() error }:
+		return func(v any) { v.(interface{ Close() error }).Close() }, true
+	case interface{ Close() }:
+		return func(v any) { v.(interface{ Close() }).Close() }, true
+	case interface{ Stop() }:
+		return func(v any) { v.(interface{ Stop() }).Stop() }, true
+	}
+	return nil, false
+}
+
+var errFreed = errors.New("already freed")
+
+// freeResource releases the resource of v now.
+func freeResource(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("not a resource")
+	}
+	resourcesMu.Lock()
+	r, ok := resources[rv.Pointer()]
+	resourcesMu.Unlock()
+	if !ok {
+		release, ok := releaser(v)
+		if !ok {
+			return errors.New("not a resource")
+		}
+		trackResource(v, release)
+		resourcesMu.Lock()
+		r = resources[rv.Pointer()]
+		resourcesMu.Unlock()
+	}
+	resourcesMu.Lock()
+	freed := r.freed
+	r.freed = true
+	resourcesMu.Unlock()
+	if freed {
+		return errFreed
+	}
+	r.release(v)
+	return nil
+}
+
+// freed reports whether the resource of v was freed.
+func freed(v any) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer {
+		return false
+	}
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	r, ok := resources[rv.Pointer()]
+	return ok && r.freed
+}
+
+var builtinsResources = map[string]*env.Builtin{
+	"free": {
+		Doc:   "Release what a native holds (GPU context, file, stream, hotkey) now instead of when it is garbage collected; fails if it was freed already",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			nat, ok := arg0.(env.Native)
+			if !ok {
+				return argError(ps, "free", 1, "native", arg0)
+			}
+			if err := freeResource(nat.Value); err != nil {
+				return failure(ps, "free", err.Error())
+			}
+			return arg0
+		},
+	},
+	"freed?": {
+		Doc:   "Check whether a native was freed",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			nat, ok := arg0.(env.Native)
+			if !ok {
+				return argError(ps, "freed?", 1, "native", arg0)
+			}
+			return *env.NewInteger(boolToInt64(freed(nat.Value)))
+		},
+	},
+	"with-resources": {
+		Doc:   "Run a block and free the natives holding resources that were made in it, even if it fails",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			blk, ok := arg0.(env.Block)
+			if !ok {
+				return argError(ps, "with-resources", 1, "block", arg0)
+			}
+			resourcesMu.Lock()
+			resourceScopes = append(resourceScopes, nil)
+			resourcesMu.Unlock()
+			defer func() {
+				resourcesMu.Lock()
+				made := resourceScopes[len(resourceScopes)-1]
+				resourceScopes = resourceScopes[:len(resourceScopes)-1]
+				resourcesMu.Unlock()
+				for i := len(made) - 1; i >= 0; i-- {
+					freeResource(made[i])
+				}
+			}()
+			ser := ps.Ser
+			ps.Ser = blk.Series
+			evaldo.EvalBlock(ps)
+			ps.Ser = ser
+			return ps.Res
+		},
+	},
+	"headless-window": {
+		Doc:   "headless.NewWindow; the window is released by free, with-resources or when garbage collected",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := integerArg(ps, "headless-window", 1, arg0)
+			if err != nil {
+				return err
+			}
+			h, err := integerArg(ps, "headless-window", 2, arg1)
+			if err != nil {
+				return err
+			}
+			win, werr := headless.NewWindow(int(w), int(h))
+			if werr != nil {
+				return failure(ps, "headless-window", werr.Error())
+			}
+			trackResource(win, (*headless.Window).Release)
+			return *env.NewNative(ps.Idx, win, "Go(*headless.Window)")
+		},
+	},
+	"Go(*headless.Window)//release": {
+		Doc:   "Release the window's GPU resources; same as free",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			win, err := nativeArg[*headless.Window](ps, "Go(*headless.Window)//release", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if err := freeResource(win); err != nil {
+				return failure(ps, "Go(*headless.Window)//release", err.Error())
+			}
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,122 @@
+// Retained widgets, re-laid out only when the state they show changes.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Retained lays out a widget into its own op list and replays it while the
+// words it depends on keep their values and the constraints and scale stay
+// the same. Running a Rye widget function costs far more than calling a
+// macro, so a large UI whose parts rarely change stays fast when they are
+// retained.
+//
+// The widget isn't run when replayed, so it must not animate or handle
+// input itself; its input is handled when it next runs.
+type Retained struct {
+	widget layout.Widget
+	deps   []*binding
+
+	ops    op.Ops
+	call   op.CallOp
+	dims   layout.Dimensions
+	valid  bool
+	values []env.Object
+	cons   layout.Constraints
+	metric unit.Metric
+
+	reused, recorded int
+}
+
+// dirty reports whether the widget must run again, and updates the values
+// of its dependencies.
+func (r *Retained) dirty(gtx layout.Context) bool {
+	dirty := !r.valid || gtx.Constraints != r.cons || gtx.Metric != r.metric
+	for i, d := range r.deps {
+		v, _ := d.get()
+		if r.values[i] == nil || v == nil || !v.Equal(r.values[i]) {
+			dirty = true
+		}
+		r.values[i] = v
+	}
+	r.cons, r.metric = gtx.Constraints, gtx.Metric
+	return dirty
+}
+
+func (r *Retained) Layout(gtx layout.Context) layout.Dimensions {
+	if r.dirty(gtx) {
+		r.ops.Reset()
+		own := gtx
+		own.Ops = &r.ops
+		m := op.Record(own.Ops)
+		r.dims = r.widget(own)
+		r.call = m.Stop()
+		r.valid = true
+		r.recorded++
+	} else {
+		r.reused++
+	}
+	r.call.Add(gtx.Ops)
+	return r.dims
+}
+
+var builtinsRetained = map[string]*env.Builtin{
+	"retained": {
+		Doc:   "Make a widget that is only run again when a word of a block of words it depends on changes value (or the constraints change) and is otherwise redrawn from the last run",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			blk, ok := arg0.(env.Block)
+			if !ok {
+				return argError(ps, "retained", 1, "block of words", arg0)
+			}
+			var deps []*binding
+			for _, it := range blk.Series.S {
+				b, err := bindingArg(ps, "retained", 1, it)
+				if err != nil {
+					return err
+				}
+				deps = append(deps, b)
+			}
+			w, err := widgetArg(ps, "retained", 2, arg1)
+			if err != nil {
+				return err
+			}
+			r := &Retained{widget: w, deps: deps, values: make([]env.Object, len(deps))}
+			return *env.NewNative(ps.Idx, r, "Go(*gioui_org.Retained)")
+		},
+	},
+	"Go(*gioui_org.Retained)//layout": layoutBuiltin[*Retained]("Go(*gioui_org.Retained)//layout"),
+	"Go(*gioui_org.Retained)//invalidate!": {
+		Doc:   "Run the widget on its next layout even if nothing it depends on changed",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Retained](ps, "Go(*gioui_org.Retained)//invalidate!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			r.valid = false
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Retained)//stats?": {
+		Doc:   "Get a dict of how many layouts ran the widget (recorded) and how many replayed it (reused)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			r, err := nativeArg[*Retained](ps, "Go(*gioui_org.Retained)//stats?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewDict(map[string]any{
+				"recorded": *env.NewInteger(int64(r.recorded)),
+				"reused":   *env.NewInteger(int64(r.reused)),
+			})
+		},
+	},
+}
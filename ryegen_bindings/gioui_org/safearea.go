@@ -0,0 +1,99 @@
+// Safe areas clear of notches and system bars.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"sync"
+
+	"gioui.org/app"
+	"gioui.org/layout"
+	"gioui.org/op"
+
+	"github.com/refaktor/rye/env"
+)
+
+// frameInsets are the parts of the window under notches and system bars
+// that frames laid out edge to edge leave to safe-area, by their ops.
+// app.NewContext pads the whole frame by them instead.
+var frameInsets sync.Map
+
+func insetsOf(ops *op.Ops) app.Insets {
+	if v, ok := frameInsets.Load(ops); ok {
+		return v.(app.Insets)
+	}
+	return app.Insets{}
+}
+
+// edgeContext is pacedContext covering the whole window, under the system
+// bars too.
+func edgeContext(ops *op.Ops, e app.FrameEvent) layout.Context {
+	ins := e.Insets
+	e.Insets = app.Insets{}
+	gtx := pacedContext(ops, e)
+	frameInsets.Store(ops, ins)
+	return gtx
+}
+
+func insetsObj(ins app.Insets) env.Object {
+	return *env.NewDict(map[string]any{
+		"top":    *env.NewDecimal(float64(ins.Top)),
+		"bottom": *env.NewDecimal(float64(ins.Bottom)),
+		"left":   *env.NewDecimal(float64(ins.Left)),
+		"right":  *env.NewDecimal(float64(ins.Right)),
+	})
+}
+
+var builtinsSafeArea = map[string]*env.Builtin{
+	"app-context\\edge-to-edge": {
+		Doc:   "app.NewContext covering the whole window, under notches and system bars too; pad the content that must stay clear of them with safe-area",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			ops, err := nativeArg[*op.Ops](ps, "app-context\\edge-to-edge", 1, arg0)
+			if err != nil {
+				return err
+			}
+			e, err := nativeArg[*app.FrameEvent](ps, "app-context\\edge-to-edge", 2, arg1)
+			if err != nil {
+				return err
+			}
+			gtx := edgeContext(ops, *e)
+			return *env.NewNative(ps.Idx, &gtx, "Go(*layout.Context)")
+		},
+	},
+	"safe-area": {
+		Doc:   "Lay out a widget padded clear of notches and system bars, in a frame made by app-context\\edge-to-edge (app-context pads the whole frame already)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "safe-area", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "safe-area", 2, arg1)
+			if err != nil {
+				return err
+			}
+			ins := insetsOf(gtx.Ops)
+			if ins == (app.Insets{}) {
+				return dimensionsObj(ps, w(gtx))
+			}
+			// Safe areas inside are already clear.
+			frameInsets.Store(gtx.Ops, app.Insets{})
+			defer frameInsets.Store(gtx.Ops, ins)
+			in := layout.Inset{Top: ins.Top, Bottom: ins.Bottom, Left: ins.Left, Right: ins.Right}
+			return dimensionsObj(ps, in.Layout(gtx, w))
+		},
+	},
+	"safe-area-insets": {
+		Doc:   "Get a dict of the top, bottom, left and right insets in dp that safe-area pads a frame's content by",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "safe-area-insets", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return insetsObj(insetsOf(gtx.Ops))
+		},
+	},
+}
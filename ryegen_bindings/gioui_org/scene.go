@@ -0,0 +1,610 @@
+// Scene graph for drawing and whiteboard apps.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+// hexColor is a color that serializes as "#rrggbbaa".
+type hexColor color.NRGBA
+
+func (c hexColor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A))
+}
+
+func (c *hexColor) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	nc, ok := parseHexColor(s)
+	if !ok {
+		return fmt.Errorf("invalid color %q", s)
+	}
+	*c = hexColor(nc)
+	return nil
+}
+
+// Shape is an element of a Scene. Coordinates are in dp; a line goes from
+// (X, Y) to (X+W, Y+H).
+type Shape struct {
+	ID          int      `json:"id"`
+	Kind        string   `json:"kind"` // "rect", "ellipse" or "line"
+	X           float32  `json:"x"`
+	Y           float32  `json:"y"`
+	W           float32  `json:"w"`
+	H           float32  `json:"h"`
+	Fill        hexColor `json:"fill"`
+	Stroke      hexColor `json:"stroke"`
+	StrokeWidth float32  `json:"stroke-width"`
+
+	// Drawing ops are recorded once and replayed until the shape changes.
+	ops   op.Ops
+	call  op.CallOp
+	scale float32 // pixels per dp the ops were recorded for, 0 if stale
+}
+
+func (s *Shape) changed() { s.scale = 0 }
+
+type bbox struct{ Min, Max f32.Point }
+
+func (b bbox) Dx() float32 { return b.Max.X - b.Min.X }
+func (b bbox) Dy() float32 { return b.Max.Y - b.Min.Y }
+
+// bounds returns the normalized bounding box in dp.
+func (s *Shape) bounds() bbox {
+	return bbox{
+		Min: f32.Pt(min(s.X, s.X+s.W), min(s.Y, s.Y+s.H)),
+		Max: f32.Pt(max(s.X, s.X+s.W), max(s.Y, s.Y+s.H)),
+	}
+}
+
+// hit reports whether the point p (in dp) is on the shape.
+func (s *Shape) hit(p f32.Point) bool {
+	b := s.bounds()
+	pad := s.StrokeWidth / 2
+	switch s.Kind {
+	case "ellipse":
+		rx, ry := b.Dx()/2+pad, b.Dy()/2+pad
+		if rx <= 0 || ry <= 0 {
+			return false
+		}
+		c := b.Min.Add(b.Max).Mul(0.5)
+		dx, dy := (p.X-c.X)/rx, (p.Y-c.Y)/ry
+		return dx*dx+dy*dy <= 1
+	case "line":
+		a, d := f32.Pt(s.X, s.Y), f32.Pt(s.W, s.H)
+		t := float32(0)
+		if l2 := d.X*d.X + d.Y*d.Y; l2 > 0 {
+			t = max(0, min(1, ((p.X-a.X)*d.X+(p.Y-a.Y)*d.Y)/l2))
+		}
+		q := a.Add(d.Mul(t)).Sub(p)
+		return float32(math.Hypot(float64(q.X), float64(q.Y))) <= max(pad, 4)
+	default:
+		return p.X >= b.Min.X-pad && p.X <= b.Max.X+pad && p.Y >= b.Min.Y-pad && p.Y <= b.Max.Y+pad
+	}
+}
+
+// record draws the shape into its own ops for the given scale.
+func (s *Shape) record(scale float32) {
+	s.ops.Reset()
+	macro := op.Record(&s.ops)
+	b := s.bounds()
+	px := image.Rectangle{
+		Min: image.Pt(int(b.Min.X*scale+.5), int(b.Min.Y*scale+.5)),
+		Max: image.Pt(int(b.Max.X*scale+.5), int(b.Max.Y*scale+.5)),
+	}
+	width := s.StrokeWidth * scale
+	switch s.Kind {
+	case "line":
+		var p clip.Path
+		p.Begin(&s.ops)
+		p.MoveTo(f32.Pt(s.X, s.Y).Mul(scale))
+		p.LineTo(f32.Pt(s.X+s.W, s.Y+s.H).Mul(scale))
+		paint.FillShape(&s.ops, color.NRGBA(s.Stroke), clip.Stroke{Path: p.End(), Width: max(width, 1)}.Op())
+	case "ellipse":
+		e := clip.Ellipse(px)
+		paint.FillShape(&s.ops, color.NRGBA(s.Fill), e.Op(&s.ops))
+		if width > 0 {
+			paint.FillShape(&s.ops, color.NRGBA(s.Stroke), clip.Stroke{Path: e.Path(&s.ops), Width: width}.Op())
+		}
+	default:
+		paint.FillShape(&s.ops, color.NRGBA(s.Fill), clip.Rect(px).Op())
+		if width > 0 {
+			paint.FillShape(&s.ops, color.NRGBA(s.Stroke), clip.Stroke{Path: clip.Rect(px).Path(), Width: width}.Op())
+		}
+	}
+	s.call = macro.Stop()
+	s.scale = scale
+}
+
+// Scene is an ordered list of shapes, the last one on top, with a
+// selection.
+type Scene struct {
+	Shapes    []*Shape    `json:"shapes"`
+	NextID    int         `json:"next-id"`
+	Selection color.NRGBA `json:"-"`
+	selected  map[int]bool
+}
+
+func newScene() *Scene {
+	return &Scene{NextID: 1, Selection: color.NRGBA{R: 0x3f, G: 0x51, B: 0xb5, A: 0xff}, selected: map[int]bool{}}
+}
+
+func (sc *Scene) add(kind string, x, y, w, h float32) *Shape {
+	s := &Shape{ID: sc.NextID, Kind: kind, X: x, Y: y, W: w, H: h, StrokeWidth: 1,
+		Fill: hexColor{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, Stroke: hexColor{A: 0xff}}
+	if kind == "line" {
+		s.Fill = hexColor{}
+		s.StrokeWidth = 2
+	}
+	sc.NextID++
+	sc.Shapes = append(sc.Shapes, s)
+	return s
+}
+
+// validate checks a loaded scene: every shape is there, of a known kind,
+// with an id of its own.
+func (sc *Scene) validate() error {
+	ids := map[int]bool{}
+	for i, s := range sc.Shapes {
+		if s == nil {
+			return fmt.Errorf("shape %d is null", i)
+		}
+		switch s.Kind {
+		case "rect", "ellipse", "line":
+		default:
+			return fmt.Errorf("shape %d has unknown kind %q", s.ID, s.Kind)
+		}
+		if ids[s.ID] {
+			return fmt.Errorf("duplicate shape id %d", s.ID)
+		}
+		ids[s.ID] = true
+	}
+	return nil
+}
+
+func (sc *Scene) index(id int) int {
+	for i, s := range sc.Shapes {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Hit returns the topmost shape at p (in dp), or nil.
+func (sc *Scene) Hit(p f32.Point) *Shape {
+	for i := len(sc.Shapes) - 1; i >= 0; i-- {
+		if sc.Shapes[i].hit(p) {
+			return sc.Shapes[i]
+		}
+	}
+	return nil
+}
+
+// restack moves the shape at index i to index j.
+func (sc *Scene) restack(i, j int) {
+	s := sc.Shapes[i]
+	sc.Shapes = append(sc.Shapes[:i], sc.Shapes[i+1:]...)
+	sc.Shapes = append(sc.Shapes[:j], append([]*Shape{s}, sc.Shapes[j:]...)...)
+}
+
+func (sc *Scene) Layout(gtx layout.Context) layout.Dimensions {
+	scale := gtx.Metric.PxPerDp
+	for _, s := range sc.Shapes {
+		if s.scale != scale {
+			s.record(scale)
+		}
+		s.call.Add(gtx.Ops)
+	}
+	for _, s := range sc.Shapes {
+		if !sc.selected[s.ID] {
+			continue
+		}
+		b := s.bounds()
+		pad := s.StrokeWidth/2 + 3
+		r := image.Rect(int((b.Min.X-pad)*scale), int((b.Min.Y-pad)*scale), int((b.Max.X+pad)*scale), int((b.Max.Y+pad)*scale))
+		paint.FillShape(gtx.Ops, sc.Selection, clip.Stroke{Path: clip.Rect(r).Path(), Width: float32(gtx.Dp(1))}.Op())
+	}
+	return layout.Dimensions{Size: gtx.Constraints.Max}
+}
+
+func (sc *Scene) idsObj(ids func(*Shape) bool) env.Object {
+	var res []env.Object
+	for _, s := range sc.Shapes {
+		if ids(s) {
+			res = append(res, *env.NewInteger(int64(s.ID)))
+		}
+	}
+	return *env.NewBlock(*env.NewTSeries(res))
+}
+
+func shapeArg(ps *env.ProgramState, name string, n int, sc *Scene, arg env.Object) (*Shape, *env.Error) {
+	id, err := integerArg(ps, name, n, arg)
+	if err != nil {
+		return nil, err
+	}
+	i := sc.index(int(id))
+	if i < 0 {
+		return nil, failure(ps, name, "no shape with id "+strconv.FormatInt(id, 10))
+	}
+	return sc.Shapes[i], nil
+}
+
+// pointArgs reads two consecutive decimal arguments starting at arg n.
+func pointArgs(ps *env.ProgramState, name string, n int, a, b env.Object) (float32, float32, *env.Error) {
+	x, err := decimalArg(ps, name, n, a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := decimalArg(ps, name, n+1, b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return float32(x), float32(y), nil
+}
+
+func addShapeBuiltin(name, kind, doc string) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 5,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, name, 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			w, h, err := pointArgs(ps, name, 4, arg3, arg4)
+			if err != nil {
+				return err
+			}
+			if kind == "line" {
+				w, h = w-x, h-y
+			}
+			return *env.NewInteger(int64(sc.add(kind, x, y, w, h).ID))
+		},
+	}
+}
+
+var builtinsScene = map[string]*env.Builtin{
+	"scene": {
+		Doc:   "Create an empty scene of shapes",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			return *env.NewNative(ps.Idx, newScene(), "Go(*gioui_org.Scene)")
+		},
+	},
+	"scene-from-json": {
+		Doc:   "Load a scene saved with to-json",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := stringArg(ps, "scene-from-json", 1, arg0)
+			if err != nil {
+				return err
+			}
+			sc := newScene()
+			if jerr := json.Unmarshal([]byte(s), sc); jerr != nil {
+				return failure(ps, "scene-from-json", jerr.Error())
+			}
+			if verr := sc.validate(); verr != nil {
+				return failure(ps, "scene-from-json", verr.Error())
+			}
+			for _, s := range sc.Shapes {
+				sc.NextID = max(sc.NextID, s.ID+1)
+			}
+			return *env.NewNative(ps.Idx, sc, "Go(*gioui_org.Scene)")
+		},
+	},
+	"Go(*gioui_org.Scene)//to-json": {
+		Doc:   "Serialize the shapes of a scene to JSON",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//to-json", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, jerr := json.Marshal(sc)
+			if jerr != nil {
+				return failure(ps, "Go(*gioui_org.Scene)//to-json", jerr.Error())
+			}
+			return *env.NewString(string(b))
+		},
+	},
+	"Go(*gioui_org.Scene)//layout":      layoutBuiltin[*Scene]("Go(*gioui_org.Scene)//layout"),
+	"Go(*gioui_org.Scene)//add-rect":    addShapeBuiltin("Go(*gioui_org.Scene)//add-rect", "rect", "Add a rectangle at x y of size w h on top; returns its id"),
+	"Go(*gioui_org.Scene)//add-ellipse": addShapeBuiltin("Go(*gioui_org.Scene)//add-ellipse", "ellipse", "Add an ellipse in the box at x y of size w h on top; returns its id"),
+	"Go(*gioui_org.Scene)//add-line":    addShapeBuiltin("Go(*gioui_org.Scene)//add-line", "line", "Add a line from x1 y1 to x2 y2 on top; returns its id"),
+	"Go(*gioui_org.Scene)//remove": {
+		Doc:   "Remove a shape",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//remove", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//remove", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			i := sc.index(s.ID)
+			sc.Shapes = append(sc.Shapes[:i], sc.Shapes[i+1:]...)
+			delete(sc.selected, s.ID)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//fill!": {
+		Doc:   "Set the fill color of a shape",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//fill!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//fill!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.Scene)//fill!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			s.Fill = hexColor(c)
+			s.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//stroke!": {
+		Doc:   "Set the outline color and width of a shape",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//stroke!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//stroke!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			c, err := colorArg(ps, "Go(*gioui_org.Scene)//stroke!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			w, err := decimalArg(ps, "Go(*gioui_org.Scene)//stroke!", 4, arg3)
+			if err != nil {
+				return err
+			}
+			s.Stroke, s.StrokeWidth = hexColor(c), float32(w)
+			s.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//move!": {
+		Doc:   "Move a shape by dx dy",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//move!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//move!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			dx, dy, err := pointArgs(ps, "Go(*gioui_org.Scene)//move!", 3, arg2, arg3)
+			if err != nil {
+				return err
+			}
+			s.X, s.Y = s.X+dx, s.Y+dy
+			s.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//position!": {
+		Doc:   "Set the x y position of a shape",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//position!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//position!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "Go(*gioui_org.Scene)//position!", 3, arg2, arg3)
+			if err != nil {
+				return err
+			}
+			s.X, s.Y = x, y
+			s.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//size!": {
+		Doc:   "Set the w h size of a shape (the end offset for lines)",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//size!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//size!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			w, h, err := pointArgs(ps, "Go(*gioui_org.Scene)//size!", 3, arg2, arg3)
+			if err != nil {
+				return err
+			}
+			s.W, s.H = w, h
+			s.changed()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//bounds?": {
+		Doc:   "Get the bounding box of a shape as a block of x y w h",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//bounds?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//bounds?", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			b := s.bounds()
+			return *env.NewBlock(*env.NewTSeries([]env.Object{
+				*env.NewDecimal(float64(b.Min.X)), *env.NewDecimal(float64(b.Min.Y)),
+				*env.NewDecimal(float64(b.Dx())), *env.NewDecimal(float64(b.Dy())),
+			}))
+		},
+	},
+	"Go(*gioui_org.Scene)//kind?": {
+		Doc:   "Get the kind of a shape: rect, ellipse or line",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//kind?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//kind?", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(s.Kind)
+		},
+	},
+	"Go(*gioui_org.Scene)//raise": {
+		Doc:   "Bring a shape to the front",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//raise", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//raise", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			sc.restack(sc.index(s.ID), len(sc.Shapes)-1)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//lower": {
+		Doc:   "Send a shape to the back",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//lower", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//lower", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			sc.restack(sc.index(s.ID), 0)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//hit?": {
+		Doc:   "Get the id of the topmost shape at x y, or 0",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//hit?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "Go(*gioui_org.Scene)//hit?", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			if s := sc.Hit(f32.Pt(x, y)); s != nil {
+				return *env.NewInteger(int64(s.ID))
+			}
+			return *env.NewInteger(0)
+		},
+	},
+	"Go(*gioui_org.Scene)//shapes?": {
+		Doc:   "Get the ids of all shapes from back to front",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//shapes?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return sc.idsObj(func(*Shape) bool { return true })
+		},
+	},
+	"Go(*gioui_org.Scene)//select!": {
+		Doc:   "Make a shape the only selected one; 0 clears the selection",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//select!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			clear(sc.selected)
+			if i, ok := arg1.(env.Integer); ok && i.Value == 0 {
+				return arg0
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//select!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			sc.selected[s.ID] = true
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//toggle-select!": {
+		Doc:   "Add a shape to the selection or remove it",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//toggle-select!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := shapeArg(ps, "Go(*gioui_org.Scene)//toggle-select!", 2, sc, arg1)
+			if err != nil {
+				return err
+			}
+			if sc.selected[s.ID] {
+				delete(sc.selected, s.ID)
+			} else {
+				sc.selected[s.ID] = true
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Scene)//selected?": {
+		Doc:   "Get the ids of the selected shapes from back to front",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			sc, err := nativeArg[*Scene](ps, "Go(*gioui_org.Scene)//selected?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return sc.idsObj(func(s *Shape) bool { return sc.selected[s.ID] })
+		},
+	},
+}
@@ -0,0 +1,112 @@
+// Screenshots of the window contents.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"sync"
+
+	"gioui.org/gpu/headless"
+	"gioui.org/layout"
+
+	"github.com/refaktor/rye/env"
+)
+
+// The offscreen window frames are replayed into; kept between captures
+// because creating a GPU context is slow.
+var (
+	captureMu  sync.Mutex
+	captureWin *headless.Window
+)
+
+// captureFrame renders the operations recorded so far in gtx offscreen and
+// reads them back. It must be called after laying out the frame and before
+// submitting it to the window.
+func captureFrame(gtx layout.Context) (*image.RGBA, error) {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	size := gtx.Constraints.Max
+	if captureWin != nil && captureWin.Size() != size {
+		captureWin.Release()
+		captureWin = nil
+	}
+	if captureWin == nil {
+		w, err := headless.NewWindow(size.X, size.Y)
+		if err != nil {
+			return nil, err
+		}
+		captureWin = w
+	}
+	if err := captureWin.Frame(gtx.Ops); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	if err := captureWin.Screenshot(img); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func savePNG(img image.Image, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var builtinsScreenshot = map[string]*env.Builtin{
+	"window-screenshot": {
+		Doc:   "Capture what has been laid out in the frame so far into an image; call before submitting the frame",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "window-screenshot", 1, arg0)
+			if err != nil {
+				return err
+			}
+			img, cerr := captureFrame(gtx)
+			if cerr != nil {
+				return failure(ps, "window-screenshot", cerr.Error())
+			}
+			return *env.NewNative(ps.Idx, img, "Go(*image.RGBA)")
+		},
+	},
+	"Go(*image.RGBA)//save-png": {
+		Doc:   "Save the image to a PNG file",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := nativeArg[*image.RGBA](ps, "Go(*image.RGBA)//save-png", 1, arg0)
+			if err != nil {
+				return err
+			}
+			path, err := stringArg(ps, "Go(*image.RGBA)//save-png", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if serr := savePNG(img, path); serr != nil {
+				return failure(ps, "Go(*image.RGBA)//save-png", serr.Error())
+			}
+			return arg0
+		},
+	},
+	"Go(*image.RGBA)//size?": {
+		Doc:   "Get the image width and height in pixels",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			img, err := nativeArg[*image.RGBA](ps, "Go(*image.RGBA)//size?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b := img.Bounds()
+			return *env.NewBlock(*env.NewTSeries([]env.Object{*env.NewInteger(int64(b.Dx())), *env.NewInteger(int64(b.Dy()))}))
+		},
+	},
+}
@@ -0,0 +1,305 @@
+// Search field with debounce, clear button and loading indicator.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// SearchQuery is handed to the query callback. It is cancelled when a newer
+// query supersedes it and finished when its results are in.
+type SearchQuery struct {
+	Text      string
+	cancelled atomic.Bool
+	finished  atomic.Bool
+	search    *SearchInput
+}
+
+// Finish marks the query as done, hiding the loading indicator if it is
+// still the current query.
+func (q *SearchQuery) Finish() {
+	if q.finished.Swap(true) {
+		return
+	}
+	q.search.mu.Lock()
+	win := q.search.win
+	q.search.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+// SearchInput is a single line editor that calls a query function after
+// the text stopped changing for Delay.
+type SearchInput struct {
+	ps       *env.ProgramState
+	Theme    *material.Theme
+	Hint     string
+	Delay    time.Duration
+	editor   widget.Editor
+	clear    widget.Clickable
+	query    *env.Function
+	pending  bool
+	deadline time.Time
+
+	mu      sync.Mutex
+	current *SearchQuery
+	win     *app.Window
+}
+
+func newSearchInput(ps *env.ProgramState, th *material.Theme) *SearchInput {
+	s := &SearchInput{ps: ps, Theme: th, Hint: "Search", Delay: 300 * time.Millisecond}
+	s.editor.SingleLine = true
+	s.editor.Submit = true
+	return s
+}
+
+// Loading reports whether the current query is still running.
+func (s *SearchInput) Loading() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current != nil && !s.current.finished.Load() && !s.current.cancelled.Load()
+}
+
+// fire cancels the running query and starts a new one.
+func (s *SearchInput) fire() {
+	s.pending = false
+	q := &SearchQuery{Text: s.editor.Text(), search: s}
+	s.mu.Lock()
+	if s.current != nil {
+		s.current.cancelled.Store(true)
+	}
+	s.current = q
+	s.mu.Unlock()
+	if s.query == nil {
+		q.Finish()
+		return
+	}
+	qObj := *env.NewNative(s.ps.Idx, q, "Go(*gioui_org.SearchQuery)")
+	res := callFunction(s.ps, "search-input query", *s.query, *env.NewString(q.Text), qObj)
+	// Returning the query means the callback finishes it later (e.g. from
+	// a goroutine); otherwise it's done now.
+	if nat, ok := res.(env.Native); !ok || nat.Value != q {
+		q.Finish()
+	}
+}
+
+func (s *SearchInput) Layout(gtx layout.Context) layout.Dimensions {
+	for {
+		e, ok := s.editor.Update(gtx)
+		if !ok {
+			break
+		}
+		switch e.(type) {
+		case widget.ChangeEvent:
+			s.pending = true
+			s.deadline = gtx.Now.Add(s.Delay)
+		case widget.SubmitEvent:
+			s.fire()
+		}
+	}
+	for s.clear.Clicked(gtx) {
+		s.editor.SetText("")
+		s.fire()
+	}
+	if s.pending {
+		if !gtx.Now.Before(s.deadline) {
+			s.fire()
+		} else {
+			gtx.Execute(op.InvalidateCmd{At: s.deadline})
+		}
+	}
+
+	th := s.Theme
+	return widget.Border{Color: mulAlpha(th.Palette.Fg, 0x60), CornerRadius: 16, Width: 1}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Left: 12, Right: 8, Top: 6, Bottom: 6}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, material.Editor(th, &s.editor, s.Hint).Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if !s.Loading() {
+						return layout.Dimensions{}
+					}
+					d := gtx.Dp(16)
+					gtx.Constraints = layout.Exact(image.Pt(d, d))
+					return layout.Inset{Left: 4}.Layout(gtx, material.Loader(th).Layout)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if s.editor.Len() == 0 {
+						return layout.Dimensions{}
+					}
+					return s.clear.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: 6, Right: 4}.Layout(gtx, material.Label(th, unit.Sp(16), "×").Layout)
+					})
+				}),
+			)
+		})
+	})
+}
+
+var builtinsSearch = map[string]*env.Builtin{
+	"search-input": {
+		Doc:   "Create a search input with a clear button that calls its query function after typing pauses",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "search-input", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newSearchInput(ps, th), "Go(*gioui_org.SearchInput)")
+		},
+	},
+	"Go(*gioui_org.SearchInput)//layout": layoutBuiltin[*SearchInput]("Go(*gioui_org.SearchInput)//layout"),
+	"Go(*gioui_org.SearchInput)//on-query!": {
+		Doc:   "Set function called with the search text and a query handle; return the handle to finish it later with .finish, otherwise it's finished when the function returns",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//on-query!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.SearchInput)//on-query!", 2, 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.query = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SearchInput)//delay!": {
+		Doc:   "Set debounce delay in milliseconds",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//delay!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			ms, err := integerArg(ps, "Go(*gioui_org.SearchInput)//delay!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.Delay = time.Duration(ms) * time.Millisecond
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SearchInput)//hint!": {
+		Doc:   "Set the hint shown when empty",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//hint!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			h, err := stringArg(ps, "Go(*gioui_org.SearchInput)//hint!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.Hint = h
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SearchInput)//text?": {
+		Doc:   "Get the search text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(s.editor.Text())
+		},
+	},
+	"Go(*gioui_org.SearchInput)//text!": {
+		Doc:   "Set the search text and run the query",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//text!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			t, err := stringArg(ps, "Go(*gioui_org.SearchInput)//text!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.editor.SetText(t)
+			s.fire()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SearchInput)//loading?": {
+		Doc:   "Check whether the current query is still running",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//loading?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(s.Loading()))
+		},
+	},
+	"Go(*gioui_org.SearchInput)//window!": {
+		Doc:   "Bind a window that is redrawn when a query finishes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SearchInput](ps, "Go(*gioui_org.SearchInput)//window!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			win, err := nativeArg[*app.Window](ps, "Go(*gioui_org.SearchInput)//window!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.win = win
+			s.mu.Unlock()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SearchQuery)//text?": {
+		Doc:   "Get the text searched for",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			q, err := nativeArg[*SearchQuery](ps, "Go(*gioui_org.SearchQuery)//text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(q.Text)
+		},
+	},
+	"Go(*gioui_org.SearchQuery)//cancelled?": {
+		Doc:   "Check whether a newer query superseded this one",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			q, err := nativeArg[*SearchQuery](ps, "Go(*gioui_org.SearchQuery)//cancelled?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(q.cancelled.Load()))
+		},
+	},
+	"Go(*gioui_org.SearchQuery)//finish": {
+		Doc:   "Mark the query as done, hiding the loading indicator",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			q, err := nativeArg[*SearchQuery](ps, "Go(*gioui_org.SearchQuery)//finish", 1, arg0)
+			if err != nil {
+				return err
+			}
+			q.Finish()
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,81 @@
+// Secrets kept in the platform's keychain.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+
+	"github.com/refaktor/rye/env"
+)
+
+// errNoSecret is returned by getSecret when the keychain has no such
+// secret.
+var errNoSecret = errors.New("no such secret")
+
+// secretArgs reads the service and name a secret is stored under.
+func secretArgs(ps *env.ProgramState, name string, arg0, arg1 env.Object) (string, string, *env.Error) {
+	service, err := stringArg(ps, name, 1, arg0)
+	if err != nil {
+		return "", "", err
+	}
+	key, err := stringArg(ps, name, 2, arg1)
+	if err != nil {
+		return "", "", err
+	}
+	if service == "" || key == "" {
+		return "", "", failure(ps, name, "service and name must not be empty")
+	}
+	return service, key, nil
+}
+
+var builtinsSecret = map[string]*env.Builtin{
+	"secret-set": {
+		Doc:   "Store a secret under a service (usually the app's name) and a name in the platform's keychain (libsecret through secret-tool, macOS Keychain, Windows Credential Manager, Android Keystore), replacing one stored before",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			service, key, err := secretArgs(ps, "secret-set", arg0, arg1)
+			if err != nil {
+				return err
+			}
+			value, err := stringArg(ps, "secret-set", 3, arg2)
+			if err != nil {
+				return err
+			}
+			if serr := setSecret(service, key, value); serr != nil {
+				return failure(ps, "secret-set", serr.Error())
+			}
+			return arg2
+		},
+	},
+	"secret-get": {
+		Doc:   "Get a secret stored under a service and a name in the platform's keychain; fails if there is none",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			service, key, err := secretArgs(ps, "secret-get", arg0, arg1)
+			if err != nil {
+				return err
+			}
+			value, serr := getSecret(service, key)
+			if serr != nil {
+				return failure(ps, "secret-get", serr.Error())
+			}
+			return *env.NewString(value)
+		},
+	},
+	"secret-delete": {
+		Doc:   "Remove a secret from the platform's keychain; removing one that isn't there is not an error",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			service, key, err := secretArgs(ps, "secret-delete", arg0, arg1)
+			if err != nil {
+				return err
+			}
+			if serr := deleteSecret(service, key); serr != nil {
+				return failure(ps, "secret-delete", serr.Error())
+			}
+			return *env.NewInteger(1)
+		},
+	},
+}
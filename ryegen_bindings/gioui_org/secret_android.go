@@ -0,0 +1,280 @@
+//go:build !b_no_gioui
+
+package gioui_org
+
+/*
+#include <jni.h>
+#include <stdlib.h>
+#include <string.h>
+
+// exceptionMessage returns the pending exception as a malloc'ed string,
+// clearing it, or NULL when there is none.
+static char *exceptionMessage(JNIEnv *env) {
+	jthrowable t = (*env)->ExceptionOccurred(env);
+	if (t == NULL) {
+		return NULL;
+	}
+	(*env)->ExceptionClear(env);
+	jclass cls = (*env)->FindClass(env, "java/lang/Throwable");
+	jmethodID toString = (*env)->GetMethodID(env, cls, "toString", "()Ljava/lang/String;");
+	jstring s = (*env)->CallObjectMethod(env, t, toString);
+	if ((*env)->ExceptionCheck(env) || s == NULL) {
+		(*env)->ExceptionClear(env);
+		return strdup("unknown exception");
+	}
+	const char *c = (*env)->GetStringUTFChars(env, s, NULL);
+	char *res = strdup(c);
+	(*env)->ReleaseStringUTFChars(env, s, c);
+	return res;
+}
+
+// keystoreKey returns the AES key of alias in the Android Keystore,
+// generating it the first time. The key never leaves the Keystore.
+static jobject keystoreKey(JNIEnv *env, const char *alias) {
+	jstring jalias = (*env)->NewStringUTF(env, alias);
+	jstring provider = (*env)->NewStringUTF(env, "AndroidKeyStore");
+	jclass ksClass = (*env)->FindClass(env, "java/security/KeyStore");
+	jobject ks = (*env)->CallStaticObjectMethod(env, ksClass,
+		(*env)->GetStaticMethodID(env, ksClass, "getInstance", "(Ljava/lang/String;)Ljava/security/KeyStore;"), provider);
+	if ((*env)->ExceptionCheck(env)) {
+		return NULL;
+	}
+	(*env)->CallVoidMethod(env, ks,
+		(*env)->GetMethodID(env, ksClass, "load", "(Ljava/security/KeyStore$LoadStoreParameter;)V"), NULL);
+	if ((*env)->ExceptionCheck(env)) {
+		return NULL;
+	}
+	jboolean has = (*env)->CallBooleanMethod(env, ks,
+		(*env)->GetMethodID(env, ksClass, "containsAlias", "(Ljava/lang/String;)Z"), jalias);
+	if ((*env)->ExceptionCheck(env)) {
+		return NULL;
+	}
+	if (!has) {
+		jclass kgClass = (*env)->FindClass(env, "javax/crypto/KeyGenerator");
+		jobject kg = (*env)->CallStaticObjectMethod(env, kgClass,
+			(*env)->GetStaticMethodID(env, kgClass, "getInstance", "(Ljava/lang/String;Ljava/lang/String;)Ljavax/crypto/KeyGenerator;"),
+			(*env)->NewStringUTF(env, "AES"), provider);
+		if ((*env)->ExceptionCheck(env)) {
+			return NULL;
+		}
+		// KeyProperties.PURPOSE_ENCRYPT | KeyProperties.PURPOSE_DECRYPT.
+		jclass bClass = (*env)->FindClass(env, "android/security/keystore/KeyGenParameterSpec$Builder");
+		jobject b = (*env)->NewObject(env, bClass,
+			(*env)->GetMethodID(env, bClass, "<init>", "(Ljava/lang/String;I)V"), jalias, 3);
+		if ((*env)->ExceptionCheck(env)) {
+			return NULL;
+		}
+		jclass strClass = (*env)->FindClass(env, "java/lang/String");
+		const char *setter = "([Ljava/lang/String;)Landroid/security/keystore/KeyGenParameterSpec$Builder;";
+		(*env)->CallObjectMethod(env, b, (*env)->GetMethodID(env, bClass, "setBlockModes", setter),
+			(*env)->NewObjectArray(env, 1, strClass, (*env)->NewStringUTF(env, "GCM")));
+		(*env)->CallObjectMethod(env, b, (*env)->GetMethodID(env, bClass, "setEncryptionPaddings", setter),
+			(*env)->NewObjectArray(env, 1, strClass, (*env)->NewStringUTF(env, "NoPadding")));
+		jobject spec = (*env)->CallObjectMethod(env, b,
+			(*env)->GetMethodID(env, bClass, "build", "()Landroid/security/keystore/KeyGenParameterSpec;"));
+		if ((*env)->ExceptionCheck(env)) {
+			return NULL;
+		}
+		(*env)->CallVoidMethod(env, kg,
+			(*env)->GetMethodID(env, kgClass, "init", "(Ljava/security/spec/AlgorithmParameterSpec;)V"), spec);
+		if ((*env)->ExceptionCheck(env)) {
+			return NULL;
+		}
+		(*env)->CallObjectMethod(env, kg, (*env)->GetMethodID(env, kgClass, "generateKey", "()Ljavax/crypto/SecretKey;"));
+		if ((*env)->ExceptionCheck(env)) {
+			return NULL;
+		}
+	}
+	return (*env)->CallObjectMethod(env, ks,
+		(*env)->GetMethodID(env, ksClass, "getKey", "(Ljava/lang/String;[C)Ljava/security/Key;"), jalias, NULL);
+}
+
+// keystoreCrypt encrypts in with AES-GCM under the Keystore key of alias,
+// giving the 12 byte IV followed by the ciphertext, or decrypts such. The
+// result is malloc'ed; errors are returned as malloc'ed messages.
+static char *keystoreCrypt(uintptr_t vmp, const char *alias, int encrypt, const void *in, int n, void **out, int *outn) {
+	JavaVM *vm = (JavaVM *)vmp;
+	JNIEnv *env;
+	int attached = 0;
+	if ((*vm)->GetEnv(vm, (void **)&env, JNI_VERSION_1_6) == JNI_EDETACHED) {
+		if ((*vm)->AttachCurrentThread(vm, &env, NULL) != JNI_OK) {
+			return strdup("cannot attach to the Java VM");
+		}
+		attached = 1;
+	}
+	char *err = NULL;
+	(*env)->PushLocalFrame(env, 32);
+	jobject key = keystoreKey(env, alias);
+	if (key == NULL) {
+		err = exceptionMessage(env);
+		if (err == NULL) {
+			err = strdup("no key in the Android Keystore");
+		}
+		goto done;
+	}
+	if (!encrypt && n < 12) {
+		err = strdup("stored secret is corrupt");
+		goto done;
+	}
+	jclass cClass = (*env)->FindClass(env, "javax/crypto/Cipher");
+	jobject cipher = (*env)->CallStaticObjectMethod(env, cClass,
+		(*env)->GetStaticMethodID(env, cClass, "getInstance", "(Ljava/lang/String;)Ljavax/crypto/Cipher;"),
+		(*env)->NewStringUTF(env, "AES/GCM/NoPadding"));
+	if ((err = exceptionMessage(env)) != NULL) {
+		goto done;
+	}
+	const char *body = in;
+	int bodyn = n;
+	if (encrypt) {
+		(*env)->CallVoidMethod(env, cipher,
+			(*env)->GetMethodID(env, cClass, "init", "(ILjava/security/Key;)V"), 1, key);
+	} else {
+		jbyteArray iv = (*env)->NewByteArray(env, 12);
+		(*env)->SetByteArrayRegion(env, iv, 0, 12, (const jbyte *)in);
+		jclass gClass = (*env)->FindClass(env, "javax/crypto/spec/GCMParameterSpec");
+		jobject spec = (*env)->NewObject(env, gClass, (*env)->GetMethodID(env, gClass, "<init>", "(I[B)V"), 128, iv);
+		(*env)->CallVoidMethod(env, cipher,
+			(*env)->GetMethodID(env, cClass, "init", "(ILjava/security/Key;Ljava/security/spec/AlgorithmParameterSpec;)V"), 2, key, spec);
+		body += 12;
+		bodyn -= 12;
+	}
+	if ((err = exceptionMessage(env)) != NULL) {
+		goto done;
+	}
+	jbyteArray input = (*env)->NewByteArray(env, bodyn);
+	(*env)->SetByteArrayRegion(env, input, 0, bodyn, (const jbyte *)body);
+	jbyteArray output = (*env)->CallObjectMethod(env, cipher, (*env)->GetMethodID(env, cClass, "doFinal", "([B)[B"), input);
+	if ((err = exceptionMessage(env)) != NULL) {
+		goto done;
+	}
+	jbyteArray iv = NULL;
+	int ivn = 0;
+	if (encrypt) {
+		iv = (*env)->CallObjectMethod(env, cipher, (*env)->GetMethodID(env, cClass, "getIV", "()[B"));
+		if ((err = exceptionMessage(env)) != NULL) {
+			goto done;
+		}
+		ivn = (*env)->GetArrayLength(env, iv);
+		if (ivn != 12) {
+			err = strdup("unexpected IV length");
+			goto done;
+		}
+	}
+	int outputn = (*env)->GetArrayLength(env, output);
+	*outn = ivn + outputn;
+	*out = malloc(*outn > 0 ? *outn : 1);
+	if (iv != NULL) {
+		(*env)->GetByteArrayRegion(env, iv, 0, ivn, (jbyte *)*out);
+	}
+	(*env)->GetByteArrayRegion(env, output, 0, outputn, (jbyte *)*out + ivn);
+done:
+	(*env)->PopLocalFrame(env, NULL);
+	if (attached) {
+		(*vm)->DetachCurrentThread(vm);
+	}
+	return err;
+}
+*/
+import "C"
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"unsafe"
+
+	"gioui.org/app"
+)
+
+// Secrets are encrypted with an AES key kept in the Android Keystore, which
+// doesn't store arbitrary data itself, and the ciphertext is kept in the
+// app's private data directory.
+
+// keystoreAlias names the Keystore key secrets are encrypted with.
+const keystoreAlias = "rye-gio-secrets"
+
+func keystoreCrypt(encrypt bool, in []byte) ([]byte, error) {
+	// The JNI environment belongs to the thread it was attached on.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	alias := C.CString(keystoreAlias)
+	defer C.free(unsafe.Pointer(alias))
+	var inp unsafe.Pointer
+	if len(in) > 0 {
+		inp = C.CBytes(in)
+		defer C.free(inp)
+	}
+	enc := C.int(0)
+	if encrypt {
+		enc = 1
+	}
+	var out unsafe.Pointer
+	var n C.int
+	if msg := C.keystoreCrypt(C.uintptr_t(app.JavaVM()), alias, enc, inp, C.int(len(in)), &out, &n); msg != nil {
+		defer C.free(unsafe.Pointer(msg))
+		return nil, errors.New("android keystore: " + C.GoString(msg))
+	}
+	defer C.free(out)
+	return C.GoBytes(out, n), nil
+}
+
+// secretPath returns the file the secret of service and name is kept in.
+func secretPath(service, name string) (string, error) {
+	dir, err := app.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secrets", hex.EncodeToString([]byte(service))+"-"+hex.EncodeToString([]byte(name))), nil
+}
+
+func setSecret(service, name, value string) error {
+	path, err := secretPath(service, name)
+	if err != nil {
+		return err
+	}
+	data, err := keystoreCrypt(true, []byte(value))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Written aside and renamed, so a secret is never left half replaced.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func getSecret(service, name string) (string, error) {
+	path, err := secretPath(service, name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errNoSecret
+	}
+	if err != nil {
+		return "", err
+	}
+	value, err := keystoreCrypt(false, data)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func deleteSecret(service, name string) error {
+	path, err := secretPath(service, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+//go:build !ios && !b_no_gioui
+
+package gioui_org
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Secrets go to the login keychain through the security tool.
+
+// _errSecItemNotFound is the exit status of security for a missing item.
+const _errSecItemNotFound = 44
+
+func security(args ...string) (string, error) {
+	out, err := exec.Command("security", args...).Output()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			if ee.ExitCode() == _errSecItemNotFound {
+				return "", errNoSecret
+			}
+			return "", fmt.Errorf("security: %s", strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// securityInput runs a security command read from its input in interactive
+// mode, so arguments like secrets never show in the process list.
+func securityInput(args ...string) error {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	var line strings.Builder
+	for i, a := range args {
+		// A line break would end the command, and the rest run as another.
+		if strings.ContainsAny(a, "\r\n\x00") {
+			return errors.New("security: values must not contain line breaks")
+		}
+		if i > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(`"` + quote.Replace(a) + `"`)
+	}
+	line.WriteByte('\n')
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(line.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	// Interactive mode reports failed commands but still exits with 0.
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("security: %s", msg)
+	}
+	return err
+}
+
+func setSecret(service, name, value string) error {
+	return securityInput("add-generic-password", "-U", "-s", service, "-a", name, "-w", value)
+}
+
+func getSecret(service, name string) (string, error) {
+	out, err := security("find-generic-password", "-s", service, "-a", name, "-w")
+	return strings.TrimSuffix(out, "\n"), err
+}
+
+func deleteSecret(service, name string) error {
+	_, err := security("delete-generic-password", "-s", service, "-a", name)
+	if err == errNoSecret {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+//go:build !android && !b_no_gioui
+
+package gioui_org
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Secrets go to the Secret Service (GNOME Keyring, KWallet) through
+// libsecret's secret-tool, which reads the secret from its input so it
+// never shows in the process list.
+
+func secretTool(input string, args ...string) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", errors.New("secrets need secret-tool (libsecret-tools)")
+	}
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(input)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("secret-tool: %s", msg)
+		}
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func setSecret(service, name, value string) error {
+	_, err := secretTool(value, "store", "--label="+service+" "+name, "service", service, "account", name)
+	return err
+}
+
+func getSecret(service, name string) (string, error) {
+	out, err := secretTool("", "lookup", "service", service, "account", name)
+	if err != nil {
+		// lookup exits with 1 and says nothing when there is no secret.
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return "", errNoSecret
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+func deleteSecret(service, name string) error {
+	_, err := secretTool("", "clear", "service", service, "account", name)
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build !linux && (!darwin || ios) && !windows && !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"runtime"
+)
+
+// The iOS Keychain is reached through Objective-C APIs Gio doesn't bind.
+
+func errSecrets() error {
+	return errors.New("secrets are not supported on " + runtime.GOOS)
+}
+
+func setSecret(service, name, value string) error { return errSecrets() }
+
+func getSecret(service, name string) (string, error) { return "", errSecrets() }
+
+func deleteSecret(service, name string) error { return errSecrets() }
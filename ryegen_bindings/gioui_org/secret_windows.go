@@ -0,0 +1,103 @@
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Secrets go to the Windows Credential Manager as generic credentials.
+
+var (
+	advapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+const (
+	_CRED_TYPE_GENERIC          = 1
+	_CRED_PERSIST_LOCAL_MACHINE = 2
+	_ERROR_NOT_FOUND            = 1168
+)
+
+type credential struct {
+	flags              uint32
+	typ                uint32
+	targetName         *uint16
+	comment            *uint16
+	lastWritten        syscall.Filetime
+	credentialBlobSize uint32
+	credentialBlob     *byte
+	persist            uint32
+	attributeCount     uint32
+	attributes         uintptr
+	targetAlias        *uint16
+	userName           *uint16
+}
+
+// credentialTarget names the credential, as it shows in the Credential
+// Manager.
+func credentialTarget(service, name string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(service + "/" + name)
+}
+
+func setSecret(service, name, value string) error {
+	target, err := credentialTarget(service, name)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	blob := []byte(value)
+	c := credential{
+		typ:                _CRED_TYPE_GENERIC,
+		targetName:         target,
+		credentialBlobSize: uint32(len(blob)),
+		persist:            _CRED_PERSIST_LOCAL_MACHINE,
+		userName:           user,
+	}
+	if len(blob) > 0 {
+		c.credentialBlob = &blob[0]
+	}
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&c)), 0); r == 0 {
+		return err
+	}
+	return nil
+}
+
+func getSecret(service, name string) (string, error) {
+	target, err := credentialTarget(service, name)
+	if err != nil {
+		return "", err
+	}
+	var c *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), _CRED_TYPE_GENERIC, 0, uintptr(unsafe.Pointer(&c)))
+	if r == 0 {
+		if err == syscall.Errno(_ERROR_NOT_FOUND) {
+			return "", errNoSecret
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(c)))
+	if c.credentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(c.credentialBlob, c.credentialBlobSize)), nil
+}
+
+func deleteSecret(service, name string) error {
+	target, err := credentialTarget(service, name)
+	if err != nil {
+		return err
+	}
+	r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), _CRED_TYPE_GENERIC, 0)
+	if r == 0 && err != syscall.Errno(_ERROR_NOT_FOUND) {
+		return err
+	}
+	return nil
+}
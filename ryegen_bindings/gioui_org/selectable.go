@@ -0,0 +1,172 @@
+// Labels with selectable and copyable text.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"io"
+	"strings"
+
+	"gioui.org/io/clipboard"
+	"gioui.org/io/event"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// SelectableLabel is a label whose text can be selected with the mouse or
+// keyboard and copied with the usual shortcut.
+type SelectableLabel struct {
+	Style material.LabelStyle
+	state widget.Selectable
+}
+
+func (s *SelectableLabel) Layout(gtx layout.Context) layout.Dimensions {
+	s.Style.State = &s.state
+	return s.Style.Layout(gtx)
+}
+
+func (s *SelectableLabel) FocusTag() event.Tag { return &s.state }
+
+var builtinsSelectable = map[string]*env.Builtin{
+	"selectable-label": {
+		Doc:   "Create a label of a text size whose text can be selected and copied",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "selectable-label", 1, arg0)
+			if err != nil {
+				return err
+			}
+			size, err := decimalArg(ps, "selectable-label", 2, arg1)
+			if err != nil {
+				return err
+			}
+			txt, err := stringArg(ps, "selectable-label", 3, arg2)
+			if err != nil {
+				return err
+			}
+			s := &SelectableLabel{Style: material.Label(th, unit.Sp(size), txt)}
+			return *env.NewNative(ps.Idx, s, "Go(*gioui_org.SelectableLabel)")
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//layout": layoutBuiltin[*SelectableLabel]("Go(*gioui_org.SelectableLabel)//layout"),
+	"Go(*gioui_org.SelectableLabel)//text?": {
+		Doc:   "Get the label text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(s.Style.Text)
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//text!": {
+		Doc:   "Set the label text, clearing the selection",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//text!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			txt, err := stringArg(ps, "Go(*gioui_org.SelectableLabel)//text!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.Style.Text = txt
+			s.state.SetText(txt)
+			s.state.ClearSelection()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//selected-text?": {
+		Doc:   "Get the selected text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//selected-text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewString(s.state.SelectedText())
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//select-all": {
+		Doc:   "Select the whole text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//select-all", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s.state.SetText(s.Style.Text)
+			s.state.SetCaret(0, len([]rune(s.Style.Text)))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//clear-selection": {
+		Doc:   "Deselect the text",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//clear-selection", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s.state.ClearSelection()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//copy": {
+		Doc:   "Copy the selected text, or the whole text when nothing is selected, to the clipboard",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//copy", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.SelectableLabel)//copy", 2, arg1)
+			if err != nil {
+				return err
+			}
+			txt := s.state.SelectedText()
+			if txt == "" {
+				txt = s.Style.Text
+			}
+			gtx.Execute(clipboard.WriteCmd{Type: "application/text", Data: io.NopCloser(strings.NewReader(txt))})
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//max-lines!": {
+		Doc:   "Set the maximum number of lines, ending with an ellipsis when cut; 0 for no limit",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//max-lines!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := integerArg(ps, "Go(*gioui_org.SelectableLabel)//max-lines!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.Style.MaxLines = int(n)
+			if s.Style.Truncator == "" {
+				s.Style.Truncator = "…"
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.SelectableLabel)//truncated?": {
+		Doc:   "Check whether the text was cut at the last layout",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*SelectableLabel](ps, "Go(*gioui_org.SelectableLabel)//truncated?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(s.state.Truncated()))
+		},
+	},
+}
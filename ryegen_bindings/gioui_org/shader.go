@@ -0,0 +1,156 @@
+// Widgets filled by a Rye function of each point.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// ShaderWidget fills its area with the colors a function gives for each
+// point, like a fragment shader. The function runs for a grid of cells
+// rather than every pixel, and the grid is scaled up smoothly, so effects
+// should be soft: gradients, plasma, glows behind other widgets.
+type ShaderWidget struct {
+	ps      *env.ProgramState
+	fn      env.Function
+	Cell    unit.Dp
+	Animate bool
+	start   time.Time
+	pointer f32.Point // relative to the area, or -1, -1 outside it
+	img     *image.NRGBA
+	failed  bool
+}
+
+func (s *ShaderWidget) update(gtx layout.Context, size image.Point) {
+	for {
+		e, ok := gtx.Event(pointer.Filter{Target: s, Kinds: pointer.Move | pointer.Drag | pointer.Enter | pointer.Leave | pointer.Cancel})
+		if !ok {
+			break
+		}
+		pe := e.(pointer.Event)
+		switch pe.Kind {
+		case pointer.Leave, pointer.Cancel:
+			s.pointer = f32.Pt(-1, -1)
+		default:
+			s.pointer = f32.Pt(pe.Position.X/float32(size.X), pe.Position.Y/float32(size.Y))
+		}
+	}
+}
+
+// shade fills img with the colors of the function at the centers of its
+// pixels, as x and y from 0 to 1.
+func (s *ShaderWidget) shade(t float64) {
+	b := s.img.Rect
+	args := []env.Object{nil, nil, *env.NewDecimal(t), *env.NewDecimal(float64(s.pointer.X)), *env.NewDecimal(float64(s.pointer.Y))}
+	for y := 0; y < b.Dy(); y++ {
+		args[1] = *env.NewDecimal((float64(y) + 0.5) / float64(b.Dy()))
+		for x := 0; x < b.Dx(); x++ {
+			args[0] = *env.NewDecimal((float64(x) + 0.5) / float64(b.Dx()))
+			res := callFunction(s.ps, "shader-widget", s.fn, args...)
+			c, err := colorArg(s.ps, "shader-widget function", 1, res)
+			if err != nil {
+				s.failed = true
+				return
+			}
+			s.img.SetNRGBA(x, y, c)
+		}
+	}
+}
+
+func (s *ShaderWidget) Layout(gtx layout.Context) layout.Dimensions {
+	size := gtx.Constraints.Max
+	if size.X <= 0 || size.Y <= 0 {
+		return layout.Dimensions{Size: gtx.Constraints.Min}
+	}
+	s.update(gtx, size)
+	if s.start.IsZero() {
+		s.start = gtx.Now
+	}
+	cell := max(gtx.Dp(s.Cell), 1)
+	grid := image.Pt((size.X+cell-1)/cell, (size.Y+cell-1)/cell)
+	if s.img == nil || s.img.Rect.Size() != grid {
+		s.img = image.NewNRGBA(image.Rectangle{Max: grid})
+	}
+	if !s.failed {
+		s.shade(gtx.Now.Sub(s.start).Seconds())
+	}
+	if s.Animate && !s.failed {
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	defer pointer.PassOp{}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, s)
+	img := paint.NewImageOp(s.img)
+	img.Filter = paint.FilterLinear
+	scale := f32.Pt(float32(size.X)/float32(grid.X), float32(size.Y)/float32(grid.Y))
+	tr := op.Affine(f32.Affine2D{}.Scale(f32.Point{}, scale)).Push(gtx.Ops)
+	img.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	tr.Pop()
+	return layout.Dimensions{Size: size}
+}
+
+var builtinsShader = map[string]*env.Builtin{
+	"shader-widget": {
+		Doc:   "Create a widget filling its area with the color a function of x y (0 to 1 across it), time t in seconds and pointer px py (-1 outside) returns for each point; it animates and runs per cell of 8dp",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			fn, err := functionArg(ps, "shader-widget", 1, 5, arg0)
+			if err != nil {
+				return err
+			}
+			s := &ShaderWidget{ps: ps, fn: fn, Cell: 8, Animate: true, pointer: f32.Pt(-1, -1)}
+			return *env.NewNative(ps.Idx, s, "Go(*gioui_org.ShaderWidget)")
+		},
+	},
+	"Go(*gioui_org.ShaderWidget)//layout": layoutBuiltin[*ShaderWidget]("Go(*gioui_org.ShaderWidget)//layout"),
+	"Go(*gioui_org.ShaderWidget)//cell!": {
+		Doc:   "Set the size in dp of the cells the function runs for (8 by default); smaller is sharper and slower",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*ShaderWidget](ps, "Go(*gioui_org.ShaderWidget)//cell!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			d, err := decimalArg(ps, "Go(*gioui_org.ShaderWidget)//cell!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if d <= 0 {
+				return failure(ps, "Go(*gioui_org.ShaderWidget)//cell!", "cell size must be positive")
+			}
+			s.Cell = unit.Dp(d)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.ShaderWidget)//animate!": {
+		Doc:   "Set whether the widget redraws every frame (true by default); without, it redraws when the window does",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*ShaderWidget](ps, "Go(*gioui_org.ShaderWidget)//animate!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, err := integerArg(ps, "Go(*gioui_org.ShaderWidget)//animate!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			s.Animate = b != 0
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,131 @@
+// CSS-like shorthands for spacing and alignment.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"gioui.org/layout"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// insetArg accepts a number for all sides or a block of 2, 3 or 4 in CSS
+// order ([ vertical horizontal ], [ top horizontal bottom ], [ top right
+// bottom left ]), in dp, besides what structArg takes.
+func insetArg(ps *env.ProgramState, name string, n int, arg env.Object) (layout.Inset, *env.Error) {
+	switch v := arg.(type) {
+	case env.Integer, env.Decimal:
+		d, err := decimalArg(ps, name, n, v)
+		if err != nil {
+			return layout.Inset{}, err
+		}
+		return layout.UniformInset(unit.Dp(d)), nil
+	case env.Block:
+		s := v.Series.S
+		ds := make([]unit.Dp, len(s))
+		for i, o := range s {
+			d, err := decimalArg(ps, name, n, o)
+			if err != nil {
+				return layout.Inset{}, err
+			}
+			ds[i] = unit.Dp(d)
+		}
+		switch len(ds) {
+		case 1:
+			return layout.UniformInset(ds[0]), nil
+		case 2:
+			return layout.Inset{Top: ds[0], Right: ds[1], Bottom: ds[0], Left: ds[1]}, nil
+		case 3:
+			return layout.Inset{Top: ds[0], Right: ds[1], Bottom: ds[2], Left: ds[1]}, nil
+		case 4:
+			return layout.Inset{Top: ds[0], Right: ds[1], Bottom: ds[2], Left: ds[3]}, nil
+		}
+		return layout.Inset{}, argError(ps, name, n, "block of 1 to 4 numbers", arg)
+	}
+	return structArg[layout.Inset](ps, name, n, arg)
+}
+
+func insetBuiltin(name, doc string) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			in, err := insetArg(ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, name, 3, arg2)
+			if err != nil {
+				return err
+			}
+			return dimensionsObj(ps, in.Layout(gtx, w))
+		},
+	}
+}
+
+// alignWords are the CSS-like names of directions, besides the compass
+// names of layout.Direction (n, se, center, ...).
+var alignWords = map[string]layout.Direction{
+	"top":          layout.N,
+	"bottom":       layout.S,
+	"left":         layout.W,
+	"right":        layout.E,
+	"start":        layout.W,
+	"end":          layout.E,
+	"top-left":     layout.NW,
+	"top-right":    layout.NE,
+	"bottom-left":  layout.SW,
+	"bottom-right": layout.SE,
+}
+
+var builtinsShorthand = map[string]*env.Builtin{
+	"pad":    insetBuiltin("pad", "Lay out a widget with padding of a number of dp on all sides or a block in CSS order ([ 8 16 ] is 8 top and bottom, 16 left and right)"),
+	"margin": insetBuiltin("margin", "Lay out a widget with a margin, given like pad's padding; Gio has no box model, so it is the same as pad"),
+	"align": {
+		Doc:   "Lay out a widget aligned in the space it is given: 'center, 'top, 'bottom-right, ... or a compass direction ('ne)",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			var dir layout.Direction
+			n, err := nameArg(ps, "align", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if d, ok := alignWords[n]; ok {
+				dir = d
+			} else {
+				v, err := enumArg(ps, "align", 1, "layout.Direction", enums["layout.Direction"], arg0)
+				if err != nil {
+					return err
+				}
+				dir = layout.Direction(v)
+			}
+			gtx, err := contextArg(ps, "align", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "align", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return dimensionsObj(ps, dir.Layout(gtx, w))
+		},
+	},
+	"gap": {
+		Doc:   "Get a flex child of empty space of a number of dp, to put between the children of a flex",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := decimalArg(ps, "gap", 1, arg0)
+			if err != nil {
+				return err
+			}
+			child := layout.Rigid(layout.Spacer{Width: unit.Dp(d), Height: unit.Dp(d)}.Layout)
+			return *env.NewNative(ps.Idx, &child, "Go(*layout.FlexChild)")
+		},
+	},
+}
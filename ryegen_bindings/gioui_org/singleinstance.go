@@ -0,0 +1,137 @@
+// Single-instance apps activated over a local socket.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"gioui.org/io/system"
+
+	"github.com/refaktor/rye/env"
+)
+
+// instanceSocket is the path of the socket the running instance of the app
+// id listens on, private to the user.
+func instanceSocket(id string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "rye-"+id+".sock")
+}
+
+// activate passes args to the running instance listening on path; it
+// fails if there is none.
+func activate(path string, args []string) error {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return json.NewEncoder(c).Encode(args)
+}
+
+// connRefused reports whether err is a refused connection, as to a socket
+// nobody listens on. Windows reports WSAECONNREFUSED, which syscall doesn't
+// map to ECONNREFUSED there.
+func connRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.Errno(10061))
+}
+
+// listenInstance makes this the running instance, sending the args of each
+// later launch to ch. A socket left by an instance that crashed, which
+// refuses connections, is replaced; one that is listened on is not.
+func listenInstance(path string, ch chan<- []string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		c, derr := net.Dial("unix", path)
+		if derr == nil {
+			c.Close()
+			return nil, errors.New("another instance is running")
+		}
+		if !connRefused(derr) {
+			return nil, err
+		}
+		os.Remove(path)
+		if l, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+	}
+	go func() {
+		defer close(ch)
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var args []string
+			err = json.NewDecoder(c).Decode(&args)
+			c.Close()
+			if err == nil {
+				ch <- args
+			}
+		}
+	}()
+	return l, nil
+}
+
+func argsObj(ps *env.ProgramState, args []string) env.Object {
+	objs := make([]env.Object, len(args))
+	for i, a := range args {
+		objs[i] = *env.NewString(a)
+	}
+	return *env.NewBlock(*env.NewTSeries(objs))
+}
+
+var builtinsSingleInstance = map[string]*env.Builtin{
+	"single-instance": {
+		Doc:   "Run the app once per user: if an instance with the id runs, pass it a block of strings (like the command line) and exit; else get a stream of the blocks later launches pass. A window set with wake! is also raised",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			id, err := stringArg(ps, "single-instance", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if id == "" || strings.ContainsAny(id, `/\`) {
+				return failure(ps, "single-instance", "id must be a name, not a path")
+			}
+			args, err := sliceArg[string](ps, "single-instance", 2, arg1)
+			if err != nil {
+				return err
+			}
+			path := instanceSocket(id)
+			if activate(path, args) == nil {
+				os.Exit(0)
+			}
+			ch := make(chan []string)
+			raised := make(chan []string)
+			l, lerr := listenInstance(path, ch)
+			if lerr != nil {
+				return failure(ps, "single-instance", lerr.Error())
+			}
+			s := newEventStream(raised, argsObj, func() { l.Close(); os.Remove(path) })
+			st := s.streamState
+			go func() {
+				defer close(raised)
+				for args := range ch {
+					raised <- args
+					st.mu.Lock()
+					win := st.win
+					st.mu.Unlock()
+					if win != nil {
+						win.Perform(system.ActionRaise)
+					}
+				}
+			}()
+			return streamObj(ps, s)
+		},
+	},
+}
@@ -0,0 +1,188 @@
+// Go slices from Rye blocks and back.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/input"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+
+	"github.com/refaktor/rye/env"
+)
+
+// sliceArg converts a block to a []T, each item as setValue converts it:
+// natives of T or *T (the generated bindings wrap structs in pointers, so
+// a Go(*pointer.Filter) works as an event.Filter), dicts for structs and
+// blocks of numbers for points ([ [ 0 0 ] [ 10 5 ] ] is a []f32.Point).
+func sliceArg[T any](ps *env.ProgramState, name string, n int, arg env.Object) ([]T, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block", arg)
+	}
+	res := make([]T, len(blk.Series.S))
+	for i, it := range blk.Series.S {
+		path := fmt.Sprintf("%s: arg %d: item %d", name, n, i+1)
+		if err := setValue(ps, path, reflect.ValueOf(&res[i]).Elem(), it); err != nil {
+			ps.FailureFlag = true
+			return nil, env.NewError(err.Error())
+		}
+	}
+	return res, nil
+}
+
+// nativeKindOf returns the kind the generated bindings give natives of t:
+// Go(*layout.FlexChild) for structs, which are passed by pointer, and
+// Go(unit.Dp) otherwise.
+func nativeKindOf(t reflect.Type) string {
+	if t.Kind() == reflect.Struct {
+		return "Go(*" + t.String() + ")"
+	}
+	return "Go(" + t.String() + ")"
+}
+
+// sliceObj converts a Go slice to a block of natives. Structs are copied
+// and wrapped in pointers; interface items get the kind of their dynamic
+// type, like values the generated bindings return.
+func sliceObj[T any](ps *env.ProgramState, s []T) env.Object {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	kind := nativeKindOf(t)
+	items := make([]env.Object, len(s))
+	for i, it := range s {
+		switch {
+		case t.Kind() == reflect.Interface:
+			items[i] = ifaceToNative(ps.Idx, it, kind)
+		case t.Kind() == reflect.Struct:
+			items[i] = *env.NewNative(ps.Idx, &it, kind)
+		default:
+			items[i] = *env.NewNative(ps.Idx, it, kind)
+		}
+	}
+	return *env.NewBlock(*env.NewTSeries(items))
+}
+
+// eventBuiltin replaces a generated "Kind//event" builtin so the filters
+// go through sliceArg. The generated one passes Go(*pointer.Filter)
+// natives on as pointers, which the router doesn't recognize as filters.
+func eventBuiltin[T any](name string, source func(T) input.Source) *env.Builtin {
+	return &env.Builtin{
+		Doc:   "Get the next event matching a block of filters, as a block of the event and whether there was one",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			src, err := nativeArg[T](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			filters, err := sliceArg[event.Filter](ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			ev, ok := source(src).Event(filters...)
+			return *env.NewBlock(*env.NewTSeries([]env.Object{
+				ifaceToNative(ps.Idx, ev, "Go(event.Event)"),
+				*env.NewInteger(boolToInt64(ok)),
+			}))
+		},
+	}
+}
+
+// polygonPath returns the outline through points, closed if close is set.
+func polygonPath(gtx layout.Context, points []f32.Point, close bool) clip.PathSpec {
+	var p clip.Path
+	p.Begin(gtx.Ops)
+	for i, pt := range points {
+		if i == 0 {
+			p.MoveTo(pt)
+		} else {
+			p.LineTo(pt)
+		}
+	}
+	if close {
+		p.Close()
+	}
+	return p.End()
+}
+
+func polygonArgs(ps *env.ProgramState, name string, arg0, arg1, arg2 env.Object) (layout.Context, color.NRGBA, []f32.Point, *env.Error) {
+	gtx, err := contextArg(ps, name, 1, arg0)
+	if err != nil {
+		return gtx, color.NRGBA{}, nil, err
+	}
+	c, err := colorArg(ps, name, 2, arg1)
+	if err != nil {
+		return gtx, c, nil, err
+	}
+	points, err := sliceArg[f32.Point](ps, name, 3, arg2)
+	if err != nil {
+		return gtx, c, nil, err
+	}
+	if len(points) < 2 {
+		return gtx, c, nil, failure(ps, name, "expected at least 2 points")
+	}
+	return gtx, c, points, nil
+}
+
+var builtinsSlices = map[string]*env.Builtin{
+	"Go(*input.Router)//event":   eventBuiltin("Go(*input.Router)//event", func(r *input.Router) input.Source { return r.Source() }),
+	"Go(*input.Source)//event":   eventBuiltin("Go(*input.Source)//event", func(s *input.Source) input.Source { return *s }),
+	"Go(*layout.Context)//event": eventBuiltin("Go(*layout.Context)//event", func(gtx *layout.Context) input.Source { return gtx.Source }),
+	"Go(*layout.Context)//events": {
+		Doc:   "Get a block of all pending events matching a block of filters",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, err := contextArg(ps, "Go(*layout.Context)//events", 1, arg0)
+			if err != nil {
+				return err
+			}
+			filters, err := sliceArg[event.Filter](ps, "Go(*layout.Context)//events", 2, arg1)
+			if err != nil {
+				return err
+			}
+			var evs []event.Event
+			for {
+				ev, ok := gtx.Event(filters...)
+				if !ok {
+					break
+				}
+				evs = append(evs, ev)
+			}
+			return sliceObj(ps, evs)
+		},
+	},
+	"fill-polygon": {
+		Doc:   "Fill the polygon through a block of points ([ x y ] blocks or f32.Point natives) with a color",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, c, points, err := polygonArgs(ps, "fill-polygon", arg0, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			paint.FillShape(gtx.Ops, c, clip.Outline{Path: polygonPath(gtx, points, true)}.Op())
+			return arg0
+		},
+	},
+	"stroke-polyline": {
+		Doc:   "Draw lines of a width through a block of points ([ x y ] blocks or f32.Point natives) with a color",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			gtx, c, points, err := polygonArgs(ps, "stroke-polyline", arg0, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			w, err := decimalArg(ps, "stroke-polyline", 4, arg3)
+			if err != nil {
+				return err
+			}
+			paint.FillShape(gtx.Ops, c, clip.Stroke{Path: polygonPath(gtx, points, false), Width: float32(w)}.Op())
+			return arg0
+		},
+	},
+}
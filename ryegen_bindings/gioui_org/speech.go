@@ -0,0 +1,282 @@
+// Text to speech and microphone capture through the system's tools.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/refaktor/rye/env"
+)
+
+// speechCommand returns the command speaking the text it reads from its
+// standard input.
+func speechCommand() (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("say", "-f", "-"), nil
+	case "windows":
+		return exec.Command("powershell", "-NoProfile", "-Command",
+			"Add-Type -AssemblyName System.Speech; (New-Object System.Speech.Synthesis.SpeechSynthesizer).Speak([Console]::In.ReadToEnd())"), nil
+	case "linux", "freebsd", "openbsd":
+		for _, c := range [][]string{{"espeak-ng", "--stdin"}, {"espeak", "--stdin"}, {"spd-say", "-w", "-e"}} {
+			if _, err := exec.LookPath(c[0]); err == nil {
+				return exec.Command(c[0], c[1:]...), nil
+			}
+		}
+		return nil, errors.New("speaking needs espeak-ng, espeak or spd-say")
+	}
+	return nil, errors.New("speaking is not supported on " + runtime.GOOS)
+}
+
+var (
+	speechMu sync.Mutex
+	speech   *exec.Cmd // the command speaking, if any
+)
+
+// speak starts speaking text, cutting off what was being said.
+func speak(text string) error {
+	stopSpeaking()
+	cmd, err := speechCommand()
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	speechMu.Lock()
+	speech = cmd
+	speechMu.Unlock()
+	go func() {
+		cmd.Wait()
+		speechMu.Lock()
+		if speech == cmd {
+			speech = nil
+		}
+		speechMu.Unlock()
+	}()
+	return nil
+}
+
+func stopSpeaking() {
+	speechMu.Lock()
+	defer speechMu.Unlock()
+	if speech != nil {
+		speech.Process.Kill()
+		speech = nil
+	}
+}
+
+// AudioCapture records the default microphone to a WAV file until stopped.
+type AudioCapture struct {
+	Path  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser // ffmpeg stops on q
+	done  chan struct{}
+}
+
+var (
+	capturesMu sync.Mutex
+	captures   = map[*AudioCapture]bool{}
+)
+
+func startCapture(path string) (*AudioCapture, error) {
+	c := &AudioCapture{Path: path, done: make(chan struct{})}
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		if _, err := exec.LookPath("arecord"); err == nil {
+			c.cmd = exec.Command("arecord", "-q", "-f", "cd", "-t", "wav", path)
+		} else {
+			c.cmd = exec.Command("parecord", "--file-format=wav", path)
+		}
+	case "darwin":
+		c.cmd = exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "avfoundation", "-i", ":0", path)
+		in, err := c.cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		c.stdin = in
+	case "windows":
+		mic, err := dshowMicrophone()
+		if err != nil {
+			return nil, err
+		}
+		c.cmd = exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "dshow", "-i", "audio="+mic, path)
+		in, err := c.cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		c.stdin = in
+	default:
+		return nil, errors.New("audio capture is not supported on " + runtime.GOOS)
+	}
+	c.cmd.Stderr = os.Stderr
+	if err := c.cmd.Start(); err != nil {
+		return nil, errors.New("audio capture needs " + c.cmd.Args[0] + ": " + err.Error())
+	}
+	capturesMu.Lock()
+	captures[c] = true
+	capturesMu.Unlock()
+	go func() {
+		c.cmd.Wait()
+		capturesMu.Lock()
+		delete(captures, c)
+		capturesMu.Unlock()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// dshowMicrophone returns the name of the first DirectShow audio input,
+// which ffmpeg only tells in the device listing it logs. Newer versions
+// mark each device with its kind, older ones list audio devices under a
+// heading.
+func dshowMicrophone() (string, error) {
+	out, err := exec.Command("ffmpeg", "-hide_banner", "-list_devices", "true", "-f", "dshow", "-i", "dummy").CombinedOutput()
+	if len(out) == 0 && err != nil {
+		return "", errors.New("audio capture needs ffmpeg: " + err.Error())
+	}
+	audio := false
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, "DirectShow audio devices") {
+			audio = true
+			continue
+		}
+		if strings.Contains(line, "DirectShow video devices") {
+			audio = false
+			continue
+		}
+		if strings.Contains(line, "Alternative name") {
+			continue
+		}
+		i := strings.IndexByte(line, '"')
+		j := strings.LastIndexByte(line, '"')
+		if i < 0 || j <= i {
+			continue
+		}
+		if audio || strings.HasSuffix(strings.TrimSpace(line), "(audio)") {
+			return line[i+1 : j], nil
+		}
+	}
+	return "", errors.New("no microphone found")
+}
+
+// Stop ends the recording, letting the recorder finish the file.
+func (c *AudioCapture) Stop() {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	if c.stdin != nil {
+		io.WriteString(c.stdin, "q")
+		c.stdin.Close()
+	} else {
+		c.cmd.Process.Signal(os.Interrupt)
+	}
+	<-c.done
+}
+
+func (c *AudioCapture) Recording() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// stopAudio stops speaking and all recordings, as the window closes.
+func stopAudio() {
+	stopSpeaking()
+	capturesMu.Lock()
+	var cs []*AudioCapture
+	for c := range captures {
+		cs = append(cs, c)
+	}
+	capturesMu.Unlock()
+	for _, c := range cs {
+		c.Stop()
+	}
+}
+
+var builtinsSpeech = map[string]*env.Builtin{
+	"speak": {
+		Doc:   "Start speaking a text with the system's voice (espeak-ng, espeak or spd-say on Linux), cutting off what was being said",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			text, err := stringArg(ps, "speak", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if serr := speak(text); serr != nil {
+				return failure(ps, "speak", serr.Error())
+			}
+			return arg0
+		},
+	},
+	"stop-speaking": {
+		Doc:   "Stop speaking",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			stopSpeaking()
+			return *env.NewInteger(1)
+		},
+	},
+	"speaking?": {
+		Doc:   "Check whether a text is being spoken",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			speechMu.Lock()
+			defer speechMu.Unlock()
+			return *env.NewInteger(boolToInt64(speech != nil))
+		},
+	},
+	"record-audio": {
+		Doc:   "Start recording the microphone to a WAV file (with arecord or parecord on Linux, ffmpeg on macOS and Windows); recordings stop when the window closes",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "record-audio", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c, cerr := startCapture(path)
+			if cerr != nil {
+				return failure(ps, "record-audio", cerr.Error())
+			}
+			trackResource(c, (*AudioCapture).Stop)
+			return *env.NewNative(ps.Idx, c, "Go(*gioui_org.AudioCapture)")
+		},
+	},
+	"Go(*gioui_org.AudioCapture)//stop": {
+		Doc:   "Stop recording and finish the file",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*AudioCapture](ps, "Go(*gioui_org.AudioCapture)//stop", 1, arg0)
+			if err != nil {
+				return err
+			}
+			c.Stop()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.AudioCapture)//recording?": {
+		Doc:   "Check whether the microphone is still being recorded",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			c, err := nativeArg[*AudioCapture](ps, "Go(*gioui_org.AudioCapture)//recording?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(c.Recording()))
+		},
+	},
+}
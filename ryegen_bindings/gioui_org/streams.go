@@ -0,0 +1,310 @@
+// Go channels as Rye event streams.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gioui.org/app"
+
+	"github.com/refaktor/rye/env"
+)
+
+// EventStream queues the values received from a Go channel until the
+// script takes them. Rye runs on one goroutine, so values are converted to
+// Rye objects and handlers called only when the script asks: await and
+// next take one value, poll hands the queued ones to the on-next handler.
+// A window set with wake! is invalidated when a value arrives, so a UI
+// loop can poll every frame.
+type EventStream struct {
+	*streamState
+}
+
+// streamState is what an EventStream shares with the goroutine feeding it,
+// which mustn't keep the stream itself from being collected.
+type streamState struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []func(ps *env.ProgramState) env.Object
+	closed  bool
+	win     *app.Window
+	handler *env.Function
+	stop    func()
+}
+
+// newEventStream forwards the values of ch to a new stream, converting
+// each with conv on the script's goroutine. stop, if set, is called by
+// close to make the channel's producer stop.
+func newEventStream[T any](ch <-chan T, conv func(ps *env.ProgramState, v T) env.Object, stop func()) *EventStream {
+	st := &streamState{stop: stop}
+	st.cond = sync.NewCond(&st.mu)
+	go func() {
+		for v := range ch {
+			st.push(func(ps *env.ProgramState) env.Object { return conv(ps, v) })
+		}
+		st.finish()
+	}()
+	return &EventStream{st}
+}
+
+func (s *streamState) push(v func(ps *env.ProgramState) env.Object) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.queue = append(s.queue, v)
+	win := s.win
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+// finish marks the stream as ended; queued values can still be taken.
+func (s *streamState) finish() {
+	s.mu.Lock()
+	s.closed = true
+	win := s.win
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+// Close ends the stream and stops its producer.
+func (s *streamState) Close() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	s.finish()
+}
+
+// Await waits up to timeout (forever if 0) for a value. ok is false if the
+// stream ended or the time ran out.
+func (s *streamState) Await(timeout time.Duration) (v func(ps *env.ProgramState) env.Object, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			s.mu.Lock()
+			timeout = -1
+			s.mu.Unlock()
+			s.cond.Broadcast()
+		})
+		defer t.Stop()
+	}
+	for len(s.queue) == 0 && !s.closed && timeout >= 0 {
+		s.cond.Wait()
+	}
+	return s.take()
+}
+
+// Next takes a queued value without waiting.
+func (s *streamState) Next() (v func(ps *env.ProgramState) env.Object, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.take()
+}
+
+func (s *streamState) take() (func(ps *env.ProgramState) env.Object, bool) {
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	v := s.queue[0]
+	s.queue = s.queue[1:]
+	return v, true
+}
+
+func (s *streamState) ended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed && len(s.queue) == 0
+}
+
+// streamBuiltin returns a "//method" builtin of streams; fn returning nil
+// returns the stream.
+func streamBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, s *EventStream, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.EventStream)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			s, err := nativeArg[*EventStream](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, s, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+func streamObj(ps *env.ProgramState, s *EventStream) env.Object {
+	trackResource(s, (*EventStream).Close)
+	return *env.NewNative(ps.Idx, s, "Go(*gioui_org.EventStream)")
+}
+
+func timeObj(ps *env.ProgramState, t time.Time) env.Object {
+	return *env.NewInteger(t.UnixMilli())
+}
+
+var signalNames = map[string]os.Signal{
+	"interrupt": os.Interrupt,
+	"terminate": syscall.SIGTERM,
+	"hangup":    syscall.SIGHUP,
+}
+
+var builtinsStreams = map[string]*env.Builtin{
+	"ticker": {
+		Doc:   "Get a stream of the times (in Unix milliseconds) of ticks every interval of milliseconds",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			ms, err := integerArg(ps, "ticker", 1, arg0)
+			if err != nil {
+				return err
+			}
+			if ms <= 0 {
+				return failure(ps, "ticker", "interval must be positive")
+			}
+			t := time.NewTicker(time.Duration(ms) * time.Millisecond)
+			ch := make(chan time.Time)
+			done := make(chan struct{})
+			go func() {
+				defer close(ch)
+				for {
+					select {
+					case v := <-t.C:
+						ch <- v
+					case <-done:
+						return
+					}
+				}
+			}()
+			return streamObj(ps, newEventStream(ch, timeObj, func() { t.Stop(); close(done) }))
+		},
+	},
+	"signals": {
+		Doc:   "Get a stream of the names of OS signals received from a block of interrupt, terminate and hangup",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			blk, ok := arg0.(env.Block)
+			if !ok {
+				return argError(ps, "signals", 1, "block of signal names", arg0)
+			}
+			var sigs []os.Signal
+			for _, it := range blk.Series.S {
+				n, err := nameArg(ps, "signals", 1, it)
+				if err != nil {
+					return err
+				}
+				sig, ok := signalNames[strings.ToLower(n)]
+				if !ok {
+					return failure(ps, "signals", "unknown signal "+n+" (interrupt, terminate or hangup)")
+				}
+				sigs = append(sigs, sig)
+			}
+			ch := make(chan os.Signal, 1)
+			signal.Notify(ch, sigs...)
+			names := map[os.Signal]string{}
+			for n, sig := range signalNames {
+				names[sig] = n
+			}
+			conv := func(ps *env.ProgramState, sig os.Signal) env.Object { return *env.NewString(names[sig]) }
+			return streamObj(ps, newEventStream(ch, conv, func() { signal.Stop(ch); close(ch) }))
+		},
+	},
+	"Go(*gioui_org.EventStream)//await": streamBuiltin("await", "Wait for the next value of the stream; fails if the stream ended", 1, func(ps *env.ProgramState, name string, s *EventStream, _ env.Object) env.Object {
+		v, ok := s.Await(0)
+		if !ok {
+			return failure(ps, name, "stream ended")
+		}
+		return v(ps)
+	}),
+	"Go(*gioui_org.EventStream)//await\\timeout": streamBuiltin("await\\timeout", "Wait up to a number of milliseconds for the next value of the stream; fails if none came", 2, func(ps *env.ProgramState, name string, s *EventStream, arg1 env.Object) env.Object {
+		ms, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if ms <= 0 {
+			return failure(ps, name, "timeout must be positive")
+		}
+		v, ok := s.Await(time.Duration(ms) * time.Millisecond)
+		if !ok {
+			return failure(ps, name, "no value")
+		}
+		return v(ps)
+	}),
+	"Go(*gioui_org.EventStream)//next": streamBuiltin("next", "Take the next queued value of the stream without waiting; fails if there is none", 1, func(ps *env.ProgramState, name string, s *EventStream, _ env.Object) env.Object {
+		v, ok := s.Next()
+		if !ok {
+			return failure(ps, name, "no value")
+		}
+		return v(ps)
+	}),
+	"Go(*gioui_org.EventStream)//pending?": streamBuiltin("pending?", "Get the number of queued values", 1, func(ps *env.ProgramState, name string, s *EventStream, _ env.Object) env.Object {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return *env.NewInteger(int64(len(s.queue)))
+	}),
+	"Go(*gioui_org.EventStream)//ended?": streamBuiltin("ended?", "Check whether the stream ended and all its values were taken", 1, func(ps *env.ProgramState, name string, s *EventStream, _ env.Object) env.Object {
+		return *env.NewInteger(boolToInt64(s.ended()))
+	}),
+	"Go(*gioui_org.EventStream)//on-next": streamBuiltin("on-next", "Set a function of one value that poll calls with each value", 2, func(ps *env.ProgramState, name string, s *EventStream, arg1 env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 1, arg1)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.handler = &fn
+		s.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.EventStream)//poll": streamBuiltin("poll", "Call the on-next function with each queued value and get how many there were; call it every frame", 1, func(ps *env.ProgramState, name string, s *EventStream, _ env.Object) env.Object {
+		s.mu.Lock()
+		fn := s.handler
+		s.mu.Unlock()
+		if fn == nil {
+			return failure(ps, name, "no on-next function")
+		}
+		n := 0
+		for {
+			v, ok := s.Next()
+			if !ok {
+				break
+			}
+			callFunction(ps, name, *fn, v(ps))
+			n++
+		}
+		return *env.NewInteger(int64(n))
+	}),
+	"Go(*gioui_org.EventStream)//wake!": streamBuiltin("wake!", "Invalidate a window whenever a value arrives, so its loop runs to take it", 2, func(ps *env.ProgramState, name string, s *EventStream, arg1 env.Object) env.Object {
+		win, err := nativeArg[*app.Window](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.win = win
+		s.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.EventStream)//close": streamBuiltin("close", "End the stream and stop its source", 1, func(ps *env.ProgramState, name string, s *EventStream, _ env.Object) env.Object {
+		s.Close()
+		return nil
+	}),
+}
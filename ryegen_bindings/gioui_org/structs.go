@@ -0,0 +1,344 @@
+// Go structs from Rye dicts and contexts.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gioui.org/layout"
+	"github.com/iancoleman/strcase"
+
+	"github.com/refaktor/rye/env"
+)
+
+// structFields returns the exported fields of struct type t by their Rye
+// names, the kebab-case of the Go name like the generated getters and
+// setters use (MinSize is min-size).
+func structFields(t reflect.Type) map[string]reflect.StructField {
+	fs := map[string]reflect.StructField{}
+	for _, f := range reflect.VisibleFields(t) {
+		if f.IsExported() && !f.Anonymous {
+			fs[strcase.ToKebab(f.Name)] = f
+		}
+	}
+	return fs
+}
+
+func fieldNames(fs map[string]reflect.StructField) string {
+	names := make([]string, 0, len(fs))
+	for n := range fs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// objectEntries returns the keys and values of a dict or context.
+func objectEntries(ps *env.ProgramState, obj env.Object) (map[string]env.Object, bool) {
+	res := map[string]env.Object{}
+	switch v := obj.(type) {
+	case env.Dict:
+		for k, val := range v.Data {
+			if o, ok := val.(env.Object); ok {
+				res[k] = o
+			} else {
+				res[k] = env.ToRyeValue(val)
+			}
+		}
+	case env.RyeCtx:
+		for _, w := range v.GetWords(*ps.Idx).Series.S {
+			k := w.(env.String).Value
+			res[k], _ = v.Get(ps.Idx.IndexWord(k))
+		}
+	default:
+		return nil, false
+	}
+	return res, true
+}
+
+// setStruct sets the fields of the struct dst named by the keys of a dict or
+// context. Fields not named keep their value; unknown names are an error
+// listing the known ones. path names dst in errors, like layout.Inset/top.
+func setStruct(ps *env.ProgramState, path string, dst reflect.Value, obj env.Object) error {
+	entries, ok := objectEntries(ps, obj)
+	if !ok {
+		return fmt.Errorf("%s: expected dict or context, but got %s", path, objectDebugString(ps.Idx, obj))
+	}
+	fs := structFields(dst.Type())
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := fs[k]
+		if !ok {
+			return fmt.Errorf("%s: no field %s (fields: %s)", path, k, fieldNames(fs))
+		}
+		fv, err := dst.FieldByIndexErr(f.Index)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %v", path, k, err)
+		}
+		if err := setValue(ps, path+"/"+k, fv, entries[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValue converts obj to the type of dst and stores it. Numbers and
+// strings convert to the Go kinds they fit (unit.Dp, text.Alignment, ...),
+// dicts and contexts to structs and maps, blocks to slices or, element by
+// element, to the fields of a struct (a point is [ 10 20 ]), and natives of
+// a matching type are used as they are. Colors also take what colorArg does.
+func setValue(ps *env.ProgramState, path string, dst reflect.Value, obj env.Object) error {
+	t := dst.Type()
+	mismatch := func(expected string) error {
+		return fmt.Errorf("%s: expected %s for %s, but got %s", path, expected, t, objectDebugString(ps.Idx, obj))
+	}
+	if nat, ok := obj.(env.Native); ok {
+		v := reflect.ValueOf(nat.Value)
+		switch {
+		case v.IsValid() && t.Kind() == reflect.Interface && v.Kind() == reflect.Pointer && !v.IsNil() && v.Type().Elem().Kind() == reflect.Struct && v.Type().Elem().AssignableTo(t):
+			// Structs are wrapped in pointers, but interfaces like
+			// event.Filter are implemented and matched by value.
+			dst.Set(v.Elem())
+			return nil
+		case v.IsValid() && v.Type().AssignableTo(t):
+			dst.Set(v)
+			return nil
+		case v.IsValid() && v.Kind() == reflect.Pointer && v.Type().Elem().AssignableTo(t):
+			dst.Set(v.Elem())
+			return nil
+		}
+		return mismatch("native of type " + t.String())
+	}
+	if t == reflect.TypeOf(color.NRGBA{}) {
+		var c color.NRGBA
+		ok := false
+		switch v := obj.(type) {
+		case env.String:
+			c, ok = parseHexColor(v.Value)
+		case env.Block:
+			c, ok = blockToColor(v)
+		}
+		if !ok {
+			return mismatch("color native, hex string or block of integers")
+		}
+		dst.Set(reflect.ValueOf(c))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if v, ok := obj.(env.Integer); ok {
+			dst.SetBool(v.Value != 0)
+			return nil
+		}
+		return mismatch("integer")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v, ok := obj.(env.Integer); ok {
+			dst.SetInt(v.Value)
+			return nil
+		}
+		return mismatch("integer")
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v, ok := obj.(env.Integer); ok && v.Value >= 0 {
+			dst.SetUint(uint64(v.Value))
+			return nil
+		}
+		return mismatch("non-negative integer")
+	case reflect.Float32, reflect.Float64:
+		switch v := obj.(type) {
+		case env.Decimal:
+			dst.SetFloat(v.Value)
+			return nil
+		case env.Integer:
+			dst.SetFloat(float64(v.Value))
+			return nil
+		}
+		return mismatch("decimal or integer")
+	case reflect.String:
+		if v, ok := obj.(env.String); ok {
+			dst.SetString(v.Value)
+			return nil
+		}
+		return mismatch("string")
+	case reflect.Struct:
+		if blk, ok := obj.(env.Block); ok {
+			n := t.NumField()
+			for i := 0; i < n; i++ {
+				if !t.Field(i).IsExported() {
+					return mismatch("dict or context")
+				}
+			}
+			if len(blk.Series.S) != n {
+				return fmt.Errorf("%s: expected %d values for %s, but got %d", path, n, t, len(blk.Series.S))
+			}
+			for i, o := range blk.Series.S {
+				if err := setValue(ps, path+"/"+strcase.ToKebab(t.Field(i).Name), dst.Field(i), o); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return setStruct(ps, path, dst, obj)
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			if _, ok := objectEntries(ps, obj); ok {
+				v := reflect.New(t.Elem())
+				if err := setStruct(ps, path, v.Elem(), obj); err != nil {
+					return err
+				}
+				dst.Set(v)
+				return nil
+			}
+		}
+		return mismatch("native")
+	case reflect.Map:
+		entries, ok := objectEntries(ps, obj)
+		if !ok || t.Key().Kind() != reflect.String {
+			return mismatch("dict or context")
+		}
+		m := reflect.MakeMapWithSize(t, len(entries))
+		for k, o := range entries {
+			v := reflect.New(t.Elem()).Elem()
+			if err := setValue(ps, path+"/"+k, v, o); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), v)
+		}
+		dst.Set(m)
+		return nil
+	case reflect.Slice:
+		blk, ok := obj.(env.Block)
+		if !ok {
+			return mismatch("block")
+		}
+		s := reflect.MakeSlice(t, len(blk.Series.S), len(blk.Series.S))
+		for i, o := range blk.Series.S {
+			if err := setValue(ps, fmt.Sprintf("%s/%d", path, i+1), s.Index(i), o); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+	}
+	return mismatch("native")
+}
+
+// structArg converts arg to a struct of type T: a native T or *T, or a dict
+// or context of field values as setStruct takes them.
+func structArg[T any](ps *env.ProgramState, name string, n int, arg env.Object) (T, *env.Error) {
+	var res T
+	if nat, ok := arg.(env.Native); ok {
+		switch v := nat.Value.(type) {
+		case T:
+			return v, nil
+		case *T:
+			return *v, nil
+		}
+	}
+	if _, ok := objectEntries(ps, arg); !ok {
+		return res, argError(ps, name, n, fmt.Sprintf("native of type %T, dict or context", res), arg)
+	}
+	v := reflect.ValueOf(&res).Elem()
+	if err := setStruct(ps, fmt.Sprintf("%s: arg %d: %s", name, n, v.Type()), v, arg); err != nil {
+		ps.FailureFlag = true
+		return res, env.NewError(err.Error())
+	}
+	return res, nil
+}
+
+// structConstructors maps Go struct names (layout.Inset) to the generated
+// builtins creating them.
+var (
+	structConstructorsOnce sync.Once
+	structConstructors     map[string]*env.Builtin
+)
+
+func structConstructor(typ string) (*env.Builtin, bool) {
+	structConstructorsOnce.Do(func() {
+		structConstructors = map[string]*env.Builtin{}
+		for _, b := range builtinsGenerated {
+			if typ, ok := strings.CutPrefix(b.Doc, "Create a new "); ok && b.Argsn == 0 {
+				if typ, ok := strings.CutSuffix(typ, " struct"); ok {
+					structConstructors[typ] = b
+				}
+			}
+		}
+	})
+	b, ok := structConstructors[typ]
+	return b, ok
+}
+
+var builtinsStructs = map[string]*env.Builtin{
+	"new-struct": {
+		Doc:   "Create a Gio struct by its Go name (\"layout.Inset\") with the fields named in a dict or context, like dict { \"top\" 8 \"left\" 4 }",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			typ, err := nameArg(ps, "new-struct", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, ok := structConstructor(typ)
+			if !ok {
+				return failure(ps, "new-struct", "no struct "+typ)
+			}
+			res := b.Fn(ps, nil, nil, nil, nil, nil)
+			return setFields(ps, "new-struct", res, arg1)
+		},
+	},
+	"inset": {
+		Doc:   "Lay out a widget inside an inset given as a dict or context of top, bottom, left and right, or a layout.Inset native",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			in, err := structArg[layout.Inset](ps, "inset", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "inset", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "inset", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return dimensionsObj(ps, in.Layout(gtx, w))
+		},
+	},
+	"set-fields!": {
+		Doc:   "Set the fields of a Gio struct native named in a dict or context",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			return setFields(ps, "set-fields!", arg0, arg1)
+		},
+	},
+}
+
+// setFields sets the fields of the struct a native points to and returns
+// the native.
+func setFields(ps *env.ProgramState, name string, nat env.Object, fields env.Object) env.Object {
+	n, ok := nat.(env.Native)
+	v := reflect.Value{}
+	if ok {
+		v = reflect.ValueOf(n.Value)
+	}
+	if !v.IsValid() || v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return argError(ps, name, 1, "native struct pointer", nat)
+	}
+	if _, ok := objectEntries(ps, fields); !ok {
+		return argError(ps, name, 2, "dict or context", fields)
+	}
+	if err := setStruct(ps, v.Elem().Type().String(), v.Elem(), fields); err != nil {
+		return failure(ps, name, err.Error())
+	}
+	return nat
+}
@@ -0,0 +1,113 @@
+// Theme overrides for a subtree of widgets.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"errors"
+	"image/color"
+
+	"gioui.org/font"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// styleOption changes a theme for the widgets laid out by with-style.
+type styleOption func(th *material.Theme) error
+
+func colorStyle(set func(p *material.Palette, c color.NRGBA)) optionSpec[styleOption] {
+	return optionSpec[styleOption]{1, func(ps *env.ProgramState, name string, args []env.Object) (styleOption, *env.Error) {
+		c, err := colorArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(th *material.Theme) error { set(&th.Palette, c); return nil }, nil
+	}}
+}
+
+// styleOptions are the specs of with-style.
+var styleOptions = map[string]optionSpec[styleOption]{
+	"bg":          colorStyle(func(p *material.Palette, c color.NRGBA) { p.Bg = c }),
+	"fg":          colorStyle(func(p *material.Palette, c color.NRGBA) { p.Fg = c }),
+	"contrast-bg": colorStyle(func(p *material.Palette, c color.NRGBA) { p.ContrastBg = c }),
+	"contrast-fg": colorStyle(func(p *material.Palette, c color.NRGBA) { p.ContrastFg = c }),
+	"text-size": {1, func(ps *env.ProgramState, name string, args []env.Object) (styleOption, *env.Error) {
+		s, err := decimalArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(th *material.Theme) error { th.TextSize = unit.Sp(s); return nil }, nil
+	}},
+	"finger-size": {1, func(ps *env.ProgramState, name string, args []env.Object) (styleOption, *env.Error) {
+		s, err := decimalArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(th *material.Theme) error { th.FingerSize = unit.Dp(s); return nil }, nil
+	}},
+	"typeface": {1, func(ps *env.ProgramState, name string, args []env.Object) (styleOption, *env.Error) {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(th *material.Theme) error { th.Face = font.Typeface(s); return nil }, nil
+	}},
+	"variant": {1, func(ps *env.ProgramState, name string, args []env.Object) (styleOption, *env.Error) {
+		n, err := nameArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(th *material.Theme) error {
+			themeStylesMu.Lock()
+			defer themeStylesMu.Unlock()
+			s := themeStyles[th]
+			if s == nil {
+				return errors.New("no theme file applied to the theme")
+			}
+			p, ok := s.Variants[n]
+			if !ok {
+				return errors.New("the theme has no variant " + n)
+			}
+			th.Palette = p
+			return nil
+		}, nil
+	}},
+}
+
+var builtinsStyle = map[string]*env.Builtin{
+	"with-style": {
+		Doc:   "Lay out a widget with the theme changed by a block of styles (bg fg contrast-bg contrast-fg colors, text-size, finger-size, typeface, variant), restoring the theme afterward",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "with-style", 1, arg0)
+			if err != nil {
+				return err
+			}
+			opts, err := optionsArg(ps, "with-style", 2, arg1, styleOptions)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "with-style", 3, arg2)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "with-style", 4, arg3)
+			if err != nil {
+				return err
+			}
+			palette, textSize, fingerSize, face := th.Palette, th.TextSize, th.FingerSize, th.Face
+			defer func() {
+				th.Palette, th.TextSize, th.FingerSize, th.Face = palette, textSize, fingerSize, face
+			}()
+			for _, o := range opts {
+				if oerr := o(th); oerr != nil {
+					return failure(ps, "with-style", oerr.Error())
+				}
+			}
+			return dimensionsObj(ps, w(gtx))
+		},
+	},
+}
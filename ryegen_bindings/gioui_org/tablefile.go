@@ -0,0 +1,641 @@
+// Data models of CSV and JSON files.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gioui.org/app"
+
+	"github.com/refaktor/rye/env"
+)
+
+const (
+	// fileCheckpoint is how many rows apart the offsets a FileTable keeps
+	// are; reading a row parses at most that many rows before it.
+	fileCheckpoint = 64
+	// fileSample is how many rows the column types are inferred from.
+	fileSample = 1000
+	// fileMaxPages is how many pages of fileCheckpoint rows a FileTable
+	// keeps parsed.
+	fileMaxPages = 16
+)
+
+// rowSource reads the rows of a file format.
+type rowSource interface {
+	// rows returns a reader of the rows of f from offset, the start of a
+	// row. It returns each row with the offset of its end, and io.EOF
+	// after the last.
+	rows(f *os.File, offset int64) (func() (any, int64, error), error)
+	// cells converts a row to values of the columns.
+	cells(row any, types []string) []any
+}
+
+// FileTable is the rows of a CSV or JSON file. The file is indexed in the
+// background, so the rows counted so far can be shown at once, and rows are
+// parsed when they are shown; large files don't have to fit in memory.
+// Column types (integer, decimal or text) are inferred from the first rows.
+type FileTable struct {
+	Path  string
+	src   rowSource
+	cols  []string
+	types []string
+	start int64 // offset of the first row
+
+	mu      sync.Mutex
+	offsets []int64 // of rows 0, fileCheckpoint, 2*fileCheckpoint ...
+	count   int
+	loading bool
+	err     error
+	pages   map[int][][]any
+	win     *app.Window
+}
+
+func newFileTable(path string, src rowSource, cols []string, start int64, sample []any, parseText bool) *FileTable {
+	t := &FileTable{Path: path, src: src, cols: cols, start: start, loading: true}
+	t.types = inferTypes(len(cols), sample, src, parseText)
+	go t.index()
+	return t
+}
+
+// index counts the rows and notes the offsets of every fileCheckpoint-th.
+func (t *FileTable) index() {
+	err := func() error {
+		f, err := os.Open(t.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		next, err := t.src.rows(f, t.start)
+		if err != nil {
+			return err
+		}
+		var offsets []int64
+		off, n := t.start, 0
+		for {
+			if n%fileCheckpoint == 0 {
+				offsets = append(offsets, off)
+			}
+			_, end, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("row %d: %w", n+1, err)
+			}
+			off = end
+			n++
+			if n%(fileCheckpoint*256) == 0 {
+				t.progress(offsets, n)
+			}
+		}
+		t.progress(offsets, n)
+		return nil
+	}()
+	t.mu.Lock()
+	t.loading, t.err = false, err
+	win := t.win
+	t.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+func (t *FileTable) progress(offsets []int64, n int) {
+	t.mu.Lock()
+	t.offsets = append(t.offsets[:0:0], offsets...)
+	t.count = n
+	win := t.win
+	t.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+func (t *FileTable) Columns() []string {
+	return t.cols
+}
+
+func (t *FileTable) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count
+}
+
+func (t *FileTable) Row(i int) []any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := i / fileCheckpoint
+	if i < 0 || i >= t.count || n >= len(t.offsets) {
+		return nil
+	}
+	rows, ok := t.pages[n]
+	if !ok {
+		var err error
+		if rows, err = t.readPage(t.offsets[n]); err != nil {
+			t.err = err
+			return nil
+		}
+		if len(t.pages) >= fileMaxPages || t.pages == nil {
+			t.pages = map[int][][]any{}
+		}
+		t.pages[n] = rows
+	}
+	if i -= n * fileCheckpoint; i < len(rows) {
+		return rows[i]
+	}
+	return nil
+}
+
+// readPage parses the fileCheckpoint rows from offset.
+func (t *FileTable) readPage(offset int64) ([][]any, error) {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	next, err := t.src.rows(f, offset)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]any
+	for len(rows) < fileCheckpoint {
+		row, _, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, t.src.cells(row, t.types))
+	}
+	return rows, nil
+}
+
+// inferTypes returns the type of each of n columns: integer if all the
+// values of the sample are whole numbers, decimal if they are numbers and
+// text otherwise. Empty values don't count, and text counts as numbers if
+// parseText is set and it reads as them.
+func inferTypes(n int, sample []any, src rowSource, parseText bool) []string {
+	types := make([]string, n)
+	for i := range types {
+		types[i] = "integer"
+	}
+	seen := make([]bool, n)
+	untyped := make([]string, n)
+	for _, row := range sample {
+		for c, v := range src.cells(row, untyped) {
+			if v == nil {
+				continue
+			}
+			seen[c] = true
+			switch v := v.(type) {
+			case int64:
+			case float64:
+				if types[c] == "integer" {
+					types[c] = "decimal"
+				}
+			case string:
+				if !parseText {
+					types[c] = "text"
+					break
+				}
+				if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+					break
+				}
+				if _, err := strconv.ParseFloat(v, 64); err == nil && types[c] != "text" {
+					types[c] = "decimal"
+					break
+				}
+				types[c] = "text"
+			default:
+				types[c] = "text"
+			}
+		}
+	}
+	for c := range types {
+		if !seen[c] {
+			types[c] = "text"
+		}
+	}
+	return types
+}
+
+// convertCell converts a value to a column's type, leaving those that
+// don't fit as they are.
+func convertCell(v any, typ string) any {
+	switch typ {
+	case "integer":
+		switch x := v.(type) {
+		case string:
+			if n, err := strconv.ParseInt(x, 10, 64); err == nil {
+				return n
+			}
+		case float64:
+			if x == float64(int64(x)) {
+				return int64(x)
+			}
+		}
+	case "decimal":
+		switch x := v.(type) {
+		case string:
+			if f, err := strconv.ParseFloat(x, 64); err == nil {
+				return f
+			}
+		case int64:
+			return float64(x)
+		}
+	case "text":
+		switch x := v.(type) {
+		case int64, float64, bool:
+			return cellText(x)
+		}
+	}
+	return v
+}
+
+// csvSource reads CSV rows as []string.
+type csvSource struct {
+	comma rune
+}
+
+func (s csvSource) reader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.Comma = s.comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	return cr
+}
+
+func (s csvSource) rows(f *os.File, offset int64) (func() (any, int64, error), error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cr := s.reader(bufio.NewReader(f))
+	return func() (any, int64, error) {
+		rec, err := cr.Read()
+		if err != nil {
+			return nil, 0, err
+		}
+		return rec, offset + cr.InputOffset(), nil
+	}, nil
+}
+
+func (s csvSource) cells(row any, types []string) []any {
+	rec := row.([]string)
+	res := make([]any, len(types))
+	for i := range res {
+		if i < len(rec) && rec[i] != "" {
+			res[i] = convertCell(rec[i], types[i])
+		}
+	}
+	return res
+}
+
+// openCSV reads the header and a sample of a CSV file. Without a header
+// the columns are named 1, 2, 3 ...
+func openCSV(path string, comma rune, header bool) (*FileTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src := csvSource{comma}
+	next, err := src.rows(f, 0)
+	if err != nil {
+		return nil, err
+	}
+	var cols []string
+	var start int64
+	var sample []any
+	first, end, err := next()
+	if err == io.EOF {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header {
+		cols, start = first.([]string), end
+	} else {
+		sample = append(sample, first)
+		for i := range first.([]string) {
+			cols = append(cols, strconv.Itoa(i+1))
+		}
+	}
+	for len(sample) < fileSample {
+		row, _, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sample = append(sample, row)
+	}
+	return newFileTable(path, src, cols, start, sample, true), nil
+}
+
+// jsonSource reads the objects of a JSON array, or of JSON Lines, as maps.
+type jsonSource struct {
+	array bool
+	cols  []string
+}
+
+func (s jsonSource) rows(f *os.File, offset int64) (func() (any, int64, error), error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	// Offsets are where the row before ended, so before a comma in an
+	// array.
+	skipped := int64(0)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b != ',' && b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			br.UnreadByte()
+			break
+		}
+		skipped++
+	}
+	base := offset + skipped
+	var dec *json.Decoder
+	if s.array {
+		// Resume the array as if it started here.
+		dec = json.NewDecoder(io.MultiReader(strings.NewReader("["), br))
+		base--
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	} else {
+		dec = json.NewDecoder(br)
+	}
+	dec.UseNumber()
+	return func() (any, int64, error) {
+		if s.array && !dec.More() {
+			return nil, 0, io.EOF
+		}
+		var row map[string]any
+		if err := dec.Decode(&row); err != nil {
+			return nil, 0, err
+		}
+		return row, base + dec.InputOffset(), nil
+	}, nil
+}
+
+func (s jsonSource) cells(row any, types []string) []any {
+	obj := row.(map[string]any)
+	res := make([]any, len(s.cols))
+	for i, c := range s.cols {
+		v := obj[c]
+		switch x := v.(type) {
+		case json.Number:
+			if n, err := x.Int64(); err == nil {
+				v = n
+			} else {
+				v, _ = x.Float64()
+			}
+		case map[string]any, []any:
+			b, _ := json.Marshal(x)
+			v = string(b)
+		}
+		if v != nil && types[i] != "" {
+			v = convertCell(v, types[i])
+		}
+		res[i] = v
+	}
+	return res
+}
+
+// objectKeys returns the keys of a JSON object in the order they appear.
+func objectKeys(raw []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("rows must be objects")
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// openJSON reads a sample of a JSON array of objects or of JSON Lines; the
+// columns are the keys of the sample's objects, in the order they first
+// appear.
+func openJSON(path string) (*FileTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var start int64
+	array := false
+	for {
+		r, size, err := br.ReadRune()
+		if err == io.EOF {
+			return nil, errors.New("empty file")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r == '\uFEFF' || r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			start += int64(size)
+			continue
+		}
+		if r == '[' {
+			array = true
+			start += int64(size)
+		}
+		break
+	}
+	var dec *json.Decoder
+	if array {
+		dec = json.NewDecoder(io.NewSectionReader(f, start-1, 1<<62))
+		dec.Token()
+	} else {
+		dec = json.NewDecoder(io.NewSectionReader(f, start, 1<<62))
+	}
+	var cols []string
+	var sample []any
+	seen := map[string]bool{}
+	for len(sample) < fileSample {
+		if array && !dec.More() {
+			break
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d: %w", len(sample)+1, err)
+		}
+		keys, err := objectKeys(raw)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", len(sample)+1, err)
+		}
+		for _, k := range keys {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+		var row map[string]any
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		d.Decode(&row)
+		sample = append(sample, row)
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("no rows")
+	}
+	return newFileTable(path, jsonSource{array: array, cols: cols}, cols, start, sample, false), nil
+}
+
+// csvOptions are the settings of reading a CSV file.
+type csvOptions struct {
+	comma  rune
+	header bool
+}
+
+var csvTableOptions = map[string]optionSpec[func(*csvOptions)]{
+	"separator": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*csvOptions), *env.Error) {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		if size == 0 || size != len(s) || r == '"' || r == '\r' || r == '\n' {
+			return nil, failure(ps, name, "separator must be one character other than a quote or line break")
+		}
+		return func(o *csvOptions) { o.comma = r }, nil
+	}},
+	"header": {1, func(ps *env.ProgramState, name string, args []env.Object) (func(*csvOptions), *env.Error) {
+		b, err := integerArg(ps, name, 1, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(o *csvOptions) { o.header = b != 0 }, nil
+	}},
+}
+
+// csvTableBuiltin returns a builtin reading a CSV file with options.
+func csvTableBuiltin(name, doc string, argsn int) *env.Builtin {
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			o := csvOptions{comma: ',', header: true}
+			if argsn == 2 {
+				opts, err := optionsArg(ps, name, 2, arg1, csvTableOptions)
+				if err != nil {
+					return err
+				}
+				for _, f := range opts {
+					f(&o)
+				}
+			}
+			t, terr := openCSV(path, o.comma, o.header)
+			if terr != nil {
+				return failure(ps, name, terr.Error())
+			}
+			return *env.NewNative(ps.Idx, t, "Go(*gioui_org.FileTable)")
+		},
+	}
+}
+
+// fileTableBuiltin returns a "//method" builtin of file tables.
+func fileTableBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, t *FileTable, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.FileTable)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*FileTable](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, t, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsTable = mergeBuiltins(modelBuiltins[*FileTable]("Go(*gioui_org.FileTable)"), map[string]*env.Builtin{
+	"table-from-csv":          csvTableBuiltin("table-from-csv", "Create a data model of the rows of a CSV file, read in the background and parsed as shown; the first row names the columns", 1),
+	"table-from-csv\\options": csvTableBuiltin("table-from-csv\\options", "Create a data model of the rows of a CSV file with options: separator (\",\") and header (1; with 0 the columns are named 1, 2, 3 ...)", 2),
+	"table-from-json": {
+		Doc:   "Create a data model of the objects of a JSON array or of JSON Lines, read in the background and parsed as shown; the keys of the first objects name the columns",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "table-from-json", 1, arg0)
+			if err != nil {
+				return err
+			}
+			t, terr := openJSON(path)
+			if terr != nil {
+				return failure(ps, "table-from-json", terr.Error())
+			}
+			return *env.NewNative(ps.Idx, t, "Go(*gioui_org.FileTable)")
+		},
+	},
+	"Go(*gioui_org.FileTable)//column-types?": fileTableBuiltin("column-types?", "Get a block of the types of the columns, inferred from the first rows: integer, decimal or text", 1, func(ps *env.ProgramState, name string, t *FileTable, _ env.Object) env.Object {
+		return argsObj(ps, t.types)
+	}),
+	"Go(*gioui_org.FileTable)//loading?": fileTableBuiltin("loading?", "Check whether the file is still being read; count? grows until it is done", 1, func(ps *env.ProgramState, name string, t *FileTable, _ env.Object) env.Object {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return *env.NewInteger(boolToInt64(t.loading))
+	}),
+	"Go(*gioui_org.FileTable)//wake!": fileTableBuiltin("wake!", "Invalidate a window as the file is read, so it shows the rows", 2, func(ps *env.ProgramState, name string, t *FileTable, arg1 env.Object) env.Object {
+		win, err := nativeArg[*app.Window](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		t.win = win
+		t.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.FileTable)//error?": fileTableBuiltin("error?", "Get why reading the file failed, or an empty string", 1, func(ps *env.ProgramState, name string, t *FileTable, _ env.Object) env.Object {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(t.err.Error())
+	}),
+})
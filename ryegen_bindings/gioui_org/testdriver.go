@@ -0,0 +1,404 @@
+// Driving a UI from scripts for end-to-end tests.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/input"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+
+	"github.com/refaktor/rye/env"
+)
+
+// TestDriver lays out a UI without a window, feeds it synthetic input and
+// reads back what it shows through the semantic descriptions widgets emit.
+// Time is simulated, starting at the same instant on every run and
+// advancing one frame interval per frame, so runs are reproducible.
+// Coordinates are in dp.
+type TestDriver struct {
+	ps     *env.ProgramState
+	draw   env.Function
+	size   image.Point
+	router input.Router
+	ops    op.Ops
+	now    time.Time
+	start  time.Time
+	mouse  f32.Point
+	nodes  []input.SemanticNode
+}
+
+// testFrameInterval is the simulated time between frames.
+const testFrameInterval = time.Second / 60
+
+func newTestDriver(ps *env.ProgramState, w, h int, draw env.Function) *TestDriver {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := &TestDriver{ps: ps, draw: draw, size: image.Pt(w, h), now: start, start: start}
+	d.Frame()
+	return d
+}
+
+// Frame lays out one frame, delivering the input queued since the last.
+func (d *TestDriver) Frame() {
+	d.ops.Reset()
+	gtx := layout.Context{
+		Ops:         &d.ops,
+		Now:         d.now,
+		Metric:      unit.Metric{PxPerDp: 1, PxPerSp: 1},
+		Constraints: layout.Exact(d.size),
+		Source:      d.router.Source(),
+	}
+	callFunction(d.ps, "test-driver draw", d.draw, *env.NewNative(d.ps.Idx, &gtx, "Go(*layout.Context)"))
+	d.router.Frame(&d.ops)
+	d.nodes = d.router.AppendSemantics(d.nodes[:0])
+	d.now = d.now.Add(testFrameInterval)
+}
+
+// Wait lays out frames until dur of simulated time has passed.
+func (d *TestDriver) Wait(dur time.Duration) {
+	for end := d.now.Add(dur); d.now.Before(end); {
+		d.Frame()
+	}
+}
+
+// send queues events and lays out a frame to handle them.
+func (d *TestDriver) send(evs ...event.Event) {
+	d.router.Queue(evs...)
+	d.Frame()
+}
+
+func (d *TestDriver) pointerEvent(kind pointer.Kind, pos f32.Point, buttons pointer.Buttons) pointer.Event {
+	return pointer.Event{
+		Kind:     kind,
+		Source:   pointer.Mouse,
+		Position: pos,
+		Buttons:  buttons,
+		Time:     d.now.Sub(d.start),
+	}
+}
+
+func (d *TestDriver) Move(x, y float32) {
+	d.mouse = f32.Pt(x, y)
+	d.send(d.pointerEvent(pointer.Move, d.mouse, 0))
+}
+
+func (d *TestDriver) Click(x, y float32) {
+	d.Move(x, y)
+	d.send(d.pointerEvent(pointer.Press, d.mouse, pointer.ButtonPrimary))
+	d.send(d.pointerEvent(pointer.Release, d.mouse, 0))
+}
+
+func (d *TestDriver) Key(name key.Name, mods key.Modifiers) {
+	d.send(key.Event{Name: name, Modifiers: mods, State: key.Press})
+	d.send(key.Event{Name: name, Modifiers: mods, State: key.Release})
+}
+
+// Type inserts s at the selection of the focused editor.
+func (d *TestDriver) Type(s string) {
+	st := d.router.EditorState()
+	d.send(key.EditEvent{Range: st.Selection.Range, Text: s})
+}
+
+// Texts returns the labels of the semantic tree, in layout order.
+func (d *TestDriver) Texts() []string {
+	var texts []string
+	for _, n := range d.nodes {
+		if n.Desc.Label != "" {
+			texts = append(texts, n.Desc.Label)
+		}
+	}
+	return texts
+}
+
+// Find returns the first node whose label or description contains s.
+func (d *TestDriver) Find(s string) (input.SemanticNode, bool) {
+	for _, n := range d.nodes {
+		if strings.Contains(n.Desc.Label, s) || strings.Contains(n.Desc.Description, s) {
+			return n, true
+		}
+	}
+	return input.SemanticNode{}, false
+}
+
+// ClickText clicks the middle of the clickable widget containing the text
+// s, or of the text itself if none.
+func (d *TestDriver) ClickText(s string) error {
+	n, ok := d.Find(s)
+	if !ok {
+		return fmt.Errorf("no text %q shown", s)
+	}
+	r := n.Desc.Bounds
+	for p := n; ; {
+		if p.Desc.Gestures&input.ClickGesture != 0 {
+			r = p.Desc.Bounds
+			break
+		}
+		if p, ok = d.node(p.ParentID); !ok || p.ID == p.ParentID {
+			break
+		}
+	}
+	c := r.Min.Add(r.Max).Div(2)
+	d.Click(float32(c.X), float32(c.Y))
+	return nil
+}
+
+func (d *TestDriver) node(id input.SemanticID) (input.SemanticNode, bool) {
+	for _, n := range d.nodes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return input.SemanticNode{}, false
+}
+
+func (d *TestDriver) semanticsObj() env.Object {
+	objs := make([]env.Object, len(d.nodes))
+	for i, n := range d.nodes {
+		b := n.Desc.Bounds
+		objs[i] = *env.NewDict(map[string]any{
+			"id":          *env.NewInteger(int64(n.ID)),
+			"parent":      *env.NewInteger(int64(n.ParentID)),
+			"class":       *env.NewString(n.Desc.Class.String()),
+			"label":       *env.NewString(n.Desc.Label),
+			"description": *env.NewString(n.Desc.Description),
+			"selected":    *env.NewInteger(boolToInt64(n.Desc.Selected)),
+			"disabled":    *env.NewInteger(boolToInt64(n.Desc.Disabled)),
+			"clickable":   *env.NewInteger(boolToInt64(n.Desc.Gestures&input.ClickGesture != 0)),
+			"bounds": *env.NewBlock(*env.NewTSeries([]env.Object{
+				*env.NewInteger(int64(b.Min.X)), *env.NewInteger(int64(b.Min.Y)),
+				*env.NewInteger(int64(b.Max.X)), *env.NewInteger(int64(b.Max.Y)),
+			})),
+		})
+	}
+	return *env.NewBlock(*env.NewTSeries(objs))
+}
+
+// testCommand is a step of the gio-test dialect taking argsn values.
+type testCommand struct {
+	argsn int
+	run   func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error
+}
+
+var testCommands = map[string]testCommand{
+	"frame": {0, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		d.Frame()
+		return nil
+	}},
+	"wait": {1, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		secs, err := decimalArg(ps, name, 1, args[0])
+		if err != nil {
+			return err
+		}
+		d.Wait(time.Duration(secs * float64(time.Second)))
+		return nil
+	}},
+	"move": {2, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		x, y, err := pointArgs(ps, name, 1, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		d.Move(x, y)
+		return nil
+	}},
+	"click": {2, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		x, y, err := pointArgs(ps, name, 1, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		d.Click(x, y)
+		return nil
+	}},
+	"click-text": {1, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return err
+		}
+		if cerr := d.ClickText(s); cerr != nil {
+			return failure(ps, name, cerr.Error())
+		}
+		return nil
+	}},
+	"type": {1, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return err
+		}
+		d.Type(s)
+		return nil
+	}},
+	"key": {1, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		k, err := keyNameArg(ps, name, 1, args[0])
+		if err != nil {
+			return err
+		}
+		d.Key(k, 0)
+		return nil
+	}},
+	"expect-text": {1, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return err
+		}
+		if _, ok := d.Find(s); !ok {
+			return failure(ps, name, fmt.Sprintf("expected text %q, shown: %q", s, d.Texts()))
+		}
+		return nil
+	}},
+	"expect-no-text": {1, func(ps *env.ProgramState, d *TestDriver, name string, args []env.Object) *env.Error {
+		s, err := stringArg(ps, name, 1, args[0])
+		if err != nil {
+			return err
+		}
+		if _, ok := d.Find(s); ok {
+			return failure(ps, name, fmt.Sprintf("expected no text %q", s))
+		}
+		return nil
+	}},
+}
+
+// runTestDialect runs the steps of a gio-test block, stopping at the first
+// failing one.
+func runTestDialect(ps *env.ProgramState, d *TestDriver, blk env.Block) *env.Error {
+	s := blk.Series.S
+	for i := 0; i < len(s); {
+		cmd, err := nameArg(ps, "gio-test", 2, s[i])
+		if err != nil {
+			return err
+		}
+		tc, ok := testCommands[cmd]
+		if !ok {
+			return failure(ps, "gio-test", fmt.Sprintf("unknown step %q", cmd))
+		}
+		if i+1+tc.argsn > len(s) {
+			return failure(ps, "gio-test", fmt.Sprintf("step %q needs %d values", cmd, tc.argsn))
+		}
+		if err := tc.run(ps, d, "gio-test "+cmd, s[i+1:i+1+tc.argsn]); err != nil {
+			return err
+		}
+		i += 1 + tc.argsn
+	}
+	return nil
+}
+
+// testStepBuiltin exposes a step of the dialect as a driver method.
+func testStepBuiltin(method, doc string) *env.Builtin {
+	name := "Go(*gioui_org.TestDriver)//" + method
+	tc := testCommands[method]
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 1 + tc.argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := nativeArg[*TestDriver](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if err := tc.run(ps, d, name, []env.Object{arg1, arg2, arg3, arg4}[:tc.argsn]); err != nil {
+				return err
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsTestDriver = map[string]*env.Builtin{
+	"test-driver": {
+		Doc:   "Create a test driver laying out a UI of width and height with a function of the layout context, without a window",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := integerArg(ps, "test-driver", 1, arg0)
+			if err != nil {
+				return err
+			}
+			h, err := integerArg(ps, "test-driver", 2, arg1)
+			if err != nil {
+				return err
+			}
+			draw, err := functionArg(ps, "test-driver", 3, 1, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, newTestDriver(ps, int(w), int(h), draw), "Go(*gioui_org.TestDriver)")
+		},
+	},
+	"gio-test": {
+		Doc:   "Run a block of test steps on a driver: frame, wait secs, move x y, click x y, click-text \"t\", type \"t\", key 'name, expect-text \"t\", expect-no-text \"t\"",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := nativeArg[*TestDriver](ps, "gio-test", 1, arg0)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg1.(env.Block)
+			if !ok {
+				return argError(ps, "gio-test", 2, "block of test steps", arg1)
+			}
+			if err := runTestDialect(ps, d, blk); err != nil {
+				return err
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.TestDriver)//frame":          testStepBuiltin("frame", "Lay out a frame"),
+	"Go(*gioui_org.TestDriver)//wait":           testStepBuiltin("wait", "Lay out frames for a number of simulated seconds"),
+	"Go(*gioui_org.TestDriver)//move":           testStepBuiltin("move", "Move the mouse to x y"),
+	"Go(*gioui_org.TestDriver)//click":          testStepBuiltin("click", "Click at x y"),
+	"Go(*gioui_org.TestDriver)//click-text":     testStepBuiltin("click-text", "Click the middle of the first widget showing a text"),
+	"Go(*gioui_org.TestDriver)//type":           testStepBuiltin("type", "Type a text into the focused editor"),
+	"Go(*gioui_org.TestDriver)//key":            testStepBuiltin("key", "Press and release a key"),
+	"Go(*gioui_org.TestDriver)//expect-text":    testStepBuiltin("expect-text", "Fail unless a text is shown"),
+	"Go(*gioui_org.TestDriver)//expect-no-text": testStepBuiltin("expect-no-text", "Fail if a text is shown"),
+	"Go(*gioui_org.TestDriver)//texts?": {
+		Doc:   "Get a block of the texts shown, in layout order",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := nativeArg[*TestDriver](ps, "Go(*gioui_org.TestDriver)//texts?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			texts := d.Texts()
+			objs := make([]env.Object, len(texts))
+			for i, t := range texts {
+				objs[i] = *env.NewString(t)
+			}
+			return *env.NewBlock(*env.NewTSeries(objs))
+		},
+	},
+	"Go(*gioui_org.TestDriver)//has-text?": {
+		Doc:   "Check whether a text is shown",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := nativeArg[*TestDriver](ps, "Go(*gioui_org.TestDriver)//has-text?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := stringArg(ps, "Go(*gioui_org.TestDriver)//has-text?", 2, arg1)
+			if err != nil {
+				return err
+			}
+			_, ok := d.Find(s)
+			return *env.NewInteger(boolToInt64(ok))
+		},
+	},
+	"Go(*gioui_org.TestDriver)//semantics?": {
+		Doc:   "Get a block of dicts describing the widget tree: id, parent, class, label, description, selected, disabled, clickable and bounds",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			d, err := nativeArg[*TestDriver](ps, "Go(*gioui_org.TestDriver)//semantics?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return d.semanticsObj()
+		},
+	},
+}
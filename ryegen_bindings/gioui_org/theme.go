@@ -0,0 +1,253 @@
+// Theme files: palettes, type scales, spacing, radii and variants.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sync"
+
+	"gioui.org/font"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// ThemeSpec is what a theme file describes, in JSON or a Rye dict with the
+// same keys:
+//
+//	{ "palette": { "bg": "#ffffff", "fg": "#202020", "contrast-bg": "#3f51b5", "contrast-fg": "#ffffff" },
+//	  "text-size": 15, "finger-size": 38, "typeface": "Go",
+//	  "type-scale": { "h1": 48, "body": 15, "caption": 12 },
+//	  "spacing": { "sm": 4, "md": 8, "lg": 16 },
+//	  "radii": { "sm": 2, "md": 6 },
+//	  "variants": { "danger": { "contrast-bg": "#c62828" } } }
+//
+// Keys left out keep the values of material.NewTheme; colors left out of a
+// variant are the palette's.
+type ThemeSpec struct {
+	Palette    material.Palette
+	TextSize   unit.Sp
+	FingerSize unit.Dp
+	Typeface   font.Typeface
+	TypeScale  map[string]unit.Sp
+	Spacing    map[string]unit.Dp
+	Radii      map[string]unit.Dp
+	Variants   map[string]material.Palette
+}
+
+func newThemeSpec() *ThemeSpec {
+	th := material.NewTheme()
+	return &ThemeSpec{Palette: th.Palette, TextSize: th.TextSize, FingerSize: th.FingerSize}
+}
+
+// fillVariants sets the colors left out of the variants to the palette's.
+func (s *ThemeSpec) fillVariants() {
+	for n, v := range s.Variants {
+		vv, pv := reflect.ValueOf(&v).Elem(), reflect.ValueOf(s.Palette)
+		for i := 0; i < vv.NumField(); i++ {
+			if vv.Field(i).IsZero() {
+				vv.Field(i).Set(pv.Field(i))
+			}
+		}
+		s.Variants[n] = v
+	}
+}
+
+// jsonObj converts decoded JSON to Rye values for setStruct; whole numbers
+// are integers.
+func jsonObj(v any) env.Object {
+	switch v := v.(type) {
+	case map[string]any:
+		d := map[string]any{}
+		for k, e := range v {
+			d[k] = jsonObj(e)
+		}
+		return *env.NewDict(d)
+	case []any:
+		items := make([]env.Object, len(v))
+		for i, e := range v {
+			items[i] = jsonObj(e)
+		}
+		return *env.NewBlock(*env.NewTSeries(items))
+	case float64:
+		if v == math.Trunc(v) {
+			return *env.NewInteger(int64(v))
+		}
+		return *env.NewDecimal(v)
+	case bool:
+		return *env.NewInteger(boolToInt64(v))
+	case string:
+		return *env.NewString(v)
+	}
+	return *env.NewInteger(0)
+}
+
+// themeSpecOf reads a theme spec from a dict or context.
+func themeSpecOf(ps *env.ProgramState, path string, obj env.Object) (*ThemeSpec, error) {
+	s := newThemeSpec()
+	if err := setStruct(ps, path, reflect.ValueOf(s).Elem(), obj); err != nil {
+		return nil, err
+	}
+	s.fillVariants()
+	return s, nil
+}
+
+// themeStyles are the specs applied to themes, for their tokens and
+// variants.
+var (
+	themeStylesMu sync.Mutex
+	themeStyles   = map[*material.Theme]*ThemeSpec{}
+	// themeVariants are the themes made for variants, kept so widgets
+	// given one keep getting the same theme.
+	themeVariants = map[*material.Theme]map[string]*material.Theme{}
+)
+
+func applyTheme(th *material.Theme, s *ThemeSpec) {
+	th.Palette = s.Palette
+	th.TextSize = s.TextSize
+	th.FingerSize = s.FingerSize
+	th.Face = s.Typeface
+	themeStylesMu.Lock()
+	themeStyles[th] = s
+	for n, vth := range themeVariants[th] {
+		*vth = *th
+		if p, ok := s.Variants[n]; ok {
+			vth.Palette = p
+		}
+	}
+	themeStylesMu.Unlock()
+}
+
+// themeToken returns a builtin getting a named size of the theme's spec.
+func themeToken[T ~float32](method, doc string, tokens func(*ThemeSpec) map[string]T) *env.Builtin {
+	name := "Go(*material.Theme)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := nameArg(ps, name, 2, arg1)
+			if err != nil {
+				return err
+			}
+			themeStylesMu.Lock()
+			s := themeStyles[th]
+			themeStylesMu.Unlock()
+			if s == nil {
+				return failure(ps, name, "no theme file applied to the theme")
+			}
+			v, ok := tokens(s)[n]
+			if !ok {
+				return failure(ps, name, "the theme has no "+n)
+			}
+			return *env.NewDecimal(float64(v))
+		},
+	}
+}
+
+var builtinsTheme = map[string]*env.Builtin{
+	"load-theme": {
+		Doc:   "Load a JSON theme file of palette, text-size, finger-size, typeface, type-scale, spacing, radii and variants; apply it with apply-theme!",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			path, err := stringArg(ps, "load-theme", 1, arg0)
+			if err != nil {
+				return err
+			}
+			data, ferr := os.ReadFile(path)
+			if ferr != nil {
+				return failure(ps, "load-theme", ferr.Error())
+			}
+			var v any
+			if jerr := json.Unmarshal(data, &v); jerr != nil {
+				return failure(ps, "load-theme", path+": "+jerr.Error())
+			}
+			s, serr := themeSpecOf(ps, "load-theme: "+path, jsonObj(v))
+			if serr != nil {
+				ps.FailureFlag = true
+				return env.NewError(serr.Error())
+			}
+			return *env.NewNative(ps.Idx, s, "Go(*gioui_org.ThemeSpec)")
+		},
+	},
+	"theme-spec": {
+		Doc:   "Make a theme spec from a dict or context with the keys of a theme file",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			if _, ok := objectEntries(ps, arg0); !ok {
+				return argError(ps, "theme-spec", 1, "dict or context", arg0)
+			}
+			s, serr := themeSpecOf(ps, "theme-spec: arg 1", arg0)
+			if serr != nil {
+				ps.FailureFlag = true
+				return env.NewError(serr.Error())
+			}
+			return *env.NewNative(ps.Idx, s, "Go(*gioui_org.ThemeSpec)")
+		},
+	},
+	"Go(*material.Theme)//apply-theme!": {
+		Doc:   "Restyle the theme, and the widgets using it, with a theme spec; switch specs at any time",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "Go(*material.Theme)//apply-theme!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			s, err := nativeArg[*ThemeSpec](ps, "Go(*material.Theme)//apply-theme!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			applyTheme(th, s)
+			return arg0
+		},
+	},
+	"Go(*material.Theme)//type-size?": themeToken("type-size?", "Get the text size in sp of a step of the theme's type scale ('h1, 'body, ...)", func(s *ThemeSpec) map[string]unit.Sp { return s.TypeScale }),
+	"Go(*material.Theme)//spacing?":   themeToken("spacing?", "Get a named spacing of the theme in dp", func(s *ThemeSpec) map[string]unit.Dp { return s.Spacing }),
+	"Go(*material.Theme)//radius?":    themeToken("radius?", "Get a named corner radius of the theme in dp", func(s *ThemeSpec) map[string]unit.Dp { return s.Radii }),
+	"Go(*material.Theme)//variant": {
+		Doc:   "Get the theme with the palette of one of its variants ('danger), to give a widget",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "Go(*material.Theme)//variant", 1, arg0)
+			if err != nil {
+				return err
+			}
+			n, err := nameArg(ps, "Go(*material.Theme)//variant", 2, arg1)
+			if err != nil {
+				return err
+			}
+			themeStylesMu.Lock()
+			defer themeStylesMu.Unlock()
+			s := themeStyles[th]
+			if s == nil {
+				return failure(ps, "Go(*material.Theme)//variant", "no theme file applied to the theme")
+			}
+			p, ok := s.Variants[n]
+			if !ok {
+				return failure(ps, "Go(*material.Theme)//variant", fmt.Sprintf("the theme has no variant %s", n))
+			}
+			if themeVariants[th] == nil {
+				themeVariants[th] = map[string]*material.Theme{}
+			}
+			vth, ok := themeVariants[th][n]
+			if !ok {
+				vth = new(material.Theme)
+				themeVariants[th][n] = vth
+			}
+			// Refreshed each time, so fonts added to th since show.
+			*vth = *th
+			vth.Palette = p
+			return *env.NewNative(ps.Idx, vth, "Go(*material.Theme)")
+		},
+	},
+}
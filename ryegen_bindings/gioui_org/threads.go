@@ -0,0 +1,166 @@
+// Guard against laying out a frame from another goroutine.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"gioui.org/app"
+	"gioui.org/layout"
+	"gioui.org/op"
+
+	"github.com/refaktor/rye/env"
+)
+
+// frameOwner is who lays out the frames of an operation list: the one that
+// last called app-context with it. Gio expects a frame to be built by one
+// goroutine; a script doing it from one it spawned corrupts the list or
+// crashes deep in Gio.
+type frameOwner struct {
+	// ps is the program state app-context was called with. Rye's go gives
+	// a goroutine a state of its own, so calls with the same state are on
+	// the owner and need no goroutine id, which is slow to get.
+	ps        *env.ProgramState
+	goroutine uint64
+	win       *app.Window // nil if the frame event didn't come from event
+}
+
+var (
+	frameOwners  sync.Map // *op.Ops -> *frameOwner
+	frameWindows sync.Map // input.Source -> *app.Window the frames are for
+)
+
+// noteFrame remembers the window of a frame event, so the operation list
+// it is laid out with can be forgotten with the window.
+func noteFrame(win *app.Window, e app.FrameEvent) {
+	frameWindows.Store(e.Source, win)
+}
+
+// forgetWindow drops what is kept about the frames of a destroyed window.
+func forgetWindow(win *app.Window) {
+	frameOwners.Range(func(k, v any) bool {
+		if v.(*frameOwner).win == win {
+			frameOwners.Delete(k)
+			frameInsets.Delete(k)
+		}
+		return true
+	})
+	frameWindows.Range(func(k, v any) bool {
+		if v.(*app.Window) == win {
+			frameWindows.Delete(k)
+			sourcePacings.Delete(k)
+		}
+		return true
+	})
+}
+
+// claimFrame makes the caller the owner of the operation list of a frame.
+func claimFrame(ps *env.ProgramState, arg0, arg1 env.Object) {
+	ops := frameOps(arg0)
+	if ops == nil {
+		return
+	}
+	owner := &frameOwner{ps: ps, goroutine: goroutineID()}
+	if nat, ok := arg1.(env.Native); ok {
+		if e, ok := nat.Value.(*app.FrameEvent); ok {
+			if win, ok := frameWindows.Load(e.Source); ok {
+				owner.win = win.(*app.Window)
+			}
+		}
+	}
+	frameOwners.Store(ops, owner)
+}
+
+// frameContextBuiltins make the layout context of a frame from their first
+// argument, an *op.Ops.
+var frameContextBuiltins = map[string]bool{
+	"app-context": true,
+}
+
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// frameOps returns the operation list arg is or belongs to.
+func frameOps(arg env.Object) *op.Ops {
+	nat, ok := arg.(env.Native)
+	if !ok {
+		return nil
+	}
+	switch v := nat.Value.(type) {
+	case *layout.Context:
+		return v.Ops
+	case *op.Ops:
+		return v
+	case *OpBuilder:
+		return v.gtx.Ops
+	}
+	return nil
+}
+
+// checkFrameOwner fails if an argument belongs to a frame laid out by
+// another goroutine.
+func checkFrameOwner(ps *env.ProgramState, name string, args ...env.Object) *env.Error {
+	var id uint64
+	for _, arg := range args {
+		ops := frameOps(arg)
+		if ops == nil {
+			continue
+		}
+		v, ok := frameOwners.Load(ops)
+		if !ok {
+			continue
+		}
+		owner := v.(*frameOwner)
+		if owner.ps == ps {
+			continue
+		}
+		if id == 0 {
+			id = goroutineID()
+		}
+		if owner.goroutine != id {
+			return failure(ps, name, "called from a goroutine other than the one laying out the frame; "+
+				"use layout contexts and ops only in the window's event loop, and hand results over "+
+				"with an event stream or by invalidating the window")
+		}
+	}
+	return nil
+}
+
+// guardFrameBuiltins wraps the builtins so the ones given a layout context
+// or operation list check they run on the goroutine of its frame.
+func guardFrameBuiltins(maps ...map[string]*env.Builtin) bool {
+	done := map[*env.Builtin]bool{}
+	for _, m := range maps {
+		for k, b := range m {
+			if done[b] {
+				continue
+			}
+			done[b] = true
+			name, fn, claims := k, b.Fn, frameContextBuiltins[k]
+			b.Fn = func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+				if claims {
+					claimFrame(ps, arg0, arg1)
+				} else if err := checkFrameOwner(ps, name, arg0, arg1, arg2, arg3, arg4); err != nil {
+					return err
+				}
+				return fn(ps, arg0, arg1, arg2, arg3, arg4)
+			}
+		}
+	}
+	return true
+}
+
+var _ = guardFrameBuiltins(builtinsGenerated, builtinsCustom)
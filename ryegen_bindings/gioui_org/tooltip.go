@@ -0,0 +1,196 @@
+// Tooltips shown while hovering a widget.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"time"
+
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// Tooltip shows Content near the pointer after it rested on Widget for
+// ShowDelay, and hides it HideDelay after the pointer left.
+type Tooltip struct {
+	Theme     *material.Theme
+	Widget    layout.Widget
+	Content   layout.Widget
+	ShowDelay time.Duration
+	HideDelay time.Duration
+	hovering  bool
+	pressed   bool // a press hides the tip until the pointer leaves
+	since     time.Time
+	visible   bool
+	pos       image.Point
+}
+
+func (t *Tooltip) update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(pointer.Filter{Target: t, Kinds: pointer.Enter | pointer.Leave | pointer.Move | pointer.Press | pointer.Cancel})
+		if !ok {
+			break
+		}
+		pe, ok := e.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch pe.Kind {
+		case pointer.Enter, pointer.Move:
+			if !t.hovering {
+				t.hovering = true
+				t.since = gtx.Now
+			}
+			if !t.visible {
+				t.pos = pe.Position.Round()
+			}
+		case pointer.Leave, pointer.Cancel:
+			t.hovering, t.pressed = false, false
+			t.since = gtx.Now
+		case pointer.Press:
+			t.pressed = true
+			t.visible = false
+		}
+	}
+	switch {
+	case t.hovering && !t.pressed && !t.visible:
+		if at := t.since.Add(t.ShowDelay); gtx.Now.Before(at) {
+			gtx.Execute(op.InvalidateCmd{At: at})
+		} else {
+			t.visible = true
+		}
+	case !t.hovering && t.visible:
+		if at := t.since.Add(t.HideDelay); gtx.Now.Before(at) {
+			gtx.Execute(op.InvalidateCmd{At: at})
+		} else {
+			t.visible = false
+		}
+	}
+}
+
+func (t *Tooltip) Layout(gtx layout.Context) layout.Dimensions {
+	t.update(gtx)
+	avail := gtx.Constraints.Max
+	macro := op.Record(gtx.Ops)
+	dims := t.Widget(gtx)
+	call := macro.Stop()
+	area := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+	event.Op(gtx.Ops, t)
+	call.Add(gtx.Ops)
+	area.Pop()
+	if t.visible {
+		macro := op.Record(gtx.Ops)
+		t.layoutTip(gtx, dims.Size, avail)
+		deferLayer(gtx.Ops, layerOverlay, macro.Stop())
+	}
+	return dims
+}
+
+// layoutTip places the tip under the widget, or above it when there's no
+// room below, keeping it within the space the widget was given.
+func (t *Tooltip) layoutTip(gtx layout.Context, size, avail image.Point) {
+	layoutTipAt(gtx, t.Theme, image.Rect(t.pos.X, 0, t.pos.X, size.Y), avail, t.Content)
+}
+
+// layoutTipAt draws a tip of content under anchor, or above it when there's
+// no room below, within avail. Widgets showing values on hover use it too.
+func layoutTipAt(gtx layout.Context, th *material.Theme, anchor image.Rectangle, avail image.Point, content layout.Widget) {
+	gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Dp(320), gtx.Dp(480))}
+	macro := op.Record(gtx.Ops)
+	dims := layout.Inset{Left: 8, Right: 8, Top: 4, Bottom: 4}.Layout(gtx, content)
+	call := macro.Stop()
+
+	at := placePopup(anchor, dims.Size, avail, placement{side: "bottom"}, gtx.Dp(6), true)
+	defer op.Offset(at).Push(gtx.Ops).Pop()
+	rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(4))
+	paint.FillShape(gtx.Ops, mulAlpha(th.Palette.Fg, 0xe6), rr.Op(gtx.Ops))
+	call.Add(gtx.Ops)
+}
+
+// tipText returns the content of a tip of text, drawn in the theme's
+// background color to contrast with the tip.
+func tipText(th *material.Theme, s string) layout.Widget {
+	return func(gtx layout.Context) layout.Dimensions {
+		lbl := material.Body2(th, s)
+		lbl.Color = th.Palette.Bg
+		return lbl.Layout(gtx)
+	}
+}
+
+// tooltipContent returns a widget for a string or widget argument.
+func tooltipContent(ps *env.ProgramState, th *material.Theme, name string, n int, arg env.Object) (layout.Widget, *env.Error) {
+	if s, ok := arg.(env.String); ok {
+		return tipText(th, s.Value), nil
+	}
+	return widgetArg(ps, name, n, arg)
+}
+
+var builtinsTooltip = map[string]*env.Builtin{
+	"with-tooltip": {
+		Doc:   "Wrap a widget so hovering it shows a tooltip; content is a string or a widget",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "with-tooltip", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "with-tooltip", 2, arg1)
+			if err != nil {
+				return err
+			}
+			content, err := tooltipContent(ps, th, "with-tooltip", 3, arg2)
+			if err != nil {
+				return err
+			}
+			t := &Tooltip{Theme: th, Widget: w, Content: content, ShowDelay: 500 * time.Millisecond, HideDelay: 100 * time.Millisecond}
+			return *env.NewNative(ps.Idx, t, "Go(*gioui_org.Tooltip)")
+		},
+	},
+	"Go(*gioui_org.Tooltip)//layout": layoutBuiltin[*Tooltip]("Go(*gioui_org.Tooltip)//layout"),
+	"Go(*gioui_org.Tooltip)//content!": {
+		Doc:   "Set the tooltip content, a string or a widget",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*Tooltip](ps, "Go(*gioui_org.Tooltip)//content!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			content, err := tooltipContent(ps, t.Theme, "Go(*gioui_org.Tooltip)//content!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			t.Content = content
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Tooltip)//delays!": {
+		Doc:   "Set show and hide delays in milliseconds",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*Tooltip](ps, "Go(*gioui_org.Tooltip)//delays!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			show, err := integerArg(ps, "Go(*gioui_org.Tooltip)//delays!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			hide, err := integerArg(ps, "Go(*gioui_org.Tooltip)//delays!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			t.ShowDelay = time.Duration(show) * time.Millisecond
+			t.HideDelay = time.Duration(hide) * time.Millisecond
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,420 @@
+// Onboarding tours highlighting widgets one step at a time.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+
+	"gioui.org/font"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// tourStep highlights the widget registered as Target, or none when it is
+// empty, with a caption.
+type tourStep struct {
+	Target string
+	Title  string
+	Text   string
+}
+
+// Tour lays out Content and, while running, dims all but the target of the
+// current step, captioned in a card with buttons to go on or skip the rest.
+// Targets are widgets wrapped with the tour's target method. A step whose
+// target isn't laid out in the frame, like one with none, is captioned in
+// the middle over everything.
+type Tour struct {
+	ps       *env.ProgramState
+	Theme    *material.Theme
+	Content  layout.Widget
+	Steps    []tourStep
+	OnStep   *env.Function
+	OnFinish *env.Function
+	step     int  // -1 when not running
+	frame    uint // counts the tour's layouts
+	seen     uint // the frame the current target was laid out in
+	next     widget.Clickable
+	back     widget.Clickable
+	skip     widget.Clickable
+	backdrop int // tag of the dimmed backdrop, taking presses
+}
+
+func (t *Tour) Running() bool { return t.step >= 0 && t.step < len(t.Steps) }
+
+// Go shows step i, finishing the tour past the last one.
+func (t *Tour) Go(i int) {
+	if i >= len(t.Steps) {
+		t.finish(true)
+		return
+	}
+	t.step = max(i, 0)
+	if t.OnStep != nil {
+		callFunction(t.ps, "tour on-step", *t.OnStep, *env.NewInteger(int64(t.step)), *env.NewString(t.Steps[t.step].Target))
+	}
+}
+
+// finish stops the tour, completed or skipped.
+func (t *Tour) finish(completed bool) {
+	if !t.Running() {
+		return
+	}
+	t.step = -1
+	if t.OnFinish != nil {
+		callFunction(t.ps, "tour on-finish", *t.OnFinish, *env.NewInteger(boolToInt64(completed)))
+	}
+}
+
+func (t *Tour) update(gtx layout.Context) {
+	for t.next.Clicked(gtx) {
+		if t.Running() {
+			t.Go(t.step + 1)
+		}
+	}
+	for t.back.Clicked(gtx) {
+		if t.Running() && t.step > 0 {
+			t.Go(t.step - 1)
+		}
+	}
+	for t.skip.Clicked(gtx) {
+		t.finish(false)
+	}
+	// Presses on the backdrop must not reach what is under it.
+	for {
+		if _, ok := gtx.Event(pointer.Filter{Target: &t.backdrop, Kinds: pointer.Press}); !ok {
+			break
+		}
+	}
+}
+
+func (t *Tour) Layout(gtx layout.Context) layout.Dimensions {
+	t.update(gtx)
+	t.frame++
+	dims := t.Content(gtx)
+	if t.Running() && t.seen != t.frame {
+		size := dims.Size
+		macro := op.Record(gtx.Ops)
+		t.layoutBackdrop(gtx, image.Rectangle{})
+		cgtx := gtx
+		cgtx.Constraints = layout.Constraints{Max: size}
+		m := op.Record(gtx.Ops)
+		cd := t.layoutCard(cgtx)
+		card := m.Stop()
+		off := op.Offset(size.Sub(cd.Size).Div(2)).Push(gtx.Ops)
+		card.Add(gtx.Ops)
+		off.Pop()
+		deferLayer(gtx.Ops, layerOverlay, macro.Stop())
+	}
+	return dims
+}
+
+// layoutBackdrop dims everything but hole, taking the presses on it.
+func (t *Tour) layoutBackdrop(gtx layout.Context, hole image.Rectangle) {
+	const far = 1 << 20
+	for _, r := range []image.Rectangle{
+		image.Rect(-far, -far, far, hole.Min.Y),
+		image.Rect(-far, hole.Max.Y, far, far),
+		image.Rect(-far, hole.Min.Y, hole.Min.X, hole.Max.Y),
+		image.Rect(hole.Max.X, hole.Min.Y, far, hole.Max.Y),
+	} {
+		if r.Empty() {
+			continue
+		}
+		area := clip.Rect(r).Push(gtx.Ops)
+		paint.ColorOp{Color: color.NRGBA{A: 0x99}}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		event.Op(gtx.Ops, &t.backdrop)
+		area.Pop()
+	}
+}
+
+// layoutCard lays out the caption of the current step with its buttons.
+func (t *Tour) layoutCard(gtx layout.Context) layout.Dimensions {
+	th := t.Theme
+	s := t.Steps[t.step]
+	gtx.Constraints.Min = image.Point{}
+	gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(320))
+	button := func(c *widget.Clickable, label string, primary bool) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			b := material.Button(th, c, label)
+			b.Inset = layout.Inset{Top: 6, Bottom: 6, Left: 10, Right: 10}
+			if !primary {
+				b.Background = color.NRGBA{}
+				b.Color = th.ContrastBg
+			}
+			return layout.Inset{Left: 4}.Layout(gtx, b.Layout)
+		})
+	}
+	macro := op.Record(gtx.Ops)
+	dims := layout.UniformInset(12).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				lbl := material.Subtitle1(th, s.Title)
+				lbl.Font.Weight = font.Bold
+				return lbl.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 4}.Layout),
+			layout.Rigid(material.Body2(th, s.Text).Layout),
+			layout.Rigid(layout.Spacer{Height: 12}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				next := "Next"
+				if t.step == len(t.Steps)-1 {
+					next = "Done"
+				}
+				children := []layout.FlexChild{
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						lbl := material.Caption(th, strconv.Itoa(t.step+1)+" / "+strconv.Itoa(len(t.Steps)))
+						lbl.Color = mulAlpha(th.Fg, 0xa0)
+						return lbl.Layout(gtx)
+					}),
+					layout.Flexed(1, layout.Spacer{}.Layout),
+				}
+				if t.step < len(t.Steps)-1 {
+					children = append(children, button(&t.skip, "Skip", false))
+				}
+				if t.step > 0 {
+					children = append(children, button(&t.back, "Back", false))
+				}
+				children = append(children, button(&t.next, next, true))
+				return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+			}),
+		)
+	})
+	content := macro.Stop()
+	rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(8))
+	paint.FillShape(gtx.Ops, th.Bg, rr.Op(gtx.Ops))
+	// Presses on the card must not reach the backdrop under it.
+	area := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+	event.Op(gtx.Ops, &t.backdrop)
+	content.Add(gtx.Ops)
+	area.Pop()
+	return dims
+}
+
+// TourTarget is a widget registered with a tour under a name, highlighted
+// while its step is shown.
+type TourTarget struct {
+	Tour   *Tour
+	Name   string
+	Widget layout.Widget
+}
+
+func (w *TourTarget) Layout(gtx layout.Context) layout.Dimensions {
+	t := w.Tour
+	avail := gtx.Constraints.Max
+	dims := w.Widget(gtx)
+	if !t.Running() || t.Steps[t.step].Target != w.Name {
+		return dims
+	}
+	t.seen = t.frame
+	pad := gtx.Dp(4)
+	hole := image.Rectangle{Max: dims.Size}.Inset(-pad)
+	macro := op.Record(gtx.Ops)
+	t.layoutBackdrop(gtx, hole)
+	ring := clip.UniformRRect(hole, pad)
+	paint.FillShape(gtx.Ops, t.Theme.ContrastBg, clip.Stroke{Path: ring.Path(gtx.Ops), Width: float32(gtx.Dp(2))}.Op())
+	cgtx := gtx
+	cgtx.Constraints = layout.Constraints{Max: avail}
+	m := op.Record(gtx.Ops)
+	cd := t.layoutCard(cgtx)
+	card := m.Stop()
+	at := placePopup(hole, cd.Size, avail, placement{side: "bottom", align: -1}, gtx.Dp(8), true)
+	off := op.Offset(at).Push(gtx.Ops)
+	card.Add(gtx.Ops)
+	off.Pop()
+	deferLayer(gtx.Ops, layerOverlay, macro.Stop())
+	return dims
+}
+
+// parseTourSteps reads the steps of a block like
+//
+//	intro "Welcome" "A quick look around."
+//	step 'search "Search" "Find anything in your notes here."
+func parseTourSteps(ps *env.ProgramState, name string, blk env.Block) ([]tourStep, *env.Error) {
+	var steps []tourStep
+	s := blk.Series.S
+	strs := func(at int) (string, string, bool) {
+		if at+2 > len(s) {
+			return "", "", false
+		}
+		title, ok1 := s[at].(env.String)
+		text, ok2 := s[at+1].(env.String)
+		return title.Value, text.Value, ok1 && ok2
+	}
+	for i := 0; i < len(s); {
+		kw, err := nameArg(ps, name, 2, s[i])
+		if err != nil {
+			return nil, err
+		}
+		switch kw {
+		case "intro":
+			title, text, ok := strs(i + 1)
+			if !ok {
+				return nil, failure(ps, name, fmt.Sprintf("step %d: expected a title and a text", len(steps)+1))
+			}
+			steps = append(steps, tourStep{Title: title, Text: text})
+			i += 3
+		case "step":
+			if i+1 == len(s) {
+				return nil, failure(ps, name, fmt.Sprintf("step %d: expected a target, a title and a text", len(steps)+1))
+			}
+			target, err := nameArg(ps, name, 2, s[i+1])
+			if err != nil {
+				return nil, err
+			}
+			title, text, ok := strs(i + 2)
+			if !ok {
+				return nil, failure(ps, name, fmt.Sprintf("step %d: expected a target, a title and a text", len(steps)+1))
+			}
+			steps = append(steps, tourStep{Target: target, Title: title, Text: text})
+			i += 4
+		default:
+			return nil, failure(ps, name, fmt.Sprintf("expected intro or step, got %q", kw))
+		}
+	}
+	return steps, nil
+}
+
+func tourBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, t *Tour, arg1, arg2 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.Tour)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*Tour](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, t, arg1, arg2); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsTour = map[string]*env.Builtin{
+	"tour": {
+		Doc:   "Create a tour over a content widget from a block of steps, each intro title text, or step target title text highlighting a widget wrapped with target; start it with start",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "tour", 1, arg0)
+			if err != nil {
+				return err
+			}
+			content, err := widgetArg(ps, "tour", 2, arg1)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg2.(env.Block)
+			if !ok {
+				return argError(ps, "tour", 3, "block of steps", arg2)
+			}
+			steps, err := parseTourSteps(ps, "tour", blk)
+			if err != nil {
+				return err
+			}
+			t := &Tour{ps: ps, Theme: th, Content: content, Steps: steps, step: -1}
+			return *env.NewNative(ps.Idx, t, "Go(*gioui_org.Tour)")
+		},
+	},
+	"Go(*gioui_org.Tour)//layout": layoutBuiltin[*Tour]("Go(*gioui_org.Tour)//layout"),
+	"Go(*gioui_org.Tour)//target": {
+		Doc:   "Wrap a widget as the target of the tour's steps with a name",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*Tour](ps, "Go(*gioui_org.Tour)//target", 1, arg0)
+			if err != nil {
+				return err
+			}
+			name, err := nameArg(ps, "Go(*gioui_org.Tour)//target", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "Go(*gioui_org.Tour)//target", 3, arg2)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &TourTarget{Tour: t, Name: name, Widget: w}, "Go(*gioui_org.TourTarget)")
+		},
+	},
+	"Go(*gioui_org.TourTarget)//layout": layoutBuiltin[*TourTarget]("Go(*gioui_org.TourTarget)//layout"),
+	"Go(*gioui_org.Tour)//steps!": tourBuiltin("steps!", "Replace the steps with a block of them, stopping the tour", 2, func(ps *env.ProgramState, name string, t *Tour, arg1, _ env.Object) env.Object {
+		blk, ok := arg1.(env.Block)
+		if !ok {
+			return argError(ps, name, 2, "block of steps", arg1)
+		}
+		steps, err := parseTourSteps(ps, name, blk)
+		if err != nil {
+			return err
+		}
+		t.Steps, t.step = steps, -1
+		return nil
+	}),
+	"Go(*gioui_org.Tour)//start": tourBuiltin("start", "Start the tour from its first step", 1, func(ps *env.ProgramState, name string, t *Tour, _, _ env.Object) env.Object {
+		if len(t.Steps) == 0 {
+			return failure(ps, name, "the tour has no steps")
+		}
+		t.Go(0)
+		return nil
+	}),
+	"Go(*gioui_org.Tour)//go-to": tourBuiltin("go-to", "Show a step, counted from 0, starting the tour if it isn't running", 2, func(ps *env.ProgramState, name string, t *Tour, arg1, _ env.Object) env.Object {
+		i, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if i < 0 || int(i) >= len(t.Steps) {
+			return failure(ps, name, "no step "+strconv.FormatInt(i, 10))
+		}
+		t.Go(int(i))
+		return nil
+	}),
+	"Go(*gioui_org.Tour)//next": tourBuiltin("next", "Go on to the next step, finishing the tour after the last", 1, func(ps *env.ProgramState, name string, t *Tour, _, _ env.Object) env.Object {
+		if t.Running() {
+			t.Go(t.step + 1)
+		}
+		return nil
+	}),
+	"Go(*gioui_org.Tour)//skip": tourBuiltin("skip", "Stop the tour, skipping the steps left", 1, func(ps *env.ProgramState, name string, t *Tour, _, _ env.Object) env.Object {
+		t.finish(false)
+		return nil
+	}),
+	"Go(*gioui_org.Tour)//step?": tourBuiltin("step?", "Get the step shown, counted from 0, or -1 when the tour isn't running", 1, func(ps *env.ProgramState, name string, t *Tour, _, _ env.Object) env.Object {
+		if !t.Running() {
+			return *env.NewInteger(-1)
+		}
+		return *env.NewInteger(int64(t.step))
+	}),
+	"Go(*gioui_org.Tour)//running?": tourBuiltin("running?", "Check whether the tour is running", 1, func(ps *env.ProgramState, name string, t *Tour, _, _ env.Object) env.Object {
+		return *env.NewInteger(boolToInt64(t.Running()))
+	}),
+	"Go(*gioui_org.Tour)//on-step!": tourBuiltin("on-step!", "Set function called with the index and the target name of each step shown", 2, func(ps *env.ProgramState, name string, t *Tour, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 2, arg1)
+		if err != nil {
+			return err
+		}
+		t.OnStep = &fn
+		return nil
+	}),
+	"Go(*gioui_org.Tour)//on-finish!": tourBuiltin("on-finish!", "Set function called when the tour stops, with 1 if it was completed and 0 if skipped", 2, func(ps *env.ProgramState, name string, t *Tour, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 1, arg1)
+		if err != nil {
+			return err
+		}
+		t.OnFinish = &fn
+		return nil
+	}),
+}
@@ -0,0 +1,509 @@
+// Treemaps of hierarchies of sizes, drilled into by clicking.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+)
+
+// treemapColors color the children of the node shown, their own children
+// in lighter shades of the same.
+var treemapColors = []color.NRGBA{
+	{R: 0x1f, G: 0x77, B: 0xb4, A: 0xff},
+	{R: 0xff, G: 0x7f, B: 0x0e, A: 0xff},
+	{R: 0x2c, G: 0xa0, B: 0x2c, A: 0xff},
+	{R: 0xd6, G: 0x27, B: 0x28, A: 0xff},
+	{R: 0x94, G: 0x67, B: 0xbd, A: 0xff},
+	{R: 0x8c, G: 0x56, B: 0x4b, A: 0xff},
+	{R: 0xe3, G: 0x77, B: 0xc2, A: 0xff},
+	{R: 0x17, G: 0xbe, B: 0xcf, A: 0xff},
+}
+
+// treemapNode is a leaf with a size or a group of children, sized by the
+// sum of theirs. Children are kept largest first.
+type treemapNode struct {
+	Name     string
+	Size     float64
+	Children []*treemapNode
+	parent   *treemapNode
+}
+
+// path returns the names from the root down to n, the root's excluded.
+func (n *treemapNode) path() []string {
+	var p []string
+	for ; n.parent != nil; n = n.parent {
+		p = append(p, n.Name)
+	}
+	slices.Reverse(p)
+	return p
+}
+
+func (n *treemapNode) pathObj() env.Object {
+	p := n.path()
+	objs := make([]env.Object, len(p))
+	for i, s := range p {
+		objs[i] = *env.NewString(s)
+	}
+	return *env.NewBlock(*env.NewTSeries(objs))
+}
+
+// find returns the node at a path below n, or nil.
+func (n *treemapNode) find(path []string) *treemapNode {
+	for _, name := range path {
+		i := slices.IndexFunc(n.Children, func(c *treemapNode) bool { return c.Name == name })
+		if i < 0 {
+			return nil
+		}
+		n = n.Children[i]
+	}
+	return n
+}
+
+// frect is a rectangle of fractional pixels, so the cells of deep trees
+// don't drift from rounding.
+type frect struct{ x, y, w, h float64 }
+
+func (r frect) rect() image.Rectangle {
+	return image.Rect(int(r.x+0.5), int(r.y+0.5), int(r.x+r.w+0.5), int(r.y+r.h+0.5))
+}
+
+// squarify divides r among sizes, largest first, in rows along its shorter
+// side, each row growing while that brings its cells closer to squares.
+func squarify(sizes []float64, r frect) []frect {
+	res := make([]frect, len(sizes))
+	var total float64
+	for _, s := range sizes {
+		total += s
+	}
+	if total <= 0 || r.w <= 0 || r.h <= 0 {
+		return res
+	}
+	scale := r.w * r.h / total
+	// worst returns the aspect ratio of the least square cell of a row of
+	// area sum along a side.
+	worst := func(row []float64, sum, side float64) float64 {
+		var w float64
+		for _, s := range row {
+			a := s * scale
+			w = max(w, side*side*a/(sum*sum), sum*sum/(side*side*a))
+		}
+		return w
+	}
+	for i := 0; i < len(sizes); {
+		side := min(r.w, r.h)
+		j, sum := i+1, sizes[i]*scale
+		best := worst(sizes[i:j], sum, side)
+		for ; j < len(sizes); j++ {
+			w := worst(sizes[i:j+1], sum+sizes[j]*scale, side)
+			if w > best {
+				break
+			}
+			best, sum = w, sum+sizes[j]*scale
+		}
+		thick := sum / side
+		at := 0.0
+		for k := i; k < j; k++ {
+			l := sizes[k] * scale / thick
+			if r.w >= r.h {
+				res[k] = frect{r.x, r.y + at, thick, l}
+			} else {
+				res[k] = frect{r.x + at, r.y, l, thick}
+			}
+			at += l
+		}
+		if r.w >= r.h {
+			r.x, r.w = r.x+thick, r.w-thick
+		} else {
+			r.y, r.h = r.y+thick, r.h-thick
+		}
+		i = j
+	}
+	return res
+}
+
+// treemapCell is where a node was drawn, for finding it under the pointer.
+type treemapCell struct {
+	node   *treemapNode
+	bounds image.Rectangle
+}
+
+// Treemap shows a hierarchy as nested rectangles with areas in proportion
+// to their sizes, Depth levels below the node drilled into. Clicking a
+// group drills into it and clicking a leaf reports it; the path above is
+// a row of crumbs that go back up, as does a secondary click.
+type Treemap struct {
+	ps       *env.ProgramState
+	Theme    *material.Theme
+	Depth    int
+	OnClick  *env.Function
+	OnDrill  *env.Function
+	root     *treemapNode
+	current  *treemapNode
+	cells    []treemapCell // parents before their children
+	crumbs   []treemapCell
+	hovered  *treemapNode
+	hoverPos image.Point
+}
+
+func (t *Treemap) SetTree(root *treemapNode) {
+	t.root, t.current, t.hovered = root, root, nil
+}
+
+// Drill shows n and what is below it.
+func (t *Treemap) Drill(n *treemapNode) {
+	if n == t.current {
+		return
+	}
+	t.current, t.hovered = n, nil
+	if t.OnDrill != nil {
+		callFunction(t.ps, "treemap on-drill", *t.OnDrill, n.pathObj())
+	}
+}
+
+// at returns the deepest node drawn at p, and whether it is a crumb.
+func (t *Treemap) at(p image.Point) (*treemapNode, bool) {
+	for _, c := range t.crumbs {
+		if p.In(c.bounds) {
+			return c.node, true
+		}
+	}
+	for i := len(t.cells) - 1; i >= 0; i-- {
+		if p.In(t.cells[i].bounds) {
+			return t.cells[i].node, false
+		}
+	}
+	return nil, false
+}
+
+func (t *Treemap) update(gtx layout.Context) {
+	for {
+		ev, ok := gtx.Event(pointer.Filter{Target: t, Kinds: pointer.Enter | pointer.Move | pointer.Leave | pointer.Press | pointer.Cancel})
+		if !ok {
+			break
+		}
+		e, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch e.Kind {
+		case pointer.Enter, pointer.Move:
+			t.hoverPos = e.Position.Round()
+			if n, crumb := t.at(t.hoverPos); !crumb {
+				t.hovered = n
+			} else {
+				t.hovered = nil
+			}
+		case pointer.Leave, pointer.Cancel:
+			t.hovered = nil
+		case pointer.Press:
+			n, crumb := t.at(e.Position.Round())
+			switch {
+			case e.Buttons.Contain(pointer.ButtonSecondary):
+				if t.current.parent != nil {
+					t.Drill(t.current.parent)
+				}
+			case n == nil:
+			case crumb || len(n.Children) > 0:
+				t.Drill(n)
+			case t.OnClick != nil:
+				callFunction(t.ps, "treemap on-click", *t.OnClick, n.pathObj(), *env.NewDecimal(n.Size))
+			}
+		}
+	}
+}
+
+// caption lays out a single line of text within width, returning its call
+// and size.
+func (t *Treemap) caption(gtx layout.Context, s string, width int, col color.NRGBA) (op.CallOp, image.Point) {
+	gtx.Constraints = layout.Constraints{Max: image.Pt(max(width, 0), gtx.Constraints.Max.Y)}
+	lbl := material.Caption(t.Theme, s)
+	lbl.Color = col
+	lbl.MaxLines = 1
+	m := op.Record(gtx.Ops)
+	d := lbl.Layout(gtx)
+	return m.Stop(), d.Size
+}
+
+// layoutChildren draws the children of n in r, level levels below the
+// node shown, colored from base, or each its own color on the first level.
+func (t *Treemap) layoutChildren(gtx layout.Context, n *treemapNode, r frect, level int, base color.NRGBA) {
+	sizes := make([]float64, len(n.Children))
+	for i, c := range n.Children {
+		sizes[i] = c.Size
+	}
+	pad := float64(gtx.Dp(2))
+	for i, cr := range squarify(sizes, r) {
+		c := n.Children[i]
+		b := cr.rect()
+		if b.Dx() < 2 || b.Dy() < 2 {
+			continue
+		}
+		col := base
+		if level == 1 {
+			col = treemapColors[i%len(treemapColors)]
+		}
+		t.cells = append(t.cells, treemapCell{node: c, bounds: b})
+		inner := b.Inset(1)
+		fill := col
+		if len(c.Children) > 0 && level < t.Depth {
+			fill = mulAlpha(col, 0x50)
+		}
+		paint.FillShape(gtx.Ops, fill, clip.Rect(inner).Op())
+
+		textCol := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+		if luminance(fill) > 0.6 {
+			textCol = color.NRGBA{A: 0xff}
+		}
+		call, size := t.caption(gtx, c.Name, inner.Dx()-2*int(pad), textCol)
+		header := 0
+		if size.Y+int(pad) <= inner.Dy() && size.X > 0 {
+			header = size.Y + int(pad)
+			off := op.Offset(inner.Min.Add(image.Pt(int(pad), int(pad)/2))).Push(gtx.Ops)
+			call.Add(gtx.Ops)
+			off.Pop()
+		}
+		if len(c.Children) > 0 && level < t.Depth {
+			sub := frect{cr.x + pad, cr.y + float64(header) + pad, cr.w - 2*pad, cr.h - float64(header) - 2*pad}
+			// Deeper levels lighten towards white.
+			shade := color.NRGBA{
+				R: col.R + (0xff-col.R)/4,
+				G: col.G + (0xff-col.G)/4,
+				B: col.B + (0xff-col.B)/4,
+				A: col.A,
+			}
+			t.layoutChildren(gtx, c, sub, level+1, shade)
+		}
+	}
+}
+
+func (t *Treemap) Layout(gtx layout.Context) layout.Dimensions {
+	t.update(gtx)
+	th := t.Theme
+	size := gtx.Constraints.Max
+	t.cells, t.crumbs = t.cells[:0], t.crumbs[:0]
+	if t.root == nil {
+		return layout.Dimensions{Size: size}
+	}
+
+	// The crumbs of the path to the node shown.
+	var trail []*treemapNode
+	for n := t.current; n != nil; n = n.parent {
+		trail = append(trail, n)
+	}
+	slices.Reverse(trail)
+	gap := gtx.Dp(6)
+	x, top := 0, 0
+	for i, n := range trail {
+		name := n.Name
+		if n == t.root && name == "" {
+			name = "All"
+		}
+		col := th.ContrastBg
+		if i == len(trail)-1 {
+			col = th.Fg
+		}
+		if i > 0 {
+			sep, ss := t.caption(gtx, "›", size.X-x, mulAlpha(th.Fg, 0x80))
+			off := op.Offset(image.Pt(x, 0)).Push(gtx.Ops)
+			sep.Add(gtx.Ops)
+			off.Pop()
+			x += ss.X + gap
+		}
+		call, cs := t.caption(gtx, name, size.X-x, col)
+		off := op.Offset(image.Pt(x, 0)).Push(gtx.Ops)
+		call.Add(gtx.Ops)
+		off.Pop()
+		if i < len(trail)-1 {
+			t.crumbs = append(t.crumbs, treemapCell{node: n, bounds: image.Rectangle{Min: image.Pt(x, 0), Max: image.Pt(x, 0).Add(cs)}})
+		}
+		x += cs.X + gap
+		top = max(top, cs.Y+gap/2)
+	}
+
+	t.layoutChildren(gtx, t.current, frect{0, float64(top), float64(size.X), float64(size.Y - top)}, 1, th.ContrastBg)
+
+	area := clip.Rect{Max: size}.Push(gtx.Ops)
+	event.Op(gtx.Ops, t)
+	if _, crumb := t.at(t.hoverPos); crumb {
+		pointer.CursorPointer.Add(gtx.Ops)
+	}
+	area.Pop()
+	if h := t.hovered; h != nil {
+		i := slices.IndexFunc(t.cells, func(c treemapCell) bool { return c.node == h })
+		if i >= 0 {
+			b := t.cells[i].bounds
+			paint.FillShape(gtx.Ops, th.Fg, clip.Stroke{Path: clip.Rect(b).Path(), Width: float32(gtx.Dp(1.5))}.Op())
+			tip := strings.Join(h.path()[len(t.current.path()):], " › ") + ": " + strconv.FormatFloat(h.Size, 'f', -1, 64)
+			m := op.Record(gtx.Ops)
+			layoutTipAt(gtx, th, image.Rectangle{Min: t.hoverPos, Max: t.hoverPos}, size, tipText(th, tip))
+			deferLayer(gtx.Ops, layerOverlay, m.Stop())
+		}
+	}
+	return layout.Dimensions{Size: size}
+}
+
+// treeArg accepts a block of names each followed by a size or by a block
+// of the same form, its children.
+func treeArg(ps *env.ProgramState, name string, n int, arg env.Object) (*treemapNode, *env.Error) {
+	var build func(blk env.Block, parent *treemapNode) *env.Error
+	build = func(blk env.Block, parent *treemapNode) *env.Error {
+		s := blk.Series.S
+		for i := 0; i < len(s); i += 2 {
+			label, ok := s[i].(env.String)
+			if !ok {
+				return argError(ps, name, n, "name", s[i])
+			}
+			if i+1 == len(s) {
+				return failure(ps, name, "missing size or block of children for "+label.Value)
+			}
+			c := &treemapNode{Name: label.Value, parent: parent}
+			switch v := s[i+1].(type) {
+			case env.Integer:
+				c.Size = float64(v.Value)
+			case env.Decimal:
+				c.Size = v.Value
+			case env.Block:
+				if err := build(v, c); err != nil {
+					return err
+				}
+			default:
+				return argError(ps, name, n, "size or block of children", v)
+			}
+			if c.Size < 0 {
+				return failure(ps, name, "negative size of "+label.Value)
+			}
+			parent.Children = append(parent.Children, c)
+			parent.Size += c.Size
+		}
+		slices.SortStableFunc(parent.Children, func(a, b *treemapNode) int {
+			switch {
+			case a.Size > b.Size:
+				return -1
+			case a.Size < b.Size:
+				return 1
+			}
+			return 0
+		})
+		return nil
+	}
+	blk, ok := arg.(env.Block)
+	if !ok {
+		return nil, argError(ps, name, n, "block", arg)
+	}
+	root := &treemapNode{}
+	if err := build(blk, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func treemapBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, t *Treemap, arg1, arg2 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.Treemap)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			t, err := nativeArg[*Treemap](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, t, arg1, arg2); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+var builtinsTreemap = map[string]*env.Builtin{
+	"treemap": {
+		Doc:   "Create a treemap of a block of names each followed by a size or a block of children of the same form; click a group to drill into it",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "treemap", 1, arg0)
+			if err != nil {
+				return err
+			}
+			root, err := treeArg(ps, "treemap", 2, arg1)
+			if err != nil {
+				return err
+			}
+			t := &Treemap{ps: ps, Theme: th, Depth: 2}
+			t.SetTree(root)
+			return *env.NewNative(ps.Idx, t, "Go(*gioui_org.Treemap)")
+		},
+	},
+	"Go(*gioui_org.Treemap)//layout": layoutBuiltin[*Treemap]("Go(*gioui_org.Treemap)//layout"),
+	"Go(*gioui_org.Treemap)//tree!": treemapBuiltin("tree!", "Replace the hierarchy with a block of names each followed by a size or a block of children, showing it from the top", 2, func(ps *env.ProgramState, name string, t *Treemap, arg1, _ env.Object) env.Object {
+		root, err := treeArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		t.SetTree(root)
+		return nil
+	}),
+	"Go(*gioui_org.Treemap)//depth!": treemapBuiltin("depth!", "Set how many levels below the node drilled into are shown, 2 by default", 2, func(ps *env.ProgramState, name string, t *Treemap, arg1, _ env.Object) env.Object {
+		n, err := integerArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return failure(ps, name, "depth must be positive")
+		}
+		t.Depth = int(n)
+		return nil
+	}),
+	"Go(*gioui_org.Treemap)//drill": treemapBuiltin("drill", "Drill into the node at a block of names from the top; an empty block goes back to the top", 2, func(ps *env.ProgramState, name string, t *Treemap, arg1, _ env.Object) env.Object {
+		path, err := stringsArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		n := t.root.find(path)
+		if n == nil {
+			return failure(ps, name, "no node at "+strings.Join(path, " › "))
+		}
+		t.Drill(n)
+		return nil
+	}),
+	"Go(*gioui_org.Treemap)//up": treemapBuiltin("up", "Go up from the node drilled into to its parent", 1, func(ps *env.ProgramState, name string, t *Treemap, _, _ env.Object) env.Object {
+		if t.current.parent != nil {
+			t.Drill(t.current.parent)
+		}
+		return nil
+	}),
+	"Go(*gioui_org.Treemap)//path?": treemapBuiltin("path?", "Get the block of names from the top down to the node drilled into", 1, func(ps *env.ProgramState, name string, t *Treemap, _, _ env.Object) env.Object {
+		return t.current.pathObj()
+	}),
+	"Go(*gioui_org.Treemap)//on-click!": treemapBuiltin("on-click!", "Set function called with the path, a block of names, and the size of each leaf clicked", 2, func(ps *env.ProgramState, name string, t *Treemap, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 2, arg1)
+		if err != nil {
+			return err
+		}
+		t.OnClick = &fn
+		return nil
+	}),
+	"Go(*gioui_org.Treemap)//on-drill!": treemapBuiltin("on-drill!", "Set function called with the path of each node drilled into, an empty block for the top", 2, func(ps *env.ProgramState, name string, t *Treemap, arg1, _ env.Object) env.Object {
+		fn, err := functionArg(ps, name, 2, 1, arg1)
+		if err != nil {
+			return err
+		}
+		t.OnDrill = &fn
+		return nil
+	}),
+}
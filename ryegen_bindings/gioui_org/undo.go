@@ -0,0 +1,252 @@
+// Undo/redo history of commands.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"gioui.org/io/key"
+	"gioui.org/layout"
+
+	"github.com/refaktor/rye/env"
+)
+
+// command is a reversible state change made with do-command.
+type command struct {
+	Label string
+	do    env.Function
+	undo  env.Function
+}
+
+// History keeps done and undone commands. Doing a new command drops the
+// redo stack; the oldest commands are forgotten beyond Limit.
+type History struct {
+	ps     *env.ProgramState
+	Limit  int
+	done   []command
+	undone []command
+}
+
+// Do runs the command and records it, reporting whether it succeeded. A
+// failed command is not recorded and leaves the redo stack alone.
+func (h *History) Do(c command) bool {
+	callFunction(h.ps, "do-command", c.do)
+	if h.ps.ErrorFlag || h.ps.FailureFlag {
+		return false
+	}
+	h.done = append(h.done, c)
+	h.undone = h.undone[:0]
+	h.trim()
+	return true
+}
+
+func (h *History) trim() {
+	if h.Limit > 0 && len(h.done) > h.Limit {
+		h.done = append(h.done[:0], h.done[len(h.done)-h.Limit:]...)
+	}
+}
+
+// Undo reverts the last command, reporting whether there was one.
+func (h *History) Undo() bool {
+	if len(h.done) == 0 {
+		return false
+	}
+	c := h.done[len(h.done)-1]
+	h.done = h.done[:len(h.done)-1]
+	callFunction(h.ps, "history undo", c.undo)
+	h.undone = append(h.undone, c)
+	return true
+}
+
+// Redo repeats the last undone command, reporting whether there was one.
+func (h *History) Redo() bool {
+	if len(h.undone) == 0 {
+		return false
+	}
+	c := h.undone[len(h.undone)-1]
+	h.undone = h.undone[:len(h.undone)-1]
+	callFunction(h.ps, "history redo", c.do)
+	h.done = append(h.done, c)
+	return true
+}
+
+// Update handles Ctrl+Z, Ctrl+Shift+Z and Ctrl+Y (Cmd on macOS) that no
+// focused widget took.
+func (h *History) Update(gtx layout.Context) {
+	for {
+		e, ok := gtx.Event(
+			key.Filter{Name: "Z", Required: key.ModShortcut, Optional: key.ModShift},
+			key.Filter{Name: "Y", Required: key.ModShortcut},
+		)
+		if !ok {
+			break
+		}
+		ke, ok := e.(key.Event)
+		if !ok || ke.State != key.Press {
+			continue
+		}
+		if ke.Name == "Y" || ke.Modifiers.Contain(key.ModShift) {
+			h.Redo()
+		} else {
+			h.Undo()
+		}
+	}
+}
+
+func labelObj(cs []command) env.Object {
+	if len(cs) == 0 {
+		return *env.NewString("")
+	}
+	return *env.NewString(cs[len(cs)-1].Label)
+}
+
+var builtinsUndo = map[string]*env.Builtin{
+	"history": {
+		Doc:   "Create an undo/redo history keeping at most the given number of commands (0 for no limit)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			limit, err := integerArg(ps, "history", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewNative(ps.Idx, &History{ps: ps, Limit: int(limit)}, "Go(*gioui_org.History)")
+		},
+	},
+	"do-command": {
+		Doc:   "Run a do function and record it with its undo function and label in a history; a failing do function is not recorded",
+		Argsn: 4,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "do-command", 1, arg0)
+			if err != nil {
+				return err
+			}
+			label, err := stringArg(ps, "do-command", 2, arg1)
+			if err != nil {
+				return err
+			}
+			do, err := functionArg(ps, "do-command", 3, 0, arg2)
+			if err != nil {
+				return err
+			}
+			undo, err := functionArg(ps, "do-command", 4, 0, arg3)
+			if err != nil {
+				return err
+			}
+			if !h.Do(command{Label: label, do: do, undo: undo}) {
+				return failure(ps, "do-command", "do function of "+label+" failed: "+objectDebugString(ps.Idx, ps.Res))
+			}
+			return arg0
+		},
+	},
+	"Go(*gioui_org.History)//update": {
+		Doc:   "Handle the undo and redo shortcuts; call each frame with the layout context",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//update", 1, arg0)
+			if err != nil {
+				return err
+			}
+			gtx, err := contextArg(ps, "Go(*gioui_org.History)//update", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h.Update(gtx)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.History)//undo": {
+		Doc:   "Revert the last command; returns 0 when there was none",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//undo", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(h.Undo()))
+		},
+	},
+	"Go(*gioui_org.History)//redo": {
+		Doc:   "Repeat the last undone command; returns 0 when there was none",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//redo", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(h.Redo()))
+		},
+	},
+	"Go(*gioui_org.History)//can-undo?": {
+		Doc:   "Check whether there is a command to undo",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//can-undo?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(len(h.done) > 0))
+		},
+	},
+	"Go(*gioui_org.History)//can-redo?": {
+		Doc:   "Check whether there is a command to redo",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//can-redo?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(len(h.undone) > 0))
+		},
+	},
+	"Go(*gioui_org.History)//undo-label?": {
+		Doc:   "Get the label of the command undo would revert, or an empty string",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//undo-label?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return labelObj(h.done)
+		},
+	},
+	"Go(*gioui_org.History)//redo-label?": {
+		Doc:   "Get the label of the command redo would repeat, or an empty string",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//redo-label?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return labelObj(h.undone)
+		},
+	},
+	"Go(*gioui_org.History)//limit!": {
+		Doc:   "Set the maximum number of commands kept (0 for no limit)",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//limit!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			limit, err := integerArg(ps, "Go(*gioui_org.History)//limit!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			h.Limit = int(limit)
+			h.trim()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.History)//clear": {
+		Doc:   "Forget all commands",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			h, err := nativeArg[*History](ps, "Go(*gioui_org.History)//clear", 1, arg0)
+			if err != nil {
+				return err
+			}
+			h.done, h.undone = nil, nil
+			return arg0
+		},
+	},
+}
@@ -0,0 +1,416 @@
+// Updating the app's executable from a release feed.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gioui.org/app"
+
+	"github.com/refaktor/rye/env"
+)
+
+// release is an entry of a release feed: a JSON object with the version,
+// notes and either the url, sha256 and signature of the executable or a
+// platforms object of them by GOOS-GOARCH. The signature is the base64
+// ed25519 signature of the raw sha256 digest by the updater's key.
+type release struct {
+	Version   string `json:"version"`
+	Notes     string `json:"notes"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+	Platforms map[string]struct {
+		URL       string `json:"url"`
+		SHA256    string `json:"sha256"`
+		Signature string `json:"signature"`
+	} `json:"platforms"`
+}
+
+// asset resolves the executable of this platform.
+func (r *release) asset() error {
+	if p, ok := r.Platforms[runtime.GOOS+"-"+runtime.GOARCH]; ok {
+		r.URL, r.SHA256, r.Signature = p.URL, p.SHA256, p.Signature
+	}
+	if r.URL == "" || r.SHA256 == "" {
+		return errors.New("no release for " + runtime.GOOS + "-" + runtime.GOARCH)
+	}
+	return requireHTTPS(r.URL)
+}
+
+// requireHTTPS refuses URLs an update could be swapped on the way from.
+func requireHTTPS(url string) error {
+	if !strings.HasPrefix(url, "https://") {
+		return errors.New(url + ": updates must come over https")
+	}
+	return nil
+}
+
+// newerVersion reports whether version a is after b, comparing dotted
+// numbers ("1.10.0" after "1.9"); a leading v is ignored.
+func newerVersion(a, b string) bool {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			return na > nb
+		}
+	}
+	return false
+}
+
+var updateClient = &http.Client{
+	Timeout: 10 * time.Minute,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("too many redirects")
+		}
+		return requireHTTPS(req.URL.String())
+	},
+}
+
+// Updater checks a release feed for a version newer than the running one,
+// downloads it next to the executable, verifies its signature by the
+// public key the updater is given, and swaps it in. Checks
+// and downloads run in the background; the script follows them with
+// state? and progress?, and a window set with wake! is invalidated as they
+// advance.
+type Updater struct {
+	Feed    string
+	Version string
+	key     ed25519.PublicKey
+
+	mu       sync.Mutex
+	state    string // idle, checking, up-to-date, available, downloading, ready or failed
+	err      error
+	latest   release
+	done     int64
+	total    int64
+	win      *app.Window
+	exe      string
+	readyExe string
+}
+
+func newUpdater(feed, version string) (*Updater, error) {
+	if err := requireHTTPS(feed); err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, err
+	}
+	// Windows can't remove a running executable, so the one replaced by
+	// the last update goes now.
+	os.Remove(exe + ".old")
+	return &Updater{Feed: feed, Version: version, state: "idle", exe: exe}, nil
+}
+
+// set changes the state and wakes up the window.
+func (u *Updater) set(f func()) {
+	u.mu.Lock()
+	f()
+	win := u.win
+	u.mu.Unlock()
+	if win != nil {
+		win.Invalidate()
+	}
+}
+
+func (u *Updater) fail(err error) {
+	u.set(func() { u.state, u.err = "failed", err })
+}
+
+// start moves to state unless a check or download is in progress.
+func (u *Updater) start(state string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.state == "checking" || u.state == "downloading" {
+		return false
+	}
+	u.state, u.err = state, nil
+	return true
+}
+
+// Check fetches the feed.
+func (u *Updater) Check() {
+	if !u.start("checking") {
+		return
+	}
+	go func() {
+		r, err := u.fetchRelease()
+		if err != nil {
+			u.fail(err)
+			return
+		}
+		u.set(func() {
+			u.latest = r
+			if newerVersion(r.Version, u.Version) {
+				u.state = "available"
+			} else {
+				u.state = "up-to-date"
+			}
+		})
+	}()
+}
+
+func (u *Updater) fetchRelease() (release, error) {
+	var r release
+	resp, err := updateClient.Get(u.Feed)
+	if err != nil {
+		return r, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return r, errors.New(u.Feed + ": " + resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return r, fmt.Errorf("%s: %v", u.Feed, err)
+	}
+	return r, r.asset()
+}
+
+// Download fetches the available release and verifies it.
+func (u *Updater) Download() error {
+	u.mu.Lock()
+	r, state, key := u.latest, u.state, u.key
+	u.mu.Unlock()
+	if key == nil {
+		return errors.New("no public key to verify updates with; set one with public-key!")
+	}
+	if state != "available" && state != "failed" || r.URL == "" {
+		return errors.New("no update available; check first")
+	}
+	if !u.start("downloading") {
+		return nil
+	}
+	u.set(func() { u.done, u.total = 0, 0 })
+	go func() {
+		path := u.exe + ".new"
+		if err := u.fetchAsset(r, key, path); err != nil {
+			os.Remove(path)
+			u.fail(err)
+			return
+		}
+		u.set(func() { u.state, u.readyExe = "ready", path })
+	}()
+	return nil
+}
+
+func (u *Updater) fetchAsset(r release, key ed25519.PublicKey, path string) error {
+	resp, err := updateClient.Get(r.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(r.URL + ": " + resp.Status)
+	}
+	u.set(func() { u.total = resp.ContentLength })
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			u.set(func() { u.done += int64(n) })
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	digest := h.Sum(nil)
+	if !strings.EqualFold(hex.EncodeToString(digest), r.SHA256) {
+		return errors.New("download doesn't match its sha256")
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || !ed25519.Verify(key, digest, sig) {
+		return errors.New("download isn't signed by the update key")
+	}
+	return f.Close()
+}
+
+// Install swaps the downloaded executable in; it runs from the next start.
+func (u *Updater) Install() error {
+	u.mu.Lock()
+	path, state := u.readyExe, u.state
+	u.mu.Unlock()
+	if state != "ready" {
+		return errors.New("no update downloaded")
+	}
+	os.Remove(u.exe + ".old")
+	if err := os.Rename(u.exe, u.exe+".old"); err != nil {
+		return err
+	}
+	if err := os.Rename(path, u.exe); err != nil {
+		os.Rename(u.exe+".old", u.exe)
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(u.exe + ".old")
+	}
+	u.set(func() { u.state, u.Version, u.readyExe = "idle", u.latest.Version, "" })
+	return nil
+}
+
+// Restart installs the downloaded executable and runs it with the same
+// arguments in place of this process.
+func (u *Updater) Restart() error {
+	if err := u.Install(); err != nil {
+		return err
+	}
+	cmd := exec.Command(u.exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// updaterBuiltin returns a "//method" builtin of updaters; fn returning nil
+// returns the updater.
+func updaterBuiltin(method, doc string, argsn int, fn func(ps *env.ProgramState, name string, u *Updater, arg1 env.Object) env.Object) *env.Builtin {
+	name := "Go(*gioui_org.Updater)//" + method
+	return &env.Builtin{
+		Doc:   doc,
+		Argsn: argsn,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			u, err := nativeArg[*Updater](ps, name, 1, arg0)
+			if err != nil {
+				return err
+			}
+			if res := fn(ps, name, u, arg1); res != nil {
+				return res
+			}
+			return arg0
+		},
+	}
+}
+
+// updaterAction returns a builtin running an action that can fail.
+func updaterAction(method, doc string, action func(u *Updater) error) *env.Builtin {
+	return updaterBuiltin(method, doc, 1, func(ps *env.ProgramState, name string, u *Updater, _ env.Object) env.Object {
+		if err := action(u); err != nil {
+			return failure(ps, name, err.Error())
+		}
+		return nil
+	})
+}
+
+var builtinsUpdater = map[string]*env.Builtin{
+	"updater": {
+		Doc:   "Create an updater of the app's executable from the https URL of a release feed (JSON with version, notes and url, sha256 and signature, or platforms of them by GOOS-GOARCH) and the running version; downloads need public-key!",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			feed, err := stringArg(ps, "updater", 1, arg0)
+			if err != nil {
+				return err
+			}
+			version, err := stringArg(ps, "updater", 2, arg1)
+			if err != nil {
+				return err
+			}
+			u, uerr := newUpdater(feed, version)
+			if uerr != nil {
+				return failure(ps, "updater", uerr.Error())
+			}
+			return *env.NewNative(ps.Idx, u, "Go(*gioui_org.Updater)")
+		},
+	},
+	"Go(*gioui_org.Updater)//public-key!": updaterBuiltin("public-key!", "Set the base64 ed25519 public key releases are verified with, signing the sha256 digest of the executable; downloads fail until it is set", 2, func(ps *env.ProgramState, name string, u *Updater, arg1 env.Object) env.Object {
+		s, err := stringArg(ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		key, kerr := base64.StdEncoding.DecodeString(s)
+		if kerr != nil || len(key) != ed25519.PublicKeySize {
+			return failure(ps, name, "not a base64 ed25519 public key")
+		}
+		u.mu.Lock()
+		u.key = key
+		u.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.Updater)//wake!": updaterBuiltin("wake!", "Invalidate a window as checks and downloads advance, so its loop shows them", 2, func(ps *env.ProgramState, name string, u *Updater, arg1 env.Object) env.Object {
+		win, err := nativeArg[*app.Window](ps, name, 2, arg1)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.win = win
+		u.mu.Unlock()
+		return nil
+	}),
+	"Go(*gioui_org.Updater)//check":    updaterAction("check", "Start fetching the feed; state? becomes available or up-to-date", func(u *Updater) error { u.Check(); return nil }),
+	"Go(*gioui_org.Updater)//download": updaterAction("download", "Start downloading and verifying the available version next to the executable; state? becomes ready", (*Updater).Download),
+	"Go(*gioui_org.Updater)//install":  updaterAction("install", "Swap the downloaded executable in; it runs from the next start", (*Updater).Install),
+	"Go(*gioui_org.Updater)//restart":  updaterAction("restart", "Swap the downloaded executable in and run it with the same arguments in place of the app", (*Updater).Restart),
+	"Go(*gioui_org.Updater)//state?": updaterBuiltin("state?", "Get the state: idle, checking, up-to-date, available, downloading, ready or failed", 1, func(ps *env.ProgramState, name string, u *Updater, _ env.Object) env.Object {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return *env.NewString(u.state)
+	}),
+	"Go(*gioui_org.Updater)//progress?": updaterBuiltin("progress?", "Get the part of the download done, from 0.0 to 1.0 (0.0 while the size is unknown)", 1, func(ps *env.ProgramState, name string, u *Updater, _ env.Object) env.Object {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.total <= 0 {
+			return *env.NewDecimal(0)
+		}
+		return *env.NewDecimal(float64(u.done) / float64(u.total))
+	}),
+	"Go(*gioui_org.Updater)//latest?": updaterBuiltin("latest?", "Get a dict of the version and notes of the feed's release, once checked", 1, func(ps *env.ProgramState, name string, u *Updater, _ env.Object) env.Object {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return *env.NewDict(map[string]any{
+			"version": *env.NewString(u.latest.Version),
+			"notes":   *env.NewString(u.latest.Notes),
+		})
+	}),
+	"Go(*gioui_org.Updater)//error?": updaterBuiltin("error?", "Get why the last check or download failed, or an empty string", 1, func(ps *env.ProgramState, name string, u *Updater, _ env.Object) env.Object {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.err == nil {
+			return *env.NewString("")
+		}
+		return *env.NewString(u.err.Error())
+	}),
+}
@@ -0,0 +1,330 @@
+// Pan and zoom viewport.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"math"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+
+	"github.com/refaktor/rye/env"
+)
+
+// viewportChild is a widget placed at a world rectangle (in dp).
+type viewportChild struct {
+	bounds bbox
+	widget layout.Widget
+}
+
+// Viewport shows a world larger than the screen, panned by dragging and
+// zoomed by scrolling or pinching. World and screen coordinates are in dp,
+// screen = world*Zoom + Pan.
+type Viewport struct {
+	Content  layout.Widget // drawn unculled below the children
+	Zoom     float32
+	MinZoom  float32
+	MaxZoom  float32
+	Pan      f32.Point
+	children []viewportChild
+	size     f32.Point                // screen size in dp
+	pointers map[pointer.ID]f32.Point // pressed pointers in screen dp
+}
+
+func newViewport() *Viewport {
+	return &Viewport{Zoom: 1, MinZoom: 0.1, MaxZoom: 10, pointers: map[pointer.ID]f32.Point{}}
+}
+
+func (v *Viewport) ToWorld(p f32.Point) f32.Point  { return p.Sub(v.Pan).Div(v.Zoom) }
+func (v *Viewport) ToScreen(p f32.Point) f32.Point { return p.Mul(v.Zoom).Add(v.Pan) }
+
+// zoomAt sets the zoom keeping the world point under the screen point p in
+// place.
+func (v *Viewport) zoomAt(p f32.Point, zoom float32) {
+	w := v.ToWorld(p)
+	v.Zoom = max(v.MinZoom, min(v.MaxZoom, zoom))
+	v.Pan = p.Sub(w.Mul(v.Zoom))
+}
+
+func (v *Viewport) update(gtx layout.Context) {
+	scale := gtx.Metric.PxPerDp
+	for {
+		e, ok := gtx.Event(pointer.Filter{
+			Target:  v,
+			Kinds:   pointer.Press | pointer.Drag | pointer.Release | pointer.Cancel | pointer.Scroll,
+			ScrollY: pointer.ScrollRange{Min: math.MinInt32, Max: math.MaxInt32},
+		})
+		if !ok {
+			break
+		}
+		pe, ok := e.(pointer.Event)
+		if !ok {
+			continue
+		}
+		pos := pe.Position.Div(scale)
+		switch pe.Kind {
+		case pointer.Scroll:
+			v.zoomAt(pos, v.Zoom*float32(math.Pow(1.002, float64(-pe.Scroll.Y))))
+		case pointer.Press:
+			v.pointers[pe.PointerID] = pos
+		case pointer.Drag:
+			old, ok := v.pointers[pe.PointerID]
+			if !ok {
+				break
+			}
+			// Grab only once dragging, so presses still reach children.
+			gtx.Execute(pointer.GrabCmd{Tag: v, ID: pe.PointerID})
+			v.pointers[pe.PointerID] = pos
+			if len(v.pointers) != 2 {
+				v.Pan = v.Pan.Add(pos.Sub(old))
+				break
+			}
+			// Pinch: zoom by the change of distance between the two
+			// pointers around their midpoint, and pan with the midpoint.
+			var other f32.Point
+			for id, p := range v.pointers {
+				if id != pe.PointerID {
+					other = p
+				}
+			}
+			d0, d1 := dist(old, other), dist(pos, other)
+			mid0, mid1 := old.Add(other).Div(2), pos.Add(other).Div(2)
+			v.Pan = v.Pan.Add(mid1.Sub(mid0))
+			if d0 > 0 {
+				v.zoomAt(mid1, v.Zoom*d1/d0)
+			}
+		case pointer.Release, pointer.Cancel:
+			delete(v.pointers, pe.PointerID)
+		}
+	}
+}
+
+func dist(a, b f32.Point) float32 {
+	d := a.Sub(b)
+	return float32(math.Hypot(float64(d.X), float64(d.Y)))
+}
+
+func (v *Viewport) Layout(gtx layout.Context) layout.Dimensions {
+	v.update(gtx)
+	size := gtx.Constraints.Max
+	scale := gtx.Metric.PxPerDp
+	v.size = f32.Pt(float32(size.X), float32(size.Y)).Div(scale)
+
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, v)
+	tr := f32.Affine2D{}.Scale(f32.Point{}, f32.Pt(v.Zoom, v.Zoom)).Offset(v.Pan.Mul(scale))
+	defer op.Affine(tr).Push(gtx.Ops).Pop()
+
+	if v.Content != nil {
+		cgtx := gtx
+		cgtx.Constraints = layout.Constraints{Max: image.Pt(math.MaxInt32/2, math.MaxInt32/2)}
+		v.Content(cgtx)
+	}
+	// Only children intersecting the visible world rectangle are laid out.
+	vis := bbox{Min: v.ToWorld(f32.Point{}), Max: v.ToWorld(v.size)}
+	for _, c := range v.children {
+		b := c.bounds
+		if b.Max.X < vis.Min.X || b.Min.X > vis.Max.X || b.Max.Y < vis.Min.Y || b.Min.Y > vis.Max.Y {
+			continue
+		}
+		off := image.Pt(int(b.Min.X*scale+.5), int(b.Min.Y*scale+.5))
+		st := op.Offset(off).Push(gtx.Ops)
+		cgtx := gtx
+		cgtx.Constraints = layout.Exact(image.Pt(int(b.Dx()*scale+.5), int(b.Dy()*scale+.5)))
+		c.widget(cgtx)
+		st.Pop()
+	}
+	return layout.Dimensions{Size: size}
+}
+
+// pointObj returns a block of two decimals.
+func pointObj(p f32.Point) env.Object {
+	return *env.NewBlock(*env.NewTSeries([]env.Object{*env.NewDecimal(float64(p.X)), *env.NewDecimal(float64(p.Y))}))
+}
+
+// rectArg accepts a block of x y w h numbers.
+func rectArg(ps *env.ProgramState, name string, n int, arg env.Object) (bbox, *env.Error) {
+	blk, ok := arg.(env.Block)
+	if !ok || len(blk.Series.S) != 4 {
+		return bbox{}, argError(ps, name, n, "block of x y w h", arg)
+	}
+	var v [4]float32
+	for i, o := range blk.Series.S {
+		d, err := decimalArg(ps, name, n, o)
+		if err != nil {
+			return bbox{}, err
+		}
+		v[i] = float32(d)
+	}
+	return bbox{Min: f32.Pt(v[0], v[1]), Max: f32.Pt(v[0]+v[2], v[1]+v[3])}, nil
+}
+
+var builtinsViewport = map[string]*env.Builtin{
+	"viewport": {
+		Doc:   "Create a pan and zoom viewport",
+		Argsn: 0,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			return *env.NewNative(ps.Idx, newViewport(), "Go(*gioui_org.Viewport)")
+		},
+	},
+	"Go(*gioui_org.Viewport)//layout": layoutBuiltin[*Viewport]("Go(*gioui_org.Viewport)//layout"),
+	"Go(*gioui_org.Viewport)//content!": {
+		Doc:   "Set a widget drawn in world coordinates without culling, e.g. a scene",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//content!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "Go(*gioui_org.Viewport)//content!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			v.Content = w
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Viewport)//child!": {
+		Doc:   "Place a widget at a world rectangle given as a block of x y w h; it's skipped while off-screen",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//child!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			b, err := rectArg(ps, "Go(*gioui_org.Viewport)//child!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			w, err := widgetArg(ps, "Go(*gioui_org.Viewport)//child!", 3, arg2)
+			if err != nil {
+				return err
+			}
+			v.children = append(v.children, viewportChild{bounds: b, widget: w})
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Viewport)//clear-children": {
+		Doc:   "Remove all children",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//clear-children", 1, arg0)
+			if err != nil {
+				return err
+			}
+			v.children = nil
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Viewport)//zoom-range!": {
+		Doc:   "Set the minimum and maximum zoom",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//zoom-range!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			lo, hi, err := pointArgs(ps, "Go(*gioui_org.Viewport)//zoom-range!", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			if lo <= 0 || hi < lo {
+				return failure(ps, "Go(*gioui_org.Viewport)//zoom-range!", "expected 0 < min <= max")
+			}
+			v.MinZoom, v.MaxZoom = lo, hi
+			v.zoomAt(v.size.Div(2), v.Zoom)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Viewport)//zoom?": {
+		Doc:   "Get the zoom factor",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//zoom?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewDecimal(float64(v.Zoom))
+		},
+	},
+	"Go(*gioui_org.Viewport)//zoom!": {
+		Doc:   "Set the zoom factor around the center of the viewport",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//zoom!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			z, err := decimalArg(ps, "Go(*gioui_org.Viewport)//zoom!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			v.zoomAt(v.size.Div(2), float32(z))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Viewport)//pan?": {
+		Doc:   "Get the screen position of the world origin as a block of x y",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//pan?", 1, arg0)
+			if err != nil {
+				return err
+			}
+			return pointObj(v.Pan)
+		},
+	},
+	"Go(*gioui_org.Viewport)//pan!": {
+		Doc:   "Set the screen position of the world origin",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//pan!", 1, arg0)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "Go(*gioui_org.Viewport)//pan!", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			v.Pan = f32.Pt(x, y)
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Viewport)//to-world": {
+		Doc:   "Convert a screen point x y to world coordinates",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//to-world", 1, arg0)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "Go(*gioui_org.Viewport)//to-world", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			return pointObj(v.ToWorld(f32.Pt(x, y)))
+		},
+	},
+	"Go(*gioui_org.Viewport)//to-screen": {
+		Doc:   "Convert a world point x y to screen coordinates",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			v, err := nativeArg[*Viewport](ps, "Go(*gioui_org.Viewport)//to-screen", 1, arg0)
+			if err != nil {
+				return err
+			}
+			x, y, err := pointArgs(ps, "Go(*gioui_org.Viewport)//to-screen", 2, arg1, arg2)
+			if err != nil {
+				return err
+			}
+			return pointObj(v.ToScreen(f32.Pt(x, y)))
+		},
+	},
+}
@@ -0,0 +1,332 @@
+// Stepper/wizard layout component.
+
+//go:build !b_no_gioui
+
+package gioui_org
+
+import (
+	"image"
+	"strconv"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/refaktor/rye/env"
+	"github.com/refaktor/rye/util"
+)
+
+type wizardStep struct {
+	title    string
+	content  layout.Widget
+	validate *env.Function
+}
+
+// Wizard is a multi-step container with a step indicator and back/next
+// navigation. Each step can have a validation function that must return a
+// truthy value before the wizard advances.
+type Wizard struct {
+	ps         *env.ProgramState
+	theme      *material.Theme
+	steps      []wizardStep
+	current    int
+	done       bool
+	back, next widget.Clickable
+	onComplete *env.Function
+	onChange   *env.Function
+}
+
+// Next validates the current step and advances, calling the completion
+// callback after the last step.
+func (w *Wizard) Next() {
+	if w.done || len(w.steps) == 0 {
+		return
+	}
+	if fn := w.steps[w.current].validate; fn != nil {
+		res := callFunction(w.ps, "wizard validate", *fn, *env.NewInteger(int64(w.current)))
+		if !util.IsTruthy(res) {
+			return
+		}
+	}
+	if w.current == len(w.steps)-1 {
+		w.done = true
+		if w.onComplete != nil {
+			callFunction(w.ps, "wizard on-complete", *w.onComplete)
+		}
+		return
+	}
+	w.setStep(w.current + 1)
+}
+
+func (w *Wizard) Back() {
+	if w.current > 0 {
+		w.done = false
+		w.setStep(w.current - 1)
+	}
+}
+
+func (w *Wizard) setStep(i int) {
+	if i == w.current {
+		return
+	}
+	w.current = i
+	if w.onChange != nil {
+		callFunction(w.ps, "wizard on-change", *w.onChange, *env.NewInteger(int64(i)))
+	}
+}
+
+func (w *Wizard) Layout(gtx layout.Context) layout.Dimensions {
+	for w.back.Clicked(gtx) {
+		w.Back()
+	}
+	for w.next.Clicked(gtx) {
+		w.Next()
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(w.layoutIndicator),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			if len(w.steps) == 0 {
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			}
+			return layout.UniformInset(unit.Dp(8)).Layout(gtx, w.steps[w.current].content)
+		}),
+		layout.Rigid(w.layoutNavigation),
+	)
+}
+
+func (w *Wizard) layoutIndicator(gtx layout.Context) layout.Dimensions {
+	children := make([]layout.FlexChild, 0, 2*len(w.steps))
+	for i := range w.steps {
+		if i > 0 {
+			done := i <= w.current
+			children = append(children, layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				c := w.theme.Palette.Fg
+				if done {
+					c = w.theme.Palette.ContrastBg
+				}
+				size := image.Pt(gtx.Constraints.Max.X, gtx.Dp(2))
+				paint.FillShape(gtx.Ops, mulAlpha(c, 0x88), clip.Rect{Max: size}.Op())
+				return layout.Dimensions{Size: size}
+			}))
+		}
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return w.layoutStep(gtx, i)
+			})
+		}))
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
+
+func (w *Wizard) layoutStep(gtx layout.Context, i int) layout.Dimensions {
+	th := w.theme
+	bg, fg := mulAlpha(th.Palette.Fg, 0x44), th.Palette.Fg
+	if i <= w.current {
+		bg, fg = th.Palette.ContrastBg, th.Palette.ContrastFg
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			d := gtx.Dp(24)
+			gtx.Constraints = layout.Exact(image.Pt(d, d))
+			paint.FillShape(gtx.Ops, bg, clip.Ellipse{Max: image.Pt(d, d)}.Op(gtx.Ops))
+			return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				lbl := material.Label(th, th.TextSize*0.8, strconv.Itoa(i+1))
+				lbl.Color = fg
+				return lbl.Layout(gtx)
+			})
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			lbl := material.Body2(th, w.steps[i].title)
+			if i == w.current {
+				lbl.Font.Weight = 600
+			}
+			return lbl.Layout(gtx)
+		}),
+	)
+}
+
+func (w *Wizard) layoutNavigation(gtx layout.Context) layout.Dimensions {
+	nextText := "Next"
+	if w.current == len(w.steps)-1 {
+		nextText = "Finish"
+	}
+	return layout.Flex{Spacing: layout.SpaceStart}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if w.current == 0 {
+				gtx = gtx.Disabled()
+			}
+			return material.Button(w.theme, &w.back, "Back").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			btn := material.Button(w.theme, &w.next, nextText)
+			btn.Font.Weight = 600
+			return btn.Layout(gtx)
+		}),
+	)
+}
+
+// wizardArg is a helper for the Go(*gioui_org.Wizard) methods.
+func wizardArg(ps *env.ProgramState, name string, arg env.Object) (*Wizard, *env.Error) {
+	return nativeArg[*Wizard](ps, name, 1, arg)
+}
+
+var builtinsWizard = map[string]*env.Builtin{
+	"wizard": {
+		Doc:   "Create a wizard from a block of alternating step titles and step widgets",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			th, err := nativeArg[*material.Theme](ps, "wizard", 1, arg0)
+			if err != nil {
+				return err
+			}
+			blk, ok := arg1.(env.Block)
+			if !ok {
+				return argError(ps, "wizard", 2, "block", arg1)
+			}
+			items := blk.Series.S
+			if len(items)%2 != 0 {
+				return failure(ps, "wizard", "arg 2: expected pairs of title and widget")
+			}
+			w := &Wizard{ps: ps, theme: th}
+			for i := 0; i < len(items); i += 2 {
+				title, err := stringArg(ps, "wizard", 2, items[i])
+				if err != nil {
+					return err
+				}
+				content, err := widgetArg(ps, "wizard", 2, items[i+1])
+				if err != nil {
+					return err
+				}
+				w.steps = append(w.steps, wizardStep{title: title, content: content})
+			}
+			return *env.NewNative(ps.Idx, w, "Go(*gioui_org.Wizard)")
+		},
+	},
+	"Go(*gioui_org.Wizard)//layout": layoutBuiltin[*Wizard]("Go(*gioui_org.Wizard)//layout"),
+	"Go(*gioui_org.Wizard)//validate!": {
+		Doc:   "Set validation function for a step (0-based); it gets the step index and must return true to advance",
+		Argsn: 3,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//validate!", arg0)
+			if err != nil {
+				return err
+			}
+			i, err := integerArg(ps, "Go(*gioui_org.Wizard)//validate!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if i < 0 || int(i) >= len(w.steps) {
+				return failure(ps, "Go(*gioui_org.Wizard)//validate!", "arg 2: step index out of range")
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Wizard)//validate!", 3, 1, arg2)
+			if err != nil {
+				return err
+			}
+			w.steps[i].validate = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Wizard)//on-complete!": {
+		Doc:   "Set function called when the last step is finished",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//on-complete!", arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Wizard)//on-complete!", 2, 0, arg1)
+			if err != nil {
+				return err
+			}
+			w.onComplete = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Wizard)//on-change!": {
+		Doc:   "Set function called with the new step index whenever the step changes",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//on-change!", arg0)
+			if err != nil {
+				return err
+			}
+			fn, err := functionArg(ps, "Go(*gioui_org.Wizard)//on-change!", 2, 1, arg1)
+			if err != nil {
+				return err
+			}
+			w.onChange = &fn
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Wizard)//step?": {
+		Doc:   "Get current step index (0-based)",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//step?", arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(int64(w.current))
+		},
+	},
+	"Go(*gioui_org.Wizard)//step!": {
+		Doc:   "Jump to a step (0-based) without validation",
+		Argsn: 2,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//step!", arg0)
+			if err != nil {
+				return err
+			}
+			i, err := integerArg(ps, "Go(*gioui_org.Wizard)//step!", 2, arg1)
+			if err != nil {
+				return err
+			}
+			if i < 0 || int(i) >= len(w.steps) {
+				return failure(ps, "Go(*gioui_org.Wizard)//step!", "arg 2: step index out of range")
+			}
+			w.done = false
+			w.setStep(int(i))
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Wizard)//next": {
+		Doc:   "Validate the current step and advance",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//next", arg0)
+			if err != nil {
+				return err
+			}
+			w.Next()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Wizard)//back": {
+		Doc:   "Go to the previous step",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//back", arg0)
+			if err != nil {
+				return err
+			}
+			w.Back()
+			return arg0
+		},
+	},
+	"Go(*gioui_org.Wizard)//done?": {
+		Doc:   "Check whether the wizard was completed",
+		Argsn: 1,
+		Fn: func(ps *env.ProgramState, arg0, arg1, arg2, arg3, arg4 env.Object) env.Object {
+			w, err := wizardArg(ps, "Go(*gioui_org.Wizard)//done?", arg0)
+			if err != nil {
+				return err
+			}
+			return *env.NewInteger(boolToInt64(w.done))
+		},
+	},
+}